@@ -2,11 +2,11 @@ package main
 
 import (
 	"flag"
-	"io"
 	"io/ioutil"
 	"os"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/cloudscheduler"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 	"gopkg.in/yaml.v2"
 )
@@ -25,6 +25,7 @@ func main() {
 	var configPath string
 	config.Version = Version
 	flag.BoolVar(&config.Debug, "debug", false, "flag to debug")
+	flag.StringVar(&config.LogFormat, "log-format", getenv("LOG_FORMAT", "text"), "format of log messages: text or json")
 	flag.StringVar(&configPath, "config", "", "path to config file")
 	flag.StringVar(&config.Name, "name", "cloudscheduler-sage", "name of cloud scheduler")
 	flag.StringVar(&config.ECRURL, "ecr-url", "https://ecr.sagecontinuum.org", "path to ECR URL")
@@ -42,6 +43,23 @@ func main() {
 	flag.StringVar(&config.AuthServerURL, "auth-server-url", getenv("AUTH_URL", ""), "Authentication server URL")
 	flag.StringVar(&config.AuthToken, "auth-token", getenv("AUTH_TOKEN", ""), "TOKEN to query to authentication server")
 	flag.IntVar(&config.JobReevaluationIntervalSecond, "job-reevaluation-interval-second", 300, "Interval in seconds to re-evaluate jobs to reflect changes from outside the scheduler. Setting it below zero disables this feature.")
+	flag.StringVar(&config.DataAPIURL, "data-api-url", getenv("DATA_API_URL", "https://data.sagecontinuum.org"), "Waggle data API URL to evaluate success criteria of jobs on published data")
+	defaultHealthRule := datatype.DefaultJobHealthRule()
+	flag.IntVar(&config.JobHealthRule.ConsecutiveFailures, "job-health-consecutive-failures", defaultHealthRule.ConsecutiveFailures, "Number of failures in a row for a plugin to be failing on a node")
+	flag.Float64Var(&config.JobHealthRule.DegradedRatio, "job-health-degraded-ratio", defaultHealthRule.DegradedRatio, "Job is degraded when the ratio of failing plugins on nodes is greater than this")
+	flag.Float64Var(&config.JobHealthRule.FailedRatio, "job-health-failed-ratio", defaultHealthRule.FailedRatio, "Job is failed when the ratio of failing plugins on nodes reaches this")
+	flag.StringVar(&config.SMTP.Host, "smtp-host", getenv("SMTP_HOST", ""), "SMTP server to send email notifications of jobs. No email is sent if empty")
+	flag.IntVar(&config.SMTP.Port, "smtp-port", 587, "SMTP server port")
+	flag.StringVar(&config.SMTP.Username, "smtp-username", getenv("SMTP_USERNAME", ""), "SMTP username")
+	flag.StringVar(&config.SMTP.Password, "smtp-password", getenv("SMTP_PASSWORD", ""), "SMTP password")
+	flag.StringVar(&config.SMTP.From, "smtp-from", getenv("SMTP_FROM", ""), "Sender address of email notifications")
+	flag.IntVar(&config.SMTP.MaxEmailsPerHour, "smtp-max-emails-per-hour", 20, "Maximum number of emails sent to a user in an hour. 0 means no limit")
+	flag.StringVar(&config.SMTP.UnsubscribeSecret, "smtp-unsubscribe-secret", getenv("SMTP_UNSUBSCRIBE_SECRET", ""), "Secret to sign unsubscribe links in emails")
+	flag.StringVar(&config.PublicURL, "public-url", getenv("PUBLIC_URL", ""), "URL users reach the API server at, used for links in emails")
+	flag.Func("webhook-allowed-network", "CIDR of a private network webhooks can post to, e.g. 10.0.0.0/8. Can be repeated", func(s string) error {
+		config.WebhookAllowedNetworks = append(config.WebhookAllowedNetworks, s)
+		return nil
+	})
 	flag.Parse()
 	logger.Info.Printf("Cloud scheduler (%s) starts...", config.Name)
 	if configPath != "" {
@@ -56,14 +74,25 @@ func main() {
 		}
 	}
 	if !config.Debug {
-		logger.Debug.SetOutput(io.Discard)
+		logger.SetLevel(logger.LevelInfo)
+	}
+	logFormat, err := logger.ParseFormat(config.LogFormat)
+	if err != nil {
+		panic(err)
+	}
+	logger.SetFormat(logFormat)
+	if err := config.Quota.Validate(); err != nil {
+		panic(err)
+	}
+	if _, err := cloudscheduler.ParseWebhookAllowedNetworks(config.WebhookAllowedNetworks); err != nil {
+		panic(err)
 	}
 	cs := cloudscheduler.NewCloudSchedulerBuilder(&config).
 		AddGoalManager().
 		AddAPIServer().
 		Build()
 
-	err := cs.Configure()
+	err = cs.Configure()
 	if err != nil {
 		panic(err)
 	}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 	"github.com/waggle-sensor/edge-scheduler/pkg/nodescheduler"
@@ -27,8 +29,15 @@ func main() {
 	var configPath string
 	config.Version = Version
 	flag.BoolVar(&config.Debug, "debug", false, "flag to debug")
+	flag.StringVar(&config.LogFormat, "log-format", getenv("LOG_FORMAT", "text"), "Format of log messages: text or json")
 	flag.StringVar(&configPath, "config", "", "Path to config file")
-	flag.BoolVar(&config.Simulate, "simulate", false, "Simulate the scheduler")
+	flag.BoolVar(&config.Simulate, "simulate", false, "Simulate the scheduler with plugins running in a fake Kubernetes cluster")
+	simulation := nodescheduler.DefaultSimulatorConfig()
+	flag.DurationVar(&config.Simulation.ScheduleDelay, "simulate-schedule-delay", simulation.ScheduleDelay, "Time for a simulated Pod to be assigned to a node")
+	flag.DurationVar(&config.Simulation.InitDelay, "simulate-init-delay", simulation.InitDelay, "Time for containers of a simulated Pod to start")
+	flag.DurationVar(&config.Simulation.RunDuration, "simulate-run-duration", simulation.RunDuration, "Time a simulated plugin runs before it exits")
+	flag.Float64Var(&config.Simulation.FailureRate, "simulate-failure-rate", simulation.FailureRate, "Probability of a simulated plugin failing, between 0 and 1")
+	flag.StringVar(&config.Simulation.GoalsPath, "simulate-goals", "", "Path to a JSON file of science goals given to the simulated scheduler at start")
 	flag.StringVar(&config.Name, "nodename", getenv("WAGGLE_NODE_VSN", "W000"), "node name (VSN)")
 	if home := homedir.HomeDir(); home != "" {
 		flag.StringVar(&config.Kubeconfig, "kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
@@ -40,10 +49,20 @@ func main() {
 	flag.StringVar(&config.RabbitmqURI, "rabbitmq-uri", getenv("RABBITMQ_URI", "wes-rabbitmq:5672"), "RabbitMQ management uri")
 	flag.StringVar(&config.RabbitmqUsername, "rabbitmq-username", getenv("RABBITMQ_USERNAME", "service"), "RabbitMQ management username")
 	flag.StringVar(&config.RabbitmqPassword, "rabbitmq-password", getenv("RABBITMQ_PASSWORD", "service"), "RabbitMQ management password")
+	flag.StringVar(&config.RabbitmqManagementURI, "rabbitmq-management-uri", getenv("RABBITMQ_MANAGEMENT_URI", ""), "RabbitMQ management API URI to create a credential per plugin. Plugins share a credential if empty")
+	flag.StringVar(&config.RabbitmqManagementUsername, "rabbitmq-management-username", getenv("RABBITMQ_MANAGEMENT_USERNAME", ""), "RabbitMQ management API username. RabbitMQ username is used if empty")
+	flag.StringVar(&config.RabbitmqManagementPassword, "rabbitmq-management-password", getenv("RABBITMQ_MANAGEMENT_PASSWORD", ""), "RabbitMQ management API password")
 	flag.StringVar(&config.GoalStreamURL, "goalstream-url", "", "URL to receive goal stream")
 	flag.StringVar(&config.RuleCheckerURI, "rulechecker-uri", "http://wes-sciencerule-checker:5000", "rulechecker URI")
 	flag.StringVar(&config.ScoreboardURI, "scoreboard-uri", "wes-scoreboard:6379", "scoreboard URI")
 	flag.StringVar(&config.SchedulingPolicy, "policy", "default", "Name of the scheduling policy")
+	flag.StringVar(&config.NodeManifestPath, "node-manifest", "", "Path to the node manifest file to learn hardware of the node")
+	flag.IntVar(&config.ExecutionHistorySize, "execution-history-size", 1000, "Number of plugin executions kept in the history")
+	flag.IntVar(&config.ExecutionDigestInterval, "execution-digest-interval", 3600, "Seconds between digests of plugin executions sent to beehive. Do not send if 0")
+	flag.StringVar(&config.OutboxPath, "outbox-path", getenv("OUTBOX_PATH", ""), "Directory to keep scheduler events until RabbitMQ confirms them. Events are kept in memory if empty")
+	flag.IntVar(&config.OutboxSize, "outbox-size", 10000, "Maximum number of events kept in the outbox")
+	flag.StringVar(&config.OutboxDropPolicy, "outbox-drop-policy", "lowest-priority", "Events dropped when the outbox is full: lowest-priority, oldest, or newest")
+	flag.IntVar(&config.ShutdownTimeout, "shutdown-timeout", 0, "Seconds to wait for running plugins to finish on shutdown. Do not wait if 0")
 	flag.Parse()
 	if configPath != "" {
 		logger.Info.Printf("Config file (%s) provided. Loading configs...", configPath)
@@ -57,8 +76,14 @@ func main() {
 		}
 	}
 	if !config.Debug {
-		logger.Debug.SetOutput(io.Discard)
+		logger.SetLevel(logger.LevelInfo)
 	}
+	logFormat, err := logger.ParseFormat(config.LogFormat)
+	if err != nil {
+		panic(err)
+	}
+	logger.SetFormat(logFormat)
+	logger.SetFields(logger.FieldNode, config.Name)
 	logger.Info.Printf("Node scheduler (%q) starts...", config.Name)
 	logger.Debug.Print("Creating node scheduler...")
 	appID := getenv("WAGGLE_APP_ID", "")
@@ -70,9 +95,11 @@ func main() {
 		AddLoggerToBeehive(appID).
 		AddConnToScoreboard().
 		Build()
-	err := ns.Configure()
+	err = ns.Configure()
 	if err != nil {
 		panic(err)
 	}
-	ns.Run()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	ns.Run(ctx)
 }
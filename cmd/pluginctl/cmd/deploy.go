@@ -21,6 +21,7 @@ func init() {
 	flags.StringSliceVarP(&deployment.EnvVarString, "env", "e", []string{}, "Set environment variables")
 	flags.StringVarP(&deployment.EnvFromFile, "env-from", "", "", "Set environment variables from file")
 	flags.BoolVar(&deployment.DevelopMode, "develop", false, "Enable the following development time features: access to wan network")
+	flags.StringSliceVar(&deployment.AllowEgress, "allow-egress", []string{}, "Allow the plugin to reach given CIDRs, IP addresses, or hostnames in addition to WES services")
 	flags.StringVar(&deployment.Type, "type", "pod", "Type of the plugin. It is one of ['pod', 'job', 'deployment', 'daemonset]. Default is 'pod'.")
 	flags.StringVar(&deployment.ResourceString, "resource", "", "Specify resource requirement for running the plugin as a comma-separated list without spaces. For example, resource.cpu=1,limit.cpu=2.")
 	// NOTE: Volume may hold a security problem
@@ -40,9 +41,9 @@ var cmdDeploy = &cobra.Command{
 		deployment.PluginArgs = args[1:]
 
 		logger.Debug.Printf("kubeconfig: %s", kubeconfig)
-		logger.Debug.Printf("deployment: %#v", deployment)
+		logger.With(logger.FieldPlugin, deployment.Name).Debugf("deployment: %#v", deployment)
 
-		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig)
+		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig, configPath)
 		if err != nil {
 			return err
 		}
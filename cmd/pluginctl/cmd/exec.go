@@ -25,7 +25,7 @@ var cmdExec = &cobra.Command{
 	Args:                  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		logger.Debug.Printf("kubeconfig: %s", kubeconfig)
-		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig)
+		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig, configPath)
 		if err != nil {
 			return
 		}
@@ -51,7 +51,7 @@ var cmdExec = &cobra.Command{
 		})
 		// k.SetArgs([]string{"exec", "-n", "default", "-it", "node-influxdb-77bb74f689-nr5zm", "--", "/bin/date"})
 		return k.Execute()
-		// pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig)
+		// pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig, configPath)
 		// if err != nil {
 		// 	return
 		// }
@@ -23,7 +23,7 @@ var cmdLog = &cobra.Command{
 	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		logger.Debug.Printf("kubeconfig: %s", kubeconfig)
-		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig)
+		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig, configPath)
 		if err != nil {
 			return
 		}
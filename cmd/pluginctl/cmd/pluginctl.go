@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 
@@ -19,7 +18,9 @@ const (
 var (
 	Version    = "0.0.0"
 	debug      bool
+	logFormat  string
 	kubeconfig string
+	configPath string
 	followLog  bool
 	stdin      bool
 	tty        bool
@@ -49,15 +50,24 @@ func init() {
 	// To prevent printing the usage when commands end with an error
 	rootCmd.SilenceUsage = true
 	rootCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", getenv("KUBECONFIG", detectDefaultKubeconfig()), "path to the kubeconfig file")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", getenv("PLUGINCTL_CONFIG", ""), "path to the pluginctl config file overriding WES services given to plugins")
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "flag to debug")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", getenv("LOG_FORMAT", "text"), "format of log messages: text or json")
 }
 
 var rootCmd = &cobra.Command{
 	Use: "pluginctl [FLAGS] [COMMANDS]",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		if !debug {
-			logger.Debug.SetOutput(io.Discard)
+			logger.SetLevel(logger.LevelInfo)
 		}
+		f, err := logger.ParseFormat(logFormat)
+		if err != nil {
+			return err
+		}
+		logger.SetFormat(f)
+		logger.SetFields(logger.FieldNode, getenv("WAGGLE_NODE_VSN", ""))
+		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Printf("SAGE plugin control for running plugins: %s\n", Version)
@@ -33,6 +33,7 @@ func init() {
 	flags.StringSliceVarP(&deployment.EnvVarString, "env", "e", []string{}, "Set environment variables")
 	flags.StringVarP(&deployment.EnvFromFile, "env-from", "", "", "Set environment variables from file")
 	flags.BoolVar(&deployment.DevelopMode, "develop", false, "Enable the following development time features: access to wan network")
+	flags.StringSliceVar(&deployment.AllowEgress, "allow-egress", []string{}, "Allow the plugin to reach given CIDRs, IP addresses, or hostnames in addition to WES services")
 	flags.StringVar(&deployment.ResourceString, "resource", "", "Specify resource requirement for running the plugin")
 	flags.StringVar(&metricsServerConfig.InfluxDBTokenPath, "influxdb-token-path", getenv("INFLUXDB_TOKEN_PATH", "~/.influxdb2/token"), "Path to valid token to access InfluxDB")
 	cmdProfile.AddCommand(cmdProfileRun)
@@ -55,8 +56,8 @@ var cmdProfileRun = &cobra.Command{
 		deployment.PluginImage = args[0]
 		deployment.PluginArgs = args[1:]
 		logger.Debug.Printf("kubeconfig: %s", kubeconfig)
-		logger.Debug.Printf("deployment: %#v", deployment)
-		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig)
+		logger.With(logger.FieldPlugin, deployment.Name).Debugf("deployment: %#v", deployment)
+		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig, configPath)
 		if err != nil {
 			return err
 		}
@@ -158,7 +159,7 @@ var cmdProfileGet = &cobra.Command{
 			pluginName = args[0]
 		}
 		logger.Debug.Printf("kubeconfig: %s", kubeconfig)
-		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig)
+		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig, configPath)
 		if err != nil {
 			return err
 		}
@@ -17,7 +17,7 @@ var cmdPs = &cobra.Command{
 	Use:   "ps [APP_NAME]",
 	Short: "Query plugin list",
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
-		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig)
+		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig, configPath)
 		if err != nil {
 			return
 		}
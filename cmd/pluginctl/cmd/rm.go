@@ -22,7 +22,7 @@ var cmdRm = &cobra.Command{
 		logger.Debug.Printf("kubeconfig: %s", kubeconfig)
 		name := args[0]
 		logger.Debug.Printf("args: %v", args)
-		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig)
+		pluginCtl, err := pluginctl.NewPluginCtl(kubeconfig, configPath)
 		if err != nil {
 			return
 		}
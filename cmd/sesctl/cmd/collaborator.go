@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/cloudscheduler"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// requestAndPrint sends the request to the path and prints the response
+func requestAndPrint(r *JobRequest, subPath string, q url.Values) error {
+	resp, err := r.handler.RequestGet(path.Join(cloudscheduler.API_V1_VERSION, subPath), q, r.Headers)
+	if err != nil {
+		return err
+	}
+	decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+	if err != nil {
+		return err
+	}
+	fmt.Println(printSingleJsonFromDecoder(decoder))
+	return nil
+}
+
+// printRoles prints users and their roles sorted by user names
+func printRoles(header string, roles map[string]datatype.JobRole) error {
+	var users []string
+	for u := range roles {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(writer, "%s\t%s\n", header, "ROLE")
+	for _, u := range users {
+		fmt.Fprintf(writer, "%s\t%s\n", u, roles[u])
+	}
+	return writer.Flush()
+}
+
+func init() {
+	cmdCollaborator := &cobra.Command{
+		Use:   "collaborator",
+		Short: "Share a job with users as viewers, editors, or owners",
+	}
+
+	cmdList := &cobra.Command{
+		Use:              "ls [FLAGS] JOB_ID",
+		Short:            "List the owner, team, and collaborators of a job",
+		TraverseChildren: true,
+		Args:             cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobRequest.JobID = args[0]
+			return jobRequest.Run(func(r *JobRequest) error {
+				q := url.Values{}
+				q.Set("override", fmt.Sprint(r.Override))
+				subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_JOB_COLLABORATORS_REGEX)
+				resp, err := r.handler.RequestGet(fmt.Sprintf(subPathString, r.JobID), q, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				var body struct {
+					User          string                      `json:"user"`
+					Team          string                      `json:"team"`
+					Collaborators map[string]datatype.JobRole `json:"collaborators"`
+				}
+				if err := decoder.Decode(&body); err != nil {
+					return err
+				}
+				fmt.Printf("Owner: %s\n", body.User)
+				if body.Team != "" {
+					fmt.Printf("Team: %s\n", body.Team)
+				}
+				return printRoles("USER", body.Collaborators)
+			})
+		},
+	}
+	cmdList.Flags().BoolVar(&jobRequest.Override, "override", false, "Attempt to override the permission")
+
+	var role string
+	cmdAdd := &cobra.Command{
+		Use:              "add [FLAGS] JOB_ID USER",
+		Short:            "Share a job with a user, or change the role of the user",
+		TraverseChildren: true,
+		Args:             cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobRequest.JobID = args[0]
+			return jobRequest.Run(func(r *JobRequest) error {
+				q := url.Values{}
+				q.Set("user", args[1])
+				q.Set("role", role)
+				q.Set("override", fmt.Sprint(r.Override))
+				return requestAndPrint(r, fmt.Sprintf(cloudscheduler.API_PATH_JOB_COLLABORATORS_ADD_REGEX, r.JobID), q)
+			})
+		},
+	}
+	cmdAdd.Flags().StringVarP(&role, "role", "r", string(datatype.JobRoleViewer), "Role of the user: viewer, editor, or owner")
+	cmdAdd.Flags().BoolVar(&jobRequest.Override, "override", false, "Attempt to override the permission")
+
+	cmdRemove := &cobra.Command{
+		Use:              "rm [FLAGS] JOB_ID USER",
+		Short:            "Stop sharing a job with a user",
+		TraverseChildren: true,
+		Args:             cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobRequest.JobID = args[0]
+			return jobRequest.Run(func(r *JobRequest) error {
+				q := url.Values{}
+				q.Set("user", args[1])
+				q.Set("override", fmt.Sprint(r.Override))
+				return requestAndPrint(r, fmt.Sprintf(cloudscheduler.API_PATH_JOB_COLLABORATORS_REMOVE_REGEX, r.JobID), q)
+			})
+		},
+	}
+	cmdRemove.Flags().BoolVar(&jobRequest.Override, "override", false, "Attempt to override the permission")
+
+	cmdCollaborator.AddCommand(cmdList, cmdAdd, cmdRemove)
+	rootCmd.AddCommand(cmdCollaborator)
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/cloudscheduler"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func init() {
+	var diff string
+	cmdHistory := &cobra.Command{
+		Use:              "history [FLAGS] JOB_ID",
+		Short:            "List revisions of a job or show changes between two revisions",
+		TraverseChildren: true,
+		Args:             cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobRequest.JobID = args[0]
+			historyFunc := func(r *JobRequest) error {
+				q := url.Values{}
+				q.Set("override", fmt.Sprint(r.Override))
+				if diff != "" {
+					from, to, found := strings.Cut(diff, ",")
+					if !found {
+						return fmt.Errorf("--diff must be two revisions separated by comma, e.g. 1,2")
+					}
+					q.Set("from", from)
+					q.Set("to", to)
+					subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_JOB_REVISIONS_DIFF_REGEX)
+					resp, err := r.handler.RequestGet(fmt.Sprintf(subPathString, r.JobID), q, r.Headers)
+					if err != nil {
+						return err
+					}
+					decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+					if err != nil {
+						return err
+					}
+					var body struct {
+						Diff string `json:"diff"`
+					}
+					if err := decoder.Decode(&body); err != nil {
+						return err
+					}
+					fmt.Print(body.Diff)
+					return nil
+				}
+				subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_JOB_REVISIONS_REGEX)
+				resp, err := r.handler.RequestGet(fmt.Sprintf(subPathString, r.JobID), q, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				var body struct {
+					Revisions []*datatype.JobRevision `json:"revisions"`
+				}
+				if err := decoder.Decode(&body); err != nil {
+					return err
+				}
+				writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", "REVISION", "ACTION", "AUTHOR", "TIME", "NOTE")
+				for _, revision := range body.Revisions {
+					note := ""
+					if revision.RolledBackTo > 0 {
+						note = "to revision " + strconv.Itoa(revision.RolledBackTo)
+					}
+					fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\n", revision.Revision, revision.Action, revision.Author, printTime(revision.Time), note)
+				}
+				return writer.Flush()
+			}
+			return jobRequest.Run(historyFunc)
+		},
+	}
+	flags := cmdHistory.Flags()
+	flags.StringVar(&diff, "diff", "", "Show changes between two revisions, e.g. 1,2")
+	flags.BoolVar(&jobRequest.Override, "override", false, "Attempt to override the permission")
+	rootCmd.AddCommand(cmdHistory)
+
+	var revision int
+	cmdRollback := &cobra.Command{
+		Use:              "rollback [FLAGS] JOB_ID",
+		Short:            "Roll back a job to a previous revision and resubmit it",
+		TraverseChildren: true,
+		Args:             cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobRequest.JobID = args[0]
+			rollbackFunc := func(r *JobRequest) error {
+				if revision < 1 {
+					return fmt.Errorf("--revision is required")
+				}
+				q := url.Values{}
+				q.Set("revision", strconv.Itoa(revision))
+				q.Set("override", fmt.Sprint(r.Override))
+				subPathString := path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_JOB_ROLLBACK_REGEX)
+				resp, err := r.handler.RequestGet(fmt.Sprintf(subPathString, r.JobID), q, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				fmt.Println(printSingleJsonFromDecoder(decoder))
+				return nil
+			}
+			return jobRequest.Run(rollbackFunc)
+		},
+	}
+	flags = cmdRollback.Flags()
+	flags.IntVarP(&revision, "revision", "r", 0, "Revision to roll back to")
+	flags.BoolVar(&jobRequest.Override, "override", false, "Attempt to override the permission")
+	rootCmd.AddCommand(cmdRollback)
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"io"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -10,8 +9,9 @@ import (
 )
 
 var (
-	Version string
-	debug   bool
+	Version   string
+	debug     bool
+	logFormat string
 )
 
 var jobRequest = &JobRequest{}
@@ -30,16 +30,20 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&jobRequest.ServerHostString, "server", getenv("SES_HOST", "http://localhost:9770"), "Path to the kubeconfig file")
 	rootCmd.PersistentFlags().StringVar(&jobRequest.UserToken, "token", "", "User token")
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "flag to debug")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", getenv("LOG_FORMAT", "text"), "format of log messages: text or json")
 }
 
 var rootCmd = &cobra.Command{
 	Use: "sesctl [FLAGS] [COMMANDS]",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		if !debug {
-			logger.Debug.SetOutput(io.Discard)
+			logger.SetLevel(logger.LevelInfo)
 		}
-	},
-	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		f, err := logger.ParseFormat(logFormat)
+		if err != nil {
+			return err
+		}
+		logger.SetFormat(f)
 		if jobRequest.UserToken == "" {
 			tokenFromEnv := getenv("SES_USER_TOKEN", "")
 			if tokenFromEnv == "" {
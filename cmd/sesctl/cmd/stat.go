@@ -67,13 +67,13 @@ func init() {
 
 					writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
 
-					fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", "JOB_ID", "NAME", "USER", "STATUS", "AGE")
+					fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", "JOB_ID", "NAME", "USER", "STATUS", "AGE", "REMAINING")
 
 					for _, job := range jobs {
 						if !showAll && (job.State.GetState() == datatype.JobRemoved || job.State.GetState() == datatype.JobComplete) {
 							continue
 						}
-						fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", job.JobID, job.Name, job.User, job.State.GetState(), getJobAgeString(job))
+						fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", job.JobID, job.Name, job.User, job.State.GetState(), getJobAgeString(job), getJobRemainingString(job))
 					}
 
 					writer.Flush()
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/cloudscheduler"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func init() {
+	cmdTeam := &cobra.Command{
+		Use:   "team",
+		Short: "Manage teams that share jobs with their members",
+	}
+
+	cmdList := &cobra.Command{
+		Use:              "ls [FLAGS]",
+		Short:            "List teams the user is a member of",
+		TraverseChildren: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return jobRequest.Run(func(r *JobRequest) error {
+				q := url.Values{}
+				q.Set("override", fmt.Sprint(r.Override))
+				resp, err := r.handler.RequestGet(path.Join(cloudscheduler.API_V1_VERSION, cloudscheduler.API_PATH_TEAMS), q, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				teams := map[string]*datatype.Team{}
+				if err := decoder.Decode(&teams); err != nil {
+					return err
+				}
+				var names []string
+				for name := range teams {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				writer := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+				fmt.Fprintf(writer, "%s\t%s\t%s\n", "NAME", "MEMBERS", "OWNERS")
+				for _, name := range names {
+					var owners []string
+					for member, role := range teams[name].Members {
+						if role == datatype.JobRoleOwner {
+							owners = append(owners, member)
+						}
+					}
+					sort.Strings(owners)
+					fmt.Fprintf(writer, "%s\t%d\t%s\n", name, len(teams[name].Members), strings.Join(owners, ","))
+				}
+				return writer.Flush()
+			})
+		},
+	}
+	cmdList.Flags().BoolVar(&jobRequest.Override, "override", false, "List all teams as a super user")
+
+	cmdShow := &cobra.Command{
+		Use:              "show [FLAGS] TEAM",
+		Short:            "Show members of a team and their roles",
+		TraverseChildren: true,
+		Args:             cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return jobRequest.Run(func(r *JobRequest) error {
+				q := url.Values{}
+				q.Set("override", fmt.Sprint(r.Override))
+				resp, err := r.handler.RequestGet(path.Join(cloudscheduler.API_V1_VERSION, fmt.Sprintf(cloudscheduler.API_PATH_TEAM_REGEX, args[0])), q, r.Headers)
+				if err != nil {
+					return err
+				}
+				decoder, err := r.handler.ParseJSONHTTPResponse(resp)
+				if err != nil {
+					return err
+				}
+				var body struct {
+					Team datatype.Team `json:"team"`
+				}
+				if err := decoder.Decode(&body); err != nil {
+					return err
+				}
+				return printRoles("MEMBER", body.Team.Members)
+			})
+		},
+	}
+	cmdShow.Flags().BoolVar(&jobRequest.Override, "override", false, "Attempt to override the permission")
+
+	cmdCreate := &cobra.Command{
+		Use:              "create TEAM",
+		Short:            "Create a team owned by the user",
+		TraverseChildren: true,
+		Args:             cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return jobRequest.Run(func(r *JobRequest) error {
+				return requestAndPrint(r, fmt.Sprintf(cloudscheduler.API_PATH_TEAM_CREATE_REGEX, args[0]), url.Values{})
+			})
+		},
+	}
+
+	cmdDelete := &cobra.Command{
+		Use:              "delete [FLAGS] TEAM",
+		Short:            "Delete a team. Jobs of the team are no longer shared with its members",
+		TraverseChildren: true,
+		Args:             cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return jobRequest.Run(func(r *JobRequest) error {
+				q := url.Values{}
+				q.Set("override", fmt.Sprint(r.Override))
+				return requestAndPrint(r, fmt.Sprintf(cloudscheduler.API_PATH_TEAM_REMOVE_REGEX, args[0]), q)
+			})
+		},
+	}
+	cmdDelete.Flags().BoolVar(&jobRequest.Override, "override", false, "Attempt to override the permission")
+
+	var role string
+	cmdAdd := &cobra.Command{
+		Use:              "add [FLAGS] TEAM USER",
+		Short:            "Add a user to a team, or change the role of the member",
+		TraverseChildren: true,
+		Args:             cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return jobRequest.Run(func(r *JobRequest) error {
+				q := url.Values{}
+				q.Set("user", args[1])
+				q.Set("role", role)
+				q.Set("override", fmt.Sprint(r.Override))
+				return requestAndPrint(r, fmt.Sprintf(cloudscheduler.API_PATH_TEAM_MEMBERS_ADD_REGEX, args[0]), q)
+			})
+		},
+	}
+	cmdAdd.Flags().StringVarP(&role, "role", "r", string(datatype.JobRoleViewer), "Role of the user: viewer, editor, or owner")
+	cmdAdd.Flags().BoolVar(&jobRequest.Override, "override", false, "Attempt to override the permission")
+
+	cmdRemove := &cobra.Command{
+		Use:              "rm [FLAGS] TEAM USER",
+		Short:            "Remove a user from a team",
+		TraverseChildren: true,
+		Args:             cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return jobRequest.Run(func(r *JobRequest) error {
+				q := url.Values{}
+				q.Set("user", args[1])
+				q.Set("override", fmt.Sprint(r.Override))
+				return requestAndPrint(r, fmt.Sprintf(cloudscheduler.API_PATH_TEAM_MEMBERS_REMOVE_REGEX, args[0]), q)
+			})
+		},
+	}
+	cmdRemove.Flags().BoolVar(&jobRequest.Override, "override", false, "Attempt to override the permission")
+
+	cmdTeam.AddCommand(cmdList, cmdShow, cmdCreate, cmdDelete, cmdAdd, cmdRemove)
+	rootCmd.AddCommand(cmdTeam)
+}
@@ -3,9 +3,13 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
 
 func printJob(j *datatype.Job) (ret string) {
@@ -23,6 +27,11 @@ Job Status: %s
 		j.State.GetState(),
 		j.State.LastUpdated.Time.UTC().String(),
 	)
+	if j.Health != "" {
+		ret += fmt.Sprintf(`  Health: %s
+`,
+			j.Health)
+	}
 	if !j.State.LastSubmitted.Time.IsZero() {
 		ret += fmt.Sprintf(`  Submitted: %s
 `,
@@ -38,6 +47,17 @@ Job Status: %s
 `,
 			j.State.LastCompleted)
 	}
+	if !j.StartTime.IsZero() || !j.GetEndTime().IsZero() {
+		ret += fmt.Sprintf(`
+Time Window
+  Start time: %s
+  End time: %s
+  Remaining: %s
+`,
+			printTime(j.StartTime),
+			printTime(datatype.Time{Time: j.GetEndTime()}),
+			getJobRemainingString(j))
+	}
 	if len(j.NotificationOn) > 0 {
 		ret += fmt.Sprintf(`
 Notification to %s
@@ -63,6 +83,40 @@ Total number of nodes %d
 		// 			)
 		// 		}
 	}
+	if nodeStatus := j.GetNodeStatus(); len(nodeStatus) > 0 {
+		ret += `
+===== NODE STATUS =====
+`
+		var nodeNames []string
+		for nodeName := range nodeStatus {
+			nodeNames = append(nodeNames, nodeName)
+		}
+		sort.Strings(nodeNames)
+		for _, nodeName := range nodeNames {
+			status := nodeStatus[nodeName]
+			ret += fmt.Sprintf("%s: goal %s, last acknowledged %s\n", nodeName, status.GoalState, printTime(status.LastAcknowledged))
+			var pluginNames []string
+			for pluginName := range status.Plugins {
+				pluginNames = append(pluginNames, pluginName)
+			}
+			sort.Strings(pluginNames)
+			for _, pluginName := range pluginNames {
+				stats := status.Plugins[pluginName]
+				lastState := stats.LastState
+				if lastState == "" {
+					lastState = "-"
+				}
+				ret += fmt.Sprintf("  %s: %s, last run %s, %d succeeded, %d failed\n", pluginName, lastState, printTime(stats.LastRun), stats.Successes, stats.Failures)
+				if n := len(stats.RecentFailures); n > 0 {
+					f := stats.RecentFailures[n-1]
+					ret += fmt.Sprintf("    Last failure at %s: %s\n", printTime(f.Time), f.Reason)
+					if f.ErrorLog != "" {
+						ret += fmt.Sprintf("    %s\n", strings.ReplaceAll(strings.TrimSpace(f.ErrorLog), "\n", "\n    "))
+					}
+				}
+			}
+		}
+	}
 	// 	ret += fmt.Sprintf(`
 	// ===== SUBMITTED JOB INPUTS =====
 	// NodeTag: %v
@@ -76,6 +130,34 @@ Total number of nodes %d
 	return ret
 }
 
+// getJobRemainingString returns the time left until the job ends
+func getJobRemainingString(job *datatype.Job) string {
+	switch job.State.GetState() {
+	case datatype.JobSubmitted, datatype.JobRunning:
+	default:
+		return "-"
+	}
+	end := job.GetEndTime()
+	if end.IsZero() {
+		return "-"
+	}
+	remaining := time.Until(end).Round(time.Second)
+	if job.IsHeld(time.Now()) {
+		return fmt.Sprintf("%s (starts in %s)", remaining, time.Until(job.StartTime.Time).Round(time.Second))
+	}
+	if remaining < 0 {
+		return "0s"
+	}
+	return remaining.String()
+}
+
+func printTime(t datatype.Time) string {
+	if t.Time.IsZero() {
+		return "-"
+	}
+	return t.Time.UTC().String()
+}
+
 func printSingleJsonFromDecoder(decoder *json.Decoder) string {
 	var blob map[string]interface{}
 	decoder.Decode(&blob)
@@ -110,5 +192,6 @@ func (r *JobRequest) Run(f func(*JobRequest) error) error {
 		"Accept":        "applications/json",
 		"Authorization": fmt.Sprintf("Sage %s", r.UserToken),
 	}
+	logger.With(logger.FieldJobID, r.JobID, "server", r.ServerHostString).Debug("sending request to the scheduler")
 	return f(r)
 }
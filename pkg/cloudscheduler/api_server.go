@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -29,8 +31,25 @@ const (
 	API_PATH_JOB_SUBMIT                        = "/submit"
 	API_PATH_JOB_LIST                          = "/jobs/list"
 	API_PATH_JOB_STATUS_REGEX                  = "/jobs/%s/status"
+	API_PATH_JOB_NODES_REGEX                   = "/jobs/%s/nodes"
 	API_PATH_JOB_REMOVE_REGEX                  = "/jobs/%s/rm"
+	API_PATH_JOB_UNSUBSCRIBE_REGEX             = "/jobs/%s/unsubscribe"
+	API_PATH_JOB_REVISIONS_REGEX               = "/jobs/%s/revisions"
+	API_PATH_JOB_REVISIONS_DIFF_REGEX          = "/jobs/%s/revisions/diff"
+	API_PATH_JOB_ROLLBACK_REGEX                = "/jobs/%s/rollback"
 	API_PATH_JOB_TEMPLATE_REGEX                = "/jobs/%s/template"
+	API_PATH_JOB_COLLABORATORS_REGEX           = "/jobs/%s/collaborators"
+	API_PATH_JOB_COLLABORATORS_ADD_REGEX       = "/jobs/%s/collaborators/add"
+	API_PATH_JOB_COLLABORATORS_REMOVE_REGEX    = "/jobs/%s/collaborators/rm"
+	API_PATH_TEAMS                             = "/teams"
+	API_PATH_TEAM_REGEX                        = "/teams/%s"
+	API_PATH_TEAM_CREATE_REGEX                 = "/teams/%s/create"
+	API_PATH_TEAM_REMOVE_REGEX                 = "/teams/%s/rm"
+	API_PATH_TEAM_MEMBERS_ADD_REGEX            = "/teams/%s/members/add"
+	API_PATH_TEAM_MEMBERS_REMOVE_REGEX         = "/teams/%s/members/rm"
+	API_PATH_WEBHOOKS                          = "/webhooks"
+	API_PATH_WEBHOOK_REMOVE_REGEX              = "/webhooks/%s/rm"
+	API_PATH_WEBHOOK_DELIVERIES_REGEX          = "/webhooks/%s/deliveries"
 	API_PATH_GOALS_NODE_REGEX                  = "/goals/%s"
 	API_PATH_GOALS_NODE_STREAM_REGEX           = "/goals/%s/stream"
 	MANAGEMENT_API_PATH_SYSTEM_METRICS         = "/system/metrics"
@@ -39,6 +58,9 @@ const (
 	MANAGEMENT_API_PATH_DATA_PLUGINS           = "/data/plugins"
 	MANAGEMENT_API_PATH_DATA_PLUGINS_WHITELIST = "/data/plugins/whitelist"
 	MANAGEMENT_API_PATH_DATA_NODES             = "/data/nodes"
+	MANAGEMENT_API_PATH_LOG_LEVEL              = "/log/level"
+	MANAGEMENT_API_PATH_QUOTAS                 = "/quotas"
+	MANAGEMENT_API_PATH_QUOTAS_USAGE           = "/quotas/usage"
 )
 
 type APIServer struct {
@@ -104,8 +126,25 @@ func (api *APIServer) ConfigureAPIs(prometheusGatherer *prometheus.Registry) {
 	api_route.Handle(API_PATH_JOB_SUBMIT, http.HandlerFunc(api.handlerSubmitJobs)).Methods(http.MethodGet, http.MethodPost)
 	api_route.Handle(API_PATH_JOB_LIST, http.HandlerFunc(api.handlerJobs)).Methods(http.MethodGet)
 	api_route.Handle(fmt.Sprintf(API_PATH_JOB_STATUS_REGEX, "{id}"), http.HandlerFunc(api.handlerJobStatus)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_JOB_NODES_REGEX, "{id}"), http.HandlerFunc(api.handlerJobNodes)).Methods(http.MethodGet)
 	api_route.Handle(fmt.Sprintf(API_PATH_JOB_REMOVE_REGEX, "{id}"), http.HandlerFunc(api.handlerJobRemove)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_JOB_UNSUBSCRIBE_REGEX, "{id}"), http.HandlerFunc(api.handlerJobUnsubscribe)).Methods(http.MethodGet, http.MethodPost)
 	api_route.Handle(fmt.Sprintf(API_PATH_JOB_TEMPLATE_REGEX, "{id}"), http.HandlerFunc(api.handlerJobTemplate)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_JOB_REVISIONS_REGEX, "{id}"), http.HandlerFunc(api.handlerJobRevisions)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_JOB_REVISIONS_DIFF_REGEX, "{id}"), http.HandlerFunc(api.handlerJobRevisionsDiff)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_JOB_ROLLBACK_REGEX, "{id}"), http.HandlerFunc(api.handlerJobRollback)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_JOB_COLLABORATORS_REGEX, "{id}"), http.HandlerFunc(api.handlerJobCollaborators)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_JOB_COLLABORATORS_ADD_REGEX, "{id}"), http.HandlerFunc(api.handlerJobCollaboratorsAdd)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_JOB_COLLABORATORS_REMOVE_REGEX, "{id}"), http.HandlerFunc(api.handlerJobCollaboratorsRemove)).Methods(http.MethodGet)
+	api_route.Handle(API_PATH_TEAMS, http.HandlerFunc(api.handlerTeams)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_TEAM_REGEX, "{name}"), http.HandlerFunc(api.handlerTeam)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_TEAM_CREATE_REGEX, "{name}"), http.HandlerFunc(api.handlerTeamCreate)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_TEAM_REMOVE_REGEX, "{name}"), http.HandlerFunc(api.handlerTeamRemove)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_TEAM_MEMBERS_ADD_REGEX, "{name}"), http.HandlerFunc(api.handlerTeamMembersAdd)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_TEAM_MEMBERS_REMOVE_REGEX, "{name}"), http.HandlerFunc(api.handlerTeamMembersRemove)).Methods(http.MethodGet)
+	api_route.Handle(API_PATH_WEBHOOKS, http.HandlerFunc(api.handlerWebhooks)).Methods(http.MethodGet, http.MethodPost)
+	api_route.Handle(fmt.Sprintf(API_PATH_WEBHOOK_REMOVE_REGEX, "{id}"), http.HandlerFunc(api.handlerWebhookRemove)).Methods(http.MethodGet)
+	api_route.Handle(fmt.Sprintf(API_PATH_WEBHOOK_DELIVERIES_REGEX, "{id}"), http.HandlerFunc(api.handlerWebhookDeliveries)).Methods(http.MethodGet)
 	// api_route.Handle("/goals", http.HandlerFunc(api.handlerGoals)).Methods(http.MethodGet, http.MethodPost, http.MethodPut)
 	api_route.Handle(fmt.Sprintf(API_PATH_GOALS_NODE_REGEX, "{nodeName}"), http.HandlerFunc(api.handlerGoalForNode)).Methods(http.MethodGet)
 	if api.enablePushNotification {
@@ -130,6 +169,12 @@ func (api *APIServer) ConfigureAPIs(prometheusGatherer *prometheus.Registry) {
 		Methods(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
 	management_route.Handle(MANAGEMENT_API_PATH_DATA_NODES, http.HandlerFunc(api.handleDataNodes)).
 		Methods(http.MethodGet, http.MethodPost, http.MethodPut)
+	management_route.Handle(MANAGEMENT_API_PATH_QUOTAS, http.HandlerFunc(api.handleQuotas)).
+		Methods(http.MethodGet, http.MethodPut)
+	management_route.Handle(MANAGEMENT_API_PATH_QUOTAS_USAGE, http.HandlerFunc(api.handleQuotasUsage)).
+		Methods(http.MethodGet)
+	management_route.Handle(MANAGEMENT_API_PATH_LOG_LEVEL, http.HandlerFunc(logger.LevelHandler)).
+		Methods(http.MethodGet, http.MethodPost, http.MethodPut)
 
 }
 
@@ -188,6 +233,11 @@ func (api *APIServer) handlerCreateJob(w http.ResponseWriter, r *http.Request) {
 				respondJSON(w, http.StatusBadRequest, response.ToJson())
 				return
 			}
+			if err := api.authorizeNewJob(user, newJob); err != nil {
+				response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+				respondJSON(w, http.StatusBadRequest, response.ToJson())
+				return
+			}
 		}
 	}
 	jobID := api.cloudScheduler.GoalManager.AddJob(newJob)
@@ -233,33 +283,39 @@ func (api *APIServer) handlerEditJob(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		updatedJob.JobID = jobID
-		if oldJob.User != user.GetUserName() {
-			logger.Info.Printf("user %q does not own the job %s", user.GetUserName(), jobID)
-			if queries.Get("override") == "true" {
-				logger.Info.Printf("user %q is attempting to override job %q owned by %s", user.GetUserName(), jobID, oldJob.User)
-				if user.Auth.IsSuperUser {
-					logger.Info.Printf("user %q is a super user. overriding permitted", user.GetUserName())
-					// keep the original user name
-					updatedJob.User = oldJob.User
-				} else {
-					response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("User %s does not have permission to override to the job", user.GetUserName())).Build()
-					respondJSON(w, http.StatusBadRequest, response.ToJson())
-					return
-				}
-			} else {
-				response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("User %s does not have access to the job", user.GetUserName())).Build()
-				respondJSON(w, http.StatusBadRequest, response.ToJson())
-				return
-			}
-		} else {
-			updatedJob.User = user.GetUserName()
+		override := queries.Get("override") == "true"
+		if err := api.authorizeJob(user, oldJob, datatype.JobRoleEditor, override); err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		if err := api.authorizeTeam(user, oldJob, updatedJob.Team, override); err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		// the job is replaced in a single transaction so that changes made to the job
+		// in the meantime, e.g. its collaborators, are not lost
+		var oldScienceGoal *datatype.ScienceGoal
+		_, err = api.cloudScheduler.GoalManager.ModifyJob(jobID, func(j *datatype.Job) bool {
+			// keep the original owner. Collaborators are managed separately
+			updatedJob.User = j.User
+			updatedJob.Collaborators = j.Collaborators
+			oldScienceGoal = j.ScienceGoal
+			updatedJob.Drafted()
+			*j = *updatedJob
+			return true
+		})
+		if err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusInternalServerError, response.ToJson())
+			return
 		}
 		// Remove science goal of old Job if exists
-		if oldJob.ScienceGoal != nil {
-			api.cloudScheduler.GoalManager.RemoveScienceGoal(oldJob.ScienceGoal.ID)
+		if oldScienceGoal != nil {
+			api.cloudScheduler.GoalManager.RemoveScienceGoal(oldScienceGoal.ID)
 		}
-		updatedJob.Drafted()
-		api.cloudScheduler.GoalManager.UpdateJob(updatedJob, false)
+		api.addJobRevision(updatedJob, user, datatype.JobRevisionEdited)
 		response := datatype.NewAPIMessageBuilder().AddEntity("job_id", jobID).AddEntity("state", datatype.JobDrafted)
 		respondJSON(w, http.StatusOK, response.Build().ToJson())
 		return
@@ -307,22 +363,10 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 				respondJSON(w, http.StatusBadRequest, response.ToJson())
 				return
 			}
-			if existingJob.User != user.GetUserName() {
-				logger.Info.Printf("user %q does not own the job %s", user.GetUserName(), jobID)
-				if queries.Get("override") == "true" {
-					logger.Info.Printf("user %q is attempting to override job %q owned by %s", user.GetUserName(), jobID, existingJob.User)
-					if user.Auth.IsSuperUser {
-						logger.Info.Printf("user %q is a super user. overriding permitted", user.GetUserName())
-					} else {
-						response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("User %s does not have permission to override to the job", user.GetUserName())).Build()
-						respondJSON(w, http.StatusBadRequest, response.ToJson())
-						return
-					}
-				} else {
-					response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("User %s does not have access to the job", user.GetUserName())).Build()
-					respondJSON(w, http.StatusBadRequest, response.ToJson())
-					return
-				}
+			if err := api.authorizeJob(user, existingJob, datatype.JobRoleEditor, queries.Get("override") == "true"); err != nil {
+				response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+				respondJSON(w, http.StatusBadRequest, response.ToJson())
+				return
 			}
 			// TODO: we should not commit to change on the existing goal of job when --dry-run is given
 			errorList := api.cloudScheduler.ValidateJobAndCreateScienceGoalForExistingJob(queries.Get("id"), user, flagDryRun)
@@ -335,6 +379,9 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 				if flagDryRun {
 					response = response.AddEntity("dryrun", true)
 				} else {
+					if submittedJob, err := api.cloudScheduler.GoalManager.GetJob(jobID); err == nil {
+						api.addJobRevision(submittedJob, user, datatype.JobRevisionSubmitted)
+					}
 					response = response.AddEntity("state", datatype.JobSubmitted)
 				}
 				respondJSON(w, http.StatusOK, response.Build().ToJson())
@@ -363,6 +410,11 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 				return
 			}
 			newJob.User = user.GetUserName()
+			if err := api.authorizeNewJob(user, newJob); err != nil {
+				response := datatype.NewAPIMessageBuilder().AddEntity("job_name", newJob.Name).AddError(err.Error()).Build()
+				respondJSON(w, http.StatusBadRequest, response.ToJson())
+				return
+			}
 			sg, errorList := api.cloudScheduler.ValidateJobAndCreateScienceGoal(newJob, user)
 			if len(errorList) > 0 {
 				response := datatype.NewAPIMessageBuilder().
@@ -380,6 +432,7 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 					jobID := api.cloudScheduler.GoalManager.AddJob(newJob)
 					newJob.UpdateJobID(jobID)
 					api.cloudScheduler.GoalManager.UpdateJob(newJob, true)
+					api.addJobRevision(newJob, user, datatype.JobRevisionSubmitted)
 					response = response.AddEntity("job_id", jobID).
 						AddEntity("state", datatype.JobSubmitted)
 				}
@@ -391,7 +444,7 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 }
 
 // handlerJobs handles getting jobs requests. It returns the full list of current jobs
-// if user token is not provided. If provided, it returns only the list owned by the token owner.
+// if user token is not provided. If provided, it returns only the list the token owner has a role on.
 func (api *APIServer) handlerJobs(w http.ResponseWriter, r *http.Request) {
 	userName := ""
 	if hasToken(r) {
@@ -407,7 +460,11 @@ func (api *APIServer) handlerJobs(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		response := datatype.NewAPIMessageBuilder()
 		var jobs []*datatype.Job
-		jobs = api.cloudScheduler.GoalManager.GetJobs(userName)
+		if userName == "" {
+			jobs = api.cloudScheduler.GoalManager.GetJobs("")
+		} else {
+			jobs = api.cloudScheduler.GoalManager.GetJobsForUser(userName)
+		}
 		for _, job := range jobs {
 			response.AddEntity(job.JobID, job)
 		}
@@ -457,6 +514,32 @@ func (api *APIServer) handlerJobStatus(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handlerJobNodes returns status of the job on each node: delivery of the science goal and
+// the latest state, runs, and failures of the plugins. Viewers of the job can see it as
+// the failures include error logs of the plugins
+func (api *APIServer) handlerJobNodes(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	job, err := api.getAccessibleJob(user, mux.Vars(r)["id"], datatype.JobRoleViewer, r.URL.Query().Get("override") == "true")
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	blob, err := httpSensitiveJsonMarshal(job.GetNodeStatus())
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	respondJSON(w, http.StatusOK, blob)
+}
+
 func (api *APIServer) handlerJobRemove(w http.ResponseWriter, r *http.Request) {
 	response := datatype.NewAPIMessageBuilder()
 	user, err := api.authenticate(r)
@@ -474,25 +557,18 @@ func (api *APIServer) handlerJobRemove(w http.ResponseWriter, r *http.Request) {
 		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
 		return
 	}
-	if job.User != user.GetUserName() {
-		logger.Info.Printf("user %q does not own the job %s", user.GetUserName(), jobID)
-		if queries.Get("override") == "true" {
-			logger.Info.Printf("user %q is attempting to override job %q owned by %s", user.GetUserName(), jobID, job.User)
-			if user.Auth.IsSuperUser {
-				logger.Info.Printf("user %q is a super user. overriding permitted", user.GetUserName())
-			} else {
-				response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("User %s does not have permission to override to the job", user.GetUserName())).Build()
-				respondJSON(w, http.StatusBadRequest, response.ToJson())
-				return
-			}
-		} else {
-			response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("user %q is not the owner of job %q", user.GetUserName(), jobID)).Build()
-			respondJSON(w, http.StatusBadRequest, response.ToJson())
-			return
-		}
-	}
 	// Suspend the job instead of removal if suspend flag is given
 	suspend := queries.Get("suspend")
+	// editors can suspend the job while only owners can remove it
+	role := datatype.JobRoleOwner
+	if suspend == "true" {
+		role = datatype.JobRoleEditor
+	}
+	if err := api.authorizeJob(user, job, role, queries.Get("override") == "true"); err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+		return
+	}
 	if suspend == "true" {
 		err := api.cloudScheduler.GoalManager.SuspendJob(jobID)
 		if err != nil {
@@ -525,144 +601,848 @@ func (api *APIServer) handlerJobRemove(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (api *APIServer) handlerJobTemplate(w http.ResponseWriter, r *http.Request) {
+// unsubscribeConfirmTemplate asks to confirm unsubscribing as mail scanners and link
+// previews follow links in emails
+var unsubscribeConfirmTemplate = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Unsubscribe from job {{.JobID}}</title></head>
+<body>
+<p>Stop emails to {{.Email}} about job {{.JobID}} ({{.Name}})?</p>
+<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Unsubscribe</button>
+</form>
+</body>
+</html>
+`))
+
+// handlerJobUnsubscribe stops email notifications of the job. It is reached from the link in
+// notification emails and authorized by the token in the link instead of a user token.
+// GET asks to confirm and POST unsubscribes, including one-click unsubscribe of mail clients
+func (api *APIServer) handlerJobUnsubscribe(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
+	response := datatype.NewAPIMessageBuilder()
+	notifier := api.cloudScheduler.emailNotifier
+	if notifier == nil {
+		response.AddError("email notification is not enabled")
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	job, err := api.cloudScheduler.GoalManager.GetJob(vars["id"])
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	// the token is in the link, or in the form of the confirmation page
+	token := r.FormValue("token")
+	if !notifier.IsUnsubscribeTokenValid(job, token) {
+		response.AddError("invalid unsubscribe link")
+		respondJSON(w, http.StatusUnauthorized, response.Build().ToJson())
+		return
+	}
 	if r.Method == http.MethodGet {
-		response := datatype.NewAPIMessageBuilder()
-		job, err := api.cloudScheduler.GoalManager.GetJob(vars["id"])
-		if err != nil {
-			response.AddError(err.Error())
-			respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
-			return
-		}
-		blob, err := httpSensitiveYamlMarshal(job.ConvertToTemplate())
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := unsubscribeConfirmTemplate.Execute(w, map[string]string{
+			"JobID": job.JobID,
+			"Name":  job.Name,
+			"Email": job.Email,
+			"Token": token,
+		})
 		if err != nil {
-			response.AddError(err.Error())
-			respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
-			return
+			job.Logger().Error("failed to respond unsubscribe confirmation", "error", err)
 		}
-		respondJSON(w, http.StatusOK, blob)
-		// respondYAML(w, http.StatusOK, job.ConvertToTemplate())
+		return
+	}
+	_, err = api.cloudScheduler.GoalManager.ModifyJob(job.JobID, func(j *datatype.Job) bool {
+		j.NotificationOn = nil
+		return true
+	})
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
 	}
+	job.Logger().Info("email notification is unsubscribed")
+	response.AddEntity("job_id", job.JobID).
+		AddEntity("message", fmt.Sprintf("%s will no longer receive emails about job %s", job.Email, job.JobID))
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
 }
 
-func (api *APIServer) handlerGoals(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
+// addJobRevision stores the job as a new revision authored by the user.
+// Failing to store the revision does not fail the request
+func (api *APIServer) addJobRevision(job *datatype.Job, user *User, action datatype.JobRevisionAction) {
+	if _, err := api.cloudScheduler.GoalManager.AddJobRevision(job, user.GetUserName(), action, 0); err != nil {
+		job.Logger().Error("failed to store revision of job", "action", action, "error", err)
+	}
+}
 
-	} else if r.Method == http.MethodPost {
-		log.Printf("hit POST")
+// getAccessibleJob returns the job if the user has the role on it, or the user is a super user overriding the permission
+func (api *APIServer) getAccessibleJob(user *User, jobID string, role datatype.JobRole, override bool) (*datatype.Job, error) {
+	job, err := api.cloudScheduler.GoalManager.GetJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.authorizeJob(user, job, role, override); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
 
-		respondJSON(w, http.StatusOK, []byte{})
-	} else if r.Method == http.MethodPut {
-		log.Printf("hit PUT")
-		// mReader, err := r.MultipartReader()
-		// if err != nil {
-		// 	respondJSON(w, http.StatusOK, "ERROR")
-		// }
-		// yamlFile, err := ioutil.ReadAll(r.Body)
-		// if err != nil {
-		// 	fmt.Println(err)
-		// }
-		// var goal Goal
-		// _ = yaml.Unmarshal(yamlFile, &goal)
-		// log.Printf("%v", goal)
-		// RegisterGoal(goal)
-		// chanTriggerScheduler <- "api server"
-		respondJSON(w, http.StatusOK, []byte{})
+// authorizeJob returns an error if the user does not have the role on the job.
+// A super user can override the permission
+func (api *APIServer) authorizeJob(user *User, job *datatype.Job, role datatype.JobRole, override bool) error {
+	userName := user.GetUserName()
+	userRole := api.cloudScheduler.GoalManager.GetJobRole(job, userName)
+	if userRole.Includes(role) {
+		return nil
+	}
+	log := job.Logger().With("user", userName)
+	log.Info("user does not have the role on the job", "role", role, "user_role", userRole)
+	if override {
+		log.Info("user is attempting to override the job", "owner", job.User)
+		if user.Auth.IsSuperUser {
+			log.Info("user is a super user. overriding permitted")
+			return nil
+		}
+		return fmt.Errorf("User %s does not have permission to override to the job", userName)
 	}
+	if userRole == "" {
+		return fmt.Errorf("User %s does not have access to the job", userName)
+	}
+	return fmt.Errorf("User %s is %s of the job and needs to be %s", userName, userRole, role)
 }
 
-func (api *APIServer) handlerGoalForNode(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	nodeName := vars["nodeName"]
-	var goals []*datatype.ScienceGoal
-	for _, g := range api.cloudScheduler.GoalManager.GetScienceGoalsForNode(nodeName) {
-		goals = append(goals, g.ShowMyScienceGoal(nodeName))
+// authorizeTeam returns an error if the user cannot move the job to the team. Only owners
+// of the job change its team, and they need to be editors of the new team
+func (api *APIServer) authorizeTeam(user *User, job *datatype.Job, team string, override bool) error {
+	if job.Team == team {
+		return nil
 	}
-	blob, err := httpSensitiveJsonMarshal(goals)
+	if err := api.authorizeJob(user, job, datatype.JobRoleOwner, override); err != nil {
+		return fmt.Errorf("only owners of the job can change its team: %s", err.Error())
+	}
+	if team == "" {
+		return nil
+	}
+	t, err := api.cloudScheduler.GoalManager.GetTeam(team)
 	if err != nil {
-		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
-		respondJSON(w, http.StatusOK, response.ToJson())
+		return err
+	}
+	if !t.GetRole(user.GetUserName()).Includes(datatype.JobRoleEditor) && !(override && user.Auth.IsSuperUser) {
+		return fmt.Errorf("User %s needs to be an editor of team %s to add jobs to the team", user.GetUserName(), team)
+	}
+	return nil
+}
+
+// authorizeNewJob returns an error if the team or collaborators of a job the user creates are invalid
+func (api *APIServer) authorizeNewJob(user *User, job *datatype.Job) error {
+	for userName, role := range job.Collaborators {
+		if _, err := datatype.ParseJobRole(string(role)); err != nil {
+			return fmt.Errorf("collaborator %s: %s", userName, err.Error())
+		}
+	}
+	return api.authorizeTeam(user, &datatype.Job{User: job.User}, job.Team, false)
+}
+
+// handlerJobRevisions returns revisions of the job, the oldest first
+func (api *APIServer) handlerJobRevisions(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
 		return
 	}
-	respondJSON(w, http.StatusOK, blob)
+	job, err := api.getAccessibleJob(user, mux.Vars(r)["id"], datatype.JobRoleViewer, r.URL.Query().Get("override") == "true")
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	revisions, err := api.cloudScheduler.GoalManager.GetJobRevisions(job.JobID)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	if revisions == nil {
+		revisions = []*datatype.JobRevision{}
+	}
+	response.AddEntity("job_id", job.JobID).
+		AddEntity("revisions", revisions)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
 }
 
-// handlerGoalStreamForNode uses server-sent events (SSE) to stream new goals to connected nodes
-// whenever goals are changed in cloud scheduler
-func (api *APIServer) handlerGoalStreamForNode(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	nodeName := vars["nodeName"]
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+// handlerJobRevisionsDiff returns changes of the job from a revision to another
+func (api *APIServer) handlerJobRevisionsDiff(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
 		return
 	}
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Cache-Control", "no-store")
-	w.Header().Set("Content-Type", "text/event-stream")
-	// To prevent nginx proxy from keeping buffer of data
-	w.Header().Set("X-Accel-Buffering", "no")
-	c := make(chan datatype.Event, 1)
-	api.subscribe(nodeName, c)
-	defer api.unsubscribe(nodeName, c)
-	var goals []*datatype.ScienceGoal
-	for _, g := range api.cloudScheduler.GoalManager.GetScienceGoalsForNode(nodeName) {
-		goals = append(goals, g.ShowMyScienceGoal(nodeName))
+	queries := r.URL.Query()
+	job, err := api.getAccessibleJob(user, mux.Vars(r)["id"], datatype.JobRoleViewer, queries.Get("override") == "true")
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
 	}
-	// if no science goal is assigned to the node return an empty list []
-	// returning null may raise an exception in edge scheduler
-	if len(goals) < 1 {
-		event := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusUpdated).
-			AddEntry("goals", "[]").
-			Build()
-		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.ToString(), event.GetEntry("goals")); err != nil {
+	var revisions []*datatype.JobRevision
+	for _, q := range []string{"from", "to"} {
+		n, err := parseRevision(queries.Get(q))
+		if err != nil {
+			response.AddError(fmt.Sprintf("%s: %s", q, err.Error()))
+			respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
 			return
 		}
-		flusher.Flush()
-	} else {
-		blob, err := httpSensitiveJsonMarshal(goals)
+		revision, err := api.cloudScheduler.GoalManager.GetJobRevision(job.JobID, n)
 		if err != nil {
-			logger.Error.Printf("Failed to compress goals for node %q before pushing", nodeName)
-		} else {
-			event := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusUpdated).
-				AddEntry("goals", string(blob)).
-				Build()
-			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.ToString(), event.GetEntry("goals")); err != nil {
-				return
-			}
-			flusher.Flush()
-		}
-	}
-	for {
-		select {
-		case event := <-c:
-			e := event.(datatype.SchedulerEvent)
-			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.ToString(), e.GetEntry("goals")); err != nil {
-				return
-			}
-			// option 1. send a small heartbeat to the client to keep the connection and notify if it fails
-			// option 2. check if the connection is closed so that it can clean up
-			flusher.Flush()
-		case <-r.Context().Done():
-			flusher.Flush()
+			response.AddError(err.Error())
+			respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
 			return
 		}
+		revisions = append(revisions, revision)
+	}
+	diff, err := datatype.DiffJobRevisions(revisions[0], revisions[1])
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
 	}
+	response.AddEntity("job_id", job.JobID).
+		AddEntity("from", revisions[0].Revision).
+		AddEntity("to", revisions[1].Revision).
+		AddEntity("diff", diff)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
 }
 
-func (api *APIServer) handleDB(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		// dump the current DB
-		err := api.cloudScheduler.GoalManager.DumpDB(w)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
-	case http.MethodPost, http.MethodPut:
-		// TODO: To be implemented. This will
-		//       1. overwrite the db file specified in the config with given byte blob
-		//       2. terminate the schedueler to safely load the overwritten db file
+// handlerJobRollback restores the job to a previous revision and resubmits it
+func (api *APIServer) handlerJobRollback(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	// Update user permission table for validating user against node access permission
+	if err := api.authenticator.UpdatePermissionTableForUser(user); err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	queries := r.URL.Query()
+	job, err := api.getAccessibleJob(user, mux.Vars(r)["id"], datatype.JobRoleEditor, queries.Get("override") == "true")
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	revision, err := parseRevision(queries.Get("revision"))
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	rolledBack, errorList := api.cloudScheduler.RollbackJob(job.JobID, revision, user)
+	if len(errorList) > 0 {
+		response.AddEntity("job_id", job.JobID).
+			AddError(fmt.Sprintf("%v", errorList))
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	response.AddEntity("job_id", job.JobID).
+		AddEntity("revision", rolledBack.Revision).
+		AddEntity("rolled_back_to", revision).
+		AddEntity("state", datatype.JobSubmitted)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+func (api *APIServer) handlerJobTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if r.Method == http.MethodGet {
+		response := datatype.NewAPIMessageBuilder()
+		job, err := api.cloudScheduler.GoalManager.GetJob(vars["id"])
+		if err != nil {
+			response.AddError(err.Error())
+			respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+			return
+		}
+		blob, err := httpSensitiveYamlMarshal(job.ConvertToTemplate())
+		if err != nil {
+			response.AddError(err.Error())
+			respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+			return
+		}
+		respondJSON(w, http.StatusOK, blob)
+		// respondYAML(w, http.StatusOK, job.ConvertToTemplate())
+	}
+}
+
+// handlerJobCollaborators returns the owner, team, and collaborators of the job
+func (api *APIServer) handlerJobCollaborators(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	job, err := api.getAccessibleJob(user, mux.Vars(r)["id"], datatype.JobRoleViewer, r.URL.Query().Get("override") == "true")
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	collaborators := job.Collaborators
+	if collaborators == nil {
+		collaborators = map[string]datatype.JobRole{}
+	}
+	response.AddEntity("job_id", job.JobID).
+		AddEntity("user", job.User).
+		AddEntity("team", job.Team).
+		AddEntity("collaborators", collaborators)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+// handlerJobCollaboratorsAdd shares the job with the user in the role, or changes the role
+// of the user if already shared. Only owners of the job manage its collaborators
+func (api *APIServer) handlerJobCollaboratorsAdd(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	queries := r.URL.Query()
+	job, err := api.getAccessibleJob(user, mux.Vars(r)["id"], datatype.JobRoleOwner, queries.Get("override") == "true")
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	collaborator := queries.Get("user")
+	if collaborator == "" {
+		response.AddError("user is required")
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	if collaborator == job.User {
+		response.AddError(fmt.Sprintf("user %q already owns the job", collaborator))
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	role, err := datatype.ParseJobRole(queries.Get("role"))
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	job, err = api.cloudScheduler.GoalManager.ModifyJob(job.JobID, func(j *datatype.Job) bool {
+		if j.Collaborators == nil {
+			j.Collaborators = make(map[string]datatype.JobRole)
+		}
+		j.Collaborators[collaborator] = role
+		return true
+	})
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	job.Logger().Info("job is shared", "collaborator", collaborator, "role", role, "by", user.GetUserName())
+	response.AddEntity("job_id", job.JobID).
+		AddEntity("collaborators", job.Collaborators)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+// handlerJobCollaboratorsRemove stops sharing the job with the user
+func (api *APIServer) handlerJobCollaboratorsRemove(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	queries := r.URL.Query()
+	job, err := api.getAccessibleJob(user, mux.Vars(r)["id"], datatype.JobRoleOwner, queries.Get("override") == "true")
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	collaborator := queries.Get("user")
+	found := false
+	job, err = api.cloudScheduler.GoalManager.ModifyJob(job.JobID, func(j *datatype.Job) bool {
+		if _, found = j.Collaborators[collaborator]; !found {
+			return false
+		}
+		delete(j.Collaborators, collaborator)
+		return true
+	})
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	if !found {
+		response.AddError(fmt.Sprintf("user %q is not a collaborator of job %q", collaborator, job.JobID))
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	job.Logger().Info("job is no longer shared", "collaborator", collaborator, "by", user.GetUserName())
+	if job.Collaborators == nil {
+		job.Collaborators = map[string]datatype.JobRole{}
+	}
+	response.AddEntity("job_id", job.JobID).
+		AddEntity("collaborators", job.Collaborators)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+// getTeamWithRole returns the team if the user has the role in it, or the user is a super user overriding the permission
+func (api *APIServer) getTeamWithRole(user *User, name string, role datatype.JobRole, override bool) (*datatype.Team, error) {
+	team, err := api.cloudScheduler.GoalManager.GetTeam(name)
+	if err != nil {
+		return nil, err
+	}
+	userName := user.GetUserName()
+	if team.GetRole(userName).Includes(role) {
+		return team, nil
+	}
+	if override && user.Auth.IsSuperUser {
+		logger.With("team", name, "user", userName).Info("user is a super user. overriding permitted", "role", role)
+		return team, nil
+	}
+	if team.GetRole(userName) == "" {
+		return nil, fmt.Errorf("User %s is not a member of team %s", userName, name)
+	}
+	return nil, fmt.Errorf("User %s is %s of team %s and needs to be %s", userName, team.GetRole(userName), name, role)
+}
+
+// handlerTeams returns teams the user is a member of. Super users get all teams with override
+func (api *APIServer) handlerTeams(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	userName := user.GetUserName()
+	if r.URL.Query().Get("override") == "true" && user.Auth.IsSuperUser {
+		userName = ""
+	}
+	teams, err := api.cloudScheduler.GoalManager.GetTeams(userName)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	for _, team := range teams {
+		response.AddEntity(team.Name, team)
+	}
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+func (api *APIServer) handlerTeam(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	team, err := api.getTeamWithRole(user, mux.Vars(r)["name"], datatype.JobRoleViewer, r.URL.Query().Get("override") == "true")
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	response.AddEntity("team", team)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+// handlerTeamCreate creates a team owned by the user
+func (api *APIServer) handlerTeamCreate(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	team := datatype.NewTeam(mux.Vars(r)["name"], user.GetUserName())
+	if err := team.Validate(); err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	if err := api.cloudScheduler.GoalManager.AddTeam(team); err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	logger.With("user", user.GetUserName()).Info("team is created", "team", team.Name)
+	response.AddEntity("team", team)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+// handlerTeamRemove removes the team. Jobs of the team are kept and owned by the users who created them
+func (api *APIServer) handlerTeamRemove(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	team, err := api.getTeamWithRole(user, mux.Vars(r)["name"], datatype.JobRoleOwner, r.URL.Query().Get("override") == "true")
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	if err := api.cloudScheduler.GoalManager.RemoveTeam(team.Name); err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	logger.With("user", user.GetUserName()).Info("team is removed", "team", team.Name)
+	response.AddEntity("team", team.Name).
+		AddEntity("state", "removed")
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+// handlerTeamMembersAdd adds the user to the team in the role, or changes the role of the member
+func (api *APIServer) handlerTeamMembersAdd(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	queries := r.URL.Query()
+	team, err := api.getTeamWithRole(user, mux.Vars(r)["name"], datatype.JobRoleOwner, queries.Get("override") == "true")
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	member := queries.Get("user")
+	if member == "" {
+		response.AddError("user is required")
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	role, err := datatype.ParseJobRole(queries.Get("role"))
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	team.Members[member] = role
+	if !team.HasOwner() {
+		response.AddError(fmt.Sprintf("team %s needs at least one owner", team.Name))
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	if err := api.cloudScheduler.GoalManager.UpdateTeam(team); err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	logger.With("user", user.GetUserName()).Info("team member is added", "team", team.Name, "member", member, "role", role)
+	response.AddEntity("team", team)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+// handlerTeamMembersRemove removes the user from the team. The last owner cannot be removed
+func (api *APIServer) handlerTeamMembersRemove(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	queries := r.URL.Query()
+	team, err := api.getTeamWithRole(user, mux.Vars(r)["name"], datatype.JobRoleOwner, queries.Get("override") == "true")
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	member := queries.Get("user")
+	if _, found := team.Members[member]; !found {
+		response.AddError(fmt.Sprintf("user %q is not a member of team %s", member, team.Name))
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	delete(team.Members, member)
+	if !team.HasOwner() {
+		response.AddError(fmt.Sprintf("team %s needs at least one owner", team.Name))
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	if err := api.cloudScheduler.GoalManager.UpdateTeam(team); err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	logger.With("user", user.GetUserName()).Info("team member is removed", "team", team.Name, "member", member)
+	response.AddEntity("team", team)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+// handlerWebhooks lists webhooks of the user on GET and registers a webhook on POST.
+// The secret of a webhook is returned only when it is registered
+func (api *APIServer) handlerWebhooks(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		webhooks, err := api.cloudScheduler.GoalManager.GetWebhooks(user.GetUserName())
+		if err != nil {
+			response.AddError(err.Error())
+			respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+			return
+		}
+		for _, webhook := range webhooks {
+			webhook.Secret = ""
+			response.AddEntity(webhook.ID, webhook)
+		}
+		respondJSON(w, http.StatusOK, response.Build().ToJson())
+	case http.MethodPost:
+		defer r.Body.Close()
+		var webhook datatype.Webhook
+		if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+			response.AddError(err.Error())
+			respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+			return
+		}
+		webhook.User = user.GetUserName()
+		if err := webhook.Validate(); err != nil {
+			response.AddError(err.Error())
+			respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+			return
+		}
+		if webhook.JobID != "" {
+			job, err := api.cloudScheduler.GoalManager.GetJob(webhook.JobID)
+			if err != nil {
+				response.AddError(err.Error())
+				respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+				return
+			}
+			if err := api.authorizeJob(user, job, datatype.JobRoleViewer, false); err != nil {
+				response.AddError(err.Error())
+				respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+				return
+			}
+		}
+		if err := api.cloudScheduler.GoalManager.AddWebhook(&webhook); err != nil {
+			response.AddError(err.Error())
+			respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+			return
+		}
+		logger.With("user", webhook.User, logger.FieldJobID, webhook.JobID).Info("webhook is registered", "webhook", webhook.ID, "url", webhook.URL)
+		response.AddEntity("webhook", webhook)
+		respondJSON(w, http.StatusOK, response.Build().ToJson())
+	}
+}
+
+// getOwnedWebhook returns the webhook if the user owns it
+func (api *APIServer) getOwnedWebhook(user *User, webhookID string) (*datatype.Webhook, error) {
+	webhook, err := api.cloudScheduler.GoalManager.GetWebhook(webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if webhook.User != user.GetUserName() && !user.Auth.IsSuperUser {
+		return nil, fmt.Errorf("user %q is not the owner of webhook %q", user.GetUserName(), webhookID)
+	}
+	return webhook, nil
+}
+
+func (api *APIServer) handlerWebhookRemove(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	webhook, err := api.getOwnedWebhook(user, mux.Vars(r)["id"])
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	if err := api.cloudScheduler.GoalManager.RemoveWebhook(webhook.ID); err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	response.AddEntity("webhook_id", webhook.ID).
+		AddEntity("state", "removed")
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+// handlerWebhookDeliveries returns recent deliveries of the webhook, the latest first
+func (api *APIServer) handlerWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	response := datatype.NewAPIMessageBuilder()
+	user, err := api.authenticate(r)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	webhook, err := api.getOwnedWebhook(user, mux.Vars(r)["id"])
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusBadRequest, response.Build().ToJson())
+		return
+	}
+	deliveries, err := api.cloudScheduler.GoalManager.GetWebhookDeliveries(webhook.ID)
+	if err != nil {
+		response.AddError(err.Error())
+		respondJSON(w, http.StatusInternalServerError, response.Build().ToJson())
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*datatype.WebhookDelivery{}
+	}
+	response.AddEntity("webhook_id", webhook.ID).
+		AddEntity("deliveries", deliveries)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+func (api *APIServer) handlerGoals(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+
+	} else if r.Method == http.MethodPost {
+		log.Printf("hit POST")
+
+		respondJSON(w, http.StatusOK, []byte{})
+	} else if r.Method == http.MethodPut {
+		log.Printf("hit PUT")
+		// mReader, err := r.MultipartReader()
+		// if err != nil {
+		// 	respondJSON(w, http.StatusOK, "ERROR")
+		// }
+		// yamlFile, err := ioutil.ReadAll(r.Body)
+		// if err != nil {
+		// 	fmt.Println(err)
+		// }
+		// var goal Goal
+		// _ = yaml.Unmarshal(yamlFile, &goal)
+		// log.Printf("%v", goal)
+		// RegisterGoal(goal)
+		// chanTriggerScheduler <- "api server"
+		respondJSON(w, http.StatusOK, []byte{})
+	}
+}
+
+func (api *APIServer) handlerGoalForNode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	nodeName := vars["nodeName"]
+	var goals []*datatype.ScienceGoal
+	for _, g := range api.cloudScheduler.GoalManager.GetScienceGoalsForNode(nodeName) {
+		goals = append(goals, g.ShowMyScienceGoal(nodeName))
+	}
+	blob, err := httpSensitiveJsonMarshal(goals)
+	if err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusOK, response.ToJson())
+		return
+	}
+	respondJSON(w, http.StatusOK, blob)
+}
+
+// handlerGoalStreamForNode uses server-sent events (SSE) to stream new goals to connected nodes
+// whenever goals are changed in cloud scheduler
+func (api *APIServer) handlerGoalStreamForNode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	nodeName := vars["nodeName"]
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/event-stream")
+	// To prevent nginx proxy from keeping buffer of data
+	w.Header().Set("X-Accel-Buffering", "no")
+	c := make(chan datatype.Event, 1)
+	api.subscribe(nodeName, c)
+	defer api.unsubscribe(nodeName, c)
+	var goals []*datatype.ScienceGoal
+	for _, g := range api.cloudScheduler.GoalManager.GetScienceGoalsForNode(nodeName) {
+		goals = append(goals, g.ShowMyScienceGoal(nodeName))
+	}
+	// if no science goal is assigned to the node return an empty list []
+	// returning null may raise an exception in edge scheduler
+	if len(goals) < 1 {
+		event := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusUpdated).
+			AddEntry("goals", "[]").
+			Build()
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.ToString(), event.GetEntry("goals")); err != nil {
+			return
+		}
+		flusher.Flush()
+	} else {
+		blob, err := httpSensitiveJsonMarshal(goals)
+		if err != nil {
+			logger.Error.Printf("Failed to compress goals for node %q before pushing", nodeName)
+		} else {
+			event := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusUpdated).
+				AddEntry("goals", string(blob)).
+				Build()
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.ToString(), event.GetEntry("goals")); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+	for {
+		select {
+		case event := <-c:
+			e := event.(datatype.SchedulerEvent)
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.ToString(), e.GetEntry("goals")); err != nil {
+				return
+			}
+			// option 1. send a small heartbeat to the client to keep the connection and notify if it fails
+			// option 2. check if the connection is closed so that it can clean up
+			flusher.Flush()
+		case <-r.Context().Done():
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+func (api *APIServer) handleDB(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// dump the current DB
+		err := api.cloudScheduler.GoalManager.DumpDB(w)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	case http.MethodPost, http.MethodPut:
+		// TODO: To be implemented. This will
+		//       1. overwrite the db file specified in the config with given byte blob
+		//       2. terminate the schedueler to safely load the overwritten db file
 		http.Error(w, "Not implemented", http.StatusInternalServerError)
 	default:
 		http.Error(w, fmt.Sprintf("the HTTP method %q is not supported", r.Method), http.StatusBadRequest)
@@ -724,10 +1504,7 @@ func (api *APIServer) handleDataPlugins(w http.ResponseWriter, r *http.Request)
 			}
 		} else {
 			response := datatype.NewAPIMessageBuilder()
-			pluginImages := []string{}
-			for image := range api.cloudScheduler.Validator.Plugins {
-				pluginImages = append(pluginImages, image)
-			}
+			pluginImages := append([]string{}, api.cloudScheduler.Validator.GetPluginImages()...)
 			response.AddEntity("plugins", pluginImages)
 			respondJSON(w, http.StatusOK, response.Build().ToJson())
 		}
@@ -784,6 +1561,97 @@ func (api *APIServer) handleDataPluginsWhitelist(w http.ResponseWriter, r *http.
 	}
 }
 
+// handleQuotas shows quotas of users and replaces them with the quotas in the request body
+func (api *APIServer) handleQuotas(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		config, err := api.cloudScheduler.GetQuotaConfig()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response := datatype.NewAPIMessageBuilder()
+		response.AddEntity("quotas", config)
+		respondJSON(w, http.StatusOK, response.Build().ToJson())
+	case http.MethodPut:
+		defer r.Body.Close()
+		var config datatype.QuotaConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			http.Error(w, fmt.Sprintf("failed to parse quotas: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		if err := config.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := api.cloudScheduler.GoalManager.SetQuotaConfig(&config); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logger.With("users", len(config.Users), "groups", len(config.Groups)).Info("quotas are updated")
+		response := datatype.NewAPIMessageBuilder()
+		response.AddEntity("quotas", config)
+		response.AddEntity("status", "success")
+		respondJSON(w, http.StatusOK, response.Build().ToJson())
+	default:
+		http.Error(w, fmt.Sprintf("the HTTP method %q is not supported", r.Method), http.StatusBadRequest)
+	}
+}
+
+// handleQuotasUsage shows quotas and current usage of a user given in the query,
+// or of all users who have active jobs. Usage of groups the users are in is summed
+// across the members of each group
+func (api *APIServer) handleQuotasUsage(w http.ResponseWriter, r *http.Request) {
+	config, err := api.cloudScheduler.GetQuotaConfig()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	users := api.cloudScheduler.GetQuotaUsers(config)
+	if userName := r.URL.Query().Get("user"); userName != "" {
+		users = []string{userName}
+	}
+	groups := map[string]bool{}
+	usages := []map[string]interface{}{}
+	for _, userName := range users {
+		usage := api.cloudScheduler.GetQuotaUsage(userName, "", config)
+		usages = append(usages, map[string]interface{}{
+			"user":                     userName,
+			"groups":                   config.GetGroups(userName),
+			"quota":                    config.GetQuota(userName),
+			"active_jobs":              usage.ActiveJobs,
+			"gpu_plugins":              usage.GPUPlugins,
+			"plugins_per_node":         usage.PluginsPerNode,
+			"runtime_per_node_per_day": usage.GetRuntimePerNodePerDay(),
+		})
+		for _, groupName := range config.GetGroups(userName) {
+			groups[groupName] = true
+		}
+	}
+	var groupNames []string
+	for groupName := range groups {
+		groupNames = append(groupNames, groupName)
+	}
+	sort.Strings(groupNames)
+	groupUsages := []map[string]interface{}{}
+	for _, groupName := range groupNames {
+		usage := api.cloudScheduler.GetGroupQuotaUsage(groupName, "", config)
+		groupUsages = append(groupUsages, map[string]interface{}{
+			"group":                    groupName,
+			"members":                  config.Groups[groupName].Members,
+			"quota":                    config.Groups[groupName].Quota,
+			"active_jobs":              usage.ActiveJobs,
+			"gpu_plugins":              usage.GPUPlugins,
+			"plugins_per_node":         usage.PluginsPerNode,
+			"runtime_per_node_per_day": usage.GetRuntimePerNodePerDay(),
+		})
+	}
+	response := datatype.NewAPIMessageBuilder()
+	response.AddEntity("usages", usages)
+	response.AddEntity("group_usages", groupUsages)
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
 func (api *APIServer) handleDataNodes(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -3,6 +3,7 @@ package cloudscheduler
 import (
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
 
 type CloudSchedulerConfig struct {
@@ -23,6 +24,21 @@ type CloudSchedulerConfig struct {
 	AuthToken                     string `json:"auth_token" yaml:"authToken"`
 	JobReevaluationIntervalSecond int    `json:"job_reevaluation_interval_second" yaml:"jobReevaluationIntervalSecond"`
 	Debug                         bool   `json:"debug" yaml:"debug"`
+	// LogFormat is the format of log messages: text or json
+	LogFormat string `json:"log_format" yaml:"logFormat"`
+	// DataAPIURL is the Waggle data API to evaluate success criteria on published data
+	DataAPIURL string `json:"data_api_url" yaml:"dataAPIURL"`
+	// JobHealthRule decides when jobs are degraded or failed by failures of their plugins
+	JobHealthRule datatype.JobHealthRule `json:"job_health_rule" yaml:"jobHealthRule"`
+	// SMTP is the server to send email notifications of jobs through. No email is sent if the host is empty
+	SMTP SMTPConfig `json:"smtp" yaml:"smtp"`
+	// PublicURL is the URL users reach the API server at. It is used for links in emails
+	PublicURL string `json:"public_url" yaml:"publicURL"`
+	// Quota limits jobs of users until quotas are edited through the management API
+	Quota datatype.QuotaConfig `json:"quota" yaml:"quota"`
+	// WebhookAllowedNetworks are CIDRs of private networks webhooks can post to, e.g. 10.0.0.0/8.
+	// Webhooks cannot post to private, loopback, or link-local addresses otherwise
+	WebhookAllowedNetworks []string `json:"webhook_allowed_networks" yaml:"webhookAllowedNetworks"`
 }
 
 type CloudSchedulerBuilder struct {
@@ -30,15 +46,25 @@ type CloudSchedulerBuilder struct {
 }
 
 func NewCloudSchedulerBuilder(config *CloudSchedulerConfig) *CloudSchedulerBuilder {
-	return &CloudSchedulerBuilder{
+	csb := &CloudSchedulerBuilder{
 		cloudScheduler: &CloudScheduler{
-			Name:                config.Name,
-			Version:             config.Version,
-			Config:              config,
-			Validator:           NewJobValidator(config),
-			chanFromGoalManager: make(chan datatype.Event, maxChannelBuffer),
+			Name:                   config.Name,
+			Version:                config.Version,
+			Config:                 config,
+			Validator:              NewJobValidator(config),
+			chanFromGoalManager:    make(chan datatype.Event, maxChannelBuffer),
+			chanJobReevaluations:   make(chan *jobReevaluation, maxChannelBuffer),
+			chanDataCriteriaCheck:  make(chan *datatype.Job, maxChannelBuffer),
+			chanSuccessCriteriaMet: make(chan successCriterionMet, maxChannelBuffer),
 		},
 	}
+	if config.DataAPIURL != "" {
+		csb.cloudScheduler.dataQuerier = NewDataAPI(config.DataAPIURL)
+	}
+	if config.SMTP.Host != "" {
+		csb.cloudScheduler.emailNotifier = NewEmailNotifier(config.Name, config.SMTP, config.PublicURL)
+	}
+	return csb
 }
 
 func (csb *CloudSchedulerBuilder) AddGoalManager() *CloudSchedulerBuilder {
@@ -48,6 +74,11 @@ func (csb *CloudSchedulerBuilder) AddGoalManager() *CloudSchedulerBuilder {
 		dataPath:     csb.cloudScheduler.Config.DataDir,
 	}
 	csb.cloudScheduler.GoalManager.Notifier.Subscribe(csb.cloudScheduler.chanFromGoalManager)
+	allowedNetworks, err := ParseWebhookAllowedNetworks(csb.cloudScheduler.Config.WebhookAllowedNetworks)
+	if err != nil {
+		logger.Error.Printf("Webhooks are not allowed to post to private networks: %s", err.Error())
+	}
+	csb.cloudScheduler.webhookDispatcher = NewWebhookDispatcher(csb.cloudScheduler.GoalManager, allowedNetworks)
 	return csb
 }
 
@@ -144,14 +144,50 @@ func (cgm *CloudGoalManager) UpdateJob(job *datatype.Job, submit bool) (err erro
 	}
 	// send an event for scheduling the science goal
 	if submit {
+		// the goal of a job waiting for its start time is loaded at the start time
+		if job.IsHeld(time.Now()) {
+			job.Logger().Info("job is held until its start time", "start_time", job.StartTime.Format(time.RFC3339))
+			event := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusSubmitted).AddJob(job).Build()
+			cgm.Notifier.Notify(event)
+			return
+		}
 		newScienceGoal := job.ScienceGoal
 		cgm.UpdateScienceGoal(newScienceGoal)
-		event := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusSubmitted).AddGoal(newScienceGoal).Build()
+		event := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusSubmitted).AddJob(job).AddGoal(newScienceGoal).Build()
 		cgm.Notifier.Notify(event)
 	}
 	return
 }
 
+// ModifyJob reads the job, modifies it, and writes it back in a single transaction so that
+// concurrent modifications are not lost. The job is not written if modify returns false
+func (cgm *CloudGoalManager) ModifyJob(jobID string, modify func(job *datatype.Job) bool) (job *datatype.Job, err error) {
+	err = cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(jobBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", jobBucketName)
+		}
+		v := b.Get([]byte(jobID))
+		if v == nil {
+			return fmt.Errorf("Job ID %q does not exist", jobID)
+		}
+		var j datatype.Job
+		if err := json.Unmarshal(v, &j); err != nil {
+			return err
+		}
+		job = &j
+		if !modify(job) {
+			return nil
+		}
+		buf, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(job.JobID), buf)
+	})
+	return
+}
+
 func (cgm *CloudGoalManager) SuspendJob(jobID string) (err error) {
 	var job datatype.Job
 	err = cgm.jobDB.Update(func(tx *bolt.Tx) error {
@@ -183,6 +219,45 @@ func (cgm *CloudGoalManager) SuspendJob(jobID string) (err error) {
 	return
 }
 
+// CompleteJob marks the job completed for given reason, e.g. its success criteria are met.
+// Jobs no longer submitted or running, e.g. suspended by the user meanwhile, are not completed
+func (cgm *CloudGoalManager) CompleteJob(jobID string, reason string) (err error) {
+	var job datatype.Job
+	err = cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(jobBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", jobBucketName)
+		}
+		v := b.Get([]byte(jobID))
+		if v == nil {
+			return fmt.Errorf("Job ID %q does not exist", jobID)
+		}
+		if err := json.Unmarshal(v, &job); err != nil {
+			return err
+		}
+		if !job.IsActive() {
+			return fmt.Errorf("Failed to complete job %q as it is in %s state", jobID, job.State.GetState())
+		}
+		job.Completed()
+		buf, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(job.JobID), []byte(buf))
+	})
+	if err != nil {
+		return
+	}
+	event := datatype.NewSchedulerEventBuilder(datatype.EventJobStatusCompleted).
+		AddJob(&job).
+		AddReason(reason)
+	if job.ScienceGoal != nil {
+		event = event.AddGoal(job.ScienceGoal)
+	}
+	cgm.Notifier.Notify(event.Build())
+	return
+}
+
 func (cgm *CloudGoalManager) RemoveJob(jobID string, force bool) (err error) {
 	var job datatype.Job
 	err = cgm.jobDB.Update(func(tx *bolt.Tx) error {
@@ -266,6 +341,8 @@ func (cgm *CloudGoalManager) GetScienceGoal(goalID string) (*datatype.ScienceGoa
 
 // GetScienceGoalsForNode returns a list of goals associated to given node.
 func (cgm *CloudGoalManager) GetScienceGoalsForNode(nodeName string) (goals []*datatype.ScienceGoal) {
+	cgm.mu.Lock()
+	defer cgm.mu.Unlock()
 	for _, scienceGoal := range cgm.scienceGoals {
 		for _, subGoal := range scienceGoal.SubGoals {
 			if strings.ToLower(subGoal.Name) == strings.ToLower(nodeName) {
@@ -300,8 +377,18 @@ func (cgm *CloudGoalManager) OpenJobDB() error {
 	}
 	cgm.jobDB = db
 	cgm.jobDB.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(jobBucketName))
-		return err
+		for _, name := range []string{jobBucketName, jobRevisionBucketName, webhookBucketName, webhookDeliveryBucketName, quotaBucketName, teamBucketName} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket([]byte(webhookIndexBucketName)) == nil {
+			if _, err := tx.CreateBucket([]byte(webhookIndexBucketName)); err != nil {
+				return err
+			}
+			return buildWebhookIndex(tx)
+		}
+		return nil
 	})
 	return nil
 }
@@ -333,6 +420,9 @@ func (cgm *CloudGoalManager) LoadScienceGoalsFromJobDB() error {
 			}
 			switch j.State.GetState() {
 			case datatype.JobSubmitted, datatype.JobRunning:
+				if j.IsHeld(time.Now()) {
+					return nil
+				}
 				cgm.UpdateScienceGoal(j.ScienceGoal)
 			}
 			return nil
@@ -1,8 +1,12 @@
 package cloudscheduler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/mail"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -23,11 +27,25 @@ type CloudScheduler struct {
 	Validator           *JobValidator
 	APIServer           *APIServer
 	chanFromGoalManager chan datatype.Event
-	MetricsCollector    *prometheus.Collector
-	eventListener       *interfacing.RabbitMQHandler
+	// chanJobReevaluations carries results of job re-evaluation to the main loop
+	chanJobReevaluations chan *jobReevaluation
+	// chanDataCriteriaCheck queues jobs whose data success criteria are checked off the main loop
+	chanDataCriteriaCheck chan *datatype.Job
+	// chanSuccessCriteriaMet carries data success criteria met to the main loop
+	chanSuccessCriteriaMet chan successCriterionMet
+	MetricsCollector       *prometheus.Collector
+	eventListener          *interfacing.RabbitMQHandler
+	dataQuerier            DataQuerier
+	emailNotifier          *EmailNotifier
+	webhookDispatcher      *WebhookDispatcher
+	// reevaluating is true while jobs are re-evaluated
+	reevaluating atomic.Bool
 }
 
 func (cs *CloudScheduler) Configure() error {
+	if err := cs.Config.JobHealthRule.Validate(); err != nil {
+		return fmt.Errorf("invalid job health rule: %s", err.Error())
+	}
 	// Loading job database
 	if err := cs.GoalManager.OpenJobDB(); err != nil {
 		return err
@@ -51,11 +69,7 @@ func (cs *CloudScheduler) Configure() error {
 
 	// Setting up RabbitMQ connection to receive scheduling events from nodes
 	if !cs.Config.NoRabbitMQ {
-		logger.Info.Printf(
-			"Using RabbitMQ at %s with user %s",
-			cs.Config.RabbitmqURL,
-			cs.Config.RabbitmqUsername,
-		)
+		logger.With("url", cs.Config.RabbitmqURL, "user", cs.Config.RabbitmqUsername).Info("using RabbitMQ")
 		cs.eventListener = interfacing.NewRabbitMQHandler(
 			cs.Config.RabbitmqURL,
 			cs.Config.RabbitmqUsername,
@@ -69,9 +83,9 @@ func (cs *CloudScheduler) Configure() error {
 
 func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, user *User) (scienceGoal *datatype.ScienceGoal, errorList []error) {
 	scienceGoalBuilder := datatype.NewScienceGoalBuilder(job.Name, job.JobID)
-	logger.Info.Printf("Validating %s...", job.Name)
+	job.Logger().Infof("Validating %s...", job.Name)
 	// Step 1: Resolve node tags
-	job.AddNodes(cs.Validator.GetNodeNamesByTags(job.NodeTags))
+	job.ResolveNodeTags(cs.Validator.GetNodeNamesByTags(job.NodeTags))
 	// TODO: Jobs may be submitted without nodes in the future
 	//       For example, Chicago nodes without having any node in Chicago yet
 	if len(job.Nodes) < 1 {
@@ -84,6 +98,10 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, use
 			errorList = append(errorList, fmt.Errorf("No email is set for notification"))
 			return
 		}
+		if addr, err := mail.ParseAddress(job.Email); err != nil || addr.Address != job.Email {
+			errorList = append(errorList, fmt.Errorf("Email %q is not a valid address", job.Email))
+			return
+		}
 		// Check if given notification types are valid
 		for _, s := range job.NotificationOn {
 			switch s {
@@ -93,7 +111,8 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, use
 				datatype.JobRunning,
 				datatype.JobComplete,
 				datatype.JobSuspended,
-				datatype.JobRemoved:
+				datatype.JobRemoved,
+				datatype.JobFailure:
 				continue
 			default:
 				errorList = append(errorList, fmt.Errorf("No type %q in Job notification", s))
@@ -103,6 +122,18 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, use
 			return
 		}
 	}
+	if errs := validateSuccessCriteria(job); len(errs) > 0 {
+		errorList = append(errorList, errs...)
+		return
+	}
+	if err := job.ValidateTimeWindow(time.Now()); err != nil {
+		errorList = append(errorList, err)
+		return
+	}
+	if errs := cs.validateQuota(job, user); len(errs) > 0 {
+		errorList = append(errorList, errs...)
+		return
+	}
 	for nodeName := range job.Nodes {
 		// Check 0: if the user can schedule
 		ret, err := user.CanScheduleOnNode(nodeName)
@@ -135,11 +166,28 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, use
 				errorList = append(errorList, fmt.Errorf("%s does not specify plugin image", plugin.Name))
 				continue
 			}
+			switch plugin.PluginSpec.Mode {
+			case "", datatype.PluginModeOneshot, datatype.PluginModeService:
+			default:
+				errorList = append(errorList, fmt.Errorf("%s has unknown plugin mode %q", plugin.Name, plugin.PluginSpec.Mode))
+				continue
+			}
+			if plugin.PluginSpec.Network != nil {
+				if err := plugin.PluginSpec.Network.Validate(); err != nil {
+					errorList = append(errorList, fmt.Errorf("%s has invalid network: %s", plugin.Name, err.Error()))
+					continue
+				}
+			}
+			// sensors declared in the job must exist in the node regardless of the plugin manifest
+			if supported, unsupportedSensorList := nodeManifest.GetUnsupportedSensors(plugin.PluginSpec.Sensors); !supported {
+				errorList = append(errorList, fmt.Errorf("%s does not have sensors %v required by %s (%s)", nodeName, unsupportedSensorList, plugin.Name, plugin.PluginSpec.Image))
+				continue
+			}
 			pluginManifest := cs.Validator.GetPluginManifest(pluginImage, true)
 			if pluginManifest == nil {
 				// we also check if the image is in the whitelist. If so, we approve for the plugin
 				if cs.Validator.IsPluginWhitelisted(pluginImage) {
-					logger.Info.Printf("%s is whitelisted", pluginImage)
+					job.Logger().Info("plugin image is whitelisted", logger.FieldPlugin, plugin.Name, "image", pluginImage)
 					approvedPlugins = append(approvedPlugins, plugin)
 				} else {
 					errorList = append(errorList, fmt.Errorf("%s does not exist in ECR", plugin.PluginSpec.Image))
@@ -155,21 +203,20 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, use
 			// logger.Info.Printf("%s:%s exists in ECR", plugin.Name, plugin.Version)
 
 			// Check 2: node supports hardware requirements of the plugin
-			// TODO: plugin manifest does not yet have sensor requirement
-			// supported, unsupportedHardwareList := nodeManifest.GetUnsupportedListOfPluginSensors(pluginManifest)
-			// if !supported {
-			// 	errorList = append(errorList, fmt.Errorf("%s does not support hardware %v required by %s (%s)", nodeName, unsupportedHardwareList, plugin.Name, plugin.PluginSpec.Image))
-			// 	continue
-			// }
-			// logger.Info.Printf("%s passed Check 2", plugin.Name)
+			supported, unsupportedHardwareList := nodeManifest.GetUnsupportedListOfPluginSensors(pluginManifest)
+			if !supported {
+				errorList = append(errorList, fmt.Errorf("%s does not support hardware %v required by %s (%s)", nodeName, unsupportedHardwareList, plugin.Name, plugin.PluginSpec.Image))
+				continue
+			}
+			job.Logger().Debug("plugin passed hardware check", logger.FieldNode, nodeName, logger.FieldPlugin, plugin.Name)
 
 			// Check 3: architecture of the plugin is supported by node
-			supported, _ := nodeManifest.GetPluginArchitectureSupportedComputes(pluginManifest)
+			supported, _ = nodeManifest.GetPluginArchitectureSupportedComputes(pluginManifest)
 			if !supported {
 				errorList = append(errorList, fmt.Errorf("%s does not support architecture %v required by %s (%s)", nodeName, pluginManifest.GetArchitectures(), plugin.Name, plugin.PluginSpec.Image))
 				continue
 			}
-			logger.Info.Printf("%s passed Check 3", plugin.Name)
+			job.Logger().Debug("plugin passed architecture check", logger.FieldNode, nodeName, logger.FieldPlugin, plugin.Name)
 			// Check 4: the required resource is available in node devices
 			// for _, c := range supportedComputes {
 			// 	supported, _ := c.GetUnsupportedPluginProfiles(pluginManifest)
@@ -185,7 +232,15 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, use
 			// 	}
 			// }
 			// }
-			approvedPlugins = append(approvedPlugins, plugin)
+			approvedPlugin := withGPUMemoryFromProfiles(plugin, pluginManifest)
+			approvedPlugin = withSensorsFromManifest(approvedPlugin, pluginManifest, nodeManifest)
+			// the node scheduler uses the architectures to place the plugin on a compute
+			if len(approvedPlugin.Architectures) == 0 {
+				_p := *approvedPlugin
+				_p.Architectures = pluginManifest.GetArchitectures()
+				approvedPlugin = &_p
+			}
+			approvedPlugins = append(approvedPlugins, approvedPlugin)
 			pluginNameForDuplication[plugin.Name] = true
 		}
 		// Check 4: conditions of job are valid
@@ -204,14 +259,68 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(job *datatype.Job, use
 		scienceGoalBuilder = scienceGoalBuilder.AddSubGoal(nodeName, approvedPlugins, rules)
 	}
 	if len(errorList) > 0 {
-		logger.Info.Printf("Validation failed for Job %q: %v", job.Name, errorList)
+		job.Logger().Info("validation failed for job", "job", job.Name, "errors", fmt.Sprint(errorList))
 	} else {
 		scienceGoal = scienceGoalBuilder.Build()
-		logger.Info.Printf("A new goal %q is generated for Job %q", scienceGoal.ID, job.Name)
+		scienceGoal.Logger().Info("a new goal is generated for job", "job", job.Name)
 	}
 	return
 }
 
+// withGPUMemoryFromProfiles returns the plugin with GPU memory it would use on the node.
+// If the plugin requires GPU but does not declare its GPU memory, the largest GPU memory
+// required by the plugin profiles in ECR is used. The original plugin is not modified.
+func withGPUMemoryFromProfiles(plugin *datatype.Plugin, pluginManifest *datatype.PluginManifest) *datatype.Plugin {
+	if !plugin.PluginSpec.IsGPURequired() || plugin.PluginSpec.GetGPUMemoryRequest() != "" {
+		return plugin
+	}
+	maxGPUMemory := 0
+	for _, profile := range pluginManifest.Profile {
+		if m := profile.Require.GetGPUMemoryInMega(); m > maxGPUMemory {
+			maxGPUMemory = m
+		}
+	}
+	if maxGPUMemory == 0 {
+		return plugin
+	}
+	pluginSpec := *plugin.PluginSpec
+	pluginSpec.Resource = map[string]string{}
+	for k, v := range plugin.PluginSpec.Resource {
+		pluginSpec.Resource[k] = v
+	}
+	pluginSpec.Resource[datatype.ResourceRequestGPUMemory] = fmt.Sprintf("%dMi", maxGPUMemory)
+	p := *plugin
+	p.PluginSpec = &pluginSpec
+	return &p
+}
+
+// withSensorsFromManifest returns the plugin with sensors it requires in the plugin manifest
+// added to its spec, so that the node scheduler can place the plugin on the compute
+// the sensors are attached to. Required hardware that is not a sensor of the node, e.g. gpu,
+// is not added. The original plugin is not modified.
+func withSensorsFromManifest(plugin *datatype.Plugin, pluginManifest *datatype.PluginManifest, nodeManifest *datatype.NodeManifest) *datatype.Plugin {
+	declared := map[string]bool{}
+	for _, s := range plugin.PluginSpec.Sensors {
+		declared[s] = true
+	}
+	var sensors []string
+	for hardware, required := range pluginManifest.Hardware {
+		if !required || declared[hardware] || len(nodeManifest.FindSensors(hardware)) == 0 {
+			continue
+		}
+		sensors = append(sensors, hardware)
+	}
+	if len(sensors) == 0 {
+		return plugin
+	}
+	sort.Strings(sensors)
+	pluginSpec := *plugin.PluginSpec
+	pluginSpec.Sensors = append(append([]string{}, plugin.PluginSpec.Sensors...), sensors...)
+	p := *plugin
+	p.PluginSpec = &pluginSpec
+	return &p
+}
+
 func (cs *CloudScheduler) ValidateJobAndCreateScienceGoalForExistingJob(jobID string, user *User, dryrun bool) (errorList []error) {
 	job, err := cs.GoalManager.GetJob(jobID)
 	if err != nil {
@@ -221,9 +330,9 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoalForExistingJob(jobID st
 	if len(errorList) > 0 {
 		return
 	}
-	logger.Info.Printf("Updating science goal for JOB ID %q", jobID)
+	job.Logger().Info("updating science goal of the job")
 	if job.ScienceGoal != nil {
-		logger.Info.Printf("job ID %q has an existing goal %q. dropping it first...", jobID, job.ScienceGoal.ID)
+		job.ScienceGoal.Logger().Info("the job has an existing goal. dropping it first...")
 		cs.GoalManager.RemoveScienceGoal(job.ScienceGoal.ID)
 	}
 	job.ScienceGoal = sg
@@ -248,7 +357,7 @@ func (cs *CloudScheduler) updateNodes(nodes []string) {
 		}
 		blob, err := json.MarshalIndent(goals, "", "  ")
 		if err != nil {
-			logger.Error.Printf("Failed to compress goals for node %q before pushing", nodeName)
+			logger.With(logger.FieldNode, nodeName).Error("failed to compress goals before pushing", "error", err)
 		} else {
 			event := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusUpdated).AddEntry("goals", string(blob)).Build()
 			cs.APIServer.Push(nodeName, event)
@@ -257,22 +366,43 @@ func (cs *CloudScheduler) updateNodes(nodes []string) {
 }
 
 func (cs *CloudScheduler) Run() {
-	logger.Info.Printf("Cloud Scheduler %s starts...", cs.Name)
+	logger.With("name", cs.Name, "version", cs.Version).Info("cloud scheduler starts")
 	go cs.APIServer.Run()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cs.webhookDispatcher.Run(ctx)
+	if cs.emailNotifier != nil {
+		go cs.emailNotifier.Run()
+	}
+	if cs.dataQuerier != nil {
+		go cs.runDataCriteriaChecker()
+	}
 	chanEventFromNode := make(chan datatype.Event)
 	if cs.eventListener != nil {
-		logger.Info.Printf("Connecting to RabbitMQ to receive node events")
 		queueName := fmt.Sprintf("to-scheduler-%s", cs.Config.Name)
-		logger.Debug.Printf("RabbitMQ Queue name for messages is %s", queueName)
+		logger.With("url", cs.Config.RabbitmqURL, "queue", queueName).Info("connecting to RabbitMQ to receive node events")
 		err := cs.eventListener.SubscribeEvents(
 			"waggle.msg",
 			queueName,
 			datatype.EventRabbitMQSubscriptionPatternGoals,
 			chanEventFromNode)
 		if err != nil {
-			logger.Error.Printf("Failed to set up a connection to RabbitMQ: %s", err.Error())
+			logger.With("queue", queueName).Error("failed to subscribe goal events from RabbitMQ", "error", err)
+		}
+		// plugin events count toward health and success criteria of jobs
+		err = cs.eventListener.SubscribeEvents(
+			"waggle.msg",
+			queueName,
+			datatype.EventRabbitMQSubscriptionPatternPlugins,
+			chanEventFromNode)
+		if err != nil {
+			logger.With("queue", queueName).Error("failed to subscribe plugin events from RabbitMQ", "error", err)
 		}
 	}
+	successCriteriaTicker := time.NewTicker(successCriteriaCheckInterval)
+	defer successCriteriaTicker.Stop()
+	jobWindowTicker := time.NewTicker(jobWindowCheckInterval)
+	defer jobWindowTicker.Stop()
 	// Timer for job re-evaluation
 	ticker := time.NewTicker(1 * time.Second)
 	if cs.Config.JobReevaluationIntervalSecond > 0 {
@@ -283,41 +413,43 @@ func (cs *CloudScheduler) Run() {
 	for {
 		select {
 		case <-ticker.C:
-			logger.Debug.Printf("Job re-evaluation")
+			logger.With("event", "reevaluation").Debug("job re-evaluation starts")
+			// reloading manifests may take long. Events are handled in the meantime
+			go cs.reevaluateJobs()
+		case r := <-cs.chanJobReevaluations:
+			cs.applyJobReevaluation(r)
+		case <-successCriteriaTicker.C:
+			cs.checkSuccessCriteriaOfRunningJobs()
+		case m := <-cs.chanSuccessCriteriaMet:
+			cs.completeJobBySuccessCriterion(m.job, m.criterion)
+		case <-jobWindowTicker.C:
+			cs.checkJobWindows()
 		case event := <-chanEventFromNode:
 			e := event.(datatype.SchedulerEvent)
-			logger.Debug.Printf("%s:%v", e.ToString(), event)
-			// TODO: stat aggregator for jobs may use this event
-			sender := e.GetEntry("vsn")
-			// sender must be identified
+			sender, _ := e.GetEntry("vsn").(string)
+			logger.With(logger.FieldNode, sender, logger.FieldGoalID, e.GetGoalID()).Debug("event received from node", "event", e.Type)
 			switch e.Type {
-			case datatype.EventGoalStatusReceived, datatype.EventGoalStatusUpdated:
-				goalID := e.GetGoalID()
-				logger.Debug.Printf("%s received science goal %s", sender, goalID)
-				scienceGoal, err := cs.GoalManager.GetScienceGoal(goalID)
-				if err != nil {
-					logger.Error.Printf("Failed to find science goal %s", goalID)
-					break
-				}
-				job, err := cs.GoalManager.GetJob(scienceGoal.JobID)
-				if err != nil {
-					logger.Error.Printf("Failed to get job of the science goal %q: %s", goalID, err.Error())
-					break
-				}
-				job.Runs()
-				err = cs.GoalManager.UpdateJob(job, false)
-				if err != nil {
-					logger.Error.Printf("Failed to update status of job %q: %s", scienceGoal.JobID, err.Error())
-					break
+			case datatype.EventPluginStatusQueued,
+				datatype.EventPluginStatusSelected,
+				datatype.EventPluginStatusScheduled,
+				datatype.EventPluginStatusInitializing,
+				datatype.EventPluginStatusRunning,
+				datatype.EventPluginStatusComplete,
+				datatype.EventPluginStatusFailed,
+				datatype.EventPluginStatusStopped:
+				cs.handlePluginEvent(e)
+			default:
+				if state, found := goalStateFromEvent(e.Type); found {
+					cs.handleGoalEvent(e, state)
 				}
 			}
-			// TODO: How do we determine if a job is failed
-			//       by looking at EventPluginStatusFailed?
 		case event := <-cs.chanFromGoalManager:
 			e := event.(datatype.SchedulerEvent)
-			logger.Debug.Printf("%s: %q", e.ToString(), e.GetGoalName())
+			logger.With(logger.FieldJobID, e.GetJobID(), logger.FieldGoalID, e.GetGoalID()).Debug("event received from goal manager", "event", e.Type)
+			cs.notifyJobOwner(e)
+			cs.webhookDispatcher.Dispatch(e)
 			switch e.Type {
-			case datatype.EventJobStatusRemoved:
+			case datatype.EventJobStatusRemoved, datatype.EventJobStatusCompleted:
 				// job, err := cs.GoalManager.GetJob(event.GetJobID())
 				// if err != nil {
 				// 	logger.Error.Printf("Failed to get job %q", event.GetJobID())
@@ -327,47 +459,51 @@ func (cs *CloudScheduler) Run() {
 				if goalID := e.GetGoalID(); goalID != "" {
 					scienceGoal, err := cs.GoalManager.GetScienceGoal(goalID)
 					if err != nil {
-						logger.Error.Printf("Failed to get science goal %q", goalID)
+						logger.With(logger.FieldJobID, e.GetJobID(), logger.FieldGoalID, goalID).Error("failed to get science goal", "error", err)
 						break
 					}
 					NodesToUpdate := scienceGoal.GetSubjectNodes()
 					if err = cs.GoalManager.RemoveScienceGoal(scienceGoal.ID); err != nil {
-						logger.Error.Printf("Failed to remove science goal %q", scienceGoal.ID)
+						scienceGoal.Logger().Error("failed to remove science goal", "error", err)
 						break
 					}
-					logger.Info.Printf("Goal %q is removed for job %q.", scienceGoal.Name, scienceGoal.JobID)
+					scienceGoal.Logger().Info("goal is removed for job", "goal", scienceGoal.Name, "reason", e.GetReason())
 					cs.updateNodes(NodesToUpdate)
 				} else {
-					logger.Info.Printf("failed to retreive goal ID from the event")
+					logger.With(logger.FieldJobID, e.GetJobID()).Info("failed to retrieve goal ID from the event", "event", e.Type)
 				}
 			case datatype.EventJobStatusSuspended:
 				job, err := cs.GoalManager.GetJob(e.GetJobID())
 				if err != nil {
-					logger.Error.Printf("Failed to get job %q", e.GetJobID())
+					logger.With(logger.FieldJobID, e.GetJobID()).Error("failed to get job", "error", err)
 					break
 				}
 				// The job is removed. Corresponding science goal should also be removed
 				if job.ScienceGoal != nil {
 					scienceGoal, err := cs.GoalManager.GetScienceGoal(job.ScienceGoal.ID)
 					if err != nil {
-						logger.Error.Printf("Failed to get science goal %q", job.ScienceGoal.ID)
+						job.ScienceGoal.Logger().Error("failed to get science goal", "error", err)
 						break
 					}
 					NodesToUpdate := scienceGoal.GetSubjectNodes()
 					if err = cs.GoalManager.RemoveScienceGoal(scienceGoal.ID); err != nil {
-						logger.Error.Printf("Failed to remove science goal %q", scienceGoal.ID)
+						scienceGoal.Logger().Error("failed to remove science goal", "error", err)
 						break
 					}
-					logger.Info.Printf("Goal %q is suspended for job %q.", scienceGoal.Name, scienceGoal.JobID)
+					scienceGoal.Logger().Info("goal is suspended for job", "goal", scienceGoal.Name)
 					cs.updateNodes(NodesToUpdate)
 				}
 			case datatype.EventGoalStatusSubmitted:
+				// held jobs are pushed to nodes when they start
+				if e.GetGoalID() == "" {
+					break
+				}
 				scienceGoal, err := cs.GoalManager.GetScienceGoal(e.GetGoalID())
 				if err != nil {
-					logger.Error.Printf("Failed to get science goal %q", e.GetGoalID())
+					logger.With(logger.FieldJobID, e.GetJobID(), logger.FieldGoalID, e.GetGoalID()).Error("failed to get science goal", "error", err)
 					break
 				}
-				logger.Info.Printf("Goal %q is submitted for job id %q.", scienceGoal.Name, scienceGoal.JobID)
+				scienceGoal.Logger().Info("goal is submitted for job", "goal", scienceGoal.Name)
 				NodesToUpdate := scienceGoal.GetSubjectNodes()
 				cs.updateNodes(NodesToUpdate)
 			}
@@ -0,0 +1,218 @@
+package cloudscheduler
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// newTestCloudScheduler returns a cloud scheduler with its goal manager and API server
+// on a job database in a temporary directory. Name and DataDir of config are filled if empty
+func newTestCloudScheduler(t *testing.T, config *CloudSchedulerConfig) *CloudScheduler {
+	t.Helper()
+	if config == nil {
+		config = &CloudSchedulerConfig{}
+	}
+	if config.Name == "" {
+		config.Name = "test"
+	}
+	if config.DataDir == "" {
+		config.DataDir = t.TempDir()
+	}
+	cs := NewCloudSchedulerBuilder(config).AddGoalManager().AddAPIServer().Build()
+	if err := cs.GoalManager.OpenJobDB(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cs.GoalManager.jobDB.Close() })
+	return cs
+}
+
+func TestGPUMemoryFromProfiles(t *testing.T) {
+	pluginManifest := &datatype.PluginManifest{
+		Profile: []datatype.Profile{
+			{Name: "small", Require: datatype.Resource{GPUMemory: "2000Mi"}},
+			{Name: "large", Require: datatype.Resource{GPUMemory: "4Gi"}},
+		},
+	}
+	tests := map[string]struct {
+		Input *datatype.Plugin
+		Wants string
+	}{
+		"no gpu": {
+			Input: &datatype.Plugin{
+				Name:       "plugin-a",
+				PluginSpec: &datatype.PluginSpec{Image: "plugin-a:0.1.0"},
+			},
+			Wants: "",
+		},
+		"gpu from profile": {
+			Input: &datatype.Plugin{
+				Name: "plugin-b",
+				PluginSpec: &datatype.PluginSpec{
+					Image:    "plugin-b:0.1.0",
+					Selector: map[string]string{"resource.gpu": "true"},
+				},
+			},
+			Wants: "4096Mi",
+		},
+		"gpu declared": {
+			Input: &datatype.Plugin{
+				Name: "plugin-c",
+				PluginSpec: &datatype.PluginSpec{
+					Image:    "plugin-c:0.1.0",
+					Selector: map[string]string{"resource.gpu": "true"},
+					Resource: map[string]string{datatype.ResourceRequestGPUMemory: "1Gi"},
+				},
+			},
+			Wants: "1Gi",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := withGPUMemoryFromProfiles(tc.Input, pluginManifest)
+			if r := p.PluginSpec.GetGPUMemoryRequest(); r != tc.Wants {
+				t.Errorf("expected GPU memory %q, but got %q", tc.Wants, r)
+			}
+			if p != tc.Input && tc.Input.PluginSpec.GetGPUMemoryRequest() != "" {
+				t.Errorf("the original plugin should not be modified")
+			}
+		})
+	}
+}
+
+type fakeDataQuerier []float64
+
+func (f fakeDataQuerier) Query(name string, nodes []string, since time.Time) ([]float64, error) {
+	return f, nil
+}
+
+func TestSuccessCriterionMet(t *testing.T) {
+	job := &datatype.Job{
+		State: datatype.State{
+			LastStarted: datatype.Time{Time: time.Now().Add(-2 * time.Hour)},
+		},
+		ScienceGoal: &datatype.ScienceGoal{
+			SubGoals: []*datatype.SubGoal{{Name: "W023"}, {Name: "W024"}},
+		},
+	}
+	job.RecordPluginSuccess("W023", "plugin-a")
+	job.RecordPluginSuccess("w023", "plugin-a")
+	job.RecordPluginSuccess("W024", "plugin-a")
+	tests := map[string]struct {
+		Criterion string
+		Querier   DataQuerier
+		Wants     bool
+	}{
+		"not enough runs on a node": {Criterion: "runs(plugin-a, 2)", Wants: false},
+		"enough runs on all nodes":  {Criterion: "runs(plugin-a, 1)", Wants: true},
+		"runs of other plugin":      {Criterion: "runs(plugin-b, 1)", Wants: false},
+		"time passed":               {Criterion: "until(2020-01-01)", Wants: true},
+		"time not passed":           {Criterion: "until(2999-01-01)", Wants: false},
+		"ran long enough":           {Criterion: "WallClock(1h)", Wants: true},
+		"not ran long enough":       {Criterion: "WallClock(1d)", Wants: false},
+		"data satisfied":            {Criterion: "data(env.temperature) > 30", Querier: fakeDataQuerier{20, 31}, Wants: true},
+		"data not satisfied":        {Criterion: "data(env.temperature) > 30", Querier: fakeDataQuerier{20, 30}, Wants: false},
+	}
+	for name, test := range tests {
+		cs := &CloudScheduler{dataQuerier: test.Querier}
+		c, err := datatype.NewSuccessCriterion(test.Criterion)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err.Error())
+		}
+		met, err := cs.isSuccessCriterionMet(job, c)
+		if err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+		} else if met != test.Wants {
+			t.Errorf("%s: wanted %v, got %v", name, test.Wants, met)
+		}
+	}
+}
+
+// blockingDataQuerier responds values once released
+type blockingDataQuerier struct {
+	release chan struct{}
+	values  []float64
+}
+
+func (b *blockingDataQuerier) Query(name string, nodes []string, since time.Time) ([]float64, error) {
+	<-b.release
+	return b.values, nil
+}
+
+func TestDataSuccessCriteriaCheckedOffMainLoop(t *testing.T) {
+	cs := newTestCloudScheduler(t, nil)
+	querier := &blockingDataQuerier{release: make(chan struct{}), values: []float64{31}}
+	cs.dataQuerier = querier
+	job := datatype.NewJob("job", "user", "")
+	job.SuccessCriteria = []string{"data(env.temperature) > 30"}
+	job.ScienceGoal = datatype.NewScienceGoalBuilder("job", "").
+		AddSubGoal("W001", []*datatype.Plugin{{Name: "plugin-a"}}, nil).Build()
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	cs.GoalManager.UpdateJob(job, true)
+	<-cs.chanFromGoalManager
+	job.Runs()
+	cs.GoalManager.UpdateJob(job, false)
+
+	// the check returns while the data API does not respond
+	cs.checkSuccessCriteriaOfRunningJobs()
+	go cs.runDataCriteriaChecker()
+	defer close(cs.chanDataCriteriaCheck)
+	close(querier.release)
+	select {
+	case m := <-cs.chanSuccessCriteriaMet:
+		cs.completeJobBySuccessCriterion(m.job, m.criterion)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the data success criterion to be met")
+	}
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if job.State.GetState() != datatype.JobComplete {
+		t.Errorf("wanted job %s, got %s", datatype.JobComplete, job.State.GetState())
+	}
+}
+
+func TestSuccessfulRunsCountedConcurrently(t *testing.T) {
+	cs := newTestCloudScheduler(t, nil)
+	const runs = 20
+	job := datatype.NewJob("job", "user", "")
+	job.SuccessCriteria = []string{"runs(plugin-a, 20)"}
+	job.ScienceGoal = datatype.NewScienceGoalBuilder("job", "").
+		AddSubGoal("W001", []*datatype.Plugin{{Name: "plugin-a"}}, nil).Build()
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	cs.GoalManager.UpdateJob(job, true)
+	<-cs.chanFromGoalManager
+	job.Runs()
+	cs.GoalManager.UpdateJob(job, false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cs.handlePluginEvent(datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusComplete).
+				AddEntry("vsn", "W001").
+				AddEntry("goal_id", job.ScienceGoal.ID).
+				AddEntry("plugin_name", "plugin-a").
+				Build())
+		}()
+	}
+	wg.Wait()
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if n := job.GetSuccessfulRuns("W001", "plugin-a"); n != runs {
+		t.Errorf("wanted %d successful runs, got %d", runs, n)
+	}
+	if job.State.GetState() != datatype.JobComplete {
+		t.Errorf("wanted job %s, got %s", datatype.JobComplete, job.State.GetState())
+	}
+
+	// a job suspended after its criteria were evaluated stays suspended
+	suspended := datatype.NewJob("suspended", "user", "")
+	suspended.UpdateJobID(cs.GoalManager.AddJob(suspended))
+	if err := cs.GoalManager.SuspendJob(suspended.JobID); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.GoalManager.CompleteJob(suspended.JobID, "success criterion is met"); err == nil {
+		t.Errorf("expected a suspended job not to be completed")
+	}
+}
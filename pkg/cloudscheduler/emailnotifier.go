@@ -0,0 +1,347 @@
+package cloudscheduler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+const (
+	// maxEmailAttempts is the number of attempts to send an email before dropping it
+	maxEmailAttempts = 5
+	// emailRetryInterval is the wait before the first retry. It doubles on each retry
+	emailRetryInterval = 30 * time.Second
+	// maxEmailQueueLength is the number of emails kept in the queue. The oldest is dropped when full
+	maxEmailQueueLength = 1000
+)
+
+// SMTPConfig is the SMTP server to send job notifications through
+type SMTPConfig struct {
+	Host     string `json:"host" yaml:"host"`
+	Port     int    `json:"port" yaml:"port"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	From     string `json:"from" yaml:"from"`
+	// MaxEmailsPerHour limits emails sent to a user in an hour. 0 means no limit
+	MaxEmailsPerHour int `json:"max_emails_per_hour" yaml:"maxEmailsPerHour"`
+	// UnsubscribeSecret signs unsubscribe links in emails. A random secret is used if not given,
+	// which invalidates links sent before restart
+	UnsubscribeSecret string `json:"unsubscribe_secret" yaml:"unsubscribeSecret"`
+}
+
+var emailSubjectTemplate = template.Must(template.New("subject").Parse(
+	`[{{.Scheduler}}] Job {{.Job.Name}} ({{.Job.JobID}}) {{.Summary}}`))
+
+var emailBodyTemplate = template.Must(template.New("body").Parse(`Hello {{.Job.User}},
+
+Job {{.Job.Name}} ({{.Job.JobID}}) {{.Summary}} at {{.Time.Format "2006-01-02T15:04:05Z07:00"}}.
+{{- if .Reason}}
+
+Reason: {{.Reason}}
+{{- end}}
+{{- if .StatusURL}}
+
+Status of the job: {{.StatusURL}}
+{{- end}}
+{{- if .UnsubscribeURL}}
+
+To stop receiving emails about this job, visit {{.UnsubscribeURL}}
+{{- end}}
+`))
+
+type emailContext struct {
+	Scheduler      string
+	Job            *datatype.Job
+	Summary        string
+	Reason         string
+	Time           time.Time
+	StatusURL      string
+	UnsubscribeURL string
+}
+
+type email struct {
+	user        string
+	to          string
+	subject     string
+	body        string
+	headers     map[string]string
+	attempts    int
+	nextAttempt time.Time
+}
+
+// EmailNotifier sends emails to owners of jobs on the job states they chose in NotificationOn.
+// Emails failed to send are retried with backoff
+type EmailNotifier struct {
+	name      string
+	config    SMTPConfig
+	publicURL string
+	secret    []byte
+	mu        sync.Mutex
+	queue     []*email
+	sent      map[string][]time.Time
+	wake      chan struct{}
+	now       func() time.Time
+}
+
+func NewEmailNotifier(name string, config SMTPConfig, publicURL string) *EmailNotifier {
+	n := &EmailNotifier{
+		name:      name,
+		config:    config,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		secret:    []byte(config.UnsubscribeSecret),
+		sent:      make(map[string][]time.Time),
+		wake:      make(chan struct{}, 1),
+		now:       time.Now,
+	}
+	if len(n.secret) == 0 {
+		logger.Info.Printf("No unsubscribe secret is given for email notification. Unsubscribe links expire on restart")
+		n.secret = make([]byte, 32)
+		rand.Read(n.secret)
+	}
+	return n
+}
+
+// Notify queues an email for the job if its owner wants to be notified on the notification type
+func (n *EmailNotifier) Notify(job *datatype.Job, on datatype.JobState, reason string) {
+	if job.Email == "" || !wantsNotification(job, on) {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.allow(job.User) {
+		job.Logger().Warn("too many emails to user. dropping notification", "notification", on)
+		return
+	}
+	e, err := n.compose(job, on, reason)
+	if err != nil {
+		job.Logger().Error("failed to compose email", "error", err)
+		return
+	}
+	if len(n.queue) >= maxEmailQueueLength {
+		logger.Error.Printf("Email queue is full. Dropping email to %s", n.queue[0].to)
+		n.queue = n.queue[1:]
+	}
+	n.queue = append(n.queue, e)
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+func wantsNotification(job *datatype.Job, on datatype.JobState) bool {
+	for _, s := range job.NotificationOn {
+		if s == on {
+			return true
+		}
+	}
+	return false
+}
+
+// allow records an email to the user if the user has not reached the limit in the last hour
+func (n *EmailNotifier) allow(user string) bool {
+	if n.config.MaxEmailsPerHour <= 0 {
+		return true
+	}
+	since := n.now().Add(-time.Hour)
+	var recent []time.Time
+	for _, t := range n.sent[user] {
+		if t.After(since) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= n.config.MaxEmailsPerHour {
+		n.sent[user] = recent
+		return false
+	}
+	n.sent[user] = append(recent, n.now())
+	return true
+}
+
+func (n *EmailNotifier) compose(job *datatype.Job, on datatype.JobState, reason string) (*email, error) {
+	c := emailContext{
+		Scheduler: n.name,
+		Job:       job,
+		Reason:    reason,
+		Time:      n.now().UTC(),
+	}
+	if on == datatype.JobFailure {
+		c.Summary = fmt.Sprintf("is %s", job.Health)
+	} else {
+		c.Summary = fmt.Sprintf("is %s", on)
+	}
+	headers := map[string]string{}
+	if n.publicURL != "" {
+		c.StatusURL = fmt.Sprintf("%s%s%s", n.publicURL, API_V1_VERSION, fmt.Sprintf(API_PATH_JOB_STATUS_REGEX, job.JobID))
+		c.UnsubscribeURL = n.UnsubscribeURL(job)
+		headers["List-Unsubscribe"] = fmt.Sprintf("<%s>", c.UnsubscribeURL)
+		// mail clients unsubscribe by POST to the link without confirmation, RFC 8058
+		headers["List-Unsubscribe-Post"] = "List-Unsubscribe=One-Click"
+	}
+	to, err := mail.ParseAddress(job.Email)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email %q: %s", job.Email, err.Error())
+	}
+	var subject, body bytes.Buffer
+	if err := emailSubjectTemplate.Execute(&subject, c); err != nil {
+		return nil, err
+	}
+	// names of jobs come from users and must not add headers to the email
+	if strings.ContainsAny(subject.String(), "\r\n") {
+		return nil, fmt.Errorf("subject of the email must not contain line breaks: %q", subject.String())
+	}
+	if err := emailBodyTemplate.Execute(&body, c); err != nil {
+		return nil, err
+	}
+	return &email{
+		user:        job.User,
+		to:          to.Address,
+		subject:     subject.String(),
+		body:        body.String(),
+		headers:     headers,
+		nextAttempt: n.now(),
+	}, nil
+}
+
+// UnsubscribeToken returns the token that proves the unsubscribe link was sent to the email of the job
+func (n *EmailNotifier) UnsubscribeToken(job *datatype.Job) string {
+	mac := hmac.New(sha256.New, n.secret)
+	mac.Write([]byte(job.JobID + "\n" + job.Email))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsUnsubscribeTokenValid returns true if the token is the one sent to the email of the job
+func (n *EmailNotifier) IsUnsubscribeTokenValid(job *datatype.Job, token string) bool {
+	return hmac.Equal([]byte(n.UnsubscribeToken(job)), []byte(token))
+}
+
+func (n *EmailNotifier) UnsubscribeURL(job *datatype.Job) string {
+	return fmt.Sprintf("%s%s%s?token=%s",
+		n.publicURL,
+		API_V1_VERSION,
+		fmt.Sprintf(API_PATH_JOB_UNSUBSCRIBE_REGEX, url.PathEscape(job.JobID)),
+		n.UnsubscribeToken(job))
+}
+
+// Run sends queued emails and retries failed ones until the program exits
+func (n *EmailNotifier) Run() {
+	logger.Info.Printf("Sending job notifications via SMTP server %s:%d", n.config.Host, n.config.Port)
+	ticker := time.NewTicker(emailRetryInterval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.wake:
+		case <-ticker.C:
+		}
+		n.flush()
+	}
+}
+
+// flush sends emails due. Emails failed to send are put back to the queue for retry
+func (n *EmailNotifier) flush() {
+	n.mu.Lock()
+	now := n.now()
+	var due, pending []*email
+	for _, e := range n.queue {
+		if e.nextAttempt.After(now) {
+			pending = append(pending, e)
+		} else {
+			due = append(due, e)
+		}
+	}
+	n.queue = pending
+	n.mu.Unlock()
+
+	var failed []*email
+	for _, e := range due {
+		if err := n.send(e); err != nil {
+			e.attempts += 1
+			if e.attempts >= maxEmailAttempts {
+				logger.Error.Printf("Failed to send email to %s after %d attempts. Dropping it: %s", e.to, e.attempts, err.Error())
+				continue
+			}
+			e.nextAttempt = now.Add(emailRetryInterval * time.Duration(1<<(e.attempts-1)))
+			logger.Info.Printf("Failed to send email to %s. Retrying at %s: %s", e.to, e.nextAttempt.Format(time.RFC3339), err.Error())
+			failed = append(failed, e)
+			continue
+		}
+		logger.Debug.Printf("Sent email %q to %s", e.subject, e.to)
+	}
+	if len(failed) > 0 {
+		n.mu.Lock()
+		n.queue = append(failed, n.queue...)
+		n.mu.Unlock()
+	}
+}
+
+func (n *EmailNotifier) send(e *email) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", e.to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", e.subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.now().Format(time.RFC1123Z))
+	for k, v := range e.headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", k, v)
+	}
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(e.body, "\n", "\r\n"))
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)
+	}
+	addr := net.JoinHostPort(n.config.Host, strconv.Itoa(n.config.Port))
+	return smtp.SendMail(addr, auth, n.config.From, []string{e.to}, msg.Bytes())
+}
+
+// notifyJobOwner emails the owner of the job about the event if the owner asked for it
+func (cs *CloudScheduler) notifyJobOwner(e datatype.SchedulerEvent) {
+	if cs.emailNotifier == nil {
+		return
+	}
+	var on datatype.JobState
+	switch e.Type {
+	case datatype.EventGoalStatusSubmitted:
+		on = datatype.JobSubmitted
+	case datatype.EventJobStatusRunning:
+		on = datatype.JobRunning
+	case datatype.EventJobStatusSuspended:
+		on = datatype.JobSuspended
+	case datatype.EventJobStatusCompleted:
+		on = datatype.JobComplete
+	case datatype.EventJobStatusRemoved:
+		on = datatype.JobRemoved
+	case datatype.EventJobStatusHealthChanged:
+		// recovery of the job is not a failure
+		switch health, _ := e.GetEntry("health").(string); datatype.JobHealth(health) {
+		case datatype.JobDegraded, datatype.JobFailed:
+			on = datatype.JobFailure
+		default:
+			return
+		}
+	default:
+		return
+	}
+	job, err := cs.GoalManager.GetJob(e.GetJobID())
+	if err != nil {
+		logger.Error.Printf("Failed to get job %q to notify: %s", e.GetJobID(), err.Error())
+		return
+	}
+	reason, _ := e.GetEntry("reason").(string)
+	cs.emailNotifier.Notify(job, on, reason)
+}
@@ -0,0 +1,282 @@
+package cloudscheduler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// fakeSMTPServer accepts emails on a local port. It rejects the first failures emails
+type fakeSMTPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	failures int
+	messages []string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: l}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM"):
+			s.mu.Lock()
+			fail := s.failures > 0
+			if fail {
+				s.failures -= 1
+			}
+			s.mu.Unlock()
+			if fail {
+				reply("451 try again later")
+			} else {
+				reply("250 OK")
+			}
+		case strings.HasPrefix(cmd, "RCPT TO"):
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 end with .")
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.messages...)
+}
+
+func TestEmailNotifier(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	n := NewEmailNotifier("test", SMTPConfig{
+		Host:             "127.0.0.1",
+		Port:             server.port(),
+		From:             "scheduler@example.com",
+		MaxEmailsPerHour: 2,
+	}, "https://scheduler.example.com/")
+	now := time.Now()
+	n.now = func() time.Time { return now }
+
+	job := datatype.NewJob("myjob", "user", "1")
+	job.SetNotification("user@example.com", []datatype.JobState{datatype.JobRunning, datatype.JobFailure})
+
+	// not asked for
+	n.Notify(job, datatype.JobSubmitted, "")
+	if len(n.queue) != 0 {
+		t.Fatalf("expected no email for %s", datatype.JobSubmitted)
+	}
+
+	n.Notify(job, datatype.JobRunning, "W001 received the science goal")
+	n.flush()
+	messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("wanted 1 email, got %d", len(messages))
+	}
+	unsubscribeURL := "https://scheduler.example.com/api/v1/jobs/1/unsubscribe?token=" + n.UnsubscribeToken(job)
+	for _, want := range []string{
+		"To: user@example.com",
+		"Subject: [test] Job myjob (1) is Running",
+		"List-Unsubscribe: <" + unsubscribeURL + ">",
+		"Reason: W001 received the science goal",
+		unsubscribeURL,
+	} {
+		if !strings.Contains(messages[0], want) {
+			t.Errorf("expected %q in email:\n%s", want, messages[0])
+		}
+	}
+
+	// the server rejects the email once. it is retried after the backoff
+	server.mu.Lock()
+	server.failures = 1
+	server.mu.Unlock()
+	job.Health = datatype.JobDegraded
+	n.Notify(job, datatype.JobFailure, "plugin-a failed on W001")
+	n.flush()
+	if len(n.queue) != 1 || n.queue[0].attempts != 1 {
+		t.Fatalf("expected the email queued for retry, got %d in queue", len(n.queue))
+	}
+	n.flush()
+	if got := len(server.received()); got != 1 {
+		t.Errorf("expected no retry before the backoff, got %d emails", got)
+	}
+	now = now.Add(emailRetryInterval)
+	n.flush()
+	messages = server.received()
+	if len(messages) != 2 || !strings.Contains(messages[1], "Subject: [test] Job myjob (1) is Degraded") {
+		t.Fatalf("expected the failure email to be retried, got %d emails", len(messages))
+	}
+
+	// the user reached 2 emails in the hour
+	n.Notify(job, datatype.JobRunning, "")
+	if len(n.queue) != 0 {
+		t.Errorf("expected the email to be rate limited")
+	}
+	now = now.Add(time.Hour)
+	n.Notify(job, datatype.JobRunning, "")
+	if len(n.queue) != 1 {
+		t.Errorf("expected the email queued after an hour")
+	}
+}
+
+func TestEmailNotifierHeaders(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	n := NewEmailNotifier("test", SMTPConfig{
+		Host: "127.0.0.1",
+		Port: server.port(),
+		From: "scheduler@example.com",
+	}, "")
+
+	// a job name must not add headers
+	job := datatype.NewJob("myjob\r\nBcc: someone@example.com", "user", "1")
+	job.SetNotification("user@example.com", []datatype.JobState{datatype.JobRunning})
+	n.Notify(job, datatype.JobRunning, "")
+	if len(n.queue) != 0 {
+		t.Fatalf("expected no email for a subject with line breaks")
+	}
+
+	job = datatype.NewJob("myjob", "user", "2")
+	job.SetNotification("user@example.com\r\nBcc: someone@example.com", []datatype.JobState{datatype.JobRunning})
+	n.Notify(job, datatype.JobRunning, "")
+	if len(n.queue) != 0 {
+		t.Fatalf("expected no email to an invalid address")
+	}
+
+	job = datatype.NewJob("météo", "user", "3")
+	job.SetNotification("user@example.com", []datatype.JobState{datatype.JobRunning})
+	n.Notify(job, datatype.JobRunning, "")
+	n.flush()
+	messages := server.received()
+	if len(messages) != 1 || !strings.Contains(messages[0], "Subject: =?utf-8?q?[test]_Job_m=C3=A9t=C3=A9o_(3)_is_Running?=") {
+		t.Errorf("expected the subject encoded, got %v", messages)
+	}
+}
+
+func TestValidateJobEmail(t *testing.T) {
+	cs := newTestCloudScheduler(t, nil)
+	user := &User{Auth: &UserAuth{UserName: "user"}}
+	for email, valid := range map[string]bool{
+		"user@example.com":                             true,
+		"User <user@example.com>":                      false,
+		"user@example.com\r\nBcc: someone@example.com": false,
+		"not an email":                                 false,
+	} {
+		job := datatype.NewJob("myjob", "user", "1")
+		job.Nodes["W001"] = true
+		job.SetNotification(email, []datatype.JobState{datatype.JobRunning})
+		_, errorList := cs.ValidateJobAndCreateScienceGoal(job, user)
+		invalid := false
+		for _, err := range errorList {
+			if strings.Contains(err.Error(), "not a valid address") {
+				invalid = true
+			}
+		}
+		if invalid == valid {
+			t.Errorf("%q: expected valid to be %v, got errors %v", email, valid, errorList)
+		}
+	}
+}
+
+func TestHandlerJobUnsubscribe(t *testing.T) {
+	cs := newTestCloudScheduler(t, &CloudSchedulerConfig{
+		SMTP:      SMTPConfig{Host: "127.0.0.1", Port: 25, UnsubscribeSecret: "secret"},
+		PublicURL: "https://scheduler.example.com",
+	})
+	job := datatype.NewJob("myjob", "user", "")
+	job.SetNotification("user@example.com", []datatype.JobState{datatype.JobRunning})
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+
+	unsubscribe := func(method string, token string) (int, string) {
+		r := httptest.NewRequest(method, "/api/v1/jobs/"+job.JobID+"/unsubscribe?token="+token, nil)
+		r = mux.SetURLVars(r, map[string]string{"id": job.JobID})
+		w := httptest.NewRecorder()
+		cs.APIServer.handlerJobUnsubscribe(w, r)
+		return w.Code, w.Body.String()
+	}
+	token := cs.emailNotifier.UnsubscribeToken(job)
+	if code, _ := unsubscribe(http.MethodPost, "invalid"); code != http.StatusUnauthorized {
+		t.Errorf("wanted %d for an invalid token, got %d", http.StatusUnauthorized, code)
+	}
+	// opening the link only asks to confirm
+	code, body := unsubscribe(http.MethodGet, token)
+	if code != http.StatusOK || !strings.Contains(body, `<form method="post">`) {
+		t.Fatalf("wanted a confirmation form, got %d %s", code, body)
+	}
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if len(job.NotificationOn) == 0 {
+		t.Fatal("expected notification to stay until unsubscribe is confirmed")
+	}
+	// the confirmation form posts the token in the body
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/jobs/"+job.JobID+"/unsubscribe", strings.NewReader("token="+token))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r = mux.SetURLVars(r, map[string]string{"id": job.JobID})
+	w := httptest.NewRecorder()
+	cs.APIServer.handlerJobUnsubscribe(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("wanted %d, got %d", http.StatusOK, w.Code)
+	}
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if len(job.NotificationOn) != 0 {
+		t.Errorf("expected no notification after unsubscribe, got %v", job.NotificationOn)
+	}
+	if !strings.HasSuffix(cs.emailNotifier.UnsubscribeURL(job), "/jobs/"+job.JobID+"/unsubscribe?token="+cs.emailNotifier.UnsubscribeToken(job)) {
+		t.Errorf("unexpected unsubscribe URL %s", cs.emailNotifier.UnsubscribeURL(job))
+	}
+}
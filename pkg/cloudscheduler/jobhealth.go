@@ -0,0 +1,117 @@
+package cloudscheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+// maxErrorLogLength is the length of the end of error logs kept in plugin failures
+const maxErrorLogLength = 2048
+
+const pluginStatusEventPrefix = "sys.scheduler.status.plugin."
+
+// handlePluginEvent records the plugin state reported by the event in its job. For finished runs,
+// it updates health of the job and checks success criteria of the job
+func (cs *CloudScheduler) handlePluginEvent(e datatype.SchedulerEvent) {
+	sender, _ := e.GetEntry("vsn").(string)
+	goalID, _ := e.GetEntry("goal_id").(string)
+	pluginName, _ := e.GetEntry("plugin_name").(string)
+	if sender == "" || goalID == "" || pluginName == "" {
+		return
+	}
+	scienceGoal, err := cs.GoalManager.GetScienceGoal(goalID)
+	if err != nil {
+		// the goal may have been withdrawn while the plugin was running
+		logger.With(logger.FieldNode, sender, logger.FieldGoalID, goalID).Debug("no science goal found for plugin run")
+		return
+	}
+	running, healthChanged := false, false
+	job, err := cs.GoalManager.ModifyJob(scienceGoal.JobID, func(job *datatype.Job) bool {
+		if running = job.State.GetState() == datatype.JobRunning; !running {
+			return false
+		}
+		job.RecordPluginState(sender, pluginName, pluginStateFromEvent(e.Type), eventTime(e))
+		switch e.Type {
+		case datatype.EventPluginStatusComplete:
+			job.RecordPluginSuccess(sender, pluginName)
+		case datatype.EventPluginStatusFailed:
+			job.RecordPluginFailure(sender, pluginName, pluginFailureFromEvent(e))
+		}
+		health := cs.Config.JobHealthRule.Evaluate(job.PluginStats)
+		healthChanged = health != job.Health
+		job.Health = health
+		return true
+	})
+	if err != nil {
+		scienceGoal.Logger().Error("failed to update plugin stats of job", "error", err)
+		return
+	}
+	if !running {
+		return
+	}
+	if healthChanged {
+		job.Logger().Warn("health of job changed", "health", job.Health, logger.FieldNode, sender, logger.FieldPlugin, pluginName)
+		event := datatype.NewSchedulerEventBuilder(datatype.EventJobStatusHealthChanged).
+			AddJob(job).
+			AddEntry("health", string(job.Health)).
+			AddReason(fmt.Sprintf("plugin %s %s on %s", pluginName, pluginOutcome(e.Type), sender)).
+			Build()
+		cs.GoalManager.Notifier.Notify(event)
+	}
+	if e.Type == datatype.EventPluginStatusComplete && len(job.SuccessCriteria) > 0 {
+		cs.checkSuccessCriteria(job)
+	}
+}
+
+func pluginOutcome(t datatype.EventType) string {
+	if t == datatype.EventPluginStatusFailed {
+		return "failed"
+	}
+	return "succeeded"
+}
+
+// pluginStateFromEvent returns the plugin state of an event type, e.g. running
+// for sys.scheduler.status.plugin.running
+func pluginStateFromEvent(t datatype.EventType) string {
+	return strings.TrimPrefix(string(t), pluginStatusEventPrefix)
+}
+
+// eventTime returns the time the event occurred on the node
+func eventTime(e datatype.SchedulerEvent) time.Time {
+	if e.Timestamp > 0 {
+		return time.Unix(0, e.Timestamp)
+	}
+	return time.Now()
+}
+
+// pluginFailureFromEvent returns the failure reported by a plugin failed event
+func pluginFailureFromEvent(e datatype.SchedulerEvent) datatype.PluginFailure {
+	failure := datatype.PluginFailure{
+		Time: datatype.Time{Time: eventTime(e)},
+	}
+	failure.Reason, _ = e.GetEntry("reason").(string)
+	if message, _ := e.GetEntry("message").(string); message != "" {
+		failure.Reason = fmt.Sprintf("%s: %s", failure.Reason, message)
+	}
+	// numbers in events from nodes are decoded from JSON
+	switch v := e.GetEntry("return_code").(type) {
+	case float64:
+		code := int(v)
+		failure.ReturnCode = &code
+	case int32:
+		code := int(v)
+		failure.ReturnCode = &code
+	case int:
+		failure.ReturnCode = &v
+	}
+	if errorLog, _ := e.GetEntry("error_log").(string); len(errorLog) > maxErrorLogLength {
+		failure.ErrorLog = errorLog[len(errorLog)-maxErrorLogLength:]
+	} else {
+		failure.ErrorLog = errorLog
+	}
+	return failure
+}
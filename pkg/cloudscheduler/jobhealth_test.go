@@ -0,0 +1,107 @@
+package cloudscheduler
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestHandlePluginEvent(t *testing.T) {
+	cs := newTestCloudScheduler(t, &CloudSchedulerConfig{
+		JobHealthRule: datatype.JobHealthRule{ConsecutiveFailures: 1, FailedRatio: 1},
+	})
+	job := datatype.NewJob("job", "user", "")
+	job.ScienceGoal = datatype.NewScienceGoalBuilder("job", "").
+		AddSubGoal("W001", nil, nil).
+		AddSubGoal("W002", nil, nil).Build()
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	cs.GoalManager.UpdateJob(job, true)
+	<-cs.chanFromGoalManager
+	job.Runs()
+	cs.GoalManager.UpdateJob(job, false)
+
+	pluginEvent := func(eventType datatype.EventType, nodeName string) datatype.SchedulerEvent {
+		return datatype.NewSchedulerEventBuilder(eventType).
+			AddEntry("vsn", nodeName).
+			AddEntry("goal_id", job.ScienceGoal.ID).
+			AddEntry("plugin_name", "plugin-a").
+			AddReason("Error").
+			AddEntry("return_code", float64(1)).
+			AddEntry("error_log", "Traceback").
+			Build()
+	}
+	cs.handlePluginEvent(pluginEvent(datatype.EventPluginStatusComplete, "W001"))
+	cs.handlePluginEvent(pluginEvent(datatype.EventPluginStatusFailed, "W002"))
+	e := (<-cs.chanFromGoalManager).(datatype.SchedulerEvent)
+	if e.Type != datatype.EventJobStatusHealthChanged || e.GetEntry("health") != string(datatype.JobHealthy) {
+		t.Errorf("wanted the job to become healthy, got %s %v", e.Type, e.GetEntry("health"))
+	}
+	e = (<-cs.chanFromGoalManager).(datatype.SchedulerEvent)
+	if e.GetEntry("health") != string(datatype.JobDegraded) {
+		t.Errorf("wanted the job to be degraded, got %v", e.GetEntry("health"))
+	}
+	cs.handlePluginEvent(pluginEvent(datatype.EventPluginStatusFailed, "W001"))
+	e = (<-cs.chanFromGoalManager).(datatype.SchedulerEvent)
+	if e.GetEntry("health") != string(datatype.JobFailed) {
+		t.Errorf("wanted the job to be failed, got %v", e.GetEntry("health"))
+	}
+
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if job.Health != datatype.JobFailed {
+		t.Errorf("wanted job health %s, got %q", datatype.JobFailed, job.Health)
+	}
+	failures := job.PluginStats["W002"]["plugin-a"].RecentFailures
+	if len(failures) != 1 || failures[0].Reason != "Error" || *failures[0].ReturnCode != 1 || failures[0].ErrorLog != "Traceback" {
+		t.Errorf("unexpected failures %+v", failures)
+	}
+}
+
+func TestHandlePluginFailuresConcurrently(t *testing.T) {
+	cs := newTestCloudScheduler(t, &CloudSchedulerConfig{
+		JobHealthRule: datatype.JobHealthRule{ConsecutiveFailures: 3, FailedRatio: 1},
+	})
+	job := datatype.NewJob("job", "user", "")
+	job.ScienceGoal = datatype.NewScienceGoalBuilder("job", "").
+		AddSubGoal("W001", nil, nil).
+		AddSubGoal("W002", nil, nil).Build()
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	cs.GoalManager.UpdateJob(job, true)
+	<-cs.chanFromGoalManager
+	job.Runs()
+	cs.GoalManager.UpdateJob(job, false)
+
+	pluginEvent := func(eventType datatype.EventType, nodeName string) datatype.SchedulerEvent {
+		return datatype.NewSchedulerEventBuilder(eventType).
+			AddEntry("vsn", nodeName).
+			AddEntry("goal_id", job.ScienceGoal.ID).
+			AddEntry("plugin_name", "plugin-a").
+			AddReason("Error").
+			Build()
+	}
+	cs.handlePluginEvent(pluginEvent(datatype.EventPluginStatusComplete, "W002"))
+	<-cs.chanFromGoalManager
+
+	// failures reported at the same time are all recorded and the job becomes degraded once
+	const failures = 10
+	var wg sync.WaitGroup
+	for i := 0; i < failures; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cs.handlePluginEvent(pluginEvent(datatype.EventPluginStatusFailed, "W001"))
+		}()
+	}
+	wg.Wait()
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	stats := job.PluginStats["W001"]["plugin-a"]
+	if stats.Failures != failures || stats.ConsecutiveFailures != failures {
+		t.Errorf("wanted %d failures in a row, got %d failures and %d in a row", failures, stats.Failures, stats.ConsecutiveFailures)
+	}
+	if job.Health != datatype.JobDegraded {
+		t.Errorf("wanted job health %s, got %q", datatype.JobDegraded, job.Health)
+	}
+	if n := len(cs.chanFromGoalManager); n != 1 {
+		t.Errorf("wanted 1 health change, got %d events", n)
+	}
+}
@@ -0,0 +1,52 @@
+package cloudscheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// jobWindowCheckInterval is the interval to check start and end times of jobs
+const jobWindowCheckInterval = 10 * time.Second
+
+// checkJobWindows pushes goals of submitted jobs reaching their start time to nodes and
+// completes jobs reaching their end time. The times are kept in the job DB, so that
+// jobs start and end as planned after a restart of the scheduler
+func (cs *CloudScheduler) checkJobWindows() {
+	now := time.Now()
+	for _, job := range cs.GoalManager.GetJobs("") {
+		switch job.State.GetState() {
+		case datatype.JobSubmitted, datatype.JobRunning:
+		default:
+			continue
+		}
+		if job.HasEnded(now) {
+			job.Logger().Info("job reached its end time", "end_time", job.GetEndTime().Format(time.RFC3339))
+			if err := cs.GoalManager.CompleteJob(job.JobID, fmt.Sprintf("end time %s reached", job.GetEndTime().Format(time.RFC3339))); err != nil {
+				job.Logger().Error("failed to complete job", "error", err)
+			}
+			continue
+		}
+		if job.IsHeld(now) || job.ScienceGoal == nil {
+			continue
+		}
+		// goals of jobs not held are loaded already
+		if _, err := cs.GoalManager.GetScienceGoal(job.ScienceGoal.ID); err == nil {
+			continue
+		}
+		cs.startJob(job)
+	}
+}
+
+// startJob loads the goal of a held job and pushes it to the nodes
+func (cs *CloudScheduler) startJob(job *datatype.Job) {
+	if err := cs.GoalManager.UpdateScienceGoal(job.ScienceGoal); err != nil {
+		job.Logger().Error("failed to load goal of job at its start time", "error", err)
+		return
+	}
+	job.ScienceGoal.Logger().Info("job reached its start time. pushing goal to nodes", "start_time", job.StartTime.Format(time.RFC3339))
+	if cs.APIServer != nil {
+		cs.updateNodes(job.ScienceGoal.GetSubjectNodes())
+	}
+}
@@ -0,0 +1,55 @@
+package cloudscheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestCheckJobWindows(t *testing.T) {
+	cs := newTestCloudScheduler(t, nil)
+	job := datatype.NewJob("campaign", "user", "")
+	job.StartTime.Time = time.Now().Add(time.Hour)
+	job.Duration = "1h"
+	job.ScienceGoal = datatype.NewScienceGoalBuilder("campaign", "").
+		AddSubGoal("W001", []*datatype.Plugin{{Name: "plugin-a"}}, nil).Build()
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	cs.GoalManager.UpdateJob(job, true)
+	<-cs.chanFromGoalManager
+
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if job.State.GetState() != datatype.JobSubmitted {
+		t.Errorf("wanted job %s, got %s", datatype.JobSubmitted, job.State.GetState())
+	}
+	if _, err := cs.GoalManager.GetScienceGoal(job.ScienceGoal.ID); err == nil {
+		t.Error("expected the goal held until the start time")
+	}
+	// a restart does not load the goal either
+	cs.GoalManager.LoadScienceGoalsFromJobDB()
+	cs.checkJobWindows()
+	if _, err := cs.GoalManager.GetScienceGoal(job.ScienceGoal.ID); err == nil {
+		t.Error("expected the goal held until the start time after restart")
+	}
+
+	// the start time comes
+	job.StartTime.Time = time.Now().Add(-time.Minute)
+	cs.GoalManager.UpdateJob(job, false)
+	cs.checkJobWindows()
+	if _, err := cs.GoalManager.GetScienceGoal(job.ScienceGoal.ID); err != nil {
+		t.Errorf("expected the goal loaded at the start time: %s", err.Error())
+	}
+
+	// the end time passes
+	job.StartTime.Time = time.Now().Add(-2 * time.Hour)
+	cs.GoalManager.UpdateJob(job, false)
+	cs.checkJobWindows()
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if job.State.GetState() != datatype.JobComplete {
+		t.Errorf("wanted job %s after its end time, got %s", datatype.JobComplete, job.State.GetState())
+	}
+	e := (<-cs.chanFromGoalManager).(datatype.SchedulerEvent)
+	if e.Type != datatype.EventJobStatusCompleted || e.GetGoalID() != job.ScienceGoal.ID {
+		t.Errorf("wanted event %s for the goal, got %s", datatype.EventJobStatusCompleted, e.Type)
+	}
+}
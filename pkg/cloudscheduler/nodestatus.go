@@ -0,0 +1,64 @@
+package cloudscheduler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+// goalStateFromEvent returns the state of the goal on the node reported by the event
+func goalStateFromEvent(t datatype.EventType) (datatype.GoalState, bool) {
+	switch t {
+	case datatype.EventGoalStatusReceived, datatype.EventGoalStatusUpdated:
+		return datatype.GoalReceived, true
+	case datatype.EventGoalStatusImagePulling:
+		return datatype.GoalPullingImages, true
+	case datatype.EventGoalStatusImagePullFailed:
+		return datatype.GoalImagePullFailed, true
+	case datatype.EventGoalStatusReady:
+		return datatype.GoalReady, true
+	default:
+		return "", false
+	}
+}
+
+// handleGoalEvent records the state of the science goal reported by the node in its job.
+// The job starts running when a node acknowledges the goal
+func (cs *CloudScheduler) handleGoalEvent(e datatype.SchedulerEvent, state datatype.GoalState) {
+	sender, _ := e.GetEntry("vsn").(string)
+	goalID, _ := e.GetEntry("goal_id").(string)
+	logger.With(logger.FieldNode, sender, logger.FieldGoalID, goalID).Debug("node reported science goal", "state", state)
+	scienceGoal, err := cs.GoalManager.GetScienceGoal(goalID)
+	if err != nil {
+		logger.Error.Printf("Failed to find science goal %s", goalID)
+		return
+	}
+	started := false
+	job, err := cs.GoalManager.ModifyJob(scienceGoal.JobID, func(job *datatype.Job) bool {
+		if state == datatype.GoalReceived {
+			started = job.State.GetState() != datatype.JobRunning
+			job.Runs()
+		} else if s, exist := job.GoalStatus[strings.ToUpper(sender)]; exist && s.GoalID == goalID && s.State == state {
+			// progress of the same state, e.g. pulling images, is not recorded
+			return false
+		}
+		if sender != "" {
+			job.RecordGoalState(sender, goalID, state, eventTime(e))
+		}
+		return true
+	})
+	if err != nil {
+		scienceGoal.Logger().Error("failed to update status of job", "error", err)
+		return
+	}
+	if started {
+		event := datatype.NewSchedulerEventBuilder(datatype.EventJobStatusRunning).
+			AddJob(job).
+			AddGoal(scienceGoal).
+			AddReason(fmt.Sprintf("%s received the science goal", sender)).
+			Build()
+		cs.GoalManager.Notifier.Notify(event)
+	}
+}
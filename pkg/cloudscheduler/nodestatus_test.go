@@ -0,0 +1,130 @@
+package cloudscheduler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestHandleGoalEvent(t *testing.T) {
+	cs := newTestCloudScheduler(t, nil)
+	job := datatype.NewJob("job", "user", "")
+	job.ScienceGoal = datatype.NewScienceGoalBuilder("job", "").
+		AddSubGoal("W001", []*datatype.Plugin{{Name: "plugin-a"}}, nil).
+		AddSubGoal("W002", []*datatype.Plugin{{Name: "plugin-a"}}, nil).Build()
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	cs.GoalManager.UpdateJob(job, true)
+	<-cs.chanFromGoalManager
+
+	goalEvent := func(eventType datatype.EventType, nodeName string) datatype.SchedulerEvent {
+		return datatype.NewSchedulerEventBuilder(eventType).
+			AddGoal(job.ScienceGoal).
+			AddEntry("vsn", nodeName).
+			Build()
+	}
+	for _, eventType := range []datatype.EventType{
+		datatype.EventGoalStatusReceived,
+		datatype.EventGoalStatusImagePulling,
+		datatype.EventGoalStatusImagePulling,
+		datatype.EventGoalStatusReady,
+	} {
+		state, found := goalStateFromEvent(eventType)
+		if !found {
+			t.Fatalf("no goal state for %s", eventType)
+		}
+		cs.handleGoalEvent(goalEvent(eventType, "W001"), state)
+	}
+	cs.handlePluginEvent(datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusRunning).
+		AddEntry("vsn", "W001").
+		AddEntry("goal_id", job.ScienceGoal.ID).
+		AddEntry("plugin_name", "plugin-a").
+		Build())
+
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if job.State.GetState() != datatype.JobRunning {
+		t.Errorf("wanted job %s after acknowledgement, got %s", datatype.JobRunning, job.State.GetState())
+	}
+	status := job.GetNodeStatus()
+	if s := status["W001"]; s.GoalState != datatype.GoalReady || s.LastAcknowledged.IsZero() {
+		t.Errorf("wanted goal %s acknowledged on W001, got %+v", datatype.GoalReady, s)
+	}
+	if p := status["W001"].Plugins["plugin-a"]; p.LastState != "running" || p.LastRun.IsZero() {
+		t.Errorf("wanted plugin-a running on W001, got %+v", p)
+	}
+	if s := status["W002"]; s.GoalState != datatype.GoalPending {
+		t.Errorf("wanted goal %s on W002, got %s", datatype.GoalPending, s.GoalState)
+	}
+}
+
+func TestHandleNodeEventsConcurrently(t *testing.T) {
+	cs := newTestCloudScheduler(t, nil)
+	nodes := []string{"W001", "W002", "W003", "W004", "W005", "W006", "W007", "W008"}
+	b := datatype.NewScienceGoalBuilder("job", "")
+	for _, n := range nodes {
+		b = b.AddSubGoal(n, []*datatype.Plugin{{Name: "plugin-a"}}, nil)
+	}
+	job := datatype.NewJob("job", "user", "")
+	job.ScienceGoal = b.Build()
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	cs.GoalManager.UpdateJob(job, true)
+	<-cs.chanFromGoalManager
+
+	// events from nodes are recorded without overwriting each other
+	var wg sync.WaitGroup
+	for _, n := range nodes {
+		wg.Add(1)
+		go func(nodeName string) {
+			defer wg.Done()
+			cs.handleGoalEvent(datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusReceived).
+				AddGoal(job.ScienceGoal).
+				AddEntry("vsn", nodeName).
+				Build(), datatype.GoalReceived)
+			cs.handlePluginEvent(datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusRunning).
+				AddEntry("vsn", nodeName).
+				AddEntry("goal_id", job.ScienceGoal.ID).
+				AddEntry("plugin_name", "plugin-a").
+				Build())
+		}(n)
+	}
+	wg.Wait()
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	status := job.GetNodeStatus()
+	for _, n := range nodes {
+		if s := status[n]; s.GoalState != datatype.GoalReceived || s.Plugins["plugin-a"] == nil || s.Plugins["plugin-a"].LastState != "running" {
+			t.Errorf("wanted goal received and plugin-a running on %s, got %+v", n, s)
+		}
+	}
+}
+
+func TestHandlerJobNodes(t *testing.T) {
+	cs := newTestCloudScheduler(t, nil)
+	cs.APIServer.authenticator = &userAuthenticator{}
+	job := datatype.NewJob("job", "alice", "")
+	job.ScienceGoal = datatype.NewScienceGoalBuilder("job", "").
+		AddSubGoal("W001", []*datatype.Plugin{{Name: "plugin-a"}}, nil).Build()
+	job.RecordPluginFailure("W001", "plugin-a", datatype.PluginFailure{Reason: "failed", ErrorLog: "secret"})
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	request := func(userName string) (int, string) {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+job.JobID+"/nodes", nil)
+		if userName != "" {
+			r.Header.Set("Authorization", "Sage "+userName)
+		}
+		r = mux.SetURLVars(r, map[string]string{"id": job.JobID})
+		w := httptest.NewRecorder()
+		cs.APIServer.handlerJobNodes(w, r)
+		return w.Code, w.Body.String()
+	}
+	for _, userName := range []string{"", "bob"} {
+		if code, body := request(userName); code == http.StatusOK || strings.Contains(body, "secret") {
+			t.Errorf("expected user %q not to see the node status, got %d %s", userName, code, body)
+		}
+	}
+	if code, body := request("alice"); code != http.StatusOK || !strings.Contains(body, "secret") {
+		t.Errorf("expected the owner to see the node status, got %d %s", code, body)
+	}
+}
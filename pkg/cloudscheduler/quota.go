@@ -0,0 +1,193 @@
+package cloudscheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+const (
+	quotaBucketName = "quotas"
+	quotaConfigKey  = "config"
+)
+
+// GetQuotaConfig returns quotas edited through the management API. found is false
+// if quotas have never been edited
+func (cgm *CloudGoalManager) GetQuotaConfig() (config *datatype.QuotaConfig, found bool, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(quotaBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", quotaBucketName)
+		}
+		v := b.Get([]byte(quotaConfigKey))
+		if v == nil {
+			return nil
+		}
+		config, found = &datatype.QuotaConfig{}, true
+		return json.Unmarshal(v, config)
+	})
+	return
+}
+
+func (cgm *CloudGoalManager) SetQuotaConfig(config *datatype.QuotaConfig) error {
+	return cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(quotaBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", quotaBucketName)
+		}
+		buf, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(quotaConfigKey), buf)
+	})
+}
+
+// GetQuotaConfig returns quotas stored in the job database, or quotas
+// of the cloud scheduler configuration if none is stored
+func (cs *CloudScheduler) GetQuotaConfig() (*datatype.QuotaConfig, error) {
+	if cs.GoalManager != nil {
+		config, found, err := cs.GoalManager.GetQuotaConfig()
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return config, nil
+		}
+	}
+	if cs.Config == nil {
+		return &datatype.QuotaConfig{}, nil
+	}
+	return &cs.Config.Quota, nil
+}
+
+// GetQuotaUsage returns usage of active jobs of the user. The job with exceptJobID is not counted
+func (cs *CloudScheduler) GetQuotaUsage(userName string, exceptJobID string, config *datatype.QuotaConfig) *datatype.QuotaUsage {
+	usage := datatype.NewQuotaUsage(userName)
+	if cs.GoalManager == nil {
+		return usage
+	}
+	pluginRuntime, _ := config.GetEstimatedPluginRuntime()
+	for _, job := range cs.GoalManager.GetJobs(userName) {
+		if job.JobID == exceptJobID || !job.IsActive() {
+			continue
+		}
+		usage.Add(job, pluginRuntime)
+	}
+	return usage
+}
+
+// GetGroupQuotaUsage returns usage of active jobs of all members of the group.
+// The job with exceptJobID is not counted
+func (cs *CloudScheduler) GetGroupQuotaUsage(groupName string, exceptJobID string, config *datatype.QuotaConfig) *datatype.QuotaUsage {
+	usage := datatype.NewQuotaUsage("")
+	usage.Group = groupName
+	if cs.GoalManager == nil {
+		return usage
+	}
+	members := map[string]bool{}
+	for _, member := range config.Groups[groupName].Members {
+		members[member] = true
+	}
+	pluginRuntime, _ := config.GetEstimatedPluginRuntime()
+	for _, job := range cs.GoalManager.GetJobs("") {
+		if job.JobID == exceptJobID || !job.IsActive() || !members[job.User] {
+			continue
+		}
+		usage.Add(job, pluginRuntime)
+	}
+	return usage
+}
+
+// GetQuotaUsers returns users who have active jobs or a quota of their own
+func (cs *CloudScheduler) GetQuotaUsers(config *datatype.QuotaConfig) (users []string) {
+	found := map[string]bool{}
+	for userName := range config.Users {
+		found[userName] = true
+	}
+	if cs.GoalManager != nil {
+		for _, job := range cs.GoalManager.GetJobs("") {
+			if job.IsActive() {
+				found[job.User] = true
+			}
+		}
+	}
+	for userName := range found {
+		users = append(users, userName)
+	}
+	sort.Strings(users)
+	return
+}
+
+// validateQuota returns errors if running the job would exceed the quota of the owner of the job.
+// Quotas of groups are shared by their members. If the owner is in multiple groups, the job is
+// accepted if any of the groups has room for it. Jobs submitted by super users are not limited
+func (cs *CloudScheduler) validateQuota(job *datatype.Job, user *User) (errorList []error) {
+	if user.Auth != nil && user.Auth.IsSuperUser {
+		return
+	}
+	config, err := cs.GetQuotaConfig()
+	if err != nil {
+		return []error{fmt.Errorf("failed to get quotas: %s", err.Error())}
+	}
+	userName := job.User
+	if userName == "" {
+		userName = user.GetUserName()
+	}
+	pluginRuntime, err := config.GetEstimatedPluginRuntime()
+	if err != nil {
+		return []error{err}
+	}
+	if _, found := config.Users[userName]; !found {
+		if groups := config.GetGroups(userName); len(groups) > 0 {
+			for _, groupName := range groups {
+				usage := cs.GetGroupQuotaUsage(groupName, job.JobID, config)
+				errs := checkQuota(job, config.Groups[groupName].Quota, "group "+groupName, usage, pluginRuntime)
+				if len(errs) == 0 {
+					return nil
+				}
+				errorList = append(errorList, errs...)
+			}
+			return
+		}
+	}
+	usage := cs.GetQuotaUsage(userName, job.JobID, config)
+	return checkQuota(job, config.GetQuota(userName), "user "+userName, usage, pluginRuntime)
+}
+
+// checkQuota returns errors if the job added to the usage exceeds the quota. subject names
+// whose quota it is in the errors, e.g. user alice or group students
+func checkQuota(job *datatype.Job, quota datatype.Quota, subject string, usage *datatype.QuotaUsage, pluginRuntime time.Duration) (errorList []error) {
+	maxRuntime, err := quota.GetMaxRuntimePerNodePerDay()
+	if err != nil {
+		return []error{err}
+	}
+	if quota.MaxActiveJobs > 0 && usage.ActiveJobs+1 > quota.MaxActiveJobs {
+		errorList = append(errorList, fmt.Errorf("quota exceeded: %s already has %d active jobs and is allowed %d", subject, usage.ActiveJobs, quota.MaxActiveJobs))
+	}
+	if quota.MaxNodesPerJob > 0 && len(job.Nodes) > quota.MaxNodesPerJob {
+		errorList = append(errorList, fmt.Errorf("quota exceeded: the job selects %d nodes and %s is allowed %d nodes per job", len(job.Nodes), subject, quota.MaxNodesPerJob))
+	}
+	if gpuPlugins := job.GetNumberOfGPUPlugins() * len(job.Nodes); quota.MaxGPUPlugins > 0 && gpuPlugins > 0 && usage.GPUPlugins+gpuPlugins > quota.MaxGPUPlugins {
+		errorList = append(errorList, fmt.Errorf("quota exceeded: the job runs %d GPU plugins across nodes and %s already runs %d out of %d allowed", gpuPlugins, subject, usage.GPUPlugins, quota.MaxGPUPlugins))
+	}
+	var nodeNames []string
+	for nodeName := range job.Nodes {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+	runtime := job.EstimateRuntimePerDay(pluginRuntime)
+	for _, nodeName := range nodeNames {
+		if plugins := usage.PluginsPerNode[nodeName] + len(job.Plugins); quota.MaxPluginsPerNode > 0 && plugins > quota.MaxPluginsPerNode {
+			errorList = append(errorList, fmt.Errorf("quota exceeded: %s would run %d plugins on %s and is allowed %d per node", subject, plugins, nodeName, quota.MaxPluginsPerNode))
+		}
+		if total := usage.RuntimePerNodePerDay[nodeName] + runtime; maxRuntime > 0 && total > maxRuntime {
+			errorList = append(errorList, fmt.Errorf("quota exceeded: plugins of %s would run an estimated %s a day on %s and are allowed %s", subject, total, nodeName, maxRuntime))
+		}
+	}
+	return
+}
@@ -0,0 +1,150 @@
+package cloudscheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestValidateQuota(t *testing.T) {
+	cs := newTestCloudScheduler(t, &CloudSchedulerConfig{
+		Quota: datatype.QuotaConfig{
+			Default: datatype.Quota{MaxActiveJobs: 1, MaxNodesPerJob: 1, MaxRuntimePerNodePerDay: "3h"},
+		},
+	})
+	for _, n := range []string{"W001", "W002"} {
+		cs.Validator.Nodes[n] = datatype.NodeManifest{Name: n, VSN: n}
+	}
+	cs.Validator.PluginsWhitelist["plugin-a:0.1.0"] = true
+	user := &User{
+		Auth: &UserAuth{UserName: "user"},
+		NodePermission: &UserPermissionTable{
+			table: map[string]bool{"W001": true, "W002": true},
+		},
+	}
+	newJob := func(nodes ...string) *datatype.Job {
+		job := datatype.NewJob("job", "user", "")
+		job.Plugins = []*datatype.Plugin{{Name: "plugin-a", PluginSpec: &datatype.PluginSpec{Image: "plugin-a:0.1.0"}}}
+		job.ScienceRules = []string{`schedule(plugin-a): cronjob("plugin-a", "0 */2 * * *")`}
+		for _, n := range nodes {
+			job.Nodes[n] = true
+		}
+		job.UpdateJobID(cs.GoalManager.AddJob(job))
+		return job
+	}
+	job := newJob("W001")
+	sg, errorList := cs.ValidateJobAndCreateScienceGoal(job, user)
+	if len(errorList) > 0 {
+		t.Fatalf("failed to validate job: %v", errorList)
+	}
+	job.ScienceGoal = sg
+	cs.GoalManager.UpdateJob(job, true)
+	// the job itself is not counted when resubmitted
+	if _, errorList := cs.ValidateJobAndCreateScienceGoal(job, user); len(errorList) > 0 {
+		t.Errorf("failed to validate the submitted job again: %v", errorList)
+	}
+
+	_, errorList = cs.ValidateJobAndCreateScienceGoal(newJob("W001", "W002"), user)
+	if len(errorList) != 2 ||
+		!strings.Contains(errorList[0].Error(), "already has 1 active jobs") ||
+		!strings.Contains(errorList[1].Error(), "selects 2 nodes") {
+		t.Errorf("expected active jobs and nodes exceeded, got %v", errorList)
+	}
+	superUser := &User{
+		Auth:           &UserAuth{UserName: "admin", IsSuperUser: true},
+		NodePermission: user.NodePermission,
+	}
+	if _, errorList := cs.ValidateJobAndCreateScienceGoal(newJob("W001", "W002"), superUser); len(errorList) > 0 {
+		t.Errorf("expected super users not limited, got %v", errorList)
+	}
+
+	// quotas edited through the management API take over the configuration
+	body := `{"default": {"max_active_jobs": 5, "max_runtime_per_node_per_day": "3h"}, "estimated_plugin_runtime": "10m"}`
+	r := httptest.NewRequest(http.MethodPut, "/api/v1/quotas", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	cs.APIServer.handleQuotas(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to update quotas: %s", w.Body.String())
+	}
+	// 12 runs of 10 minutes of the new job adds to 2 hours of the submitted job on W001
+	_, errorList = cs.ValidateJobAndCreateScienceGoal(newJob("W001", "W002"), user)
+	if len(errorList) != 1 || !strings.Contains(errorList[0].Error(), "estimated 4h0m0s a day on W001") {
+		t.Errorf("expected runtime exceeded on W001, got %v", errorList)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/quotas/usage?user=user", nil)
+	w = httptest.NewRecorder()
+	cs.APIServer.handleQuotasUsage(w, r)
+	var resp struct {
+		Usages []struct {
+			User                 string            `json:"user"`
+			ActiveJobs           int               `json:"active_jobs"`
+			PluginsPerNode       map[string]int    `json:"plugins_per_node"`
+			RuntimePerNodePerDay map[string]string `json:"runtime_per_node_per_day"`
+			Quota                datatype.Quota    `json:"quota"`
+		} `json:"usages"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Usages) != 1 {
+		t.Fatalf("wanted usage of a user, got %s", w.Body.String())
+	}
+	u := resp.Usages[0]
+	if u.ActiveJobs != 1 || u.PluginsPerNode["W001"] != 1 || u.RuntimePerNodePerDay["W001"] != "2h0m0s" || u.Quota.MaxActiveJobs != 5 {
+		t.Errorf("unexpected usage %s", w.Body.String())
+	}
+
+	// members of a group share its quota
+	body = `{"default": {"max_active_jobs": 5}, "groups": {"lab": {"members": ["user", "other"], "max_active_jobs": 2}}}`
+	r = httptest.NewRequest(http.MethodPut, "/api/v1/quotas", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	cs.APIServer.handleQuotas(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to update quotas: %s", w.Body.String())
+	}
+	other := &User{
+		Auth:           &UserAuth{UserName: "other"},
+		NodePermission: user.NodePermission,
+	}
+	otherJob := datatype.NewJob("job", "other", "")
+	otherJob.Plugins = job.Plugins
+	otherJob.Nodes["W002"] = true
+	otherJob.UpdateJobID(cs.GoalManager.AddJob(otherJob))
+	sg, errorList = cs.ValidateJobAndCreateScienceGoal(otherJob, other)
+	if len(errorList) > 0 {
+		t.Fatalf("failed to validate job of the other member: %v", errorList)
+	}
+	otherJob.ScienceGoal = sg
+	cs.GoalManager.UpdateJob(otherJob, true)
+	_, errorList = cs.ValidateJobAndCreateScienceGoal(newJob("W001"), user)
+	if len(errorList) != 1 || !strings.Contains(errorList[0].Error(), "group lab already has 2 active jobs") {
+		t.Errorf("expected active jobs of the group exceeded, got %v", errorList)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/quotas/usage?user=user", nil)
+	w = httptest.NewRecorder()
+	cs.APIServer.handleQuotasUsage(w, r)
+	var groupResp struct {
+		GroupUsages []struct {
+			Group      string `json:"group"`
+			ActiveJobs int    `json:"active_jobs"`
+		} `json:"group_usages"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &groupResp); err != nil {
+		t.Fatal(err)
+	}
+	if len(groupResp.GroupUsages) != 1 || groupResp.GroupUsages[0].Group != "lab" || groupResp.GroupUsages[0].ActiveJobs != 2 {
+		t.Errorf("unexpected group usage %s", w.Body.String())
+	}
+
+	r = httptest.NewRequest(http.MethodPut, "/api/v1/quotas", strings.NewReader(`{"default": {"max_active_jobs": -1}}`))
+	w = httptest.NewRecorder()
+	cs.APIServer.handleQuotas(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected invalid quotas rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,197 @@
+package cloudscheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+// jobReevaluation is the result of re-evaluating a job. It is computed off the main loop
+// and applied on the main loop as it changes goals of nodes
+type jobReevaluation struct {
+	job            *datatype.Job
+	oldScienceGoal *datatype.ScienceGoal
+	scienceGoal    *datatype.ScienceGoal
+	accepted       []string
+	removed        []string
+	rejected       []string
+	reasons        []string
+	// errorList is set when the job fails validation on its new nodes
+	errorList []error
+}
+
+// reevaluateJobs reloads node and plugin manifests and re-resolves node tags of
+// submitted and running jobs to reflect nodes added to or removed from the tags.
+// The results are sent to the main loop. It returns immediately if the previous
+// re-evaluation has not finished
+func (cs *CloudScheduler) reevaluateJobs() {
+	if !cs.reevaluating.CompareAndSwap(false, true) {
+		logger.With("event", "reevaluation").Debug("previous job re-evaluation is still running. skipping")
+		return
+	}
+	defer cs.reevaluating.Store(false)
+	if err := cs.Validator.LoadDatabase(); err != nil {
+		logger.With("plugin_db", cs.Config.ECRURL, "node_db", cs.Config.NodeManifestURL).Error("failed to reload node and plugin manifests", "error", err)
+		return
+	}
+	for _, job := range cs.GoalManager.GetJobs("") {
+		switch job.State.GetState() {
+		case datatype.JobSubmitted, datatype.JobRunning:
+		default:
+			continue
+		}
+		if len(job.NodeTags) == 0 && len(job.TaggedNodes) == 0 {
+			continue
+		}
+		user, err := cs.getJobOwner(job)
+		if err != nil {
+			job.Logger().Error("failed to get node permission of job owner", "error", err)
+			continue
+		}
+		if r := cs.reevaluateJob(job, user); r != nil {
+			cs.chanJobReevaluations <- r
+		}
+	}
+}
+
+// getJobOwner returns the owner of the job with its node permission
+func (cs *CloudScheduler) getJobOwner(job *datatype.Job) (*User, error) {
+	user := &User{
+		Auth: &UserAuth{
+			UserName: job.User,
+		},
+	}
+	if cs.APIServer != nil && cs.APIServer.authenticator != nil {
+		if err := cs.APIServer.authenticator.UpdatePermissionTableForUser(user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// validateOnNodes validates the job on given nodes without resolving its node tags
+func (cs *CloudScheduler) validateOnNodes(job *datatype.Job, nodes map[string]interface{}, user *User) (*datatype.ScienceGoal, []error) {
+	j := *job
+	j.Nodes = nodes
+	j.NodeTags, j.TaggedNodes = nil, nil
+	return cs.ValidateJobAndCreateScienceGoal(&j, user)
+}
+
+// reevaluateJob re-resolves node tags of the job. When nodes of the job change, the job is
+// validated again and the result holds a new science goal to replace the existing one.
+// New nodes failing the validation are left out and retried in the next re-evaluation.
+// It returns nil if nodes of the job do not change
+func (cs *CloudScheduler) reevaluateJob(job *datatype.Job, user *User) *jobReevaluation {
+	r := &jobReevaluation{
+		job:            job,
+		oldScienceGoal: job.ScienceGoal,
+	}
+	var added []string
+	added, r.removed = job.ResolveNodeTags(cs.Validator.GetNodeNamesByTags(job.NodeTags))
+	if len(added) == 0 && len(r.removed) == 0 {
+		return nil
+	}
+	for _, nodeName := range added {
+		if _, errorList := cs.validateOnNodes(job, map[string]interface{}{nodeName: 1}, user); len(errorList) > 0 {
+			job.DropNode(nodeName)
+			r.rejected = append(r.rejected, nodeName)
+			r.reasons = append(r.reasons, fmt.Sprintf("%s: %v", nodeName, errorList))
+		} else {
+			r.accepted = append(r.accepted, nodeName)
+		}
+	}
+	if len(r.accepted) == 0 && len(r.removed) == 0 {
+		job.Logger().Debug("new nodes of job failed validation", "nodes", strings.Join(r.rejected, ","), "errors", strings.Join(r.reasons, "; "))
+		return nil
+	}
+	if len(job.Nodes) > 0 {
+		r.scienceGoal, r.errorList = cs.validateOnNodes(job, job.Nodes, user)
+	}
+	return r
+}
+
+// applyJobReevaluation writes nodes and the new goal of the re-evaluated job and
+// pushes goals to the nodes affected. It must run on the main loop
+func (cs *CloudScheduler) applyJobReevaluation(r *jobReevaluation) {
+	job := r.job
+	if len(r.errorList) > 0 {
+		job.Logger().Error("job failed validation on its new nodes. keeping the existing goal", "errors", fmt.Sprint(r.errorList))
+		event := datatype.NewSchedulerEventBuilder(datatype.EventJobStatusReevaluated).
+			AddJob(job).
+			AddReason(fmt.Sprintf("validation failed: %v", r.errorList)).Build()
+		cs.GoalManager.Notifier.Notify(event)
+		return
+	}
+	nodesToUpdate := map[string]bool{}
+	if r.oldScienceGoal != nil {
+		for _, nodeName := range r.oldScienceGoal.GetSubjectNodes() {
+			nodesToUpdate[nodeName] = true
+		}
+	}
+	if r.scienceGoal != nil {
+		for _, nodeName := range r.scienceGoal.GetSubjectNodes() {
+			nodesToUpdate[nodeName] = true
+		}
+	}
+	// only nodes and the goal are written as the job may have changed while re-evaluating.
+	// The result is dropped if the job was edited, suspended, or removed in the meantime
+	changed := false
+	updatedJob, err := cs.GoalManager.ModifyJob(job.JobID, func(j *datatype.Job) bool {
+		if !j.IsActive() || scienceGoalID(j.ScienceGoal) != scienceGoalID(r.oldScienceGoal) {
+			changed = true
+			return false
+		}
+		j.Nodes, j.TaggedNodes, j.ScienceGoal = job.Nodes, job.TaggedNodes, r.scienceGoal
+		return true
+	})
+	if err != nil {
+		job.Logger().Error("failed to update job after re-evaluation", "error", err)
+		return
+	}
+	if changed {
+		job.Logger().Info("job changed during re-evaluation. dropping the result")
+		return
+	}
+	job = updatedJob
+	if r.oldScienceGoal != nil {
+		cs.GoalManager.RemoveScienceGoal(r.oldScienceGoal.ID)
+	}
+	// the goal of a held job is loaded when the job starts
+	if r.scienceGoal != nil && !job.IsHeld(time.Now()) {
+		cs.GoalManager.UpdateScienceGoal(r.scienceGoal)
+	}
+	var nodes []string
+	for nodeName := range nodesToUpdate {
+		nodes = append(nodes, nodeName)
+	}
+	sort.Strings(nodes)
+	cs.updateNodes(nodes)
+	job.Logger().Info("nodes of job are changed by node tags",
+		"added", strings.Join(r.accepted, ","),
+		"removed", strings.Join(r.removed, ","),
+		"rejected", strings.Join(r.rejected, ","))
+	event := datatype.NewSchedulerEventBuilder(datatype.EventJobStatusReevaluated).
+		AddJob(job).
+		AddEntry("nodes_added", strings.Join(r.accepted, ",")).
+		AddEntry("nodes_removed", strings.Join(r.removed, ",")).
+		AddEntry("nodes_rejected", strings.Join(r.rejected, ","))
+	if len(r.reasons) > 0 {
+		event = event.AddReason(strings.Join(r.reasons, "; "))
+	}
+	if r.scienceGoal != nil {
+		event = event.AddGoal(r.scienceGoal)
+	}
+	cs.GoalManager.Notifier.Notify(event.Build())
+}
+
+// scienceGoalID returns the ID of the goal, or an empty string if the goal is nil
+func scienceGoalID(g *datatype.ScienceGoal) string {
+	if g == nil {
+		return ""
+	}
+	return g.ID
+}
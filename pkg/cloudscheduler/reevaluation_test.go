@@ -0,0 +1,234 @@
+package cloudscheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestReevaluateJob(t *testing.T) {
+	cs := newTestCloudScheduler(t, nil)
+	setNodes := func(tagged ...string) {
+		cs.Validator.Nodes = map[string]datatype.NodeManifest{}
+		for _, n := range []string{"W001", "W002", "W003", "W004"} {
+			cs.Validator.Nodes[n] = datatype.NodeManifest{Name: n, VSN: n}
+		}
+		for _, n := range tagged {
+			node := cs.Validator.Nodes[n]
+			node.Tags = []string{"urban"}
+			cs.Validator.Nodes[n] = node
+		}
+	}
+	cs.Validator.PluginsWhitelist["plugin-a"] = true
+	reevaluateJob := func(job *datatype.Job, user *User) {
+		if r := cs.reevaluateJob(job, user); r != nil {
+			cs.applyJobReevaluation(r)
+		}
+	}
+	user := &User{
+		Auth: &UserAuth{UserName: "user"},
+		NodePermission: &UserPermissionTable{
+			table: map[string]bool{"W001": true, "W002": true, "W003": true},
+		},
+	}
+
+	setNodes("W002")
+	job := datatype.NewJob("job", "user", "")
+	job.Nodes["W001"] = 1
+	job.NodeTags = []string{"urban"}
+	job.Plugins = []*datatype.Plugin{
+		{Name: "plugin-a", PluginSpec: &datatype.PluginSpec{Image: "plugin-a:0.1.0"}},
+	}
+	sg, errorList := cs.ValidateJobAndCreateScienceGoal(job, user)
+	if len(errorList) > 0 {
+		t.Fatalf("failed to validate job: %v", errorList)
+	}
+	job.ScienceGoal = sg
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	cs.GoalManager.UpdateJob(job, true)
+	<-cs.chanFromGoalManager
+
+	// W002 leaves the tag while W003 and W004 join. The user cannot schedule on W004
+	setNodes("W001", "W003", "W004")
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	// a plugin run is recorded while the job is re-evaluated
+	cs.GoalManager.ModifyJob(job.JobID, func(j *datatype.Job) bool {
+		j.RecordPluginSuccess("W001", "plugin-a")
+		return true
+	})
+	reevaluateJob(job, user)
+
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	got := job.ScienceGoal.GetSubjectNodes()
+	sort.Strings(got)
+	if want := []string{"W001", "W003"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted goal for %v, got %v", want, got)
+	}
+	if want := []string{"W003", "W004"}; !reflect.DeepEqual(job.TaggedNodes, want) {
+		t.Errorf("wanted tagged nodes %v, got %v", want, job.TaggedNodes)
+	}
+	if job.GetSuccessfulRuns("W001", "plugin-a") != 1 {
+		t.Error("expected the plugin run recorded during re-evaluation to be kept")
+	}
+	if _, err := cs.GoalManager.GetScienceGoal(sg.ID); err == nil {
+		t.Error("expected the old goal to be removed")
+	}
+	if _, err := cs.GoalManager.GetScienceGoal(job.ScienceGoal.ID); err != nil {
+		t.Errorf("expected the new goal to be loaded: %s", err.Error())
+	}
+	e := (<-cs.chanFromGoalManager).(datatype.SchedulerEvent)
+	if e.Type != datatype.EventJobStatusReevaluated {
+		t.Fatalf("wanted event %s, got %s", datatype.EventJobStatusReevaluated, e.Type)
+	}
+	for k, v := range map[string]string{"nodes_added": "W003", "nodes_removed": "W002", "nodes_rejected": "W004"} {
+		if e.GetEntry(k) != v {
+			t.Errorf("wanted %s=%s, got %v", k, v, e.GetEntry(k))
+		}
+	}
+
+	// nothing changes when the tag selects the same nodes
+	reevaluateJob(job, user)
+	select {
+	case e := <-cs.chanFromGoalManager:
+		t.Errorf("expected no event, got %s", e.(datatype.SchedulerEvent).Type)
+	default:
+	}
+
+	// the result is dropped when the job is suspended during re-evaluation
+	setNodes("W001")
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if err := cs.GoalManager.SuspendJob(job.JobID); err != nil {
+		t.Fatal(err)
+	}
+	<-cs.chanFromGoalManager
+	reevaluateJob(job, user)
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if want := []string{"W003", "W004"}; !reflect.DeepEqual(job.TaggedNodes, want) {
+		t.Errorf("wanted tagged nodes %v of the suspended job, got %v", want, job.TaggedNodes)
+	}
+	select {
+	case e := <-cs.chanFromGoalManager:
+		t.Errorf("expected no event, got %s", e.(datatype.SchedulerEvent).Type)
+	default:
+	}
+}
+
+// nodePermissionAuthenticator grants users permission to schedule on the nodes
+type nodePermissionAuthenticator struct {
+	userAuthenticator
+	nodes map[string]bool
+}
+
+func (auth *nodePermissionAuthenticator) UpdatePermissionTableForUser(u *User) error {
+	u.NodePermission = &UserPermissionTable{table: auth.nodes}
+	return nil
+}
+
+// TestReevaluateJobsConcurrently re-evaluates jobs while jobs are validated and goals
+// are read as API handlers do. It is meant to run with -race
+func TestReevaluateJobsConcurrently(t *testing.T) {
+	var manifestRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/apps":
+			w.Write([]byte(`{"data":[]}`))
+		case "/manifests/":
+			// W002 joins and leaves the tag on every other request
+			nodes := []datatype.NodeManifest{
+				{Name: "W001", VSN: "W001", Tags: []string{"urban"}},
+				{Name: "W002", VSN: "W002"},
+			}
+			if manifestRequests.Add(1)%2 == 0 {
+				nodes[1].Tags = []string{"urban"}
+			}
+			json.NewEncoder(w).Encode(nodes)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	cs := newTestCloudScheduler(t, &CloudSchedulerConfig{
+		ECRURL:          server.URL,
+		NodeManifestURL: server.URL,
+	})
+	cs.APIServer.authenticator = &nodePermissionAuthenticator{
+		nodes: map[string]bool{"W001": true, "W002": true},
+	}
+	if err := cs.Validator.LoadDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	cs.Validator.AddPluginWhitelist("plugin-a")
+
+	job := datatype.NewJob("job", "user", "")
+	job.NodeTags = []string{"urban"}
+	job.Plugins = []*datatype.Plugin{
+		{Name: "plugin-a", PluginSpec: &datatype.PluginSpec{Image: "plugin-a:0.1.0"}},
+	}
+	user, err := cs.getJobOwner(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sg, errorList := cs.ValidateJobAndCreateScienceGoal(job, user)
+	if len(errorList) > 0 {
+		t.Fatalf("failed to validate job: %v", errorList)
+	}
+	job.ScienceGoal = sg
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	cs.GoalManager.UpdateJob(job, true)
+	cs.GoalManager.UpdateScienceGoal(sg)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 4; i++ {
+			cs.reevaluateJobs()
+		}
+	}()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			j, err := cs.GoalManager.GetJob(job.JobID)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			cs.ValidateJobAndCreateScienceGoal(j, user)
+			cs.GoalManager.GetScienceGoalsForNode("W001")
+			cs.Validator.ListPluginWhitelist()
+		}
+	}()
+	applied := 0
+	for running := true; running; {
+		select {
+		case r := <-cs.chanJobReevaluations:
+			cs.applyJobReevaluation(r)
+			applied++
+		case <-cs.chanFromGoalManager:
+		case <-done:
+			running = false
+		}
+	}
+	wg.Wait()
+	for len(cs.chanJobReevaluations) > 0 {
+		cs.applyJobReevaluation(<-cs.chanJobReevaluations)
+		applied++
+	}
+	if applied == 0 {
+		t.Error("expected the job to be re-evaluated")
+	}
+}
@@ -0,0 +1,142 @@
+package cloudscheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+const jobRevisionBucketName = "job_revisions"
+
+// AddJobRevision stores the spec of the job as a new revision. Revisions of a job are kept
+// in a bucket of the job under the revision bucket
+func (cgm *CloudGoalManager) AddJobRevision(job *datatype.Job, author string, action datatype.JobRevisionAction, rolledBackTo int) (revision *datatype.JobRevision, err error) {
+	revision = &datatype.JobRevision{
+		JobID:        job.JobID,
+		Author:       author,
+		Action:       action,
+		Time:         datatype.Time{Time: time.Now().UTC()},
+		RolledBackTo: rolledBackTo,
+		Job:          job.Spec(),
+	}
+	err = cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(jobRevisionBucketName))
+		if root == nil {
+			return fmt.Errorf("Bucket %s does not exist", jobRevisionBucketName)
+		}
+		b, err := root.CreateBucketIfNotExists([]byte(job.JobID))
+		if err != nil {
+			return err
+		}
+		n, _ := b.NextSequence()
+		revision.Revision = int(n)
+		buf, err := json.Marshal(revision)
+		if err != nil {
+			return err
+		}
+		return b.Put(revisionKey(revision.Revision), buf)
+	})
+	return
+}
+
+// revisionKey returns the key of a revision. Keys are zero-padded to keep revisions in order
+func revisionKey(revision int) []byte {
+	return []byte(fmt.Sprintf("%010d", revision))
+}
+
+// GetJobRevisions returns revisions of the job, the oldest first
+func (cgm *CloudGoalManager) GetJobRevisions(jobID string) (revisions []*datatype.JobRevision, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(jobRevisionBucketName))
+		if root == nil {
+			return fmt.Errorf("Bucket %s does not exist", jobRevisionBucketName)
+		}
+		b := root.Bucket([]byte(jobID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var r datatype.JobRevision
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			revisions = append(revisions, &r)
+			return nil
+		})
+	})
+	return
+}
+
+func (cgm *CloudGoalManager) GetJobRevision(jobID string, revision int) (r *datatype.JobRevision, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(jobRevisionBucketName))
+		if root == nil {
+			return fmt.Errorf("Bucket %s does not exist", jobRevisionBucketName)
+		}
+		var v []byte
+		if b := root.Bucket([]byte(jobID)); b != nil {
+			v = b.Get(revisionKey(revision))
+		}
+		if v == nil {
+			return fmt.Errorf("Revision %d of job %q does not exist", revision, jobID)
+		}
+		r = &datatype.JobRevision{}
+		return json.Unmarshal(v, r)
+	})
+	return
+}
+
+// parseRevision returns the revision number in a request
+func parseRevision(s string) (int, error) {
+	revision, err := strconv.Atoi(s)
+	if err != nil || revision < 1 {
+		return 0, fmt.Errorf("revision must be a positive number: %q", s)
+	}
+	return revision, nil
+}
+
+// RollbackJob restores the job to the revision and submits it. The rollback is stored as a new revision
+func (cs *CloudScheduler) RollbackJob(jobID string, revision int, user *User) (*datatype.JobRevision, []error) {
+	job, err := cs.GoalManager.GetJob(jobID)
+	if err != nil {
+		return nil, []error{err}
+	}
+	if job.State.GetState() == datatype.JobRemoved {
+		return nil, []error{fmt.Errorf("job %q is removed", jobID)}
+	}
+	r, err := cs.GoalManager.GetJobRevision(jobID, revision)
+	if err != nil {
+		return nil, []error{err}
+	}
+	// runtime fields of the job, e.g. stats of its plugins, and sharing of the job are not rolled back
+	restored := *job
+	restored.ApplySpec(r.Job)
+	sg, errorList := cs.ValidateJobAndCreateScienceGoal(&restored, user)
+	if len(errorList) > 0 {
+		return nil, errorList
+	}
+	var nodesToUpdate []string
+	if job.ScienceGoal != nil {
+		nodesToUpdate = job.ScienceGoal.GetSubjectNodes()
+		cs.GoalManager.RemoveScienceGoal(job.ScienceGoal.ID)
+	}
+	restored.ScienceGoal = sg
+	if err := cs.GoalManager.UpdateJob(&restored, true); err != nil {
+		return nil, []error{err}
+	}
+	// nodes of the new goal are updated when the goal is submitted. Nodes left out of
+	// the restored job need to drop the old goal
+	if cs.APIServer != nil && len(nodesToUpdate) > 0 {
+		cs.updateNodes(nodesToUpdate)
+	}
+	rolledBack, err := cs.GoalManager.AddJobRevision(&restored, user.GetUserName(), datatype.JobRevisionRolledBack, revision)
+	if err != nil {
+		return nil, []error{err}
+	}
+	restored.Logger().Info("job is rolled back", "revision", revision, "new_revision", rolledBack.Revision, "author", user.GetUserName())
+	return rolledBack, nil
+}
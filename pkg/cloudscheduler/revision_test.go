@@ -0,0 +1,89 @@
+package cloudscheduler
+
+import (
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestRollbackJob(t *testing.T) {
+	cs := newTestCloudScheduler(t, nil)
+	for _, n := range []string{"W001", "W002"} {
+		cs.Validator.Nodes[n] = datatype.NodeManifest{Name: n, VSN: n}
+	}
+	cs.Validator.PluginsWhitelist["plugin-a:0.1.0"] = true
+	cs.Validator.PluginsWhitelist["plugin-a:0.2.0"] = true
+	user := &User{
+		Auth: &UserAuth{UserName: "user"},
+		NodePermission: &UserPermissionTable{
+			table: map[string]bool{"W001": true, "W002": true},
+		},
+	}
+	submit := func(job *datatype.Job) {
+		sg, errorList := cs.ValidateJobAndCreateScienceGoal(job, user)
+		if len(errorList) > 0 {
+			t.Fatalf("failed to validate job: %v", errorList)
+		}
+		if job.ScienceGoal != nil {
+			cs.GoalManager.RemoveScienceGoal(job.ScienceGoal.ID)
+		}
+		job.ScienceGoal = sg
+		cs.GoalManager.UpdateJob(job, true)
+		if _, err := cs.GoalManager.AddJobRevision(job, "user", datatype.JobRevisionSubmitted, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	job := datatype.NewJob("job", "user", "")
+	job.Nodes["W001"] = 1
+	job.Plugins = []*datatype.Plugin{
+		{Name: "plugin-a", PluginSpec: &datatype.PluginSpec{Image: "plugin-a:0.1.0"}},
+	}
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	submit(job)
+
+	// a bad edit moves the job to W002 with a new image
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	job.Nodes = map[string]interface{}{"W002": 1}
+	job.Plugins[0].PluginSpec.Image = "plugin-a:0.2.0"
+	submit(job)
+	oldGoalID := job.ScienceGoal.ID
+	// the job ran before the rollback
+	cs.GoalManager.ModifyJob(job.JobID, func(job *datatype.Job) bool {
+		job.RecordPluginSuccess("W002", "plugin-a")
+		job.Health = datatype.JobHealthy
+		return true
+	})
+
+	revision, errorList := cs.RollbackJob(job.JobID, 1, user)
+	if len(errorList) > 0 {
+		t.Fatalf("failed to roll back: %v", errorList)
+	}
+	if revision.Revision != 3 || revision.Action != datatype.JobRevisionRolledBack || revision.RolledBackTo != 1 {
+		t.Errorf("unexpected revision of rollback %+v", revision)
+	}
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if job.State.GetState() != datatype.JobSubmitted {
+		t.Errorf("wanted job %s after rollback, got %s", datatype.JobSubmitted, job.State.GetState())
+	}
+	if image := job.Plugins[0].PluginSpec.Image; image != "plugin-a:0.1.0" {
+		t.Errorf("wanted image plugin-a:0.1.0, got %s", image)
+	}
+	if job.GetSuccessfulRuns("W002", "plugin-a") != 1 || job.Health != datatype.JobHealthy {
+		t.Errorf("expected stats of plugins kept after rollback, got %+v and health %q", job.PluginStats, job.Health)
+	}
+	if nodes := job.ScienceGoal.GetSubjectNodes(); len(nodes) != 1 || nodes[0] != "W001" {
+		t.Errorf("wanted goal for W001, got %v", nodes)
+	}
+	if _, err := cs.GoalManager.GetScienceGoal(oldGoalID); err == nil {
+		t.Error("expected the goal of the bad edit to be removed")
+	}
+	revisions, _ := cs.GoalManager.GetJobRevisions(job.JobID)
+	if len(revisions) != 3 {
+		t.Errorf("wanted 3 revisions, got %d", len(revisions))
+	}
+
+	if _, errorList := cs.RollbackJob(job.JobID, 10, user); len(errorList) == 0 {
+		t.Error("expected rolling back to a missing revision to fail")
+	}
+}
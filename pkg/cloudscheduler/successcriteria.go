@@ -0,0 +1,249 @@
+package cloudscheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+const (
+	successCriteriaCheckInterval = 1 * time.Minute
+	dataQueryTimeout             = 30 * time.Second
+)
+
+// DataQuerier returns values of the measurement published by given nodes since given time
+type DataQuerier interface {
+	Query(name string, nodes []string, since time.Time) ([]float64, error)
+}
+
+// DataAPI queries data published by nodes from the Waggle data API
+type DataAPI struct {
+	request *interfacing.HTTPRequest
+}
+
+func NewDataAPI(url string) *DataAPI {
+	return &DataAPI{
+		request: interfacing.NewHTTPRequest(url).WithTimeout(dataQueryTimeout),
+	}
+}
+
+// Query returns numeric values of the measurement. Values that are not a number are skipped
+func (d *DataAPI) Query(name string, nodes []string, since time.Time) (values []float64, err error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"start": since.UTC().Format(time.RFC3339),
+		"filter": map[string]string{
+			"name": name,
+			"vsn":  strings.Join(nodes, "|"),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.request.RequestPost("api/v1/query", body, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("data API responded %s", resp.Status)
+	}
+	// the data API responds a record per line
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var record struct {
+			Value interface{} `json:"value"`
+		}
+		if err := decoder.Decode(&record); err == io.EOF {
+			return values, nil
+		} else if err != nil {
+			return values, fmt.Errorf("failed to parse data: %s", err.Error())
+		}
+		switch v := record.Value.(type) {
+		case float64:
+			values = append(values, v)
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				values = append(values, f)
+			}
+		}
+	}
+}
+
+// validateSuccessCriteria returns errors of success criteria that cannot be parsed or
+// refer to a plugin not in the job
+func validateSuccessCriteria(job *datatype.Job) (errorList []error) {
+	pluginNames := map[string]bool{}
+	for _, p := range job.Plugins {
+		pluginNames[p.Name] = true
+	}
+	for _, c := range job.SuccessCriteria {
+		criterion, err := datatype.NewSuccessCriterion(c)
+		if err != nil {
+			errorList = append(errorList, err)
+			continue
+		}
+		if criterion.Type == datatype.SuccessCriterionRuns && !pluginNames[criterion.Plugin] {
+			errorList = append(errorList, fmt.Errorf("success criterion %q refers to plugin %q that is not in the job", c, criterion.Plugin))
+		}
+	}
+	return
+}
+
+// successCriterionMet is a success criterion of the job met by data of the job
+type successCriterionMet struct {
+	job       *datatype.Job
+	criterion string
+}
+
+// checkSuccessCriteriaOfRunningJobs completes running jobs whose success criteria are met.
+// Jobs with data criteria are queued to the data criteria checker
+func (cs *CloudScheduler) checkSuccessCriteriaOfRunningJobs() {
+	for _, job := range cs.GoalManager.GetJobs("") {
+		if len(job.SuccessCriteria) == 0 || job.State.GetState() != datatype.JobRunning {
+			continue
+		}
+		if cs.checkSuccessCriteria(job) {
+			continue
+		}
+		if hasDataSuccessCriterion(job) {
+			cs.queueDataCriteriaCheck(job)
+		}
+	}
+}
+
+// checkSuccessCriteria completes the job when any of its success criteria is met.
+// Data criteria are not checked as querying data would block the caller.
+// It returns true if the job is completed
+func (cs *CloudScheduler) checkSuccessCriteria(job *datatype.Job) bool {
+	criteria, err := job.GetSuccessCriteria()
+	if err != nil {
+		job.Logger().Error("failed to parse success criteria", "error", err)
+		return false
+	}
+	for _, c := range criteria {
+		if c.Type == datatype.SuccessCriterionData {
+			continue
+		}
+		met, err := cs.isSuccessCriterionMet(job, c)
+		if err != nil {
+			job.Logger().Error("failed to evaluate success criterion", "criterion", c.Criterion, "error", err)
+			continue
+		}
+		if met {
+			return cs.completeJobBySuccessCriterion(job, c.Criterion)
+		}
+	}
+	return false
+}
+
+// completeJobBySuccessCriterion completes the job as the criterion is met.
+// It returns true if the job is completed
+func (cs *CloudScheduler) completeJobBySuccessCriterion(job *datatype.Job, criterion string) bool {
+	job.Logger().Info("success criterion is met. completing the job", "criterion", criterion)
+	if err := cs.GoalManager.CompleteJob(job.JobID, fmt.Sprintf("success criterion %q is met", criterion)); err != nil {
+		job.Logger().Error("failed to complete job", "error", err)
+		return false
+	}
+	return true
+}
+
+func hasDataSuccessCriterion(job *datatype.Job) bool {
+	criteria, _ := job.GetSuccessCriteria()
+	for _, c := range criteria {
+		if c.Type == datatype.SuccessCriterionData {
+			return true
+		}
+	}
+	return false
+}
+
+// queueDataCriteriaCheck queues the job to the data criteria checker. The job is
+// skipped until the next check if the queue is full
+func (cs *CloudScheduler) queueDataCriteriaCheck(job *datatype.Job) {
+	if cs.dataQuerier == nil {
+		job.Logger().Error("failed to evaluate data success criteria", "error", "no data API is configured")
+		return
+	}
+	select {
+	case cs.chanDataCriteriaCheck <- job:
+	default:
+		job.Logger().Warn("data success criteria checker is busy. skipping the job until the next check")
+	}
+}
+
+// runDataCriteriaChecker queries data for data success criteria of queued jobs and sends
+// the criteria met to the main loop. Queries run off the main loop as the data API may be slow
+func (cs *CloudScheduler) runDataCriteriaChecker() {
+	for job := range cs.chanDataCriteriaCheck {
+		criteria, err := job.GetSuccessCriteria()
+		if err != nil {
+			job.Logger().Error("failed to parse success criteria", "error", err)
+			continue
+		}
+		for _, c := range criteria {
+			if c.Type != datatype.SuccessCriterionData {
+				continue
+			}
+			met, err := cs.isSuccessCriterionMet(job, c)
+			if err != nil {
+				job.Logger().Error("failed to evaluate success criterion", "criterion", c.Criterion, "error", err)
+				continue
+			}
+			if met {
+				cs.chanSuccessCriteriaMet <- successCriterionMet{job: job, criterion: c.Criterion}
+				break
+			}
+		}
+	}
+	logger.Debug.Printf("data success criteria checker stopped")
+}
+
+func (cs *CloudScheduler) isSuccessCriterionMet(job *datatype.Job, c *datatype.SuccessCriterion) (bool, error) {
+	var nodes []string
+	if job.ScienceGoal != nil {
+		nodes = job.ScienceGoal.GetSubjectNodes()
+	}
+	switch c.Type {
+	case datatype.SuccessCriterionRuns:
+		if len(nodes) == 0 {
+			return false, nil
+		}
+		for _, nodeName := range nodes {
+			if job.GetSuccessfulRuns(nodeName, c.Plugin) < c.Runs {
+				return false, nil
+			}
+		}
+		return true, nil
+	case datatype.SuccessCriterionUntil:
+		return time.Now().After(c.Until), nil
+	case datatype.SuccessCriterionWallClock:
+		return time.Since(job.State.LastStarted.Time) >= c.Duration, nil
+	case datatype.SuccessCriterionData:
+		if cs.dataQuerier == nil {
+			return false, fmt.Errorf("no data API is configured")
+		}
+		if len(nodes) == 0 {
+			return false, nil
+		}
+		values, err := cs.dataQuerier.Query(c.Measurement, nodes, job.State.LastStarted.Time)
+		if err != nil {
+			return false, err
+		}
+		for _, v := range values {
+			if c.IsSatisfiedBy(v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown success criterion %q", c.Type)
+	}
+}
@@ -0,0 +1,155 @@
+package cloudscheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+const teamBucketName = "teams"
+
+// AddTeam stores the team if no team has the name
+func (cgm *CloudGoalManager) AddTeam(team *datatype.Team) error {
+	team.Created.Time = time.Now().UTC()
+	return cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(teamBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", teamBucketName)
+		}
+		if b.Get([]byte(team.Name)) != nil {
+			return fmt.Errorf("Team %q already exists", team.Name)
+		}
+		buf, err := json.Marshal(team)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(team.Name), buf)
+	})
+}
+
+func (cgm *CloudGoalManager) UpdateTeam(team *datatype.Team) error {
+	return cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(teamBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", teamBucketName)
+		}
+		if b.Get([]byte(team.Name)) == nil {
+			return fmt.Errorf("Team %q does not exist", team.Name)
+		}
+		buf, err := json.Marshal(team)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(team.Name), buf)
+	})
+}
+
+func (cgm *CloudGoalManager) GetTeam(name string) (team *datatype.Team, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(teamBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", teamBucketName)
+		}
+		v := b.Get([]byte(name))
+		if v == nil {
+			return fmt.Errorf("Team %q does not exist", name)
+		}
+		team = &datatype.Team{}
+		return json.Unmarshal(v, team)
+	})
+	return
+}
+
+// GetTeams returns teams the user is a member of, or all teams if the user name is empty
+func (cgm *CloudGoalManager) GetTeams(userName string) (teams []*datatype.Team, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(teamBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", teamBucketName)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var t datatype.Team
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			if userName == "" || t.GetRole(userName) != "" {
+				teams = append(teams, &t)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// RemoveTeam removes the team and takes its jobs out of the team, so that a team
+// created later with the same name does not get roles on the jobs
+func (cgm *CloudGoalManager) RemoveTeam(name string) error {
+	return cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(teamBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", teamBucketName)
+		}
+		if b.Get([]byte(name)) == nil {
+			return fmt.Errorf("Team %q does not exist", name)
+		}
+		jobs := tx.Bucket([]byte(jobBucketName))
+		if jobs == nil {
+			return fmt.Errorf("Bucket %s does not exist", jobBucketName)
+		}
+		updated := map[string][]byte{}
+		err := jobs.ForEach(func(k, v []byte) error {
+			var j datatype.Job
+			if err := json.Unmarshal(v, &j); err != nil {
+				return err
+			}
+			if j.Team != name {
+				return nil
+			}
+			j.Team = ""
+			buf, err := json.Marshal(j)
+			if err != nil {
+				return err
+			}
+			updated[string(k)] = buf
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// buckets cannot be modified while iterating them
+		for k, v := range updated {
+			if err := jobs.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return b.Delete([]byte(name))
+	})
+}
+
+// GetJobRole returns the role of the user on the job including the role in the team of the job
+func (cgm *CloudGoalManager) GetJobRole(job *datatype.Job, userName string) datatype.JobRole {
+	var team *datatype.Team
+	if job.Team != "" {
+		team, _ = cgm.GetTeam(job.Team)
+	}
+	return job.GetRole(userName, team)
+}
+
+// GetJobsForUser returns jobs the user has a role on
+func (cgm *CloudGoalManager) GetJobsForUser(userName string) (jobs []*datatype.Job) {
+	teams := map[string]*datatype.Team{}
+	if ts, err := cgm.GetTeams(userName); err == nil {
+		for _, t := range ts {
+			teams[t.Name] = t
+		}
+	}
+	for _, job := range cgm.GetJobs("") {
+		if job.GetRole(userName, teams[job.Team]) != "" {
+			jobs = append(jobs, job)
+		}
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package cloudscheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// userAuthenticator authenticates the token as the user name
+type userAuthenticator struct{}
+
+func (auth *userAuthenticator) Authenticate(token string) (*User, error) {
+	return &User{Token: token, Auth: &UserAuth{UserName: token}}, nil
+}
+
+func (auth *userAuthenticator) UpdatePermissionTableForUser(u *User) error {
+	return nil
+}
+
+func TestJobSharing(t *testing.T) {
+	cs := newTestCloudScheduler(t, nil)
+	api := cs.APIServer
+	api.authenticator = &userAuthenticator{}
+	request := func(handler http.HandlerFunc, userName string, method string, target string, vars map[string]string, body string) (int, string) {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", "Sage "+userName)
+		r = mux.SetURLVars(r, vars)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code, w.Body.String()
+	}
+	team := map[string]string{"name": "lab"}
+	if code, body := request(api.handlerTeamCreate, "alice", http.MethodGet, "/api/v1/teams/lab/create", team, ""); code != http.StatusOK {
+		t.Fatalf("failed to create team: %s", body)
+	}
+	for member, role := range map[string]string{"bob": "editor", "carol": "viewer"} {
+		if code, body := request(api.handlerTeamMembersAdd, "alice", http.MethodGet, fmt.Sprintf("/api/v1/teams/lab/members/add?user=%s&role=%s", member, role), team, ""); code != http.StatusOK {
+			t.Fatalf("failed to add %s: %s", member, body)
+		}
+	}
+	if code, _ := request(api.handlerTeamMembersAdd, "bob", http.MethodGet, "/api/v1/teams/lab/members/add?user=eve&role=owner", team, ""); code == http.StatusOK {
+		t.Error("expected only owners of the team to add members")
+	}
+	if code, body := request(api.handlerTeamMembersRemove, "alice", http.MethodGet, "/api/v1/teams/lab/members/rm?user=alice", team, ""); code == http.StatusOK || !strings.Contains(body, "at least one owner") {
+		t.Errorf("expected the last owner kept, got %s", body)
+	}
+
+	job := datatype.NewJob("campaign", "alice", "")
+	job.Team = "lab"
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	vars := map[string]string{"id": job.JobID}
+	edit := func(userName string) (int, string) {
+		return request(api.handlerEditJob, userName, http.MethodPost, "/api/v1/edit?id="+job.JobID, nil, "name: campaign\nteam: lab\n")
+	}
+	if code, body := edit("bob"); code != http.StatusOK {
+		t.Errorf("expected team editors to edit the job, got %s", body)
+	}
+	if code, body := edit("carol"); code == http.StatusOK || !strings.Contains(body, "is viewer of the job and needs to be editor") {
+		t.Errorf("expected team viewers not to edit the job, got %s", body)
+	}
+	if code, body := edit("eve"); code == http.StatusOK || !strings.Contains(body, "does not have access") {
+		t.Errorf("expected others not to edit the job, got %s", body)
+	}
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if job.User != "alice" {
+		t.Errorf("expected the job still owned by alice, got %s", job.User)
+	}
+	if code, _ := request(api.handlerJobRevisions, "carol", http.MethodGet, "/api/v1/jobs/"+job.JobID+"/revisions", vars, ""); code != http.StatusOK {
+		t.Error("expected team viewers to read revisions")
+	}
+	if code, _ := request(api.handlerJobRemove, "bob", http.MethodGet, "/api/v1/jobs/"+job.JobID+"/rm", vars, ""); code == http.StatusOK {
+		t.Error("expected only owners to remove the job")
+	}
+	// editors cannot move the job out of the team
+	if code, body := request(api.handlerEditJob, "bob", http.MethodPost, "/api/v1/edit?id="+job.JobID, nil, "name: campaign\n"); code == http.StatusOK || !strings.Contains(body, "only owners of the job can change its team") {
+		t.Errorf("expected editors not to change the team, got %s", body)
+	}
+
+	// collaborators are managed by owners
+	if code, _ := request(api.handlerJobCollaboratorsAdd, "bob", http.MethodGet, "/api/v1/jobs/"+job.JobID+"/collaborators/add?user=eve&role=editor", vars, ""); code == http.StatusOK {
+		t.Error("expected only owners to add collaborators")
+	}
+	if code, body := request(api.handlerJobCollaboratorsAdd, "alice", http.MethodGet, "/api/v1/jobs/"+job.JobID+"/collaborators/add?user=eve&role=editor", vars, ""); code != http.StatusOK {
+		t.Fatalf("failed to add collaborator: %s", body)
+	}
+	if code, body := edit("eve"); code != http.StatusOK {
+		t.Errorf("expected collaborators to edit the job, got %s", body)
+	}
+	code, body := request(api.handlerJobs, "eve", http.MethodGet, "/api/v1/jobs/list", nil, "")
+	var jobs map[string]*datatype.Job
+	if err := json.Unmarshal([]byte(body), &jobs); code != http.StatusOK || err != nil || jobs[job.JobID] == nil {
+		t.Errorf("expected the shared job listed, got %s", body)
+	}
+	if code, body := request(api.handlerJobCollaboratorsRemove, "alice", http.MethodGet, "/api/v1/jobs/"+job.JobID+"/collaborators/rm?user=eve", vars, ""); code != http.StatusOK {
+		t.Fatalf("failed to remove collaborator: %s", body)
+	}
+	if code, _ := edit("eve"); code == http.StatusOK {
+		t.Error("expected removed collaborators not to edit the job")
+	}
+
+	// removing the team stops sharing the job
+	if code, body := request(api.handlerTeamRemove, "alice", http.MethodGet, "/api/v1/teams/lab/rm", team, ""); code != http.StatusOK {
+		t.Fatalf("failed to remove team: %s", body)
+	}
+	if code, _ := edit("bob"); code == http.StatusOK {
+		t.Error("expected members of the removed team not to edit the job")
+	}
+	// a new team of the same name does not take over the job
+	if code, body := request(api.handlerTeamCreate, "mallory", http.MethodGet, "/api/v1/teams/lab/create", team, ""); code != http.StatusOK {
+		t.Fatalf("failed to create team: %s", body)
+	}
+	if code, _ := request(api.handlerJobRemove, "mallory", http.MethodGet, "/api/v1/jobs/"+job.JobID+"/rm", vars, ""); code == http.StatusOK {
+		t.Error("expected a new team of the same name not to own the job")
+	}
+	job, _ = cs.GoalManager.GetJob(job.JobID)
+	if job.Team != "" {
+		t.Errorf("expected the job out of the removed team, got %q", job.Team)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
@@ -20,6 +21,9 @@ type JobValidator struct {
 	Plugins          map[string]datatype.PluginManifest
 	PluginsWhitelist map[string]bool
 	Nodes            map[string]datatype.NodeManifest
+	// mu guards the manifests and the whitelist as jobs are re-evaluated
+	// while API handlers validate jobs
+	mu sync.RWMutex
 }
 
 func NewJobValidator(config *CloudSchedulerConfig) *JobValidator {
@@ -34,6 +38,8 @@ func NewJobValidator(config *CloudSchedulerConfig) *JobValidator {
 }
 
 func (jv *JobValidator) GetNodeManifest(nodeName string) *datatype.NodeManifest {
+	jv.mu.RLock()
+	defer jv.mu.RUnlock()
 	if n, exist := jv.Nodes[nodeName]; exist {
 		return &n
 	} else {
@@ -42,7 +48,10 @@ func (jv *JobValidator) GetNodeManifest(nodeName string) *datatype.NodeManifest
 }
 
 func (jv *JobValidator) GetPluginManifest(pluginImage string, updateDBIfNotExist bool) *datatype.PluginManifest {
-	if p, exist := jv.Plugins[pluginImage]; exist {
+	jv.mu.RLock()
+	p, exist := jv.Plugins[pluginImage]
+	jv.mu.RUnlock()
+	if exist {
 		return &p
 	} else {
 		if updateDBIfNotExist {
@@ -51,7 +60,9 @@ func (jv *JobValidator) GetPluginManifest(pluginImage string, updateDBIfNotExist
 				logger.Error.Printf("failed to fetch plugin manifest: %s", err.Error())
 				return nil
 			} else {
+				jv.mu.Lock()
 				jv.Plugins[newP.ID] = *newP
+				jv.mu.Unlock()
 				return newP
 			}
 		}
@@ -59,6 +70,16 @@ func (jv *JobValidator) GetPluginManifest(pluginImage string, updateDBIfNotExist
 	}
 }
 
+// GetPluginImages returns images of the plugins loaded from the plugin database
+func (jv *JobValidator) GetPluginImages() (images []string) {
+	jv.mu.RLock()
+	defer jv.mu.RUnlock()
+	for image := range jv.Plugins {
+		images = append(images, image)
+	}
+	return
+}
+
 // IsPluginNameValid checks if given plugin name is valid.
 // Plugin name must follow RFC 1123.
 // Reference: https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#dns-subdomain-names
@@ -72,10 +93,10 @@ func (jv *JobValidator) IsPluginNameValid(name string) bool {
 	return validNamePattern.MatchString(name)
 }
 
-// LoadDatabase loads node and plugin manifests
-// this function should be called only at initialization
+// LoadDatabase loads node and plugin manifests. The manifests loaded previously
+// are kept if loading fails. The manifests in use are replaced only after both are loaded
 func (jv *JobValidator) LoadDatabase() error {
-	jv.Plugins = make(map[string]datatype.PluginManifest)
+	pluginManifests := make(map[string]datatype.PluginManifest)
 	// IMPROVEMENT: we may want to load plugin manifest from files first
 	// in case the plugin manifest pull fails due to an error comuunicating with ECR
 
@@ -123,10 +144,10 @@ func (jv *JobValidator) LoadDatabase() error {
 		return err
 	}
 	for _, p := range plugins.Data {
-		jv.Plugins[p.ID] = p
+		pluginManifests[p.ID] = p
 	}
 
-	jv.Nodes = make(map[string]datatype.NodeManifest)
+	nodeManifests := make(map[string]datatype.NodeManifest)
 	// IMPROVEMENT: we may want to load node manifest from files first
 	// in case the node manifest pull fails due to an error comuunicating with manifest server
 	// nodeFiles, err := ioutil.ReadDir(path.Join(jv.dataPath, "nodes"))
@@ -166,38 +187,52 @@ func (jv *JobValidator) LoadDatabase() error {
 		return err
 	}
 	for _, n := range nodes {
-		jv.Nodes[n.VSN] = n
+		nodeManifests[n.VSN] = n
 	}
-
+	jv.mu.Lock()
+	jv.Plugins = pluginManifests
+	jv.Nodes = nodeManifests
+	jv.mu.Unlock()
 	return nil
 }
 
 func (jv *JobValidator) LoadPluginWhitelist() {
-	jv.PluginsWhitelist = make(map[string]bool)
+	pluginsWhitelist := make(map[string]bool)
 	whitelistFilePath := path.Join(jv.dataPath, "plugins.whitelist")
 	if file, err := os.OpenFile(whitelistFilePath, os.O_CREATE|os.O_RDONLY, 0644); err == nil {
 		fileScanner := bufio.NewScanner(file)
 		for fileScanner.Scan() {
-			jv.AddPluginWhitelist(fileScanner.Text())
+			if whitelist := fileScanner.Text(); whitelist != "" {
+				pluginsWhitelist[whitelist] = true
+			}
 		}
 	} else {
 		logger.Error.Printf("failed to create or open %q: %s", whitelistFilePath, err.Error())
 	}
+	jv.mu.Lock()
+	jv.PluginsWhitelist = pluginsWhitelist
+	jv.mu.Unlock()
 }
 
 func (jv *JobValidator) AddPluginWhitelist(whitelist string) {
+	jv.mu.Lock()
+	defer jv.mu.Unlock()
 	if whitelist != "" {
 		jv.PluginsWhitelist[whitelist] = true
 	}
 }
 
 func (jv *JobValidator) RemovePluginWhitelist(whitelist string) {
+	jv.mu.Lock()
+	defer jv.mu.Unlock()
 	if _, found := jv.PluginsWhitelist[whitelist]; found {
 		delete(jv.PluginsWhitelist, whitelist)
 	}
 }
 
 func (jv *JobValidator) ListPluginWhitelist() (l []string) {
+	jv.mu.RLock()
+	defer jv.mu.RUnlock()
 	for whitelist := range jv.PluginsWhitelist {
 		l = append(l, whitelist)
 	}
@@ -205,6 +240,8 @@ func (jv *JobValidator) ListPluginWhitelist() (l []string) {
 }
 
 func (jv *JobValidator) IsPluginWhitelisted(pluginImage string) bool {
+	jv.mu.RLock()
+	defer jv.mu.RUnlock()
 	for l := range jv.PluginsWhitelist {
 		if matched, _ := regexp.MatchString(l, pluginImage); matched {
 			return true
@@ -214,6 +251,8 @@ func (jv *JobValidator) IsPluginWhitelisted(pluginImage string) bool {
 }
 
 func (jv *JobValidator) WritePluginWhitelist() {
+	jv.mu.RLock()
+	defer jv.mu.RUnlock()
 	whitelistFilePath := path.Join(jv.dataPath, "plugins.whitelist")
 	if file, err := os.OpenFile(whitelistFilePath, os.O_CREATE|os.O_WRONLY, 0644); err == nil {
 		for whitelist := range jv.PluginsWhitelist {
@@ -229,6 +268,8 @@ func (jv *JobValidator) GetNodeNamesByTags(tags []string) (nodesFound []string)
 	if len(tags) == 0 {
 		return
 	}
+	jv.mu.RLock()
+	defer jv.mu.RUnlock()
 	for _, node := range jv.Nodes {
 		if node.MatchTags(tags, true) {
 			nodesFound = append(nodesFound, node.Name)
@@ -0,0 +1,523 @@
+package cloudscheduler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/boltdb/bolt"
+	uuid "github.com/nu7hatch/gouuid"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+const (
+	webhookBucketName         = "webhooks"
+	webhookDeliveryBucketName = "webhook_deliveries"
+	// webhookIndexBucketName indexes webhooks by the job they are registered for,
+	// or by their user if they are registered for all jobs of the user
+	webhookIndexBucketName = "webhook_index"
+	// maxWebhookDeliveries is the number of recent deliveries kept for a webhook
+	maxWebhookDeliveries = 50
+	// maxWebhookAttempts is the number of attempts to deliver an event before giving up
+	maxWebhookAttempts = 5
+	webhookTimeout     = 10 * time.Second
+	// webhookWorkers is the number of deliveries posted at the same time
+	webhookWorkers = 4
+	// maxWebhookQueueLength is the number of deliveries kept in the queue. The oldest is dropped when full
+	maxWebhookQueueLength = 1000
+	// WebhookSignatureHeader carries HMAC-SHA256 of the payload with the webhook secret
+	WebhookSignatureHeader = "X-Scheduler-Signature"
+	WebhookEventHeader     = "X-Scheduler-Event"
+	WebhookDeliveryHeader  = "X-Scheduler-Delivery"
+)
+
+// AddWebhook stores the webhook with a new ID. A secret is generated if not given
+func (cgm *CloudGoalManager) AddWebhook(w *datatype.Webhook) error {
+	if w.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		w.Secret = hex.EncodeToString(secret)
+	}
+	w.Created.Time = time.Now().UTC()
+	return cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(webhookBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", webhookBucketName)
+		}
+		id, _ := b.NextSequence()
+		w.ID = fmt.Sprintf("%d", int(id))
+		buf, err := json.Marshal(w)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(w.ID), buf); err != nil {
+			return err
+		}
+		return putWebhookIndex(tx, w)
+	})
+}
+
+// webhookIndexPrefix returns the index prefix of webhooks registered for the job, or
+// for all jobs of the user if jobID is empty
+func webhookIndexPrefix(jobID string, userName string) []byte {
+	if jobID != "" {
+		return []byte("job\x00" + jobID + "\x00")
+	}
+	return []byte("user\x00" + userName + "\x00")
+}
+
+func putWebhookIndex(tx *bolt.Tx, w *datatype.Webhook) error {
+	b := tx.Bucket([]byte(webhookIndexBucketName))
+	if b == nil {
+		return fmt.Errorf("Bucket %s does not exist", webhookIndexBucketName)
+	}
+	return b.Put(append(webhookIndexPrefix(w.JobID, w.User), w.ID...), []byte(w.ID))
+}
+
+// buildWebhookIndex indexes webhooks stored before the index existed
+func buildWebhookIndex(tx *bolt.Tx) error {
+	b := tx.Bucket([]byte(webhookBucketName))
+	if b == nil {
+		return fmt.Errorf("Bucket %s does not exist", webhookBucketName)
+	}
+	return b.ForEach(func(k, v []byte) error {
+		var w datatype.Webhook
+		if err := json.Unmarshal(v, &w); err != nil {
+			return err
+		}
+		return putWebhookIndex(tx, &w)
+	})
+}
+
+// GetWebhooks returns webhooks of the user, or all webhooks if the user name is empty
+func (cgm *CloudGoalManager) GetWebhooks(userName string) (webhooks []*datatype.Webhook, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(webhookBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", webhookBucketName)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var w datatype.Webhook
+			if err := json.Unmarshal(v, &w); err != nil {
+				return err
+			}
+			if userName == "" || w.User == userName {
+				webhooks = append(webhooks, &w)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+func (cgm *CloudGoalManager) GetWebhook(id string) (webhook *datatype.Webhook, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(webhookBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", webhookBucketName)
+		}
+		v := b.Get([]byte(id))
+		if v == nil {
+			return fmt.Errorf("Webhook ID %q does not exist", id)
+		}
+		var w datatype.Webhook
+		if err := json.Unmarshal(v, &w); err != nil {
+			return err
+		}
+		webhook = &w
+		return nil
+	})
+	return
+}
+
+// GetWebhooksForJob returns webhooks registered for the job and webhooks the owner
+// of the job registered for all of their jobs
+func (cgm *CloudGoalManager) GetWebhooksForJob(job *datatype.Job) (webhooks []*datatype.Webhook, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(webhookBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", webhookBucketName)
+		}
+		i := tx.Bucket([]byte(webhookIndexBucketName))
+		if i == nil {
+			return fmt.Errorf("Bucket %s does not exist", webhookIndexBucketName)
+		}
+		for _, prefix := range [][]byte{webhookIndexPrefix(job.JobID, ""), webhookIndexPrefix("", job.User)} {
+			c := i.Cursor()
+			for k, id := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, id = c.Next() {
+				v := b.Get(id)
+				if v == nil {
+					continue
+				}
+				var w datatype.Webhook
+				if err := json.Unmarshal(v, &w); err != nil {
+					return err
+				}
+				webhooks = append(webhooks, &w)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// RemoveWebhook removes the webhook and its deliveries
+func (cgm *CloudGoalManager) RemoveWebhook(id string) error {
+	return cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(webhookBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", webhookBucketName)
+		}
+		v := b.Get([]byte(id))
+		if v == nil {
+			return fmt.Errorf("Webhook ID %q does not exist", id)
+		}
+		var w datatype.Webhook
+		if err := json.Unmarshal(v, &w); err != nil {
+			return err
+		}
+		if err := b.Delete([]byte(id)); err != nil {
+			return err
+		}
+		if i := tx.Bucket([]byte(webhookIndexBucketName)); i != nil {
+			if err := i.Delete(append(webhookIndexPrefix(w.JobID, w.User), w.ID...)); err != nil {
+				return err
+			}
+		}
+		if d := tx.Bucket([]byte(webhookDeliveryBucketName)); d != nil {
+			return d.Delete([]byte(id))
+		}
+		return nil
+	})
+}
+
+// RecordWebhookDelivery adds or updates the delivery in the recent deliveries of its webhook
+func (cgm *CloudGoalManager) RecordWebhookDelivery(delivery *datatype.WebhookDelivery) error {
+	return cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(webhookDeliveryBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", webhookDeliveryBucketName)
+		}
+		// the webhook may have been removed while delivering
+		if w := tx.Bucket([]byte(webhookBucketName)); w == nil || w.Get([]byte(delivery.WebhookID)) == nil {
+			return nil
+		}
+		var deliveries []*datatype.WebhookDelivery
+		if v := b.Get([]byte(delivery.WebhookID)); v != nil {
+			if err := json.Unmarshal(v, &deliveries); err != nil {
+				return err
+			}
+		}
+		found := false
+		for i, d := range deliveries {
+			if d.ID == delivery.ID {
+				deliveries[i] = delivery
+				found = true
+			}
+		}
+		if !found {
+			deliveries = append(deliveries, delivery)
+		}
+		if len(deliveries) > maxWebhookDeliveries {
+			deliveries = deliveries[len(deliveries)-maxWebhookDeliveries:]
+		}
+		buf, err := json.Marshal(deliveries)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(delivery.WebhookID), buf)
+	})
+}
+
+// GetWebhookDeliveries returns recent deliveries of the webhook, the latest first
+func (cgm *CloudGoalManager) GetWebhookDeliveries(webhookID string) (deliveries []*datatype.WebhookDelivery, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(webhookDeliveryBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", webhookDeliveryBucketName)
+		}
+		if v := b.Get([]byte(webhookID)); v != nil {
+			return json.Unmarshal(v, &deliveries)
+		}
+		return nil
+	})
+	for i, j := 0, len(deliveries)-1; i < j; i, j = i+1, j-1 {
+		deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+	}
+	return
+}
+
+// WebhookDispatcher posts events emitted by the goal manager to webhooks registered for the jobs
+type WebhookDispatcher struct {
+	goalManager *CloudGoalManager
+	client      *http.Client
+	// retryInterval is the wait before the first retry. It doubles on each retry
+	retryInterval time.Duration
+	// allowedNetworks are private networks webhooks are allowed to post to
+	allowedNetworks []*net.IPNet
+	mu              sync.Mutex
+	queue           []*pendingWebhookDelivery
+	wake            chan struct{}
+}
+
+// pendingWebhookDelivery is a delivery waiting in the queue for its next attempt
+type pendingWebhookDelivery struct {
+	webhook     *datatype.Webhook
+	payload     datatype.WebhookPayload
+	body        []byte
+	delivery    *datatype.WebhookDelivery
+	nextAttempt time.Time
+}
+
+// NewWebhookDispatcher returns a dispatcher that does not post to private, loopback, or link-local
+// addresses unless they are in allowedNetworks. Addresses are checked when connecting so that
+// host names resolving to such addresses are also rejected
+func NewWebhookDispatcher(goalManager *CloudGoalManager, allowedNetworks []*net.IPNet) *WebhookDispatcher {
+	d := &WebhookDispatcher{
+		goalManager:     goalManager,
+		retryInterval:   5 * time.Second,
+		allowedNetworks: allowedNetworks,
+		wake:            make(chan struct{}, webhookWorkers),
+	}
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			return d.checkAddress(address)
+		},
+	}
+	d.client = &http.Client{
+		Timeout: webhookTimeout,
+		// webhooks are posted directly as a proxy would connect to addresses not checked here
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+		},
+	}
+	return d
+}
+
+// checkAddress returns an error if webhooks must not post to the address, e.g. 127.0.0.1:80
+func (d *WebhookDispatcher) checkAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("invalid address %q", address)
+	}
+	if !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsUnspecified() {
+		return nil
+	}
+	for _, n := range d.allowedNetworks {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("webhooks are not allowed to post to %s", ip)
+}
+
+// ParseWebhookAllowedNetworks parses CIDRs of networks webhooks are allowed to post to, e.g. 10.0.0.0/8
+func ParseWebhookAllowedNetworks(cidrs []string) (networks []*net.IPNet, err error) {
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook allowed network %q: %s", cidr, err.Error())
+		}
+		networks = append(networks, n)
+	}
+	return
+}
+
+// Dispatch queues deliveries of the event to webhooks matching the event
+func (d *WebhookDispatcher) Dispatch(e datatype.SchedulerEvent) {
+	jobID := e.GetJobID()
+	if jobID == "" {
+		return
+	}
+	job, err := d.goalManager.GetJob(jobID)
+	if err != nil {
+		logger.Error.Printf("Failed to get job %q for webhooks: %s", jobID, err.Error())
+		return
+	}
+	webhooks, err := d.goalManager.GetWebhooksForJob(job)
+	if err != nil {
+		job.Logger().Error("failed to get webhooks", "error", err)
+		return
+	}
+	var team *datatype.Team
+	if job.Team != "" {
+		team, _ = d.goalManager.GetTeam(job.Team)
+	}
+	for _, w := range webhooks {
+		if !w.Matches(job, e.Type) {
+			continue
+		}
+		// webhooks of users the job is shared with stop when the job is no longer shared
+		if w.User != job.User && !job.GetRole(w.User, team).Includes(datatype.JobRoleViewer) {
+			continue
+		}
+		id, _ := uuid.NewV4()
+		payload := datatype.WebhookPayload{
+			DeliveryID: id.String(),
+			WebhookID:  w.ID,
+			Event:      e.Type,
+			Timestamp:  e.Timestamp,
+			JobID:      job.JobID,
+			JobName:    job.Name,
+			JobState:   job.State.GetState(),
+			Meta:       e.Meta,
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			logger.Error.Printf("Failed to encode payload for webhook %s: %s", w.ID, err.Error())
+			continue
+		}
+		d.enqueue(&pendingWebhookDelivery{
+			webhook: w,
+			payload: payload,
+			body:    body,
+			delivery: &datatype.WebhookDelivery{
+				ID:        payload.DeliveryID,
+				WebhookID: w.ID,
+				Event:     payload.Event,
+				JobID:     payload.JobID,
+			},
+			nextAttempt: time.Now(),
+		})
+	}
+}
+
+// enqueue adds the delivery to the queue and wakes up a worker
+func (d *WebhookDispatcher) enqueue(p *pendingWebhookDelivery) {
+	d.mu.Lock()
+	if len(d.queue) >= maxWebhookQueueLength {
+		logger.Error.Printf("Webhook queue is full. Dropping delivery %s to webhook %s", d.queue[0].delivery.ID, d.queue[0].webhook.ID)
+		d.queue = d.queue[1:]
+	}
+	d.queue = append(d.queue, p)
+	d.mu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextDue removes a delivery due for its attempt from the queue. It returns nil if none is due
+func (d *WebhookDispatcher) nextDue() *pendingWebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for i, p := range d.queue {
+		if !p.nextAttempt.After(now) {
+			d.queue = append(d.queue[:i], d.queue[i+1:]...)
+			return p
+		}
+	}
+	return nil
+}
+
+// Run posts queued deliveries with a fixed number of workers until the context is cancelled
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < webhookWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+	wg.Wait()
+	logger.Debug.Printf("Webhook dispatcher stopped")
+}
+
+// work attempts deliveries as they are due until the context is cancelled
+func (d *WebhookDispatcher) work(ctx context.Context) {
+	ticker := time.NewTicker(d.retryInterval / 2)
+	defer ticker.Stop()
+	for {
+		for p := d.nextDue(); p != nil && ctx.Err() == nil; p = d.nextDue() {
+			d.attempt(p)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// attempt posts the delivery and records the attempt in the deliveries of the webhook.
+// A failed delivery is queued again until it runs out of attempts. The wait before
+// the next attempt doubles on each retry
+func (d *WebhookDispatcher) attempt(p *pendingWebhookDelivery) {
+	delivery := p.delivery
+	delivery.Attempts += 1
+	delivery.Time.Time = time.Now().UTC()
+	var err error
+	delivery.StatusCode, err = d.post(p.webhook, p.payload, p.body)
+	if err == nil {
+		delivery.Delivered, delivery.Error = true, ""
+	} else {
+		delivery.Error = err.Error()
+	}
+	if err := d.goalManager.RecordWebhookDelivery(delivery); err != nil {
+		logger.Error.Printf("Failed to record delivery %s of webhook %s: %s", delivery.ID, p.webhook.ID, err.Error())
+	}
+	if delivery.Delivered {
+		logger.Debug.Printf("Delivered %s to webhook %s", p.payload.Event, p.webhook.ID)
+		return
+	}
+	if delivery.Attempts >= maxWebhookAttempts {
+		logger.Error.Printf("Failed to deliver %s to webhook %s after %d attempts. Dropping it: %s", p.payload.Event, p.webhook.ID, delivery.Attempts, delivery.Error)
+		return
+	}
+	p.nextAttempt = time.Now().Add(d.retryInterval * time.Duration(1<<(delivery.Attempts-1)))
+	logger.Info.Printf("Failed to deliver %s to webhook %s (attempt %d). Retrying at %s: %s", p.payload.Event, p.webhook.ID, delivery.Attempts, p.nextAttempt.Format(time.RFC3339), delivery.Error)
+	d.enqueue(p)
+}
+
+func (d *WebhookDispatcher) post(w *datatype.Webhook, payload datatype.WebhookPayload, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(payload.Event))
+	req.Header.Set(WebhookDeliveryHeader, payload.DeliveryID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(w.Secret, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload returns the signature of the payload, e.g. sha256=<hex digest>.
+// Receivers compute the same with their secret to verify the payload
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,199 @@
+package cloudscheduler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestWebhookDispatcher(t *testing.T) {
+	var mu sync.Mutex
+	var received []datatype.WebhookPayload
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(WebhookSignatureHeader) != SignWebhookPayload("secret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures -= 1
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p datatype.WebhookPayload
+		json.Unmarshal(body, &p)
+		received = append(received, p)
+	}))
+	defer server.Close()
+
+	cs := newTestCloudScheduler(t, &CloudSchedulerConfig{
+		// the test server listens on the loopback address
+		WebhookAllowedNetworks: []string{"127.0.0.0/8"},
+	})
+	cs.webhookDispatcher.retryInterval = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cs.webhookDispatcher.Run(ctx)
+	job := datatype.NewJob("job", "user", "")
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	webhook := &datatype.Webhook{
+		User:   "user",
+		JobID:  job.JobID,
+		URL:    server.URL,
+		Secret: "secret",
+		Events: []string{string(datatype.EventJobStatusRemoved)},
+	}
+	if err := cs.GoalManager.AddWebhook(webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	// not subscribed by the webhook
+	cs.webhookDispatcher.Dispatch(datatype.NewSchedulerEventBuilder(datatype.EventJobStatusSuspended).AddJob(job).Build())
+	cs.webhookDispatcher.Dispatch(datatype.NewSchedulerEventBuilder(datatype.EventJobStatusRemoved).AddJob(job).Build())
+
+	var deliveries []*datatype.WebhookDelivery
+	for i := 0; i < 100; i++ {
+		deliveries, _ = cs.GoalManager.GetWebhookDeliveries(webhook.ID)
+		if len(deliveries) > 0 && deliveries[0].Delivered {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("wanted 1 delivery, got %d", len(deliveries))
+	}
+	if d := deliveries[0]; !d.Delivered || d.Attempts != 2 || d.StatusCode != http.StatusOK || d.Event != datatype.EventJobStatusRemoved {
+		t.Errorf("unexpected delivery %+v", d)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || received[0].JobID != job.JobID || received[0].DeliveryID != deliveries[0].ID {
+		t.Errorf("unexpected payloads %+v", received)
+	}
+
+	if err := cs.GoalManager.RemoveWebhook(webhook.ID); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries, _ := cs.GoalManager.GetWebhookDeliveries(webhook.ID); len(deliveries) != 0 {
+		t.Errorf("expected deliveries removed with the webhook, got %d", len(deliveries))
+	}
+}
+
+func TestWebhookDispatcherQueue(t *testing.T) {
+	d := NewWebhookDispatcher(nil, nil)
+	for i := 0; i < maxWebhookQueueLength+1; i++ {
+		d.enqueue(&pendingWebhookDelivery{
+			webhook:     &datatype.Webhook{ID: "1"},
+			delivery:    &datatype.WebhookDelivery{ID: strconv.Itoa(i)},
+			nextAttempt: time.Now().Add(time.Hour),
+		})
+	}
+	if len(d.queue) != maxWebhookQueueLength || d.queue[0].delivery.ID != "1" {
+		t.Errorf("expected the oldest delivery dropped from the full queue, got %d deliveries", len(d.queue))
+	}
+	if p := d.nextDue(); p != nil {
+		t.Errorf("expected no delivery due, got %s", p.delivery.ID)
+	}
+
+	// workers stop when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(stopped)
+	}()
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the dispatcher to stop")
+	}
+}
+
+func TestWebhookDispatcherRejectsPrivateAddresses(t *testing.T) {
+	allowed, err := ParseWebhookAllowedNetworks([]string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewWebhookDispatcher(nil, allowed)
+	for address, ok := range map[string]bool{
+		"93.184.216.34:443":     true,
+		"[2606:4700::1]:443":    true,
+		"10.1.2.3:80":           true,
+		"10.2.0.1:80":           false,
+		"127.0.0.1:8080":        false,
+		"192.168.1.1:80":        false,
+		"169.254.169.254:80":    false,
+		"0.0.0.0:80":            false,
+		"[::1]:80":              false,
+		"[fe80::1]:80":          false,
+		"[::ffff:127.0.0.1]:80": false,
+	} {
+		if err := d.checkAddress(address); (err == nil) != ok {
+			t.Errorf("%s: expected allowed to be %v, but got error %v", address, ok, err)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("webhook should not have been posted to the loopback address")
+	}))
+	defer server.Close()
+	if _, err := NewWebhookDispatcher(nil, nil).post(&datatype.Webhook{URL: server.URL}, datatype.WebhookPayload{}, []byte("{}")); err == nil {
+		t.Error("expected posting to the loopback address to fail")
+	}
+	if _, err := ParseWebhookAllowedNetworks([]string{"10.0.0.1"}); err == nil {
+		t.Error("expected an error for a network without a prefix length")
+	}
+}
+
+func TestGetWebhooksForJob(t *testing.T) {
+	cs := newTestCloudScheduler(t, nil)
+	job := datatype.NewJob("job", "user", "")
+	job.UpdateJobID(cs.GoalManager.AddJob(job))
+	otherJob := datatype.NewJob("other-job", "user", "")
+	otherJob.UpdateJobID(cs.GoalManager.AddJob(otherJob))
+	webhooks := map[string]*datatype.Webhook{
+		"all jobs of the owner":     {User: "user"},
+		"the job":                   {User: "user", JobID: job.JobID},
+		"the job by a shared user":  {User: "shared-user", JobID: job.JobID},
+		"another job":               {User: "user", JobID: otherJob.JobID},
+		"all jobs of another user":  {User: "shared-user"},
+		"all jobs of user's prefix": {User: "use"},
+	}
+	for _, w := range webhooks {
+		w.URL = "https://example.com"
+		if err := cs.GoalManager.AddWebhook(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cs.GoalManager.RemoveWebhook(webhooks["the job"].ID); err != nil {
+		t.Fatal(err)
+	}
+	found, err := cs.GoalManager.GetWebhooksForJob(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for _, w := range found {
+		ids[w.ID] = true
+	}
+	for _, name := range []string{"all jobs of the owner", "the job by a shared user"} {
+		if !ids[webhooks[name].ID] {
+			t.Errorf("expected webhook of %s to be found", name)
+		}
+	}
+	if len(found) != 2 {
+		t.Errorf("expected 2 webhooks, got %d", len(found))
+	}
+}
@@ -61,6 +61,9 @@ func (s *SchedulerEventBuilder) AddEntry(k string, v interface{}) *SchedulerEven
 
 func (s *SchedulerEventBuilder) AddPluginRuntimeMeta(pr PluginRuntime) *SchedulerEventBuilder {
 	s.e.Meta["pluginruntime_pod_instance"] = pr.PodInstance
+	if pr.Compute != "" {
+		s.e.Meta["pluginruntime_compute"] = pr.Compute
+	}
 	return s
 }
 
@@ -73,6 +76,9 @@ func (s *SchedulerEventBuilder) AddPluginMeta(plugin Plugin) *SchedulerEventBuil
 	if err == nil {
 		s.e.Meta["plugin_selector"] = string(selectors)
 	}
+	if plugin.PluginSpec.Mode != "" {
+		s.e.Meta["plugin_mode"] = string(plugin.PluginSpec.Mode)
+	}
 	s.e.Meta["goal_id"] = plugin.GoalID
 	return s
 }
@@ -193,13 +199,22 @@ const (
 	EventRabbitMQSubscriptionPatternGoals   string = "sys.scheduler.status.goal.#"
 	EventRabbitMQSubscriptionPatternPlugins string = "sys.scheduler.status.plugin.#"
 	// EventSchedulingDecisionScheduled EventType = "sys.scheduler.decision.scheduled"
+	EventJobStatusRunning       EventType = "sys.scheduler.status.job.running"
 	EventJobStatusSuspended     EventType = "sys.scheduler.status.job.suspended"
 	EventJobStatusRemoved       EventType = "sys.scheduler.status.job.removed"
+	EventJobStatusCompleted     EventType = "sys.scheduler.status.job.completed"
+	EventJobStatusReevaluated   EventType = "sys.scheduler.status.job.reevaluated"
+	EventJobStatusHealthChanged EventType = "sys.scheduler.status.job.health"
 	EventGoalStatusSubmitted    EventType = "sys.scheduler.status.goal.submitted"
 	EventGoalStatusUpdated      EventType = "sys.scheduler.status.goal.updated"
 	EventGoalStatusReceived     EventType = "sys.scheduler.status.goal.received"
 	EventGoalStatusReceivedBulk EventType = "sys.scheduler.status.goal.received.bulk"
 	EventGoalStatusRemoved      EventType = "sys.scheduler.status.goal.removed"
+	EventGoalStatusReady        EventType = "sys.scheduler.status.goal.ready"
+
+	EventGoalStatusImagePulling    EventType = "sys.scheduler.status.goal.image.pulling"
+	EventGoalStatusImagePulled     EventType = "sys.scheduler.status.goal.image.pulled"
+	EventGoalStatusImagePullFailed EventType = "sys.scheduler.status.goal.image.failed"
 
 	EventPluginStatusQueued       EventType = "sys.scheduler.status.plugin.queued"
 	EventPluginStatusSelected     EventType = "sys.scheduler.status.plugin.selected"
@@ -210,8 +225,14 @@ const (
 	EventPluginLastExecution      EventType = "sys.scheduler.plugin.lastexecution"
 	EventPluginStatusFailed       EventType = "sys.scheduler.status.plugin.failed"
 	EventPluginStatusEvent        EventType = "sys.scheduler.status.plugin.event"
+	EventPluginStatusHealthy      EventType = "sys.scheduler.status.plugin.healthy"
+	EventPluginStatusUnhealthy    EventType = "sys.scheduler.status.plugin.unhealthy"
+	EventPluginStatusStopped      EventType = "sys.scheduler.status.plugin.stopped"
 	EventFailure                  EventType = "sys.scheduler.failure"
 
+	// EventPluginExecutionDigest summarizes plugin executions on the node periodically
+	EventPluginExecutionDigest EventType = "sys.scheduler.digest.execution"
+
 	// Deprecated: use EventPluginStatusScheduled instead
 	EventPluginStatusLaunched EventType = "sys.scheduler.status.plugin.launched"
 
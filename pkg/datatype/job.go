@@ -3,9 +3,11 @@ package datatype
 import (
 	"bytes"
 	"encoding/json"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 	"gopkg.in/yaml.v2"
 )
 
@@ -19,6 +21,9 @@ const (
 	JobComplete  JobState = "Completed"
 	JobSuspended JobState = "Suspended"
 	JobRemoved   JobState = "Removed"
+	// JobFailure is not a state of jobs. It is used in NotificationOn to be notified
+	// when the job becomes degraded or failed by failures of its plugins
+	JobFailure JobState = "Failure"
 )
 
 type Time struct {
@@ -53,6 +58,8 @@ type State struct {
 	LastSubmitted Time     `json:"last_submitted" yaml:"lastSubmitted"`
 	LastStarted   Time     `json:"last_started" yaml:"lastStarted"`
 	LastCompleted Time     `json:"last_completed" yaml:"lastCompleted"`
+	// FirstSubmitted is set on the first submission and kept when the job is resubmitted
+	FirstSubmitted Time `json:"first_submitted,omitempty" yaml:"firstSubmitted,omitempty"`
 }
 
 func (s *State) GetState() JobState {
@@ -65,6 +72,9 @@ func (s *State) UpdateState(newState JobState) {
 	switch newState {
 	case JobSubmitted:
 		s.LastSubmitted.Time = s.LastUpdated.Time
+		if s.FirstSubmitted.IsZero() {
+			s.FirstSubmitted.Time = s.LastUpdated.Time
+		}
 	case JobRunning:
 		s.LastStarted.Time = s.LastUpdated.Time
 	case JobComplete, JobSuspended, JobRemoved:
@@ -74,18 +84,34 @@ func (s *State) UpdateState(newState JobState) {
 
 // Job structs user request for jobs
 type Job struct {
-	Name            string                 `json:"name" yaml:"name"`
-	JobID           string                 `json:"job_id,omitempty" yaml:"jobID,omitempty"`
-	User            string                 `json:"user,omitempty" yaml:"user,omitempty"`
-	Email           string                 `json:"email,omitempty" yaml:"email,omitempty"`
-	NotificationOn  []JobState             `json:"notification_on,omitempty" yaml:"notificationOn,omitempty"`
-	Plugins         []*Plugin              `json:"plugins,omitempty" yaml:"plugins,omitempty"`
-	NodeTags        []string               `json:"node_tags" yaml:"nodeTags"`
-	Nodes           map[string]interface{} `json:"nodes" yaml:"nodes"`
-	ScienceRules    []string               `json:"science_rules" yaml:"scienceRules"`
-	SuccessCriteria []string               `json:"success_criteria" yaml:"successCriteria"`
-	ScienceGoal     *ScienceGoal           `json:"science_goal,omitempty" yaml:"scienceGoal,omitempty"`
-	State           State                  `json:"state,omitempty" yaml:"state,omitempty"`
+	Name           string                 `json:"name" yaml:"name"`
+	JobID          string                 `json:"job_id,omitempty" yaml:"jobID,omitempty"`
+	User           string                 `json:"user,omitempty" yaml:"user,omitempty"`
+	Email          string                 `json:"email,omitempty" yaml:"email,omitempty"`
+	NotificationOn []JobState             `json:"notification_on,omitempty" yaml:"notificationOn,omitempty"`
+	Plugins        []*Plugin              `json:"plugins,omitempty" yaml:"plugins,omitempty"`
+	NodeTags       []string               `json:"node_tags" yaml:"nodeTags"`
+	Nodes          map[string]interface{} `json:"nodes" yaml:"nodes"`
+	// TaggedNodes are the nodes in Nodes selected by NodeTags
+	TaggedNodes     []string `json:"tagged_nodes,omitempty" yaml:"taggedNodes,omitempty"`
+	ScienceRules    []string `json:"science_rules" yaml:"scienceRules"`
+	SuccessCriteria []string `json:"success_criteria" yaml:"successCriteria"`
+	// StartTime and EndTime bound when the job runs. Duration ends the job the duration after
+	// its start time, or its first submission if no start time is given
+	StartTime   Time         `json:"start_time" yaml:"startTime,omitempty"`
+	EndTime     Time         `json:"end_time" yaml:"endTime,omitempty"`
+	Duration    string       `json:"duration,omitempty" yaml:"duration,omitempty"`
+	ScienceGoal *ScienceGoal `json:"science_goal,omitempty" yaml:"scienceGoal,omitempty"`
+	State       State        `json:"state,omitempty" yaml:"state,omitempty"`
+	// PluginStats counts runs of plugins per node
+	PluginStats map[string]map[string]*PluginStats `json:"plugin_stats,omitempty" yaml:"pluginStats,omitempty"`
+	Health      JobHealth                          `json:"health,omitempty" yaml:"health,omitempty"`
+	// GoalStatus is the delivery of the science goal per node
+	GoalStatus map[string]*NodeGoalStatus `json:"goal_status,omitempty" yaml:"goalStatus,omitempty"`
+	// Team shares the job with members of the team in their roles
+	Team string `json:"team,omitempty" yaml:"team,omitempty"`
+	// Collaborators are users the job is shared with and their roles
+	Collaborators map[string]JobRole `json:"collaborators,omitempty" yaml:"collaborators,omitempty"`
 }
 
 func NewJob(name string, user string, jobID string) *Job {
@@ -97,6 +123,11 @@ func NewJob(name string, user string, jobID string) *Job {
 	}
 }
 
+// Logger returns a logger with the ID and user of the job
+func (j *Job) Logger() *logger.Entry {
+	return logger.With(logger.FieldJobID, j.JobID, "user", j.User)
+}
+
 func (j *Job) SetNotification(email string, on []JobState) {
 	j.Email = email
 	j.NotificationOn = on
@@ -118,6 +149,10 @@ func (j *Job) Runs() {
 	j.UpdateState(JobRunning)
 }
 
+func (j *Job) Completed() {
+	j.UpdateState(JobComplete)
+}
+
 func (j *Job) Suspended() {
 	j.UpdateState(JobSuspended)
 }
@@ -130,6 +165,59 @@ func (j *Job) UpdateState(newState JobState) {
 	j.State.UpdateState(newState)
 }
 
+// getPluginStats returns stats of the plugin on the node. Node names are VSNs, e.g. W023
+func (j *Job) getPluginStats(nodeName string, pluginName string) *PluginStats {
+	if j.PluginStats == nil {
+		j.PluginStats = make(map[string]map[string]*PluginStats)
+	}
+	nodeName = strings.ToUpper(nodeName)
+	if _, exist := j.PluginStats[nodeName]; !exist {
+		j.PluginStats[nodeName] = make(map[string]*PluginStats)
+	}
+	if _, exist := j.PluginStats[nodeName][pluginName]; !exist {
+		j.PluginStats[nodeName][pluginName] = &PluginStats{}
+	}
+	return j.PluginStats[nodeName][pluginName]
+}
+
+// RecordPluginSuccess counts a successful run of the plugin on the node
+func (j *Job) RecordPluginSuccess(nodeName string, pluginName string) {
+	stats := j.getPluginStats(nodeName, pluginName)
+	stats.Successes += 1
+	stats.ConsecutiveFailures = 0
+}
+
+// RecordPluginFailure counts a failure of the plugin on the node and keeps the latest failures
+func (j *Job) RecordPluginFailure(nodeName string, pluginName string, failure PluginFailure) {
+	stats := j.getPluginStats(nodeName, pluginName)
+	stats.Failures += 1
+	stats.ConsecutiveFailures += 1
+	stats.RecentFailures = append(stats.RecentFailures, failure)
+	if len(stats.RecentFailures) > maxRecentFailures {
+		stats.RecentFailures = stats.RecentFailures[len(stats.RecentFailures)-maxRecentFailures:]
+	}
+}
+
+// GetSuccessfulRuns returns the number of successful runs of the plugin on the node
+func (j *Job) GetSuccessfulRuns(nodeName string, pluginName string) int {
+	if stats, exist := j.PluginStats[strings.ToUpper(nodeName)][pluginName]; exist {
+		return stats.Successes
+	}
+	return 0
+}
+
+// GetSuccessCriteria returns parsed success criteria of the job
+func (j *Job) GetSuccessCriteria() (criteria []*SuccessCriterion, err error) {
+	for _, c := range j.SuccessCriteria {
+		criterion, err := NewSuccessCriterion(c)
+		if err != nil {
+			return nil, err
+		}
+		criteria = append(criteria, criterion)
+	}
+	return
+}
+
 func (j *Job) AddNodes(nodeNames []string) {
 	for _, nodeName := range nodeNames {
 		if _, exist := j.Nodes[nodeName]; !exist {
@@ -138,6 +226,43 @@ func (j *Job) AddNodes(nodeNames []string) {
 	}
 }
 
+// ResolveNodeTags updates the nodes selected by node tags with given nodes matching the tags.
+// Nodes listed in the job by name are kept. It returns the nodes added to and removed from the job
+func (j *Job) ResolveNodeTags(nodeNames []string) (added []string, removed []string) {
+	tagged := make(map[string]bool)
+	for _, nodeName := range j.TaggedNodes {
+		tagged[nodeName] = true
+	}
+	matched := make(map[string]bool)
+	var newTaggedNodes []string
+	for _, nodeName := range nodeNames {
+		if _, exist := j.Nodes[nodeName]; exist && !tagged[nodeName] {
+			// the node is listed by name
+			continue
+		}
+		if matched[nodeName] {
+			continue
+		}
+		matched[nodeName] = true
+		newTaggedNodes = append(newTaggedNodes, nodeName)
+		if _, exist := j.Nodes[nodeName]; !exist {
+			j.Nodes[nodeName] = 1
+			added = append(added, nodeName)
+		}
+	}
+	for _, nodeName := range j.TaggedNodes {
+		if _, exist := j.Nodes[nodeName]; exist && !matched[nodeName] {
+			delete(j.Nodes, nodeName)
+			removed = append(removed, nodeName)
+		}
+	}
+	sort.Strings(newTaggedNodes)
+	sort.Strings(added)
+	sort.Strings(removed)
+	j.TaggedNodes = newTaggedNodes
+	return
+}
+
 func (j *Job) DropNode(nodeName string) {
 	if _, exist := j.Nodes[nodeName]; exist {
 		delete(j.Nodes, nodeName)
@@ -159,7 +284,15 @@ func (j *Job) ConvertToTemplate() (template Job) {
 	nodeTags := j.NodeTags
 	template.NodeTags = nodeTags
 	template.Nodes = make(map[string]interface{})
+	tagged := make(map[string]bool)
+	for _, nodeName := range j.TaggedNodes {
+		tagged[nodeName] = true
+	}
 	for k, v := range j.Nodes {
+		// nodes selected by tags are resolved again when the template is submitted
+		if tagged[k] {
+			continue
+		}
 		template.Nodes[k] = v
 	}
 	for _, plugin := range j.Plugins {
@@ -180,6 +313,9 @@ func (j *Job) ConvertToTemplate() (template Job) {
 	}
 	successCriteria := j.SuccessCriteria
 	template.SuccessCriteria = successCriteria
+	template.StartTime = j.StartTime
+	template.EndTime = j.EndTime
+	template.Duration = j.Duration
 	return
 }
 
@@ -0,0 +1,94 @@
+package datatype
+
+import "fmt"
+
+type JobHealth string
+
+const (
+	JobHealthy  JobHealth = "Healthy"
+	JobDegraded JobHealth = "Degraded"
+	JobFailed   JobHealth = "Failed"
+)
+
+// maxRecentFailures is the number of failures kept for a plugin on a node
+const maxRecentFailures = 5
+
+// PluginFailure is a failure of a plugin reported by a node
+type PluginFailure struct {
+	Time       Time   `json:"time" yaml:"time"`
+	Reason     string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	ReturnCode *int   `json:"return_code,omitempty" yaml:"returnCode,omitempty"`
+	ErrorLog   string `json:"error_log,omitempty" yaml:"errorLog,omitempty"`
+}
+
+// PluginStats counts runs of a plugin of a job on a node along with its latest state
+type PluginStats struct {
+	LastState           string          `json:"last_state,omitempty" yaml:"lastState,omitempty"`
+	LastUpdated         Time            `json:"last_updated" yaml:"lastUpdated"`
+	LastRun             Time            `json:"last_run" yaml:"lastRun"`
+	Successes           int             `json:"successes" yaml:"successes"`
+	Failures            int             `json:"failures" yaml:"failures"`
+	ConsecutiveFailures int             `json:"consecutive_failures" yaml:"consecutiveFailures"`
+	RecentFailures      []PluginFailure `json:"recent_failures,omitempty" yaml:"recentFailures,omitempty"`
+}
+
+// JobHealthRule decides health of a job from its plugins on nodes. A plugin is failing on a node
+// when it failed ConsecutiveFailures times in a row. The job is degraded when the ratio of failing
+// plugins to the plugins that have run on the nodes is greater than DegradedRatio, and failed when
+// the ratio reaches FailedRatio
+type JobHealthRule struct {
+	ConsecutiveFailures int     `json:"consecutive_failures" yaml:"consecutiveFailures"`
+	DegradedRatio       float64 `json:"degraded_ratio" yaml:"degradedRatio"`
+	FailedRatio         float64 `json:"failed_ratio" yaml:"failedRatio"`
+}
+
+// DefaultJobHealthRule degrades a job when any plugin fails 3 times in a row on a node
+// and fails the job when all of them do
+func DefaultJobHealthRule() JobHealthRule {
+	return JobHealthRule{
+		ConsecutiveFailures: 3,
+		DegradedRatio:       0,
+		FailedRatio:         1,
+	}
+}
+
+// Validate returns an error if the rule cannot be applied
+func (r JobHealthRule) Validate() error {
+	if r.ConsecutiveFailures < 1 {
+		return fmt.Errorf("consecutive failures must be at least 1")
+	}
+	if r.DegradedRatio < 0 || r.DegradedRatio > 1 || r.FailedRatio < 0 || r.FailedRatio > 1 {
+		return fmt.Errorf("ratios must be between 0 and 1")
+	}
+	return nil
+}
+
+// Evaluate returns health of a job with given stats of plugins per node.
+// It returns an empty health if no plugin has run
+func (r JobHealthRule) Evaluate(stats map[string]map[string]*PluginStats) JobHealth {
+	total, failing := 0, 0
+	for _, plugins := range stats {
+		for _, s := range plugins {
+			// plugins that have not finished a run yet do not count
+			if s.Successes+s.Failures == 0 {
+				continue
+			}
+			total += 1
+			if s.ConsecutiveFailures >= r.ConsecutiveFailures {
+				failing += 1
+			}
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+	ratio := float64(failing) / float64(total)
+	switch {
+	case failing > 0 && ratio >= r.FailedRatio:
+		return JobFailed
+	case failing > 0 && ratio > r.DegradedRatio:
+		return JobDegraded
+	default:
+		return JobHealthy
+	}
+}
@@ -0,0 +1,44 @@
+package datatype
+
+import "testing"
+
+func TestJobHealthRule(t *testing.T) {
+	rule := DefaultJobHealthRule()
+	failTimes := func(j *Job, nodeName string, n int) {
+		for i := 0; i < n; i++ {
+			j.RecordPluginFailure(nodeName, "plugin-a", PluginFailure{Reason: "Error"})
+		}
+	}
+	j := NewJob("job", "user", "1")
+	if h := rule.Evaluate(j.PluginStats); h != "" {
+		t.Errorf("wanted no health without runs, got %q", h)
+	}
+	j.RecordPluginSuccess("W001", "plugin-a")
+	j.RecordPluginSuccess("W002", "plugin-a")
+	if h := rule.Evaluate(j.PluginStats); h != JobHealthy {
+		t.Errorf("wanted %s, got %q", JobHealthy, h)
+	}
+	failTimes(j, "W001", 2)
+	if h := rule.Evaluate(j.PluginStats); h != JobHealthy {
+		t.Errorf("wanted %s before reaching consecutive failures, got %q", JobHealthy, h)
+	}
+	failTimes(j, "W001", 1)
+	if h := rule.Evaluate(j.PluginStats); h != JobDegraded {
+		t.Errorf("wanted %s, got %q", JobDegraded, h)
+	}
+	failTimes(j, "W002", 10)
+	if h := rule.Evaluate(j.PluginStats); h != JobFailed {
+		t.Errorf("wanted %s, got %q", JobFailed, h)
+	}
+	if n := len(j.PluginStats["W002"]["plugin-a"].RecentFailures); n != maxRecentFailures {
+		t.Errorf("wanted %d recent failures, got %d", maxRecentFailures, n)
+	}
+	// a success recovers the plugin on the node
+	j.RecordPluginSuccess("w002", "plugin-a")
+	if h := rule.Evaluate(j.PluginStats); h != JobDegraded {
+		t.Errorf("wanted %s after recovery, got %q", JobDegraded, h)
+	}
+	if s := j.PluginStats["W002"]["plugin-a"]; s.Successes != 2 || s.Failures != 10 {
+		t.Errorf("wanted 2 successes and 10 failures, got %d and %d", s.Successes, s.Failures)
+	}
+}
@@ -0,0 +1,69 @@
+package datatype
+
+import (
+	"fmt"
+	"time"
+)
+
+// IsHeld returns true if the job waits for its start time
+func (j *Job) IsHeld(now time.Time) bool {
+	return !j.StartTime.IsZero() && now.Before(j.StartTime.Time)
+}
+
+// GetEndTime returns the time the job ends. It returns zero time if the job does not end
+func (j *Job) GetEndTime() time.Time {
+	if !j.EndTime.IsZero() {
+		return j.EndTime.Time
+	}
+	if j.Duration == "" {
+		return time.Time{}
+	}
+	d, err := parseDuration(j.Duration)
+	if err != nil {
+		return time.Time{}
+	}
+	// resubmitting the job, e.g. after suspension, does not restart its window
+	start := j.StartTime.Time
+	if start.IsZero() {
+		start = j.State.FirstSubmitted.Time
+	}
+	// jobs submitted before FirstSubmitted was recorded
+	if start.IsZero() {
+		start = j.State.LastSubmitted.Time
+	}
+	if start.IsZero() {
+		return time.Time{}
+	}
+	return start.Add(d)
+}
+
+// HasEnded returns true if the end time of the job has passed
+func (j *Job) HasEnded(now time.Time) bool {
+	end := j.GetEndTime()
+	return !end.IsZero() && !now.Before(end)
+}
+
+// ValidateTimeWindow returns an error if the job cannot run in its time window
+func (j *Job) ValidateTimeWindow(now time.Time) error {
+	if !j.EndTime.IsZero() && j.Duration != "" {
+		return fmt.Errorf("endTime and duration cannot be given together")
+	}
+	if j.Duration != "" {
+		d, err := parseDuration(j.Duration)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %s", j.Duration, err.Error())
+		}
+		if d <= 0 {
+			return fmt.Errorf("duration %q must be positive", j.Duration)
+		}
+	}
+	if !j.EndTime.IsZero() {
+		if !j.StartTime.IsZero() && !j.EndTime.After(j.StartTime.Time) {
+			return fmt.Errorf("endTime %s must be after startTime %s", j.EndTime.Format(time.RFC3339), j.StartTime.Format(time.RFC3339))
+		}
+		if !j.EndTime.After(now) {
+			return fmt.Errorf("endTime %s has passed", j.EndTime.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package datatype
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestJobTimeWindow(t *testing.T) {
+	var j Job
+	err := yaml.Unmarshal([]byte(`
+name: campaign
+startTime: 2024-06-01T00:00:00Z
+duration: 3d
+`), &j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	if !j.StartTime.Equal(start) {
+		t.Errorf("wanted start time %s, got %s", start, j.StartTime.Time)
+	}
+	if end := j.GetEndTime(); !end.Equal(start.Add(72 * time.Hour)) {
+		t.Errorf("wanted end time 3 days after start, got %s", end)
+	}
+	if !j.IsHeld(start.Add(-time.Minute)) || j.IsHeld(start) {
+		t.Error("expected the job held only before its start time")
+	}
+	if j.HasEnded(start.Add(71*time.Hour)) || !j.HasEnded(start.Add(72*time.Hour)) {
+		t.Error("expected the job ended at its end time")
+	}
+	if err := j.ValidateTimeWindow(start); err != nil {
+		t.Errorf("expected valid time window: %s", err.Error())
+	}
+
+	// without start time the duration counts from the first submission
+	j = Job{Duration: "90m"}
+	if !j.GetEndTime().IsZero() {
+		t.Error("expected no end time before submission")
+	}
+	j.Submitted()
+	end := j.GetEndTime()
+	if !end.Equal(j.State.LastSubmitted.Add(90 * time.Minute)) {
+		t.Errorf("wanted end time 90 minutes after submission, got %s", end)
+	}
+	j.Suspended()
+	j.State.LastSubmitted.Time = j.State.LastSubmitted.Add(-time.Hour)
+	j.State.FirstSubmitted.Time = j.State.LastSubmitted.Time
+	end = j.GetEndTime()
+	j.Submitted()
+	if resubmitted := j.GetEndTime(); !resubmitted.Equal(end) {
+		t.Errorf("expected resubmission to keep end time %s, got %s", end, resubmitted)
+	}
+
+	now := time.Now()
+	for name, job := range map[string]Job{
+		"end and duration":  {EndTime: Time{now.Add(time.Hour)}, Duration: "1h"},
+		"invalid duration":  {Duration: "one hour"},
+		"negative duration": {Duration: "-1h"},
+		"end before start":  {StartTime: Time{now.Add(2 * time.Hour)}, EndTime: Time{now.Add(time.Hour)}},
+		"end passed":        {EndTime: Time{now.Add(-time.Hour)}},
+	} {
+		if err := job.ValidateTimeWindow(now); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -57,19 +57,75 @@ func (n *NodeManifest) GetPluginArchitectureSupportedComputes(pManifest *PluginM
 	return
 }
 
-// GetUnsupportedListOfPluginSensors returns a list of unsupported sensors by the node
+// GetGPUMemoryInMega returns the sum of GPU memory in Mi of the computes that have GPU
+func (n *NodeManifest) GetGPUMemoryInMega() (total int) {
+	for _, m := range n.GetGPUMemoryPerCompute() {
+		total += m
+	}
+	return
+}
+
+// GetGPUMemoryPerCompute returns GPU memory in Mi of the computes that have GPU keyed by compute names.
+// Computes with unknown GPU memory are left out
+func (n *NodeManifest) GetGPUMemoryPerCompute() map[string]int {
+	computes := make(map[string]int)
+	for _, c := range n.Computes {
+		if !c.Hardware.HasCapability("gpu") {
+			continue
+		}
+		r := Resource{GPUMemory: c.Hardware.GPURAM}
+		if m := r.GetGPUMemoryInMega(); m > 0 {
+			computes[c.Name] = m
+		}
+	}
+	return computes
+}
+
+// GetUnsupportedListOfPluginSensors returns a list of unsupported sensors by the node.
+// Hardware required by the plugin is supported if a sensor of the node has the name or
+// a label of the hardware, or any compute of the node has it as a capability, e.g. gpu
 func (n *NodeManifest) GetUnsupportedListOfPluginSensors(plugin *PluginManifest) (result bool, notSupported []string) {
-	// TODO: plugin manifest does not yet have sensor list. Once it has a sensor list we will implement this function
-	// for requiredHardware := range plugin.Hardware {
-	// 	if _, exist := n.Hardware[requiredHardware]; !exist {
-	// 		notSupported = append(notSupported, requiredHardware)
-	// 	}
-	// }
-	// if len(notSupported) == 0 {
-	// 	result = true
-	// } else {
-	// 	result = false
-	// }
+	var requiredSensors []string
+	for requiredHardware, required := range plugin.Hardware {
+		if required {
+			requiredSensors = append(requiredSensors, requiredHardware)
+		}
+	}
+	return n.GetUnsupportedSensors(requiredSensors)
+}
+
+// GetUnsupportedSensors returns a list of given sensors that the node does not have
+func (n *NodeManifest) GetUnsupportedSensors(sensors []string) (result bool, notSupported []string) {
+	for _, sensor := range sensors {
+		if len(n.FindSensors(sensor)) > 0 {
+			continue
+		}
+		supportedByCompute := false
+		for _, c := range n.Computes {
+			if c.Hardware.HasCapability(sensor) {
+				supportedByCompute = true
+				break
+			}
+		}
+		if !supportedByCompute {
+			notSupported = append(notSupported, sensor)
+		}
+	}
+	if len(notSupported) == 0 {
+		result = true
+	} else {
+		result = false
+	}
+	return
+}
+
+// FindSensors returns sensors of the node that match given name by their name or labels
+func (n *NodeManifest) FindSensors(name string) (found []SensorManifest) {
+	for _, s := range n.Sensors {
+		if s.Matches(name) {
+			found = append(found, s)
+		}
+	}
 	return
 }
 
@@ -134,12 +190,43 @@ func (c *ComputeHardwareManifest) GetArchitecture() string {
 	return ""
 }
 
+// HasCapability returns true if the hardware has given capability, e.g. gpu
+func (c *ComputeHardwareManifest) HasCapability(capability string) bool {
+	for _, cap := range c.Capabilities {
+		if cap == capability {
+			return true
+		}
+	}
+	return false
+}
+
 type SensorManifest struct {
 	Name   string   `json:"name" yaml:"name"`
 	Scope  string   `json:"scope" yaml:"scope"`
 	Labels []string `json:"labels" yaml:"labels"`
 }
 
+// SensorScopeGlobal is the scope of sensors accessible from any compute of the node, e.g. network cameras
+const SensorScopeGlobal = "global"
+
+// Matches returns true if the sensor has given name or label
+func (s *SensorManifest) Matches(name string) bool {
+	if s.Name == name {
+		return true
+	}
+	for _, label := range s.Labels {
+		if label == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAttachedTo returns true if the sensor is accessible from given compute
+func (s *SensorManifest) IsAttachedTo(compute string) bool {
+	return s.Scope == "" || s.Scope == SensorScopeGlobal || s.Scope == compute
+}
+
 type SensorHardwareManifest struct {
 	Hardware     string   `json:"hardware" yaml:"hardware"`
 	Model        string   `json:"hw_model" yaml:"hwModel"`
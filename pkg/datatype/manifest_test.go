@@ -0,0 +1,37 @@
+package datatype
+
+import "testing"
+
+func TestUnsupportedPluginSensors(t *testing.T) {
+	node := &NodeManifest{
+		Computes: []ComputeManifest{
+			{Name: "nxcore", Hardware: ComputeHardwareManifest{Capabilities: []string{"arm64", "gpu"}}},
+		},
+		Sensors: []SensorManifest{
+			{Name: "bottom_camera", Scope: "global", Labels: []string{"camera"}},
+			{Name: "microphone", Scope: "rpi"},
+		},
+	}
+	tests := map[string]struct {
+		Hardware map[string]bool
+		Wants    []string
+	}{
+		"by name":        {Hardware: map[string]bool{"bottom_camera": true, "microphone": true}},
+		"by label":       {Hardware: map[string]bool{"camera": true}},
+		"compute":        {Hardware: map[string]bool{"gpu": true}},
+		"not required":   {Hardware: map[string]bool{"thermal_camera": false}},
+		"not supported":  {Hardware: map[string]bool{"thermal_camera": true}, Wants: []string{"thermal_camera"}},
+		"no requirement": {},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			supported, notSupported := node.GetUnsupportedListOfPluginSensors(&PluginManifest{Hardware: tc.Hardware})
+			if supported != (len(tc.Wants) == 0) {
+				t.Errorf("expected supported to be %t, but got %t", len(tc.Wants) == 0, supported)
+			}
+			if len(notSupported) != len(tc.Wants) || (len(tc.Wants) > 0 && notSupported[0] != tc.Wants[0]) {
+				t.Errorf("expected %v not supported, but got %v", tc.Wants, notSupported)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package datatype
+
+import (
+	"strings"
+	"time"
+)
+
+type GoalState string
+
+const (
+	// GoalPending means the node has not acknowledged the goal
+	GoalPending         GoalState = "Pending"
+	GoalReceived        GoalState = "Received"
+	GoalPullingImages   GoalState = "PullingImages"
+	GoalImagePullFailed GoalState = "ImagePullFailed"
+	// GoalReady means all plugin images of the goal are on the node
+	GoalReady GoalState = "Ready"
+)
+
+// NodeGoalStatus is the delivery of a science goal to a node
+type NodeGoalStatus struct {
+	GoalID           string    `json:"goal_id" yaml:"goalID"`
+	State            GoalState `json:"state" yaml:"state"`
+	LastUpdated      Time      `json:"last_updated" yaml:"lastUpdated"`
+	LastAcknowledged Time      `json:"last_acknowledged" yaml:"lastAcknowledged"`
+}
+
+// NodeStatus is the status of a job on a node
+type NodeStatus struct {
+	GoalState        GoalState               `json:"goal_state" yaml:"goalState"`
+	LastAcknowledged Time                    `json:"last_goal_ack" yaml:"lastGoalAck"`
+	Plugins          map[string]*PluginStats `json:"plugins" yaml:"plugins"`
+}
+
+// RecordGoalState records the state of the goal reported by the node
+func (j *Job) RecordGoalState(nodeName string, goalID string, state GoalState, t time.Time) {
+	if j.GoalStatus == nil {
+		j.GoalStatus = make(map[string]*NodeGoalStatus)
+	}
+	nodeName = strings.ToUpper(nodeName)
+	s, exist := j.GoalStatus[nodeName]
+	if !exist || s.GoalID != goalID {
+		s = &NodeGoalStatus{GoalID: goalID}
+		j.GoalStatus[nodeName] = s
+	}
+	s.State = state
+	s.LastUpdated.Time = t
+	if state == GoalReceived {
+		s.LastAcknowledged.Time = t
+	}
+}
+
+// RecordPluginState records the latest state of the plugin reported by the node
+func (j *Job) RecordPluginState(nodeName string, pluginName string, state string, t time.Time) {
+	stats := j.getPluginStats(nodeName, pluginName)
+	stats.LastState = state
+	stats.LastUpdated.Time = t
+	if state == "running" {
+		stats.LastRun.Time = t
+	}
+}
+
+// GetNodeStatus returns status of the job on each node of its science goal
+func (j *Job) GetNodeStatus() map[string]*NodeStatus {
+	status := make(map[string]*NodeStatus)
+	if j.ScienceGoal == nil {
+		return status
+	}
+	for _, subGoal := range j.ScienceGoal.SubGoals {
+		nodeName := strings.ToUpper(subGoal.Name)
+		s := &NodeStatus{
+			GoalState: GoalPending,
+			Plugins:   make(map[string]*PluginStats),
+		}
+		// states of the goal replaced by a new one do not count
+		if g, exist := j.GoalStatus[nodeName]; exist && g.GoalID == j.ScienceGoal.ID {
+			s.GoalState = g.State
+			s.LastAcknowledged = g.LastAcknowledged
+		}
+		for _, p := range subGoal.Plugins {
+			if stats, exist := j.PluginStats[nodeName][p.Name]; exist {
+				s.Plugins[p.Name] = stats
+			} else {
+				s.Plugins[p.Name] = &PluginStats{}
+			}
+		}
+		status[subGoal.Name] = s
+	}
+	return status
+}
@@ -0,0 +1,41 @@
+package datatype
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetNodeStatus(t *testing.T) {
+	plugins := []*Plugin{{Name: "plugin-a"}, {Name: "plugin-b"}}
+	j := NewJob("job", "user", "1")
+	j.ScienceGoal = NewScienceGoalBuilder("job", "1").
+		AddSubGoal("W001", plugins, nil).
+		AddSubGoal("W002", plugins, nil).Build()
+	now := time.Now()
+	j.RecordGoalState("w001", j.ScienceGoal.ID, GoalReceived, now)
+	j.RecordGoalState("W001", j.ScienceGoal.ID, GoalReady, now.Add(time.Minute))
+	j.RecordGoalState("W002", "old-goal", GoalReady, now)
+	j.RecordPluginState("W001", "plugin-a", "running", now)
+	j.RecordPluginState("W001", "plugin-a", "failed", now.Add(time.Minute))
+	j.RecordPluginFailure("W001", "plugin-a", PluginFailure{Reason: "Error", ErrorLog: "Traceback"})
+
+	status := j.GetNodeStatus()
+	if len(status) != 2 {
+		t.Fatalf("wanted status of 2 nodes, got %d", len(status))
+	}
+	w001 := status["W001"]
+	if w001.GoalState != GoalReady || !w001.LastAcknowledged.Equal(now) {
+		t.Errorf("wanted goal %s acknowledged at %s, got %s at %s", GoalReady, now, w001.GoalState, w001.LastAcknowledged.Time)
+	}
+	a := w001.Plugins["plugin-a"]
+	if a.LastState != "failed" || !a.LastRun.Equal(now) || a.Failures != 1 || a.RecentFailures[0].ErrorLog != "Traceback" {
+		t.Errorf("unexpected status of plugin-a %+v", a)
+	}
+	if b, exist := w001.Plugins["plugin-b"]; !exist || b.LastState != "" {
+		t.Errorf("wanted empty status of plugin-b, got %+v", b)
+	}
+	// W002 acknowledged a goal replaced by the current one
+	if w002 := status["W002"]; w002.GoalState != GoalPending || !w002.LastAcknowledged.IsZero() {
+		t.Errorf("wanted goal %s on W002, got %s", GoalPending, w002.GoalState)
+	}
+}
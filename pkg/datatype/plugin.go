@@ -2,25 +2,37 @@ package datatype
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net"
 	"path"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/looplab/fsm"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
 
 const (
 	letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	// ResourceRequestGPUMemory is the resource name for the GPU memory a plugin uses.
+	// The scheduler uses it to run multiple GPU plugins at the same time.
+	ResourceRequestGPUMemory = "request.gpumemory"
 )
 
+var hostnamePattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
 // Plugin structs plugin metadata from ECR
 type Plugin struct {
 	Name       string      `json:"name" yaml:"name"`
 	PluginSpec *PluginSpec `json:"plugin_spec" yaml:"pluginSpec,omitempty"`
 	GoalID     string      `json:"goal_id,omitempty" yaml:"goalID,omitempty"`
 	JobID      string      `json:"job_id,omitempty" yaml:"jobID,omitempty"`
+	// Architectures lists architectures the plugin image supports, e.g. linux/arm64
+	Architectures []string `json:"architectures,omitempty" yaml:"architectures,omitempty"`
 }
 
 func (p *Plugin) GetPluginImage() (string, error) {
@@ -30,6 +42,25 @@ func (p *Plugin) GetPluginImage() (string, error) {
 	return p.PluginSpec.Image, nil
 }
 
+// Logger returns a logger with the job, goal, and name of the plugin
+func (p *Plugin) Logger() *logger.Entry {
+	return logger.With(logger.FieldJobID, p.JobID, logger.FieldGoalID, p.GoalID, logger.FieldPlugin, p.Name)
+}
+
+// IsUpdated returns true if the other plugin has a different spec.
+// Goal and job IDs of the plugins are not compared
+func (p *Plugin) IsUpdated(otherPlugin *Plugin) bool {
+	a, b := *p, *otherPlugin
+	a.GoalID, b.GoalID = "", ""
+	a.JobID, b.JobID = "", ""
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return true
+	}
+	return string(aJSON) != string(bJSON)
+}
+
 type PluginSpec struct {
 	Image       string            `json:"image" yaml:"image"`
 	Args        []string          `json:"args,omitempty" yaml:"args,omitempty"`
@@ -41,7 +72,10 @@ type PluginSpec struct {
 	Env         map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
 	DevelopMode bool              `json:"develop,omitempty" yaml:"develop,omitempty"`
 	Resource    map[string]string `json:"resource,omitempty" yaml:"resource,omitempty"`
-	Volume      map[string]string `json:"volume,omitempty" yaml:"volume,omitempty`
+	Volume      map[string]string `json:"volume,omitempty" yaml:"volume,omitempty"`
+	Mode        PluginMode        `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Sensors     []string          `json:"sensors,omitempty" yaml:"sensors,omitempty"`
+	Network     *PluginNetwork    `json:"network,omitempty" yaml:"network,omitempty"`
 }
 
 func (ps *PluginSpec) GetImageTag() (string, error) {
@@ -70,6 +104,62 @@ func (ps *PluginSpec) IsGPURequired() bool {
 	}
 }
 
+// GetGPUMemoryRequest returns the amount of GPU memory the plugin declares to use.
+// It returns an empty string if the plugin does not declare it.
+func (ps *PluginSpec) GetGPUMemoryRequest() string {
+	return ps.Resource[ResourceRequestGPUMemory]
+}
+
+// GetResourceRequest returns the resource the plugin declares to use
+func (ps *PluginSpec) GetResourceRequest() Resource {
+	return Resource{
+		CPU:       ps.Resource["request.cpu"],
+		Memory:    ps.Resource["request.memory"],
+		GPUMemory: ps.GetGPUMemoryRequest(),
+	}
+}
+
+// IsService returns true if the plugin is meant to run continuously
+// as a service, instead of running to completion.
+func (ps *PluginSpec) IsService() bool {
+	return ps.Mode == PluginModeService
+}
+
+// PluginMode tells how a plugin is run by the scheduler
+type PluginMode string
+
+const (
+	// PluginModeOneshot runs the plugin as a Pod to completion every time
+	// its science rule becomes valid. This is the default mode.
+	PluginModeOneshot PluginMode = "oneshot"
+	// PluginModeService runs the plugin as a Deployment that is restarted on crash.
+	// The plugin keeps running as long as its science rule stays valid and the goal exists.
+	PluginModeService PluginMode = "service"
+)
+
+// PluginNetwork declares network access of a plugin.
+// A plugin can always reach WES services within the node
+type PluginNetwork struct {
+	// Egress lists destinations the plugin can reach in CIDR, IP address, or hostname
+	Egress []string `json:"egress,omitempty" yaml:"egress,omitempty"`
+}
+
+// Validate returns an error if a destination is not a CIDR, an IP address, or a hostname
+func (n *PluginNetwork) Validate() error {
+	for _, dest := range n.Egress {
+		if _, _, err := net.ParseCIDR(dest); err == nil {
+			continue
+		}
+		if net.ParseIP(dest) != nil {
+			continue
+		}
+		if !hostnamePattern.MatchString(dest) {
+			return fmt.Errorf("egress destination %q is not a CIDR, IP address, or hostname", dest)
+		}
+	}
+	return nil
+}
+
 // ContextStatus represents contextual status of a plugin
 type ContextStatus string
 
@@ -136,54 +226,85 @@ type PluginRuntime struct {
 	PodUID                 string
 	Status                 *fsm.FSM
 	PodInstance            string
+	// Healthy tracks the health of a service plugin whose Pod
+	// can be restarted by Kubernetes while the plugin is running
+	Healthy bool
+	// Compute is the name of the compute in the node chosen to run the plugin
+	Compute string
+	// ComputeHostname is the Kubernetes node name of the Compute
+	ComputeHostname string
+	// DataConfigMap is the name of the ConfigMap holding data shims of the sensors
+	// the plugin requires. The data config of the node is used if empty
+	DataConfigMap string
+	// CredentialSecret is the name of the Secret holding the RabbitMQ credential
+	// of the plugin. The shared plugin credential is used if empty
+	CredentialSecret string
+	// QueuedAt, StartedAt, and FinishedAt record when the plugin last entered
+	// the queued, running, and completed or failed state
+	QueuedAt   time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// TriggeredBy is the condition of the science rule that last queued the plugin
+	TriggeredBy string
 }
 
 func NewPluginRuntime(p Plugin) *PluginRuntime {
 	pr := &PluginRuntime{
 		Plugin: p,
-		// Creating a finite state machine for PluginRuntme
-		Status: fsm.NewFSM(
-			string(Inactive),
-			fsm.Events{
-				{
-					Name: string(Queued),
-					Src:  []string{string(Inactive)},
-					Dst:  string(Queued),
-				},
-				{
-					Name: string(Scheduled),
-					Src:  []string{string(Queued)},
-					Dst:  string(Scheduled),
-				},
-				{
-					Name: string(Initializing),
-					Src:  []string{string(Scheduled)},
-					Dst:  string(Initializing),
-				},
-				{
-					Name: string(Running),
-					Src:  []string{string(Initializing)},
-					Dst:  string(Running),
-				},
-				{
-					Name: string(Completed),
-					Src:  []string{string(Running)},
-					Dst:  string(Completed),
-				},
-				{
-					Name: string(Failed),
-					Src:  []string{string(Initializing), string(Running)},
-					Dst:  string(Failed),
-				},
-				{
-					Name: string(Inactive),
-					Src:  []string{string(Queued), string(Scheduled), string(Initializing), string(Running), string(Completed), string(Failed)},
-					Dst:  string(Inactive),
-				},
-			},
-			fsm.Callbacks{},
-		),
 	}
+	// Creating a finite state machine for PluginRuntme
+	pr.Status = fsm.NewFSM(
+		string(Inactive),
+		fsm.Events{
+			{
+				Name: string(Queued),
+				Src:  []string{string(Inactive)},
+				Dst:  string(Queued),
+			},
+			{
+				Name: string(Scheduled),
+				Src:  []string{string(Queued)},
+				Dst:  string(Scheduled),
+			},
+			{
+				Name: string(Initializing),
+				Src:  []string{string(Scheduled)},
+				Dst:  string(Initializing),
+			},
+			{
+				Name: string(Running),
+				Src:  []string{string(Initializing)},
+				Dst:  string(Running),
+			},
+			{
+				Name: string(Completed),
+				Src:  []string{string(Running)},
+				Dst:  string(Completed),
+			},
+			{
+				Name: string(Failed),
+				Src:  []string{string(Initializing), string(Running)},
+				Dst:  string(Failed),
+			},
+			{
+				Name: string(Inactive),
+				Src:  []string{string(Queued), string(Scheduled), string(Initializing), string(Running), string(Completed), string(Failed)},
+				Dst:  string(Inactive),
+			},
+		},
+		fsm.Callbacks{
+			"enter_state": func(_ context.Context, e *fsm.Event) {
+				switch PluginState(e.Dst) {
+				case Queued:
+					pr.QueuedAt = time.Now()
+				case Running:
+					pr.StartedAt = time.Now()
+				case Completed, Failed:
+					pr.FinishedAt = time.Now()
+				}
+			},
+		},
+	)
 	return pr
 }
 
@@ -198,6 +319,7 @@ func (pr *PluginRuntime) SetPluginController(flag bool) {
 }
 
 func (pr *PluginRuntime) UpdateWithScienceRule(runtimeArgs ScienceRule) {
+	pr.TriggeredBy = runtimeArgs.Condition
 	// TODO: any runtime parameters of the plugin should be parsed and added to the runtime
 	// if v, found := runtimeArgs.ActionParameters["duration"]; found {
 	// 	pr.Duration
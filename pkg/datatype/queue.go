@@ -48,6 +48,16 @@ func (q *Queue) GetGoalIDs() (list map[string]bool) {
 	return
 }
 
+// GetPluginRuntimes returns a copy of the plugins in the queue.
+// Unlike iterating with Next, it is safe to call from other goroutines
+func (q *Queue) GetPluginRuntimes() []*PluginRuntime {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := make([]*PluginRuntime, len(q.entities))
+	copy(list, q.entities)
+	return list
+}
+
 func (q *Queue) Length() int {
 	return len(q.entities)
 }
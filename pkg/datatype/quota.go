@@ -0,0 +1,325 @@
+package datatype
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultEstimatedPluginRuntime is how long a plugin is assumed to run each time it is scheduled
+	DefaultEstimatedPluginRuntime = 5 * time.Minute
+	// unscheduledPluginRunsPerDay is the number of runs assumed for plugins without a cronjob rule
+	unscheduledPluginRunsPerDay = 24
+)
+
+// Quota limits what a user can run. A limit of zero, or an empty runtime, means no limit
+type Quota struct {
+	MaxActiveJobs     int `json:"max_active_jobs,omitempty" yaml:"maxActiveJobs,omitempty"`
+	MaxNodesPerJob    int `json:"max_nodes_per_job,omitempty" yaml:"maxNodesPerJob,omitempty"`
+	MaxPluginsPerNode int `json:"max_plugins_per_node,omitempty" yaml:"maxPluginsPerNode,omitempty"`
+	// MaxGPUPlugins counts GPU plugins of all active jobs on all nodes
+	MaxGPUPlugins int `json:"max_gpu_plugins,omitempty" yaml:"maxGPUPlugins,omitempty"`
+	// MaxRuntimePerNodePerDay is the estimated runtime of plugins on a node in a day, e.g. 6h
+	MaxRuntimePerNodePerDay string `json:"max_runtime_per_node_per_day,omitempty" yaml:"maxRuntimePerNodePerDay,omitempty"`
+}
+
+func (q Quota) Validate() error {
+	for name, v := range map[string]int{
+		"max_active_jobs":      q.MaxActiveJobs,
+		"max_nodes_per_job":    q.MaxNodesPerJob,
+		"max_plugins_per_node": q.MaxPluginsPerNode,
+		"max_gpu_plugins":      q.MaxGPUPlugins,
+	} {
+		if v < 0 {
+			return fmt.Errorf("%s must not be negative: %d", name, v)
+		}
+	}
+	if _, err := q.GetMaxRuntimePerNodePerDay(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetMaxRuntimePerNodePerDay returns the runtime limit, or 0 if not limited
+func (q Quota) GetMaxRuntimePerNodePerDay() (time.Duration, error) {
+	if q.MaxRuntimePerNodePerDay == "" {
+		return 0, nil
+	}
+	d, err := parseDuration(q.MaxRuntimePerNodePerDay)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("max_runtime_per_node_per_day must be a positive duration, e.g. 6h: %q", q.MaxRuntimePerNodePerDay)
+	}
+	return d, nil
+}
+
+// QuotaGroup applies its quota to its members together. Active jobs of all members count
+// against the quota of the group
+type QuotaGroup struct {
+	Members []string `json:"members" yaml:"members"`
+	Quota   `yaml:",inline"`
+}
+
+// QuotaConfig holds quotas of users. A user's own quota is used first, then quotas of
+// groups the user is in, then the default quota
+type QuotaConfig struct {
+	Default Quota                 `json:"default" yaml:"default"`
+	Groups  map[string]QuotaGroup `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Users   map[string]Quota      `json:"users,omitempty" yaml:"users,omitempty"`
+	// EstimatedPluginRuntime is how long a plugin is assumed to run each time it is scheduled.
+	// DefaultEstimatedPluginRuntime is used if empty
+	EstimatedPluginRuntime string `json:"estimated_plugin_runtime,omitempty" yaml:"estimatedPluginRuntime,omitempty"`
+}
+
+func (c *QuotaConfig) Validate() error {
+	if err := c.Default.Validate(); err != nil {
+		return fmt.Errorf("default: %s", err.Error())
+	}
+	for name, g := range c.Groups {
+		if err := g.Quota.Validate(); err != nil {
+			return fmt.Errorf("group %s: %s", name, err.Error())
+		}
+	}
+	for name, q := range c.Users {
+		if err := q.Validate(); err != nil {
+			return fmt.Errorf("user %s: %s", name, err.Error())
+		}
+	}
+	if _, err := c.GetEstimatedPluginRuntime(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *QuotaConfig) GetEstimatedPluginRuntime() (time.Duration, error) {
+	if c.EstimatedPluginRuntime == "" {
+		return DefaultEstimatedPluginRuntime, nil
+	}
+	d, err := parseDuration(c.EstimatedPluginRuntime)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("estimated_plugin_runtime must be a positive duration, e.g. 5m: %q", c.EstimatedPluginRuntime)
+	}
+	return d, nil
+}
+
+// GetGroups returns names of the groups the user is in
+func (c *QuotaConfig) GetGroups(userName string) (groups []string) {
+	for name, g := range c.Groups {
+		for _, member := range g.Members {
+			if member == userName {
+				groups = append(groups, name)
+				break
+			}
+		}
+	}
+	sort.Strings(groups)
+	return
+}
+
+// GetQuota returns the quota applied to the user. A user in multiple groups
+// gets the largest limit of the groups for each limit. Group quotas are shared
+// by the members, so this shows the limits, not what the user alone can use
+func (c *QuotaConfig) GetQuota(userName string) Quota {
+	if q, found := c.Users[userName]; found {
+		return q
+	}
+	groups := c.GetGroups(userName)
+	if len(groups) == 0 {
+		return c.Default
+	}
+	q := c.Groups[groups[0]].Quota
+	for _, name := range groups[1:] {
+		g := c.Groups[name].Quota
+		q.MaxActiveJobs = largerLimit(q.MaxActiveJobs, g.MaxActiveJobs)
+		q.MaxNodesPerJob = largerLimit(q.MaxNodesPerJob, g.MaxNodesPerJob)
+		q.MaxPluginsPerNode = largerLimit(q.MaxPluginsPerNode, g.MaxPluginsPerNode)
+		q.MaxGPUPlugins = largerLimit(q.MaxGPUPlugins, g.MaxGPUPlugins)
+		a, _ := q.GetMaxRuntimePerNodePerDay()
+		b, _ := g.GetMaxRuntimePerNodePerDay()
+		if a != 0 && (b == 0 || b > a) {
+			q.MaxRuntimePerNodePerDay = g.MaxRuntimePerNodePerDay
+		}
+	}
+	return q
+}
+
+// largerLimit returns the less restrictive limit where 0 means no limit
+func largerLimit(a int, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// QuotaUsage is what active jobs of a user, or of all members of a group, use against the quota
+type QuotaUsage struct {
+	User       string `json:"user" yaml:"user"`
+	Group      string `json:"group,omitempty" yaml:"group,omitempty"`
+	ActiveJobs int    `json:"active_jobs" yaml:"activeJobs"`
+	GPUPlugins int    `json:"gpu_plugins" yaml:"gpuPlugins"`
+	// PluginsPerNode and RuntimePerNodePerDay are keyed by node names
+	PluginsPerNode       map[string]int           `json:"plugins_per_node" yaml:"pluginsPerNode"`
+	RuntimePerNodePerDay map[string]time.Duration `json:"-" yaml:"-"`
+}
+
+func NewQuotaUsage(userName string) *QuotaUsage {
+	return &QuotaUsage{
+		User:                 userName,
+		PluginsPerNode:       make(map[string]int),
+		RuntimePerNodePerDay: make(map[string]time.Duration),
+	}
+}
+
+// Add counts the job in the usage
+func (u *QuotaUsage) Add(job *Job, pluginRuntime time.Duration) {
+	u.ActiveJobs += 1
+	runtime := job.EstimateRuntimePerDay(pluginRuntime)
+	for nodeName := range job.Nodes {
+		u.PluginsPerNode[nodeName] += len(job.Plugins)
+		u.GPUPlugins += job.GetNumberOfGPUPlugins()
+		u.RuntimePerNodePerDay[nodeName] += runtime
+	}
+}
+
+// GetRuntimePerNodePerDay returns estimated runtime on nodes in text, e.g. 2h30m0s
+func (u *QuotaUsage) GetRuntimePerNodePerDay() map[string]string {
+	r := make(map[string]string)
+	for nodeName, d := range u.RuntimePerNodePerDay {
+		r[nodeName] = d.String()
+	}
+	return r
+}
+
+// IsActive returns true if the job counts against quotas of its user
+func (j *Job) IsActive() bool {
+	switch j.State.GetState() {
+	case JobSubmitted, JobRunning:
+		return true
+	default:
+		return false
+	}
+}
+
+func (j *Job) GetNumberOfGPUPlugins() (n int) {
+	for _, p := range j.Plugins {
+		if p.PluginSpec != nil && p.PluginSpec.IsGPURequired() {
+			n += 1
+		}
+	}
+	return
+}
+
+// EstimateRuntimePerDay returns how long plugins of the job would run on a node in a day.
+// Service plugins run all day. Other plugins run as often as their cronjob rule schedules
+// them for pluginRuntime each time, and hourly if no cronjob rule schedules them
+func (j *Job) EstimateRuntimePerDay(pluginRuntime time.Duration) (total time.Duration) {
+	runsPerDay := map[string]int{}
+	for _, rule := range j.ScienceRules {
+		r, err := NewScienceRule(rule)
+		if err != nil || r.ActionType != ScienceRuleActionSchedule {
+			continue
+		}
+		if expr, found := parseCronjobCondition(r.Condition); found {
+			if n, err := CronRunsPerDay(expr); err == nil {
+				runsPerDay[r.ActionObject] += n
+			}
+		}
+	}
+	for _, p := range j.Plugins {
+		runtime := 24 * time.Hour
+		if p.PluginSpec == nil || !p.PluginSpec.IsService() {
+			n, found := runsPerDay[p.Name]
+			if !found {
+				n = unscheduledPluginRunsPerDay
+			}
+			if d := time.Duration(n) * pluginRuntime; d < runtime {
+				runtime = d
+			}
+		}
+		total += runtime
+	}
+	return
+}
+
+var cronjobConditionRegex = regexp.MustCompile(`cronjob\(\s*["'][^"']*["']\s*,\s*["']([^"']+)["']\s*\)`)
+
+// parseCronjobCondition returns the cron expression of a cronjob condition,
+// e.g. */5 * * * * from cronjob("myplugin", "*/5 * * * *")
+func parseCronjobCondition(condition string) (string, bool) {
+	sp := cronjobConditionRegex.FindStringSubmatch(condition)
+	if len(sp) != 2 {
+		return "", false
+	}
+	return sp[1], true
+}
+
+// CronRunsPerDay returns the number of times the cron expression fires in a day at most.
+// The expression has minute, hour, day of month, month, and day of week fields, optionally
+// followed by a second field. Days are not counted as they do not change runs in a day
+func CronRunsPerDay(expr string) (int, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 && len(fields) != 6 {
+		return 0, fmt.Errorf("cron expression %q must have 5 or 6 fields", expr)
+	}
+	minutes, err := countCronField(fields[0], 0, 59)
+	if err != nil {
+		return 0, err
+	}
+	hours, err := countCronField(fields[1], 0, 23)
+	if err != nil {
+		return 0, err
+	}
+	runs := minutes * hours
+	if len(fields) == 6 {
+		seconds, err := countCronField(fields[5], 0, 59)
+		if err != nil {
+			return 0, err
+		}
+		runs *= seconds
+	}
+	return runs, nil
+}
+
+// countCronField returns the number of values a cron field matches, e.g. 12 for */5 of minutes
+func countCronField(field string, min int, max int) (int, error) {
+	values := map[int]bool{}
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if r, s, found := strings.Cut(item, "/"); found {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in cron field %q", field)
+			}
+			item, step = r, n
+		}
+		from, to := min, max
+		if item != "*" {
+			a, b, isRange := strings.Cut(item, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value in cron field %q", field)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid range in cron field %q", field)
+				}
+			} else if step > 1 {
+				to = max
+			}
+			if from < min || to > max || from > to {
+				return 0, fmt.Errorf("cron field %q is out of range %d-%d", field, min, max)
+			}
+		}
+		for v := from; v <= to; v += step {
+			values[v] = true
+		}
+	}
+	return len(values), nil
+}
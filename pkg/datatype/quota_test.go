@@ -0,0 +1,95 @@
+package datatype
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronRunsPerDay(t *testing.T) {
+	tests := map[string]struct {
+		Expr     string
+		Runs     int
+		HasError bool
+	}{
+		"EveryMinute":   {Expr: "* * * * *", Runs: 1440},
+		"Every5Minutes": {Expr: "*/5 * * * *", Runs: 288},
+		"Hourly":        {Expr: "0 * * * *", Runs: 24},
+		"List":          {Expr: "0,30 8-17 * * 1-5", Runs: 20},
+		"StepFrom":      {Expr: "10/20 0 * * *", Runs: 3},
+		"Seconds":       {Expr: "* * * * * */2", Runs: 1440 * 30},
+		"Fields":        {Expr: "* * *", HasError: true},
+		"OutOfRange":    {Expr: "0 24 * * *", HasError: true},
+		"BadStep":       {Expr: "*/0 * * * *", HasError: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			runs, err := CronRunsPerDay(test.Expr)
+			if test.HasError {
+				if err == nil {
+					t.Errorf("expected an error for %q", test.Expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if runs != test.Runs {
+				t.Errorf("wanted %d runs for %q, got %d", test.Runs, test.Expr, runs)
+			}
+		})
+	}
+}
+
+func TestEstimateRuntimePerDay(t *testing.T) {
+	job := &Job{
+		Plugins: []*Plugin{
+			{Name: "cron", PluginSpec: &PluginSpec{}},
+			{Name: "unscheduled", PluginSpec: &PluginSpec{}},
+			{Name: "service", PluginSpec: &PluginSpec{Mode: PluginModeService}},
+			{Name: "often", PluginSpec: &PluginSpec{}},
+		},
+		ScienceRules: []string{
+			`schedule(cron): cronjob("cron", "0 */2 * * *")`,
+			`schedule(often): cronjob('often', '* * * * *')`,
+		},
+	}
+	// 12 runs, 24 runs, all day, and capped to a day
+	want := 12*time.Minute + 24*time.Minute + 24*time.Hour + 24*time.Hour
+	if got := job.EstimateRuntimePerDay(time.Minute); got != want {
+		t.Errorf("wanted %s, got %s", want, got)
+	}
+}
+
+func TestGetQuota(t *testing.T) {
+	config := &QuotaConfig{
+		Default: Quota{MaxActiveJobs: 1},
+		Groups: map[string]QuotaGroup{
+			"students":   {Members: []string{"alice", "bob"}, Quota: Quota{MaxActiveJobs: 2, MaxNodesPerJob: 5, MaxRuntimePerNodePerDay: "2h"}},
+			"scientists": {Members: []string{"bob"}, Quota: Quota{MaxActiveJobs: 10, MaxNodesPerJob: 0, MaxRuntimePerNodePerDay: "1h"}},
+		},
+		Users: map[string]Quota{
+			"carol": {MaxActiveJobs: 3},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if q := config.GetQuota("dave"); q.MaxActiveJobs != 1 {
+		t.Errorf("wanted the default quota, got %v", q)
+	}
+	if q := config.GetQuota("carol"); q.MaxActiveJobs != 3 {
+		t.Errorf("wanted the user quota, got %v", q)
+	}
+	if q := config.GetQuota("alice"); q.MaxActiveJobs != 2 || q.MaxNodesPerJob != 5 {
+		t.Errorf("wanted the group quota, got %v", q)
+	}
+	q := config.GetQuota("bob")
+	if q.MaxActiveJobs != 10 || q.MaxNodesPerJob != 0 || q.MaxRuntimePerNodePerDay != "2h" {
+		t.Errorf("wanted the largest limits of the groups, got %v", q)
+	}
+
+	config.Users["carol"] = Quota{MaxRuntimePerNodePerDay: "soon"}
+	if err := config.Validate(); err == nil {
+		t.Error("expected an error for invalid runtime")
+	}
+}
@@ -14,6 +14,9 @@ type Resource struct {
 	cpuInMilli   int    `json:"-" yaml:"-"`
 	memInMega    int    `json:"-" yaml:"-"`
 	gpuMemInMega int    `json:"-" yaml:"-"`
+	// GPUDevices is GPU memory of each GPU keyed by the compute having the GPU.
+	// A plugin uses GPU memory of only one device
+	GPUDevices map[string]string `json:"gpu_devices,omitempty" yaml:"gpuDevices,omitempty"`
 }
 
 func (r *Resource) CanAccommodate(c *Resource) bool {
@@ -56,14 +59,51 @@ func (r *Resource) convert() {
 	value, unit = splitValueAndUnit(r.GPUMemory)
 	switch unit {
 	case "Ki":
-		r.gpuMemInMega = value * 1024
+		r.gpuMemInMega = int(value / 1024.)
 	case "Mi":
 		r.gpuMemInMega = value
 	case "Gi":
-		r.gpuMemInMega = int(value / 1024.)
+		r.gpuMemInMega = value * 1024
 	case "Ti":
-		r.gpuMemInMega = int(value / 1024. / 1024.)
+		r.gpuMemInMega = value * 1024 * 1024
+	}
+}
+
+// GetCPUInMilli returns CPU of the resource in millicores.
+// It returns a negative value if CPU is not given or invalid.
+func (r *Resource) GetCPUInMilli() int {
+	r.convert()
+	return r.cpuInMilli
+}
+
+// GetMemoryInMega returns memory of the resource in Mi
+func (r *Resource) GetMemoryInMega() int {
+	r.convert()
+	return r.memInMega
+}
+
+// GetGPUMemoryInMega returns GPU memory of the resource in Mi
+func (r *Resource) GetGPUMemoryInMega() int {
+	r.convert()
+	return r.gpuMemInMega
+}
+
+// GetGPUDevicesInMega returns GPU memory in Mi of each GPU device. GPUMemory is taken as a single
+// device if no device is given
+func (r *Resource) GetGPUDevicesInMega() map[string]int {
+	devices := make(map[string]int)
+	for name, memory := range r.GPUDevices {
+		d := Resource{GPUMemory: memory}
+		if m := d.GetGPUMemoryInMega(); m > 0 {
+			devices[name] = m
+		}
+	}
+	if len(devices) == 0 {
+		if m := r.GetGPUMemoryInMega(); m > 0 {
+			devices[""] = m
+		}
 	}
+	return devices
 }
 
 // splitValueAndUnit returns value and its unit. The unit is one of Ki, Mi, Gi, and Ti.
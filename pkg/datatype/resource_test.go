@@ -27,6 +27,22 @@ func TestResourceConversion(t *testing.T) {
 				GpuMemory: 8000,
 			},
 		},
+		"gpuMemoryConversion": {
+			input: &Resource{
+				CPU:       "2",
+				Memory:    "2048Ki",
+				GPUMemory: "4Gi",
+			},
+			want: struct {
+				CPU       int
+				Memory    int
+				GpuMemory int
+			}{
+				CPU:       2000,
+				Memory:    2,
+				GpuMemory: 4 * 1024,
+			},
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
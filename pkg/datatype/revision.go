@@ -0,0 +1,120 @@
+package datatype
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type JobRevisionAction string
+
+const (
+	JobRevisionSubmitted  JobRevisionAction = "submitted"
+	JobRevisionEdited     JobRevisionAction = "edited"
+	JobRevisionRolledBack JobRevisionAction = "rolledback"
+)
+
+// JobRevision is the job as it was written by a user at an edit or submit. Revisions are never modified
+type JobRevision struct {
+	JobID    string            `json:"job_id" yaml:"jobID"`
+	Revision int               `json:"revision" yaml:"revision"`
+	Author   string            `json:"author" yaml:"author"`
+	Action   JobRevisionAction `json:"action" yaml:"action"`
+	Time     Time              `json:"time" yaml:"time"`
+	// RolledBackTo is the revision restored by a rollback
+	RolledBackTo int `json:"rolled_back_to,omitempty" yaml:"rolledBackTo,omitempty"`
+	Job          Job `json:"job" yaml:"job"`
+}
+
+// Spec returns the fields of the job users write. State of the job, its science goal,
+// collaborators, and nodes selected by node tags are left out
+func (j *Job) Spec() Job {
+	spec := j.ConvertToTemplate()
+	spec.ScienceRules = j.ScienceRules
+	spec.Email = j.Email
+	spec.NotificationOn = j.NotificationOn
+	spec.Team = j.Team
+	return spec
+}
+
+// ApplySpec writes the fields of the spec users write onto the job. State of the job, its science goal,
+// stats of its plugins, and sharing of the job are kept. Nodes selected by node tags need to be resolved again
+func (j *Job) ApplySpec(spec Job) {
+	j.Name = spec.Name
+	j.Plugins = spec.Plugins
+	j.NodeTags = spec.NodeTags
+	j.Nodes = make(map[string]interface{})
+	for k, v := range spec.Nodes {
+		j.Nodes[k] = v
+	}
+	j.TaggedNodes = nil
+	j.ScienceRules = spec.ScienceRules
+	j.SuccessCriteria = spec.SuccessCriteria
+	j.StartTime = spec.StartTime
+	j.EndTime = spec.EndTime
+	j.Duration = spec.Duration
+	j.Email = spec.Email
+	j.NotificationOn = spec.NotificationOn
+}
+
+// DiffJobRevisions returns the changes from a revision to another in a unified format
+func DiffJobRevisions(from *JobRevision, to *JobRevision) (string, error) {
+	a, err := yaml.Marshal(from.Job)
+	if err != nil {
+		return "", err
+	}
+	b, err := yaml.Marshal(to.Job)
+	if err != nil {
+		return "", err
+	}
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- revision %d\n+++ revision %d\n", from.Revision, to.Revision)
+	for _, line := range diffLines(strings.Split(strings.TrimSuffix(string(a), "\n"), "\n"), strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")) {
+		diff.WriteString(line)
+		diff.WriteString("\n")
+	}
+	return diff.String(), nil
+}
+
+// diffLines returns lines of a and b prefixed with "-" for removed, "+" for added,
+// and " " for unchanged lines using their longest common subsequence
+func diffLines(a []string, b []string) (lines []string) {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, " "+a[i])
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "-"+a[i])
+			i += 1
+		default:
+			lines = append(lines, "+"+b[j])
+			j += 1
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+"+b[j])
+	}
+	return
+}
@@ -0,0 +1,49 @@
+package datatype
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	a := []string{"name: job", "plugins:", "- image: plugin-a:0.1.0", "nodes:", "  W001: 1"}
+	b := []string{"name: job", "plugins:", "- image: plugin-a:0.2.0", "nodes:", "  W001: 1", "  W002: 1"}
+	want := []string{" name: job", " plugins:", "-- image: plugin-a:0.1.0", "+- image: plugin-a:0.2.0", " nodes:", "   W001: 1", "+  W002: 1"}
+	if got := diffLines(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted %q, got %q", want, got)
+	}
+	if got := diffLines(nil, []string{"a"}); !reflect.DeepEqual(got, []string{"+a"}) {
+		t.Errorf("unexpected diff from empty: %q", got)
+	}
+}
+
+func TestDiffJobRevisions(t *testing.T) {
+	job := NewJob("job", "user", "1")
+	job.Nodes["W001"] = 1
+	job.TaggedNodes = []string{"W002"}
+	job.Nodes["W002"] = 1
+	job.ScienceRules = []string{"schedule(plugin-a): cronjob('plugin-a', '* * * * *')"}
+	from := &JobRevision{Revision: 1, Job: job.Spec()}
+	job.ScienceRules = []string{"schedule(plugin-a): cronjob('plugin-a', '*/5 * * * *')"}
+	job.Runs()
+	to := &JobRevision{Revision: 2, Job: job.Spec()}
+
+	diff, err := DiffJobRevisions(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(diff, "--- revision 1\n+++ revision 2\n") {
+		t.Errorf("unexpected header of diff:\n%s", diff)
+	}
+	var changes []string
+	for _, line := range strings.Split(diff, "\n")[2:] {
+		if strings.HasPrefix(line, "-") || strings.HasPrefix(line, "+") {
+			changes = append(changes, line)
+		}
+	}
+	// the state of the job and nodes selected by tags are not part of revisions
+	if len(changes) != 2 || !strings.Contains(changes[0], "* * * * *") || !strings.Contains(changes[1], "*/5 * * * *") {
+		t.Errorf("unexpected changes %q in diff:\n%s", changes, diff)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	uuid "github.com/nu7hatch/gouuid"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
 
 type ScienceGoalBuilder struct {
@@ -52,6 +53,11 @@ type ScienceGoal struct {
 	Conditions []string   `json:"conditions,omitempty" yaml:"conditions,omitempty"`
 }
 
+// Logger returns a logger with the job and ID of the goal
+func (g *ScienceGoal) Logger() *logger.Entry {
+	return logger.With(logger.FieldJobID, g.JobID, logger.FieldGoalID, g.ID)
+}
+
 // GetMySubGoal returns the subgoal assigned to node
 func (g *ScienceGoal) GetMySubGoal(nodeName string) *SubGoal {
 	for _, subGoal := range g.SubGoals {
@@ -0,0 +1,144 @@
+package datatype
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SuccessCriterionType string
+
+const (
+	// SuccessCriterionRuns is met when the plugin succeeded the number of times on each node of the job
+	SuccessCriterionRuns SuccessCriterionType = "runs"
+	// SuccessCriterionUntil is met when the time passes
+	SuccessCriterionUntil SuccessCriterionType = "until"
+	// SuccessCriterionData is met when a node of the job publishes a value satisfying the condition
+	SuccessCriterionData SuccessCriterionType = "data"
+	// SuccessCriterionWallClock is met when the job has run for the duration
+	SuccessCriterionWallClock SuccessCriterionType = "wallclock"
+)
+
+// SuccessCriterion is a parsed success criterion of a job. Supported criteria are,
+//
+// runs(plugin-a, 10): plugin-a succeeded 10 times on each node
+//
+// until(2026-12-31): the date, or the time in RFC3339, has passed
+//
+// data(env.temperature) > 30: a node published env.temperature greater than 30
+//
+// WallClock(1d): the job has run for a day. Durations are in days (d) or as in time.ParseDuration
+type SuccessCriterion struct {
+	Criterion   string
+	Type        SuccessCriterionType
+	Plugin      string
+	Runs        int
+	Until       time.Time
+	Measurement string
+	Operator    string
+	Threshold   float64
+	Duration    time.Duration
+}
+
+var successCriterionRegex = regexp.MustCompile(`^(\w+)\((.*?)\)\s*(.*?)$`)
+
+// NewSuccessCriterion parses given success criterion
+func NewSuccessCriterion(criterion string) (*SuccessCriterion, error) {
+	c := &SuccessCriterion{Criterion: criterion}
+	sp := successCriterionRegex.FindStringSubmatch(strings.TrimSpace(criterion))
+	if len(sp) != 4 {
+		return nil, fmt.Errorf("failed to parse success criterion %q: criterion must be a function, e.g. runs(plugin-a, 10)", criterion)
+	}
+	var args []string
+	for _, a := range strings.Split(sp[2], ",") {
+		args = append(args, strings.Trim(strings.TrimSpace(a), `'"`))
+	}
+	condition := strings.TrimSpace(sp[3])
+	switch SuccessCriterionType(strings.ToLower(sp[1])) {
+	case SuccessCriterionRuns:
+		if len(args) != 2 || args[0] == "" || condition != "" {
+			return nil, fmt.Errorf("failed to parse success criterion %q: runs takes a plugin name and the number of runs", criterion)
+		}
+		runs, err := strconv.Atoi(args[1])
+		if err != nil || runs < 1 {
+			return nil, fmt.Errorf("failed to parse success criterion %q: number of runs must be a positive integer", criterion)
+		}
+		c.Type, c.Plugin, c.Runs = SuccessCriterionRuns, args[0], runs
+	case SuccessCriterionUntil:
+		if len(args) != 1 || condition != "" {
+			return nil, fmt.Errorf("failed to parse success criterion %q: until takes a date or time", criterion)
+		}
+		until, err := time.Parse(time.RFC3339, args[0])
+		if err != nil {
+			until, err = time.Parse("2006-01-02", args[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse success criterion %q: time must be a date, e.g. 2026-12-31, or in RFC3339", criterion)
+		}
+		c.Type, c.Until = SuccessCriterionUntil, until
+	case SuccessCriterionData:
+		if len(args) != 1 || args[0] == "" {
+			return nil, fmt.Errorf("failed to parse success criterion %q: data takes a measurement name", criterion)
+		}
+		fields := strings.Fields(condition)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("failed to parse success criterion %q: data must be compared with a number, e.g. data(env.temperature) > 30", criterion)
+		}
+		switch fields[0] {
+		case ">", ">=", "<", "<=", "==", "!=":
+		default:
+			return nil, fmt.Errorf("failed to parse success criterion %q: unknown operator %q", criterion, fields[0])
+		}
+		threshold, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse success criterion %q: %q is not a number", criterion, fields[1])
+		}
+		c.Type, c.Measurement, c.Operator, c.Threshold = SuccessCriterionData, args[0], fields[0], threshold
+	case SuccessCriterionWallClock:
+		if len(args) != 1 || condition != "" {
+			return nil, fmt.Errorf("failed to parse success criterion %q: WallClock takes a duration", criterion)
+		}
+		duration, err := parseDuration(args[0])
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("failed to parse success criterion %q: duration must be positive, e.g. 1d or 12h", criterion)
+		}
+		c.Type, c.Duration = SuccessCriterionWallClock, duration
+	default:
+		return nil, fmt.Errorf("failed to parse success criterion %q: unknown criterion %q", criterion, sp[1])
+	}
+	return c, nil
+}
+
+// parseDuration extends time.ParseDuration with days, e.g. 2d
+func parseDuration(s string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// IsSatisfiedBy returns true if the value satisfies the condition of the data criterion
+func (c *SuccessCriterion) IsSatisfiedBy(value float64) bool {
+	switch c.Operator {
+	case ">":
+		return value > c.Threshold
+	case ">=":
+		return value >= c.Threshold
+	case "<":
+		return value < c.Threshold
+	case "<=":
+		return value <= c.Threshold
+	case "==":
+		return value == c.Threshold
+	case "!=":
+		return value != c.Threshold
+	default:
+		return false
+	}
+}
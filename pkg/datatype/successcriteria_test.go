@@ -0,0 +1,101 @@
+package datatype
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSuccessCriterion(t *testing.T) {
+	tests := map[string]struct {
+		Criterion         string
+		ShouldFailToParse bool
+		Wants             SuccessCriterion
+	}{
+		"Runs": {
+			Criterion: "runs(plugin-a, 10)",
+			Wants:     SuccessCriterion{Type: SuccessCriterionRuns, Plugin: "plugin-a", Runs: 10},
+		},
+		"Runs with quotes": {
+			Criterion: `runs("plugin-a", 1)`,
+			Wants:     SuccessCriterion{Type: SuccessCriterionRuns, Plugin: "plugin-a", Runs: 1},
+		},
+		"Runs without number": {
+			Criterion:         "runs(plugin-a)",
+			ShouldFailToParse: true,
+		},
+		"Runs with zero": {
+			Criterion:         "runs(plugin-a, 0)",
+			ShouldFailToParse: true,
+		},
+		"Until date": {
+			Criterion: "until(2026-12-31)",
+			Wants:     SuccessCriterion{Type: SuccessCriterionUntil, Until: time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)},
+		},
+		"Until time": {
+			Criterion: "until(2026-12-31T12:00:00Z)",
+			Wants:     SuccessCriterion{Type: SuccessCriterionUntil, Until: time.Date(2026, 12, 31, 12, 0, 0, 0, time.UTC)},
+		},
+		"Until wrong date": {
+			Criterion:         "until(12/31/2026)",
+			ShouldFailToParse: true,
+		},
+		"Data": {
+			Criterion: "data(env.temperature) >= 30.5",
+			Wants:     SuccessCriterion{Type: SuccessCriterionData, Measurement: "env.temperature", Operator: ">=", Threshold: 30.5},
+		},
+		"Data without condition": {
+			Criterion:         "data(env.temperature)",
+			ShouldFailToParse: true,
+		},
+		"Data with unknown operator": {
+			Criterion:         "data(env.temperature) => 30",
+			ShouldFailToParse: true,
+		},
+		"WallClock in days": {
+			Criterion: "WallClock(1d)",
+			Wants:     SuccessCriterion{Type: SuccessCriterionWallClock, Duration: 24 * time.Hour},
+		},
+		"WallClock in hours": {
+			Criterion: "wallclock(90m)",
+			Wants:     SuccessCriterion{Type: SuccessCriterionWallClock, Duration: 90 * time.Minute},
+		},
+		"WallClock without unit": {
+			Criterion:         "WallClock(1)",
+			ShouldFailToParse: true,
+		},
+		"Unknown criterion": {
+			Criterion:         "forever(plugin-a)",
+			ShouldFailToParse: true,
+		},
+	}
+	for name, test := range tests {
+		c, err := NewSuccessCriterion(test.Criterion)
+		if test.ShouldFailToParse {
+			if err == nil {
+				t.Errorf("%s: expected to fail to parse %q", name, test.Criterion)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: failed to parse %q: %s", name, test.Criterion, err.Error())
+			continue
+		}
+		test.Wants.Criterion = test.Criterion
+		if *c != test.Wants {
+			t.Errorf("%s: wanted %+v, got %+v", name, test.Wants, *c)
+		}
+	}
+}
+
+func TestSuccessCriterionIsSatisfiedBy(t *testing.T) {
+	c, err := NewSuccessCriterion("data(env.temperature) > 30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.IsSatisfiedBy(30) {
+		t.Error("expected 30 not to satisfy > 30")
+	}
+	if !c.IsSatisfiedBy(30.1) {
+		t.Error("expected 30.1 to satisfy > 30")
+	}
+}
@@ -0,0 +1,110 @@
+package datatype
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// JobRole is what a user can do with a shared job. Each role can do what the roles before it can
+type JobRole string
+
+const (
+	// JobRoleViewer reads revisions of the job and registers webhooks for the job
+	JobRoleViewer JobRole = "viewer"
+	// JobRoleEditor edits, submits, suspends, and rolls back the job
+	JobRoleEditor JobRole = "editor"
+	// JobRoleOwner removes the job and manages its collaborators and team
+	JobRoleOwner JobRole = "owner"
+)
+
+func ParseJobRole(s string) (JobRole, error) {
+	switch r := JobRole(s); r {
+	case JobRoleViewer, JobRoleEditor, JobRoleOwner:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unknown role %q: role must be one of viewer, editor, and owner", s)
+	}
+}
+
+func (r JobRole) level() int {
+	switch r {
+	case JobRoleViewer:
+		return 1
+	case JobRoleEditor:
+		return 2
+	case JobRoleOwner:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Includes returns true if the role can do what the other role can
+func (r JobRole) Includes(other JobRole) bool {
+	return r.level() >= other.level() && r.level() > 0
+}
+
+// Team is a group of users sharing jobs of the team. Owners of the team manage its members
+type Team struct {
+	Name    string             `json:"name" yaml:"name"`
+	Members map[string]JobRole `json:"members" yaml:"members"`
+	Created Time               `json:"created" yaml:"created"`
+}
+
+func NewTeam(name string, owner string) *Team {
+	return &Team{
+		Name:    name,
+		Members: map[string]JobRole{owner: JobRoleOwner},
+	}
+}
+
+var teamNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+func (t *Team) Validate() error {
+	if !teamNameRegex.MatchString(t.Name) {
+		return fmt.Errorf("team name %q must consist of up to 64 alphanumeric characters, '-', '_', or '.'", t.Name)
+	}
+	for userName, role := range t.Members {
+		if _, err := ParseJobRole(string(role)); err != nil {
+			return fmt.Errorf("member %s: %s", userName, err.Error())
+		}
+	}
+	return nil
+}
+
+// HasOwner returns true if a member owns the team
+func (t *Team) HasOwner() bool {
+	for _, role := range t.Members {
+		if role == JobRoleOwner {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRole returns the role of the user in the team, or an empty role if the user is not a member
+func (t *Team) GetRole(userName string) JobRole {
+	if t == nil {
+		return ""
+	}
+	return t.Members[userName]
+}
+
+// GetRole returns the role of the user on the job. The user who created the job owns it.
+// Otherwise the higher of the user's roles as a collaborator and in the team is used.
+// The team can be nil if the job has no team
+func (j *Job) GetRole(userName string, team *Team) JobRole {
+	if userName == "" {
+		return ""
+	}
+	if j.User == userName {
+		return JobRoleOwner
+	}
+	role := j.Collaborators[userName]
+	if team != nil && team.Name == j.Team {
+		if r := team.GetRole(userName); r.level() > role.level() {
+			role = r
+		}
+	}
+	return role
+}
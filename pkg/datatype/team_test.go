@@ -0,0 +1,38 @@
+package datatype
+
+import "testing"
+
+func TestJobGetRole(t *testing.T) {
+	team := NewTeam("lab", "alice")
+	team.Members["bob"] = JobRoleEditor
+	team.Members["carol"] = JobRoleViewer
+	job := NewJob("job", "alice", "1")
+	job.Team = "lab"
+	job.Collaborators = map[string]JobRole{"carol": JobRoleEditor, "dave": JobRoleViewer}
+	for userName, want := range map[string]JobRole{
+		"alice": JobRoleOwner,
+		"bob":   JobRoleEditor,
+		// the higher of the roles in the team and as a collaborator
+		"carol": JobRoleEditor,
+		"dave":  JobRoleViewer,
+		"eve":   "",
+		"":      "",
+	} {
+		if got := job.GetRole(userName, team); got != want {
+			t.Errorf("%s: wanted role %q, got %q", userName, want, got)
+		}
+	}
+	// a team of another name does not give roles
+	if got := job.GetRole("bob", NewTeam("other", "bob")); got != "" {
+		t.Errorf("wanted no role from other team, got %q", got)
+	}
+	if !JobRoleOwner.Includes(JobRoleViewer) || JobRoleViewer.Includes(JobRoleEditor) || JobRole("").Includes("") {
+		t.Error("unexpected role inclusion")
+	}
+	if _, err := ParseJobRole("admin"); err == nil {
+		t.Error("expected an error for unknown role")
+	}
+	if err := (&Team{Name: "bad name"}).Validate(); err == nil {
+		t.Error("expected an error for invalid team name")
+	}
+}
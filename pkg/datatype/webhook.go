@@ -0,0 +1,87 @@
+package datatype
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Webhook is a URL the cloud scheduler posts events of jobs to. A webhook with an empty JobID
+// receives events of all jobs the user created
+type Webhook struct {
+	ID    string `json:"id" yaml:"id"`
+	User  string `json:"user" yaml:"user"`
+	JobID string `json:"job_id,omitempty" yaml:"jobID,omitempty"`
+	URL   string `json:"url" yaml:"url"`
+	// Secret signs payloads posted to the URL. It is shown only when the webhook is created
+	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
+	// Events are the event types to post, e.g. sys.scheduler.status.job.removed.
+	// A type ending with * matches types starting with the rest. All events are posted if empty
+	Events  []string `json:"events,omitempty" yaml:"events,omitempty"`
+	Created Time     `json:"created" yaml:"created"`
+}
+
+// Validate returns an error if the webhook cannot be registered
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %s", w.URL, err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url %q must be http or https", w.URL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url %q has no host", w.URL)
+	}
+	return nil
+}
+
+// Matches returns true if the webhook wants the event of the job. A webhook of a user
+// the job is shared with matches only the job it is registered for. Callers check
+// that the user still has access to the job
+func (w *Webhook) Matches(job *Job, eventType EventType) bool {
+	if w.JobID == "" && w.User != job.User {
+		return false
+	}
+	if w.JobID != "" && w.JobID != job.JobID {
+		return false
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if prefix, found := strings.CutSuffix(e, "*"); found {
+			if strings.HasPrefix(string(eventType), prefix) {
+				return true
+			}
+		} else if e == string(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookPayload is the body posted to webhooks
+type WebhookPayload struct {
+	DeliveryID string                 `json:"delivery_id"`
+	WebhookID  string                 `json:"webhook_id"`
+	Event      EventType              `json:"event"`
+	Timestamp  int64                  `json:"timestamp"`
+	JobID      string                 `json:"job_id"`
+	JobName    string                 `json:"job_name"`
+	JobState   JobState               `json:"job_state"`
+	Meta       map[string]interface{} `json:"meta"`
+}
+
+// WebhookDelivery is an attempt of the cloud scheduler to post an event to a webhook
+type WebhookDelivery struct {
+	ID         string    `json:"id" yaml:"id"`
+	WebhookID  string    `json:"webhook_id" yaml:"webhookID"`
+	Event      EventType `json:"event" yaml:"event"`
+	JobID      string    `json:"job_id" yaml:"jobID"`
+	Time       Time      `json:"time" yaml:"time"`
+	Attempts   int       `json:"attempts" yaml:"attempts"`
+	Delivered  bool      `json:"delivered" yaml:"delivered"`
+	StatusCode int       `json:"status_code,omitempty" yaml:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty" yaml:"error,omitempty"`
+}
@@ -0,0 +1,68 @@
+package datatype
+
+import "testing"
+
+func TestWebhookMatches(t *testing.T) {
+	job := NewJob("job", "user", "1")
+	tests := map[string]struct {
+		webhook   Webhook
+		eventType EventType
+		want      bool
+	}{
+		"all events": {
+			webhook:   Webhook{User: "user"},
+			eventType: EventJobStatusRemoved,
+			want:      true,
+		},
+		"other user": {
+			webhook:   Webhook{User: "other"},
+			eventType: EventJobStatusRemoved,
+			want:      false,
+		},
+		"other job": {
+			webhook:   Webhook{User: "user", JobID: "2"},
+			eventType: EventJobStatusRemoved,
+			want:      false,
+		},
+		"other user for the job": {
+			webhook:   Webhook{User: "other", JobID: "1"},
+			eventType: EventJobStatusRemoved,
+			want:      true,
+		},
+		"event type": {
+			webhook:   Webhook{User: "user", JobID: "1", Events: []string{string(EventJobStatusRunning)}},
+			eventType: EventJobStatusRemoved,
+			want:      false,
+		},
+		"event prefix": {
+			webhook:   Webhook{User: "user", Events: []string{"sys.scheduler.status.job.*"}},
+			eventType: EventJobStatusRemoved,
+			want:      true,
+		},
+		"goal event by prefix": {
+			webhook:   Webhook{User: "user", Events: []string{"sys.scheduler.status.job.*"}},
+			eventType: EventGoalStatusSubmitted,
+			want:      false,
+		},
+	}
+	for name, test := range tests {
+		if got := test.webhook.Matches(job, test.eventType); got != test.want {
+			t.Errorf("%s: wanted %t, got %t", name, test.want, got)
+		}
+	}
+}
+
+func TestWebhookValidate(t *testing.T) {
+	for url, valid := range map[string]bool{
+		"https://example.com/hook": true,
+		"http://localhost:8080":    true,
+		"ftp://example.com":        false,
+		"example.com/hook":         false,
+		"https://":                 false,
+	} {
+		w := Webhook{URL: url}
+		if err := w.Validate(); (err == nil) != valid {
+			t.Errorf("%s: wanted valid=%t, got %v", url, valid, err)
+		}
+	}
+}
@@ -31,6 +31,13 @@ func NewHTTPRequest(baseURL string) *HTTPRequest {
 	}
 }
 
+// WithTimeout limits time of each request including reading the response body.
+// It must not be set for requests subscribing to a stream
+func (r *HTTPRequest) WithTimeout(timeout time.Duration) *HTTPRequest {
+	r.c.Timeout = timeout
+	return r
+}
+
 func (r *HTTPRequest) RequestGet(subPath string, queries url.Values, header map[string]string) (*http.Response, error) {
 	url, err := url.Parse(r.BaseURL)
 	if err != nil {
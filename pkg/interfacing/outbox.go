@@ -0,0 +1,298 @@
+package interfacing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+const (
+	outboxFileSuffix = ".msg"
+	outboxTempSuffix = ".tmp"
+)
+
+// MessagePriority ranks messages when the outbox is full. Messages of lower priority are dropped first
+type MessagePriority int
+
+const (
+	MessagePriorityLow MessagePriority = iota
+	MessagePriorityNormal
+	MessagePriorityHigh
+)
+
+var (
+	lowPriorityMessagePrefixes = []string{
+		"sys.plugin.perf.",
+		"sys.scheduler.status.goal.image.pulling",
+		"sys.scheduler.status.plugin.queued",
+		"sys.scheduler.status.plugin.selected",
+		"sys.scheduler.status.plugin.event",
+	}
+	highPriorityMessagePrefixes = []string{
+		"sys.scheduler.failure",
+		"sys.scheduler.status.job.",
+		"sys.scheduler.status.plugin.failed",
+		"sys.scheduler.status.plugin.unhealthy",
+		"sys.scheduler.status.goal.image.failed",
+		"sys.scheduler.status.goal.received",
+		"sys.scheduler.status.goal.updated",
+		"sys.scheduler.status.goal.removed",
+	}
+)
+
+// MessagePriorityOf returns the priority of the message by its name.
+// Failures and changes of jobs are high and frequent progress reports are low
+func MessagePriorityOf(name string) MessagePriority {
+	for _, prefix := range highPriorityMessagePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return MessagePriorityHigh
+		}
+	}
+	for _, prefix := range lowPriorityMessagePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return MessagePriorityLow
+		}
+	}
+	return MessagePriorityNormal
+}
+
+// OutboxDropPolicy decides which message is dropped when the outbox is full
+type OutboxDropPolicy string
+
+const (
+	// OutboxDropLowestPriority drops the oldest message of the lowest priority.
+	// The new message is dropped if it has the lowest priority
+	OutboxDropLowestPriority OutboxDropPolicy = "lowest-priority"
+	// OutboxDropOldest drops the oldest message
+	OutboxDropOldest OutboxDropPolicy = "oldest"
+	// OutboxDropNewest drops the new message
+	OutboxDropNewest OutboxDropPolicy = "newest"
+)
+
+// Validate returns an error if the policy is unknown
+func (p OutboxDropPolicy) Validate() error {
+	switch p {
+	case OutboxDropLowestPriority, OutboxDropOldest, OutboxDropNewest:
+		return nil
+	default:
+		return fmt.Errorf("unknown outbox drop policy %q: must be one of %s, %s, or %s", p, OutboxDropLowestPriority, OutboxDropOldest, OutboxDropNewest)
+	}
+}
+
+type outboxEntry struct {
+	seq      uint64
+	priority MessagePriority
+	size     int64
+}
+
+func (e outboxEntry) fileName() string {
+	return fmt.Sprintf("%020d-%d%s", e.seq, e.priority, outboxFileSuffix)
+}
+
+// Outbox is a bounded queue of messages kept on disk until they are published.
+// Each message is appended as a file named by its sequence number so that
+// messages survive restarts and are published in order
+type Outbox struct {
+	mu      sync.Mutex
+	dir     string
+	size    int
+	policy  OutboxDropPolicy
+	entries []outboxEntry
+	nextSeq uint64
+	bytes   int64
+	dropped atomic.Uint64
+	// added is signaled when a message is added
+	added chan struct{}
+}
+
+// NewOutbox returns an Outbox keeping up to size messages in dir.
+// Messages left in dir from a previous run are loaded
+func NewOutbox(dir string, size int, policy OutboxDropPolicy) (*Outbox, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("outbox size must be positive: %d", size)
+	}
+	if policy == "" {
+		policy = OutboxDropLowestPriority
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	o := &Outbox{
+		dir:    dir,
+		size:   size,
+		policy: policy,
+		added:  make(chan struct{}, 1),
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		// messages not completely written are discarded
+		if strings.HasSuffix(f.Name(), outboxTempSuffix) {
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		var e outboxEntry
+		if _, err := fmt.Sscanf(f.Name(), "%d-%d.msg", &e.seq, &e.priority); err != nil {
+			logger.Error.Printf("Ignoring unknown file %q in outbox %q", f.Name(), dir)
+			continue
+		}
+		if info, err := f.Info(); err == nil {
+			e.size = info.Size()
+		}
+		o.entries = append(o.entries, e)
+		o.bytes += e.size
+	}
+	sort.Slice(o.entries, func(i, j int) bool { return o.entries[i].seq < o.entries[j].seq })
+	if len(o.entries) > 0 {
+		o.nextSeq = o.entries[len(o.entries)-1].seq + 1
+		logger.Info.Printf("%d messages are loaded from outbox %q", len(o.entries), dir)
+	}
+	for len(o.entries) > o.size {
+		o.remove(0)
+		o.dropped.Add(1)
+	}
+	return o, nil
+}
+
+// Put appends the message to the outbox. If the outbox is full, a message is dropped
+// by the drop policy and an error is returned if the dropped one is the new message
+func (o *Outbox) Put(m RabbitMQMessageWrapper, priority MessagePriority) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.entries) >= o.size {
+		victim := o.victim(priority)
+		o.dropped.Add(1)
+		if victim < 0 {
+			return fmt.Errorf("outbox is full (%d messages). the message is dropped", o.size)
+		}
+		logger.Debug.Printf("outbox is full. dropping message %d", o.entries[victim].seq)
+		o.remove(victim)
+	}
+	blob, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	e := outboxEntry{
+		seq:      o.nextSeq,
+		priority: priority,
+		size:     int64(len(blob)),
+	}
+	// the message is renamed after written so that a partially written message is never loaded
+	tempPath := filepath.Join(o.dir, e.fileName()+outboxTempSuffix)
+	if err := os.WriteFile(tempPath, blob, 0644); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err := os.Rename(tempPath, filepath.Join(o.dir, e.fileName())); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	o.nextSeq += 1
+	o.entries = append(o.entries, e)
+	o.bytes += e.size
+	select {
+	case o.added <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// victim returns the index of the message to drop for a new message of given priority.
+// It returns -1 if the new message should be dropped
+func (o *Outbox) victim(priority MessagePriority) int {
+	switch o.policy {
+	case OutboxDropOldest:
+		return 0
+	case OutboxDropNewest:
+		return -1
+	}
+	victim := -1
+	for i, e := range o.entries {
+		if e.priority <= priority && (victim < 0 || e.priority < o.entries[victim].priority) {
+			victim = i
+		}
+	}
+	return victim
+}
+
+// remove deletes the message at index i. The caller must hold the lock
+func (o *Outbox) remove(i int) {
+	e := o.entries[i]
+	if err := os.Remove(filepath.Join(o.dir, e.fileName())); err != nil && !os.IsNotExist(err) {
+		logger.Error.Printf("Failed to remove message %d from outbox: %s", e.seq, err.Error())
+	}
+	o.entries = append(o.entries[:i], o.entries[i+1:]...)
+	o.bytes -= e.size
+}
+
+// Peek returns the oldest message and its sequence number. It returns false if the outbox is empty
+func (o *Outbox) Peek() (uint64, RabbitMQMessageWrapper, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for len(o.entries) > 0 {
+		e := o.entries[0]
+		var m RabbitMQMessageWrapper
+		blob, err := os.ReadFile(filepath.Join(o.dir, e.fileName()))
+		if err == nil {
+			err = json.Unmarshal(blob, &m)
+		}
+		if err == nil {
+			return e.seq, m, true
+		}
+		logger.Error.Printf("Dropping unreadable message %d from outbox: %s", e.seq, err.Error())
+		o.remove(0)
+		o.dropped.Add(1)
+	}
+	return 0, RabbitMQMessageWrapper{}, false
+}
+
+// Ack removes the message of given sequence number as it is published
+func (o *Outbox) Ack(seq uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, e := range o.entries {
+		if e.seq == seq {
+			o.remove(i)
+			return
+		}
+	}
+}
+
+// Added returns a channel signaled when a message is added
+func (o *Outbox) Added() <-chan struct{} {
+	return o.added
+}
+
+// Len returns the number of messages in the outbox
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// Bytes returns the total size of messages in the outbox
+func (o *Outbox) Bytes() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.bytes
+}
+
+// Dropped returns the number of messages dropped as the outbox was full or messages were unreadable
+func (o *Outbox) Dropped() uint64 {
+	return o.dropped.Load()
+}
@@ -0,0 +1,130 @@
+package interfacing
+
+import (
+	"testing"
+)
+
+func TestOutboxPersistsMessages(t *testing.T) {
+	dir := t.TempDir()
+	o, err := NewOutbox(dir, 10, OutboxDropLowestPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"first", "second"} {
+		if err := o.Put(*NewRabbitMQMessageWrapper("to-validator", "all", []byte(body), ""), MessagePriorityNormal); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seq, m, found := o.Peek()
+	if !found || string(m.Body) != "first" {
+		t.Fatalf("expected the first message, got %q", m.Body)
+	}
+	o.Ack(seq)
+
+	// messages not acknowledged are loaded again after restart
+	o, err = NewOutbox(dir, 10, OutboxDropLowestPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Len() != 1 {
+		t.Fatalf("expected 1 message in the outbox, got %d", o.Len())
+	}
+	if _, m, _ := o.Peek(); string(m.Body) != "second" {
+		t.Errorf("expected the second message, got %q", m.Body)
+	}
+	if err := o.Put(*NewRabbitMQMessageWrapper("to-validator", "all", []byte("third"), ""), MessagePriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+	seq, _, _ = o.Peek()
+	o.Ack(seq)
+	if _, m, _ := o.Peek(); string(m.Body) != "third" {
+		t.Errorf("expected the third message, got %q", m.Body)
+	}
+}
+
+func TestOutboxDropPolicy(t *testing.T) {
+	tests := map[string]struct {
+		Policy   OutboxDropPolicy
+		Incoming MessagePriority
+		Want     []string
+		Err      bool
+	}{
+		"lowest-priority": {
+			Policy:   OutboxDropLowestPriority,
+			Incoming: MessagePriorityNormal,
+			Want:     []string{"high", "low-2", "incoming"},
+		},
+		"oldest": {
+			Policy:   OutboxDropOldest,
+			Incoming: MessagePriorityLow,
+			Want:     []string{"high", "low-2", "incoming"},
+		},
+		"newest": {
+			Policy:   OutboxDropNewest,
+			Incoming: MessagePriorityHigh,
+			Want:     []string{"low-1", "high", "low-2"},
+			Err:      true,
+		},
+	}
+	for name, test := range tests {
+		o, err := NewOutbox(t.TempDir(), 3, test.Policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.Put(*NewRabbitMQMessageWrapper("", "", []byte("low-1"), ""), MessagePriorityLow)
+		o.Put(*NewRabbitMQMessageWrapper("", "", []byte("high"), ""), MessagePriorityHigh)
+		o.Put(*NewRabbitMQMessageWrapper("", "", []byte("low-2"), ""), MessagePriorityLow)
+		err = o.Put(*NewRabbitMQMessageWrapper("", "", []byte("incoming"), ""), test.Incoming)
+		if (err != nil) != test.Err {
+			t.Errorf("%s: expected error %t, got %v", name, test.Err, err)
+		}
+		if o.Dropped() != 1 {
+			t.Errorf("%s: expected 1 message dropped, got %d", name, o.Dropped())
+		}
+		var got []string
+		for {
+			seq, m, found := o.Peek()
+			if !found {
+				break
+			}
+			got = append(got, string(m.Body))
+			o.Ack(seq)
+		}
+		if len(got) != len(test.Want) {
+			t.Fatalf("%s: expected %v, got %v", name, test.Want, got)
+		}
+		for i := range got {
+			if got[i] != test.Want[i] {
+				t.Errorf("%s: expected %v, got %v", name, test.Want, got)
+				break
+			}
+		}
+	}
+
+	// the incoming message is dropped if others have higher priority
+	o, err := NewOutbox(t.TempDir(), 1, OutboxDropLowestPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Put(*NewRabbitMQMessageWrapper("", "", []byte("high"), ""), MessagePriorityHigh)
+	if err := o.Put(*NewRabbitMQMessageWrapper("", "", []byte("low"), ""), MessagePriorityLow); err == nil {
+		t.Error("expected the low priority message to be dropped")
+	}
+	if _, m, _ := o.Peek(); string(m.Body) != "high" {
+		t.Errorf("expected the high priority message to be kept, got %q", m.Body)
+	}
+}
+
+func TestMessagePriorityOf(t *testing.T) {
+	tests := map[string]MessagePriority{
+		"sys.scheduler.status.plugin.failed":      MessagePriorityHigh,
+		"sys.scheduler.status.plugin.running":     MessagePriorityNormal,
+		"sys.scheduler.status.goal.image.pulling": MessagePriorityLow,
+		"sys.plugin.perf.cpu":                     MessagePriorityLow,
+	}
+	for name, want := range tests {
+		if got := MessagePriorityOf(name); got != want {
+			t.Errorf("%s: expected priority %d, got %d", name, want, got)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package interfacing
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/streadway/amqp"
@@ -13,6 +16,11 @@ import (
 	"gopkg.in/cenkalti/backoff.v1"
 )
 
+const (
+	publishConfirmTimeout  = 10 * time.Second
+	outboxMaxRetryInterval = time.Minute
+)
+
 type RabbitMQMessageWrapper struct {
 	DestName    string
 	RoutingKey  string
@@ -38,6 +46,20 @@ type RabbitMQHandler struct {
 	rabbitmqChan     *amqp.Channel
 	appID            string
 	chanToPublish    chan RabbitMQMessageWrapper
+	// pending counts messages cached but not yet published
+	pending sync.WaitGroup
+	started bool
+	// publishFailures counts messages that failed to be cached or published
+	publishFailures atomic.Uint64
+	// connMu serializes connecting to RabbitMQ for publishing
+	connMu sync.Mutex
+	// outbox keeps messages on disk until RabbitMQ confirms them if set
+	outbox      *Outbox
+	confirmConn *amqp.Connection
+	confirmChan *amqp.Channel
+	confirms    chan amqp.Confirmation
+	stop        chan struct{}
+	stopOnce    sync.Once
 }
 
 func NewRabbitMQHandler(rabbitmqURI string, rabbitmqUsername string, rabbitmqPassword string, cacertPath string, appID string) *RabbitMQHandler {
@@ -48,6 +70,7 @@ func NewRabbitMQHandler(rabbitmqURI string, rabbitmqUsername string, rabbitmqPas
 		cacertPath:       cacertPath,
 		appID:            appID,
 		chanToPublish:    make(chan RabbitMQMessageWrapper, 100),
+		stop:             make(chan struct{}),
 	}
 }
 
@@ -143,6 +166,8 @@ func (rh *RabbitMQHandler) DeclareQueueAndConnectToExchange(exchangeName string,
 }
 
 func (rh *RabbitMQHandler) publish(m RabbitMQMessageWrapper) error {
+	rh.connMu.Lock()
+	defer rh.connMu.Unlock()
 	if rh.rabbitmqConn == nil || rh.rabbitmqConn.IsClosed() {
 		err := rh.Connect()
 		if err != nil {
@@ -154,17 +179,67 @@ func (rh *RabbitMQHandler) publish(m RabbitMQMessageWrapper) error {
 		m.RoutingKey,
 		false,
 		false,
-		amqp.Publishing{
-			Body:         m.Body,
-			DeliveryMode: 2,
-			UserId:       rh.rabbitmqUsername,
-			AppId:        rh.appID,
-			ContentType:  m.ContentType,
-		},
+		rh.publishing(m),
 	)
 	return err
 }
 
+func (rh *RabbitMQHandler) publishing(m RabbitMQMessageWrapper) amqp.Publishing {
+	return amqp.Publishing{
+		Body:         m.Body,
+		DeliveryMode: 2,
+		UserId:       rh.rabbitmqUsername,
+		AppId:        rh.appID,
+		ContentType:  m.ContentType,
+	}
+}
+
+// publishWithConfirm publishes the message and waits until RabbitMQ confirms it.
+// It uses its own channel in confirm mode
+func (rh *RabbitMQHandler) publishWithConfirm(m RabbitMQMessageWrapper) error {
+	rh.connMu.Lock()
+	defer rh.connMu.Unlock()
+	if rh.rabbitmqConn == nil || rh.rabbitmqConn.IsClosed() {
+		err := rh.Connect()
+		if err != nil {
+			return err
+		}
+	}
+	if rh.confirmChan == nil || rh.confirmConn != rh.rabbitmqConn {
+		ch, err := rh.rabbitmqConn.Channel()
+		if err != nil {
+			return err
+		}
+		if err := ch.Confirm(false); err != nil {
+			ch.Close()
+			return err
+		}
+		rh.confirmConn = rh.rabbitmqConn
+		rh.confirmChan = ch
+		rh.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	}
+	if err := rh.confirmChan.Publish(m.DestName, m.RoutingKey, false, false, rh.publishing(m)); err != nil {
+		rh.confirmChan = nil
+		return err
+	}
+	select {
+	case c, ok := <-rh.confirms:
+		if !ok {
+			rh.confirmChan = nil
+			return fmt.Errorf("channel closed before RabbitMQ confirmed the message")
+		}
+		if !c.Ack {
+			return fmt.Errorf("RabbitMQ rejected the message")
+		}
+		return nil
+	case <-time.After(publishConfirmTimeout):
+		// a late confirmation would be taken for the next message
+		rh.confirmChan.Close()
+		rh.confirmChan = nil
+		return fmt.Errorf("RabbitMQ did not confirm the message in %s", publishConfirmTimeout)
+	}
+}
+
 // SendWaggleMessageOnNode delivers a Waggle message to Waggle data pipeline inside a node
 //
 // The message is sent to the "to-validator" exchange
@@ -179,10 +254,25 @@ func (rh *RabbitMQHandler) SendWaggleMessageOnNode(message *datatype.WaggleMessa
 }
 
 // SendWaggleMessageOnNodeAsync caches message internally. The background routine will push messages asynchronously.
+// If an outbox is used, the message is kept on disk until RabbitMQ confirms it.
 func (rh *RabbitMQHandler) SendWaggleMessageOnNodeAsync(message *datatype.WaggleMessage, scope string) error {
+	if rh.outbox != nil {
+		err := rh.outbox.Put(*NewRabbitMQMessageWrapper(
+			"to-validator",
+			scope,
+			datatype.Dump(message),
+			"",
+		), MessagePriorityOf(message.Name))
+		if err != nil {
+			rh.publishFailures.Add(1)
+		}
+		return err
+	}
 	if len(rh.chanToPublish) == cap(rh.chanToPublish) {
+		rh.publishFailures.Add(1)
 		return fmt.Errorf("maximum capacity (%d) reached. this message will not be cached", cap(rh.chanToPublish))
 	}
+	rh.pending.Add(1)
 	rh.chanToPublish <- *NewRabbitMQMessageWrapper(
 		"to-validator",
 		scope,
@@ -255,13 +345,125 @@ func (rh *RabbitMQHandler) SubscribeEvents(exchange string, queueName string, to
 	return nil
 }
 
+// UseOutbox makes the handler keep messages in the outbox until RabbitMQ confirms them.
+// It must be called before StartLoop
+func (rh *RabbitMQHandler) UseOutbox(outbox *Outbox) {
+	rh.outbox = outbox
+}
+
+// Outbox returns the outbox of the handler. It returns nil if no outbox is used
+func (rh *RabbitMQHandler) Outbox() *Outbox {
+	return rh.outbox
+}
+
 func (rh *RabbitMQHandler) StartLoop() {
+	rh.started = true
+	if rh.outbox != nil {
+		go rh.runOutbox()
+		return
+	}
 	go func() {
 		for m := range rh.chanToPublish {
 			logger.Debug.Printf("to %s with routing key %s: %s", m.DestName, m.RoutingKey, m.Body)
 			if err := rh.publish(m); err != nil {
+				rh.publishFailures.Add(1)
 				logger.Error.Printf("failed to send message to %s: %s", m.DestName, err.Error())
 			}
+			rh.pending.Done()
 		}
 	}()
 }
+
+// Flush waits until the background routine publishes all cached messages.
+// It returns an error if the context is done before that
+func (rh *RabbitMQHandler) Flush(ctx context.Context) error {
+	if !rh.started {
+		return nil
+	}
+	if rh.outbox != nil {
+		return rh.flushOutbox(ctx)
+	}
+	done := make(chan struct{})
+	go func() {
+		rh.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d messages not published: %s", len(rh.chanToPublish), ctx.Err())
+	}
+}
+
+// PublishFailures returns the number of messages that failed to be published
+func (rh *RabbitMQHandler) PublishFailures() uint64 {
+	return rh.publishFailures.Load()
+}
+
+// Ping connects to RabbitMQ if not connected. It returns an error if RabbitMQ is not reachable
+func (rh *RabbitMQHandler) Ping() error {
+	rh.connMu.Lock()
+	defer rh.connMu.Unlock()
+	if rh.rabbitmqConn == nil || rh.rabbitmqConn.IsClosed() {
+		return rh.Connect()
+	}
+	return nil
+}
+
+// Close stops publishing messages from the outbox and closes the connection to RabbitMQ
+func (rh *RabbitMQHandler) Close() error {
+	rh.stopOnce.Do(func() { close(rh.stop) })
+	rh.connMu.Lock()
+	defer rh.connMu.Unlock()
+	if rh.rabbitmqConn == nil || rh.rabbitmqConn.IsClosed() {
+		return nil
+	}
+	return rh.rabbitmqConn.Close()
+}
+
+// runOutbox publishes messages in the outbox in order. A message stays in the outbox
+// until RabbitMQ confirms it and publishing is retried with backoff
+func (rh *RabbitMQHandler) runOutbox() {
+	b := backoff.NewExponentialBackOff()
+	b.MaxInterval = outboxMaxRetryInterval
+	b.MaxElapsedTime = 0
+	for {
+		seq, m, found := rh.outbox.Peek()
+		if !found {
+			select {
+			case <-rh.outbox.Added():
+				continue
+			case <-rh.stop:
+				return
+			}
+		}
+		logger.Debug.Printf("to %s with routing key %s: %s", m.DestName, m.RoutingKey, m.Body)
+		if err := rh.publishWithConfirm(m); err != nil {
+			rh.publishFailures.Add(1)
+			wait := b.NextBackOff()
+			logger.Error.Printf("failed to send message to %s: %s. %d messages in outbox. retrying in %s", m.DestName, err.Error(), rh.outbox.Len(), wait)
+			select {
+			case <-time.After(wait):
+				continue
+			case <-rh.stop:
+				return
+			}
+		}
+		b.Reset()
+		rh.outbox.Ack(seq)
+	}
+}
+
+func (rh *RabbitMQHandler) flushOutbox(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for rh.outbox.Len() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%d messages not published and kept in outbox: %s", rh.outbox.Len(), ctx.Err())
+		}
+	}
+	return nil
+}
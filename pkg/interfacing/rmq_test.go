@@ -0,0 +1,32 @@
+package interfacing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRabbitMQHandlerClose(t *testing.T) {
+	rh := NewRabbitMQHandler("localhost:5672", "guest", "guest", "", "test")
+	o, err := NewOutbox(t.TempDir(), 10, OutboxDropLowestPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rh.UseOutbox(o)
+	done := make(chan struct{})
+	go func() {
+		rh.runOutbox()
+		close(done)
+	}()
+	if err := rh.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// closing again does nothing
+	if err := rh.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("expected the outbox loop stopped on close")
+	}
+}
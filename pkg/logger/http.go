@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type levelMessage struct {
+	Level string `json:"level"`
+	Error string `json:"error,omitempty"`
+}
+
+// LevelHandler responds with the current log level on GET and changes the level on PUT or POST.
+// The new level is given as JSON, e.g. {"level": "debug"}, or the level query parameter
+func LevelHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPut || r.Method == http.MethodPost {
+		name := r.URL.Query().Get("level")
+		if name == "" {
+			var m levelMessage
+			if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(levelMessage{Level: GetLevel().String(), Error: fmt.Sprintf("failed to parse body: %s", err.Error())})
+				return
+			}
+			name = m.Level
+		}
+		l, err := ParseLevel(name)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(levelMessage{Level: GetLevel().String(), Error: err.Error()})
+			return
+		}
+		if l != GetLevel() {
+			Info.Printf("log level changes from %s to %s", GetLevel(), l)
+			SetLevel(l)
+		}
+	}
+	json.NewEncoder(w).Encode(levelMessage{Level: GetLevel().String()})
+}
@@ -1,17 +1,254 @@
 package logger
 
 import (
-	"log"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Standard field names used across binaries
+const (
+	FieldNode   = "node"
+	FieldJobID  = "job_id"
+	FieldGoalID = "goal_id"
+	FieldPlugin = "plugin"
+)
+
+// Level is the severity of a log message
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warning"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", l)
+	}
+}
+
+// ParseLevel returns the level of given name: debug, info, warning (or warn), or error
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warning", "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// Format is the output format of log messages
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat returns the format of given name: text or json
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	default:
+		return FormatText, fmt.Errorf("unknown log format %q", s)
+	}
+}
+
+var (
+	level  atomic.Int32
+	mu     sync.Mutex
+	output io.Writer = os.Stdout
+	format           = FormatText
+	// base keeps fields added to every message, e.g. the node name
+	base = &Entry{}
+	// root logs messages of the level loggers
+	root = &Entry{}
+)
+
+func init() {
+	level.Store(int32(LevelDebug))
+}
+
+// SetLevel sets the minimum level of messages to be logged. It is safe to call at runtime
+func SetLevel(l Level) {
+	level.Store(int32(l))
+}
+
+// GetLevel returns the minimum level of messages to be logged
+func GetLevel() Level {
+	return Level(level.Load())
+}
+
+// SetFormat sets the output format of log messages
+func SetFormat(f Format) {
+	mu.Lock()
+	defer mu.Unlock()
+	format = f
+}
+
+// SetOutput sets the destination of log messages
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	output = w
+}
+
+// SetFields adds key/value pairs to every log message
+func SetFields(kv ...interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	base = base.With(kv...)
+}
+
+// With returns an Entry that logs messages with given key/value pairs
+func With(kv ...interface{}) *Entry {
+	return (&Entry{}).With(kv...)
+}
+
+// Entry logs messages with key/value fields
+type Entry struct {
+	fields []field
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// With returns a new Entry with given key/value pairs added. Empty values are skipped
+func (e *Entry) With(kv ...interface{}) *Entry {
+	n := &Entry{fields: append([]field{}, e.fields...)}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] == "" {
+			continue
+		}
+		n.fields = append(n.fields, field{key: fmt.Sprint(kv[i]), value: kv[i+1]})
+	}
+	return n
+}
+
+func (e *Entry) Debug(msg string, kv ...interface{}) { e.With(kv...).log(LevelDebug, msg) }
+func (e *Entry) Info(msg string, kv ...interface{})  { e.With(kv...).log(LevelInfo, msg) }
+func (e *Entry) Warn(msg string, kv ...interface{})  { e.With(kv...).log(LevelWarn, msg) }
+func (e *Entry) Error(msg string, kv ...interface{}) { e.With(kv...).log(LevelError, msg) }
+
+func (e *Entry) Debugf(format string, v ...interface{}) { e.log(LevelDebug, fmt.Sprintf(format, v...)) }
+func (e *Entry) Infof(format string, v ...interface{})  { e.log(LevelInfo, fmt.Sprintf(format, v...)) }
+func (e *Entry) Warnf(format string, v ...interface{})  { e.log(LevelWarn, fmt.Sprintf(format, v...)) }
+func (e *Entry) Errorf(format string, v ...interface{}) { e.log(LevelError, fmt.Sprintf(format, v...)) }
+
+// callerDepth is the number of frames between the caller and log
+const callerDepth = 2
+
+func (e *Entry) log(l Level, msg string) {
+	if l < GetLevel() {
+		return
+	}
+	caller := ""
+	if _, file, line, ok := runtime.Caller(callerDepth); ok {
+		caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	fields := append(append([]field{}, base.fields...), e.fields...)
+	var buf bytes.Buffer
+	if format == FormatJSON {
+		m := map[string]interface{}{
+			"time":   time.Now().UTC().Format(time.RFC3339Nano),
+			"level":  l.String(),
+			"caller": caller,
+			"msg":    strings.TrimSuffix(msg, "\n"),
+		}
+		for _, f := range fields {
+			if err, ok := f.value.(error); ok {
+				m[f.key] = err.Error()
+			} else {
+				m[f.key] = f.value
+			}
+		}
+		if err := json.NewEncoder(&buf).Encode(m); err != nil {
+			fmt.Fprintf(&buf, "{\"level\":%q,\"msg\":%q}\n", l.String(), err.Error())
+		}
+	} else {
+		fmt.Fprintf(&buf, "%s: %s %s: %s", strings.ToUpper(l.String()), time.Now().Format("2006/01/02 15:04:05"), caller, strings.TrimSuffix(msg, "\n"))
+		for _, f := range fields {
+			fmt.Fprintf(&buf, " %s=%s", f.key, quote(fmt.Sprint(f.value)))
+		}
+		buf.WriteByte('\n')
+	}
+	output.Write(buf.Bytes())
+}
+
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+// LevelLogger logs printf-style messages at its level
+type LevelLogger struct {
+	level Level
+}
+
+func (l *LevelLogger) Print(v ...interface{}) {
+	root.log(l.level, fmt.Sprint(v...))
+}
+
+func (l *LevelLogger) Printf(format string, v ...interface{}) {
+	root.log(l.level, fmt.Sprintf(format, v...))
+}
+
+func (l *LevelLogger) Println(v ...interface{}) {
+	root.log(l.level, fmt.Sprintln(v...))
+}
+
+func (l *LevelLogger) Fatalln(v ...interface{}) {
+	root.log(LevelError, fmt.Sprintln(v...))
+	os.Exit(1)
+}
+
+func (l *LevelLogger) Fatalf(format string, v ...interface{}) {
+	root.log(LevelError, fmt.Sprintf(format, v...))
+	os.Exit(1)
+}
+
 var (
 	// Debug logs messages verbosely
-	Debug = log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
+	Debug = &LevelLogger{level: LevelDebug}
 	// Info logs information helpful to know
-	Info = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	Info = &LevelLogger{level: LevelInfo}
 	// Warn logs warnings
-	Warn = log.New(os.Stdout, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
+	Warn = &LevelLogger{level: LevelWarn}
 	// Error logs errors
-	Error = log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	Error = &LevelLogger{level: LevelError}
 )
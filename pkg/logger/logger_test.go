@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStructuredLogging(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	SetFormat(FormatJSON)
+	defer func() {
+		SetOutput(os.Stdout)
+		SetFormat(FormatText)
+		SetLevel(LevelDebug)
+	}()
+
+	SetLevel(LevelInfo)
+	With(FieldJobID, "1", FieldGoalID, "").Debug("dropped")
+	if buf.Len() != 0 {
+		t.Fatalf("expected debug message to be dropped at info level, got %q", buf.String())
+	}
+	With(FieldJobID, "1", FieldGoalID, "").With(FieldPlugin, "plugin-a").Info("plugin is queued", "condition", "True")
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("failed to parse %q: %s", buf.String(), err.Error())
+	}
+	want := map[string]interface{}{
+		"level":     "info",
+		"msg":       "plugin is queued",
+		FieldJobID:  "1",
+		FieldPlugin: "plugin-a",
+		"condition": "True",
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("expected %s=%v, got %v", k, v, m[k])
+		}
+	}
+	if _, found := m[FieldGoalID]; found {
+		t.Error("expected empty field to be skipped")
+	}
+	if !strings.HasPrefix(m["caller"].(string), "logger_test.go:") {
+		t.Errorf("expected caller to be the test, got %v", m["caller"])
+	}
+
+	buf.Reset()
+	SetFormat(FormatText)
+	Info.Printf("plugin %q failed", "plugin-a")
+	if got := buf.String(); !strings.HasPrefix(got, "INFO: ") || !strings.Contains(got, `logger_test.go:`) || !strings.HasSuffix(got, "plugin \"plugin-a\" failed\n") {
+		t.Errorf("unexpected text output %q", got)
+	}
+}
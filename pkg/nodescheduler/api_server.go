@@ -1,23 +1,30 @@
 package nodescheduler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	// "net/http/pprof"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 	// "github.com/urfave/negroni"
 )
 
 type APIServer struct {
+	mu            sync.Mutex
 	version       string
 	port          int
 	mainRouter    *mux.Router
+	server        *http.Server
 	nodeScheduler *NodeScheduler
 }
 
@@ -29,14 +36,35 @@ func (api *APIServer) Run() {
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, `{"id": "Node Scheduler (`+api.nodeScheduler.NodeID+`)", "version":"`+api.version+`"}`)
 	})
+	r.Handle("/metrics", promhttp.HandlerFor(api.nodeScheduler.Metrics.Registry, promhttp.HandlerOpts{EnableOpenMetrics: true})).Methods(http.MethodGet)
+	r.Handle("/healthz", http.HandlerFunc(api.handlerLiveness)).Methods(http.MethodGet)
+	r.Handle("/readyz", http.HandlerFunc(api.handlerReadiness)).Methods(http.MethodGet)
 	api_route := r.PathPrefix("/api/v1").Subrouter()
 	// mux := http.NewServeMux()
 	// mux.HandleFunc("/debug/pprof", pprof.Index)
 	// go http.ListenAndServe(":18080", nil)
 	api_route.Handle("/goals", http.HandlerFunc(api.handlerGoals)).Methods(http.MethodGet, http.MethodPost, http.MethodPut)
 	api_route.Handle("/schedule", http.HandlerFunc(api.handlerSchedule)).Methods(http.MethodGet, http.MethodPost, http.MethodPut)
+	api_route.Handle("/history", http.HandlerFunc(api.handlerHistory)).Methods(http.MethodGet)
+	api_route.Handle("/drain", http.HandlerFunc(api.handlerDrain)).Methods(http.MethodGet, http.MethodPost, http.MethodDelete)
 	// api_route.Handle("/status/queue/waiting", http.HandlerFunc(api.handlerGoals)).Methods(http.MethodGet, http.MethodPost, http.MethodPut)
-	logger.Info.Fatalln(http.ListenAndServe(api_address_port, r))
+	server := &http.Server{Addr: api_address_port, Handler: r}
+	api.mu.Lock()
+	api.server = server
+	api.mu.Unlock()
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Info.Fatalln(err)
+	}
+}
+
+// Shutdown stops the API server after handling requests in progress
+func (api *APIServer) Shutdown(ctx context.Context) error {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.server == nil {
+		return nil
+	}
+	return api.server.Shutdown(ctx)
 }
 
 func respondJSON(w http.ResponseWriter, statusCode int, data []byte) {
@@ -98,6 +126,11 @@ func (api *APIServer) handlerSchedule(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		}
+		if api.nodeScheduler.IsDraining() {
+			response := datatype.NewAPIMessageBuilder().AddError("node is draining").Build()
+			respondJSON(w, http.StatusServiceUnavailable, response.ToJson())
+			return
+		}
 		logger.Info.Printf("locally requested to add plugin %q to schedule", newPlugin.Name)
 		e := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusQueued).AddReason("locally submitted").Build()
 		// api.nodeScheduler.LogToBeehive.SendWaggleMessageOnNodeAsync(response.ToWaggleMessage(), "node")
@@ -113,3 +146,86 @@ func (api *APIServer) handlerSchedule(w http.ResponseWriter, r *http.Request) {
 		respondJSON(w, http.StatusOK, response.ToJson())
 	}
 }
+
+// handlerDrain puts the node into drain mode on POST and resumes scheduling on DELETE.
+// Plugins running on the node are not affected
+func (api *APIServer) handlerDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		logger.Info.Printf("locally requested to drain the node")
+		api.nodeScheduler.Drain()
+	case http.MethodDelete:
+		logger.Info.Printf("locally requested to resume scheduling on the node")
+		api.nodeScheduler.Resume()
+	}
+	response := datatype.NewAPIMessageBuilder().
+		AddEntity("draining", api.nodeScheduler.IsDraining()).
+		AddEntity("running_plugins", api.nodeScheduler.getRunningPluginNames()).
+		Build()
+	respondJSON(w, http.StatusOK, response.ToJson())
+}
+
+// handlerLiveness responds with an error if the main loop of the scheduler is stuck
+func (api *APIServer) handlerLiveness(w http.ResponseWriter, r *http.Request) {
+	if err := api.nodeScheduler.IsAlive(); err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusServiceUnavailable, response.ToJson())
+		return
+	}
+	response := datatype.NewAPIMessageBuilder().AddEntity("status", "ok").Build()
+	respondJSON(w, http.StatusOK, response.ToJson())
+}
+
+// handlerReadiness responds with an error if the scheduler cannot reach Kubernetes or RabbitMQ
+func (api *APIServer) handlerReadiness(w http.ResponseWriter, r *http.Request) {
+	builder := datatype.NewAPIMessageBuilder()
+	status := http.StatusOK
+	for name, err := range api.nodeScheduler.IsReady() {
+		builder.AddEntity(name, err.Error())
+		status = http.StatusServiceUnavailable
+	}
+	if status == http.StatusOK {
+		builder.AddEntity("status", "ok")
+	}
+	respondJSON(w, status, builder.Build().ToJson())
+}
+
+// handlerHistory returns executions of plugins from the latest. The query parameters
+// plugin, job, state, since (RFC3339), and limit filter the executions
+func (api *APIServer) handlerHistory(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	q := ExecutionQuery{
+		PluginName: values.Get("plugin"),
+		JobID:      values.Get("job"),
+		State:      values.Get("state"),
+	}
+	if v := values.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("failed to parse since: %s", err.Error())).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		q.Since = since
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("failed to parse limit: %s", err.Error())).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		q.Limit = limit
+	}
+	records := api.nodeScheduler.ExecutionHistory.Query(q)
+	if records == nil {
+		records = []ExecutionRecord{}
+	}
+	blob, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusInternalServerError, response.ToJson())
+		return
+	}
+	respondJSON(w, http.StatusOK, blob)
+}
@@ -1,6 +1,7 @@
 package nodescheduler
 
 import (
+	"context"
 	"strings"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
@@ -15,14 +16,39 @@ type NodeSchedulerConfig struct {
 	RabbitmqURI      string `json:"rabbitmq_uri" yaml:"rabbimqURI"`
 	RabbitmqUsername string `json:"rabbitmq_username" yaml:"rabbitMQUsername"`
 	RabbitmqPassword string `json:"rabbitmq_password" yaml:"rabbitMQPassword"`
-	Kubeconfig       string `json:"kubeconfig" yaml:"kubeConfig"`
-	InCluster        bool   `json:"in_cluster" yaml:"inCluster"`
-	RuleCheckerURI   string `json:"rulechecker_uri" yaml:"ruleCheckerURI"`
-	ScoreboardURI    string `json:"scoreboard_uri" yaml:"scoreboardURI"`
-	Simulate         bool   `json:"simulate" yaml:"simulate"`
-	GoalStreamURL    string `json:"goalstream_URI" yaml:"goalStreamURL"`
-	SchedulingPolicy string `json:"policy" yaml:"policy"`
-	Debug            bool   `json:"debug" yaml:"debug"`
+	// RabbitmqManagementURI enables a credential per plugin run.
+	// The RabbitMQ username and password are used if management username is not given
+	RabbitmqManagementURI      string `json:"rabbitmq_management_uri" yaml:"rabbitMQManagementURI"`
+	RabbitmqManagementUsername string `json:"rabbitmq_management_username" yaml:"rabbitMQManagementUsername"`
+	RabbitmqManagementPassword string `json:"rabbitmq_management_password" yaml:"rabbitMQManagementPassword"`
+	Kubeconfig                 string `json:"kubeconfig" yaml:"kubeConfig"`
+	InCluster                  bool   `json:"in_cluster" yaml:"inCluster"`
+	RuleCheckerURI             string `json:"rulechecker_uri" yaml:"ruleCheckerURI"`
+	ScoreboardURI              string `json:"scoreboard_uri" yaml:"scoreboardURI"`
+	Simulate                   bool   `json:"simulate" yaml:"simulate"`
+	GoalStreamURL              string `json:"goalstream_URI" yaml:"goalStreamURL"`
+	SchedulingPolicy           string `json:"policy" yaml:"policy"`
+	NodeManifestPath           string `json:"node_manifest_path" yaml:"nodeManifestPath"`
+	Debug                      bool   `json:"debug" yaml:"debug"`
+	// LogFormat is the format of log messages: text or json
+	LogFormat string `json:"log_format" yaml:"logFormat"`
+	// ShutdownTimeout is seconds to wait for running plugins to finish on shutdown
+	ShutdownTimeout int `json:"shutdown_timeout" yaml:"shutdownTimeout"`
+	// ExecutionHistorySize is the number of plugin executions kept in the history
+	ExecutionHistorySize int `json:"execution_history_size" yaml:"executionHistorySize"`
+	// ExecutionDigestInterval is seconds between digests of plugin executions. No digest is sent if 0
+	ExecutionDigestInterval int `json:"execution_digest_interval" yaml:"executionDigestInterval"`
+	// NodeServices overrides WES services provided to plugins
+	NodeServices NodeServices `json:"node_services" yaml:"nodeServices"`
+	// OutboxPath is the directory keeping scheduler events until RabbitMQ confirms them.
+	// Events are kept in memory if empty
+	OutboxPath string `json:"outbox_path" yaml:"outboxPath"`
+	// OutboxSize is the maximum number of events kept in the outbox
+	OutboxSize int `json:"outbox_size" yaml:"outboxSize"`
+	// OutboxDropPolicy decides which event is dropped when the outbox is full
+	OutboxDropPolicy string `json:"outbox_drop_policy" yaml:"outboxDropPolicy"`
+	// Simulation configures plugin Pods simulated when Simulate is set
+	Simulation SimulatorConfig `json:"simulation" yaml:"simulation"`
 }
 
 type NodeSchedulerBuilder struct {
@@ -30,7 +56,7 @@ type NodeSchedulerBuilder struct {
 }
 
 func NewNodeSchedulerBuilder(config *NodeSchedulerConfig) *NodeSchedulerBuilder {
-	return &NodeSchedulerBuilder{
+	nsb := &NodeSchedulerBuilder{
 		nodeScheduler: &NodeScheduler{
 			Version:                     config.Version,
 			NodeID:                      strings.ToLower(config.Name),
@@ -40,14 +66,19 @@ func NewNodeSchedulerBuilder(config *NodeSchedulerConfig) *NodeSchedulerBuilder
 			chanFromResourceManager:     make(chan datatype.Event, maxChannelBuffer),
 			chanFromCloudScheduler:      make(chan datatype.Event, maxChannelBuffer),
 			chanNeedScheduling:          make(chan datatype.Event, maxChannelBuffer),
+			imagePullCancels:            make(map[string]context.CancelFunc),
+			ExecutionHistory:            NewExecutionHistory(config.ExecutionHistorySize),
 		},
 	}
+	nsb.nodeScheduler.Metrics = NewMetrics(nsb.nodeScheduler)
+	return nsb
 }
 
 func (nsb *NodeSchedulerBuilder) AddGoalManager(appID string) *NodeSchedulerBuilder {
 	nsb.nodeScheduler.GoalManager = &NodeGoalManager{
 		ScienceGoals:  make(map[string]datatype.ScienceGoal),
 		LoadedPlugins: make(map[PluginIndex]*datatype.PluginRuntime),
+		readyGoals:    make(map[string]bool),
 	}
 	return nsb
 }
@@ -58,6 +89,7 @@ func (nsb *NodeSchedulerBuilder) AddResourceManager() *NodeSchedulerBuilder {
 		Clientset:     nil,
 		MetricsClient: nil,
 		Simulate:      nsb.nodeScheduler.Config.Simulate,
+		NodeServices:  nsb.nodeScheduler.Config.NodeServices.WithDefaults(),
 		Notifier:      interfacing.NewNotifier(),
 		runner:        "nodescheduler",
 	}
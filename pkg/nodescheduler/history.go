@@ -0,0 +1,193 @@
+package nodescheduler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+)
+
+const defaultExecutionHistorySize = 1000
+
+// ExecutionRecord structs a plugin execution that has finished on the node
+type ExecutionRecord struct {
+	PluginName  string    `json:"plugin_name"`
+	PluginImage string    `json:"plugin_image"`
+	JobID       string    `json:"job_id"`
+	GoalID      string    `json:"goal_id"`
+	PodName     string    `json:"pod_name,omitempty"`
+	Compute     string    `json:"compute,omitempty"`
+	TriggeredBy string    `json:"triggered_by,omitempty"`
+	State       string    `json:"state"`
+	QueuedAt    time.Time `json:"queued_at"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+	ExitCode    *int32    `json:"exit_code,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	CPU         string    `json:"cpu,omitempty"`
+	Memory      string    `json:"memory,omitempty"`
+}
+
+// Duration returns how long the plugin ran. It returns 0 if the plugin never ran
+func (r ExecutionRecord) Duration() time.Duration {
+	if r.StartedAt.IsZero() {
+		return 0
+	}
+	return r.EndedAt.Sub(r.StartedAt)
+}
+
+// ExecutionQuery filters execution records. Empty fields match any record
+type ExecutionQuery struct {
+	PluginName string
+	JobID      string
+	State      string
+	Since      time.Time
+	Limit      int
+}
+
+func (q ExecutionQuery) match(r ExecutionRecord) bool {
+	return (q.PluginName == "" || q.PluginName == r.PluginName) &&
+		(q.JobID == "" || q.JobID == r.JobID) &&
+		(q.State == "" || q.State == r.State) &&
+		(q.Since.IsZero() || !r.EndedAt.Before(q.Since))
+}
+
+// ExecutionHistory keeps the latest execution records of plugins up to its size
+type ExecutionHistory struct {
+	mu      sync.Mutex
+	size    int
+	records []ExecutionRecord
+}
+
+// NewExecutionHistory returns an ExecutionHistory keeping up to size records
+func NewExecutionHistory(size int) *ExecutionHistory {
+	if size <= 0 {
+		size = defaultExecutionHistorySize
+	}
+	return &ExecutionHistory{
+		size: size,
+	}
+}
+
+// Add adds the record and drops the oldest one if the history is full
+func (h *ExecutionHistory) Add(r ExecutionRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	if len(h.records) > h.size {
+		h.records = h.records[len(h.records)-h.size:]
+	}
+}
+
+// Query returns records matching the query from the latest
+func (h *ExecutionHistory) Query(q ExecutionQuery) (records []ExecutionRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := len(h.records) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(records) >= q.Limit {
+			break
+		}
+		if q.match(h.records[i]) {
+			records = append(records, h.records[i])
+		}
+	}
+	return
+}
+
+// ExecutionSummary summarizes executions of a plugin
+type ExecutionSummary struct {
+	Runs            int     `json:"runs"`
+	Completed       int     `json:"completed"`
+	Failed          int     `json:"failed"`
+	AverageDuration float64 `json:"average_duration_seconds"`
+	LastFailure     string  `json:"last_failure,omitempty"`
+}
+
+// Summarize returns the summary of executions ended since given time per plugin
+func (h *ExecutionHistory) Summarize(since time.Time) map[string]*ExecutionSummary {
+	summaries := make(map[string]*ExecutionSummary)
+	totalDurations := make(map[string]time.Duration)
+	// records are returned from the latest
+	for _, r := range h.Query(ExecutionQuery{Since: since}) {
+		s, found := summaries[r.PluginName]
+		if !found {
+			s = &ExecutionSummary{}
+			summaries[r.PluginName] = s
+		}
+		s.Runs += 1
+		totalDurations[r.PluginName] += r.Duration()
+		switch r.State {
+		case string(datatype.Completed):
+			s.Completed += 1
+		case string(datatype.Failed):
+			s.Failed += 1
+			if s.LastFailure == "" {
+				s.LastFailure = r.Reason
+			}
+		}
+	}
+	for name, s := range summaries {
+		s.AverageDuration = totalDurations[name].Seconds() / float64(s.Runs)
+	}
+	return summaries
+}
+
+// newExecutionRecord returns the record of the plugin that finished in the Pod
+func (ns *NodeScheduler) newExecutionRecord(pr *datatype.PluginRuntime, pod *v1.Pod, action KubernetesEventActionType) ExecutionRecord {
+	r := ExecutionRecord{
+		PluginName:  pr.Plugin.Name,
+		PluginImage: pr.Plugin.PluginSpec.Image,
+		JobID:       pr.Plugin.JobID,
+		GoalID:      pr.Plugin.GoalID,
+		PodName:     pod.Name,
+		Compute:     pr.Compute,
+		TriggeredBy: pr.TriggeredBy,
+		State:       string(datatype.Failed),
+		QueuedAt:    pr.QueuedAt,
+		StartedAt:   pr.StartedAt,
+		EndedAt:     pr.FinishedAt,
+	}
+	if pr.Status.Is(string(datatype.Completed)) {
+		r.State = string(datatype.Completed)
+	}
+	if action == KubernetesEventTypeDeleted {
+		r.Reason = "plugin deleted from external"
+	} else if pod.Status.Reason != "" {
+		r.Reason = fmt.Sprintf("%s: %s", pod.Status.Reason, pod.Status.Message)
+	}
+	pluginContainerName := pod.Labels[PodLabelPluginTask]
+	if status, err := ns.ResourceManager.GetContainerStatusFromPod(pod, pluginContainerName); err == nil {
+		if t := status.State.Terminated; t != nil {
+			exitCode := t.ExitCode
+			r.ExitCode = &exitCode
+			if r.Reason == "" && t.ExitCode != 0 {
+				r.Reason = t.Reason
+				if t.Message != "" {
+					r.Reason = fmt.Sprintf("%s: %s", t.Reason, t.Message)
+				}
+			}
+		}
+	}
+	if cpu, memory, err := ns.ResourceManager.GetPodResourceUsage(pod.Name, pluginContainerName); err == nil {
+		r.CPU, r.Memory = cpu, memory
+	} else {
+		logger.Debug.Printf("No resource usage of plugin %q is known: %s", pod.Name, err.Error())
+	}
+	return r
+}
+
+// sendExecutionDigest sends a summary of plugin executions ended since given time
+func (ns *NodeScheduler) sendExecutionDigest(since time.Time) {
+	summaries := ns.ExecutionHistory.Summarize(since)
+	if len(summaries) == 0 {
+		return
+	}
+	msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginExecutionDigest).
+		AddEntry("since", since.UTC().Format(time.RFC3339)).
+		AddEntry("plugins", summaries).
+		Build()
+	ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+}
@@ -0,0 +1,49 @@
+package nodescheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestExecutionHistory(t *testing.T) {
+	h := NewExecutionHistory(3)
+	start := time.Now().Add(-time.Hour)
+	for i, r := range []ExecutionRecord{
+		{PluginName: "plugin-a", JobID: "1", State: string(datatype.Completed)},
+		{PluginName: "plugin-a", JobID: "1", State: string(datatype.Failed), Reason: "Error"},
+		{PluginName: "plugin-b", JobID: "2", State: string(datatype.Completed)},
+		{PluginName: "plugin-a", JobID: "1", State: string(datatype.Completed)},
+	} {
+		r.StartedAt = start.Add(time.Duration(i) * time.Minute)
+		r.EndedAt = r.StartedAt.Add(10 * time.Second)
+		h.Add(r)
+	}
+	tests := map[string]struct {
+		Query    ExecutionQuery
+		Expected int
+	}{
+		"all":       {Query: ExecutionQuery{}, Expected: 3},
+		"plugin":    {Query: ExecutionQuery{PluginName: "plugin-a"}, Expected: 2},
+		"state":     {Query: ExecutionQuery{State: string(datatype.Failed)}, Expected: 1},
+		"since":     {Query: ExecutionQuery{Since: start.Add(2 * time.Minute)}, Expected: 2},
+		"limit":     {Query: ExecutionQuery{Limit: 1}, Expected: 1},
+		"not found": {Query: ExecutionQuery{JobID: "3"}, Expected: 0},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if records := h.Query(tc.Query); len(records) != tc.Expected {
+				t.Errorf("expected %d records, but got %d: %v", tc.Expected, len(records), records)
+			}
+		})
+	}
+	if records := h.Query(ExecutionQuery{Limit: 1}); records[0].EndedAt != start.Add(3*time.Minute+10*time.Second) {
+		t.Errorf("expected the latest record first, but got %v", records[0])
+	}
+	summaries := h.Summarize(time.Time{})
+	a := summaries["plugin-a"]
+	if a == nil || a.Runs != 2 || a.Completed != 1 || a.Failed != 1 || a.LastFailure != "Error" || a.AverageDuration != 10 {
+		t.Errorf("unexpected summary of plugin-a: %+v", a)
+	}
+}
@@ -60,6 +60,38 @@ func (kb *KnowledgeBase) AddRulesFromScienceGoal(s *datatype.ScienceGoal) error
 	}
 }
 
+// UpdateRulesFromScienceGoal replaces the rules of the old goal with the rules of given goal.
+// Rules that have not changed are kept as parsed and only new rules are parsed
+func (kb *KnowledgeBase) UpdateRulesFromScienceGoal(oldGoalID string, s *datatype.ScienceGoal) error {
+	mySubGoal := s.GetMySubGoal(kb.nodeID)
+	if mySubGoal == nil {
+		return fmt.Errorf("failed to find my sub goal from science goal %q", s.ID)
+	}
+	existingRules := make(map[string]datatype.ScienceRule)
+	for _, r := range kb.rules[oldGoalID] {
+		existingRules[r.Rule] = r
+	}
+	updatedScienceRules := []datatype.ScienceRule{}
+	for _, r := range mySubGoal.ScienceRules {
+		if existingRule, found := existingRules[r.Rule]; found {
+			updatedScienceRules = append(updatedScienceRules, existingRule)
+			delete(existingRules, r.Rule)
+			continue
+		}
+		if err := r.Parse(r.Rule); err != nil {
+			logger.Error.Printf("Failed to parse ScienceRule %q: %s", r.Rule, err.Error())
+		}
+		logger.Info.Printf("ScienceRule %q is added to goal %q", r.Rule, s.ID)
+		updatedScienceRules = append(updatedScienceRules, r)
+	}
+	for rule := range existingRules {
+		logger.Info.Printf("ScienceRule %q is removed from goal %q", rule, s.ID)
+	}
+	delete(kb.rules, oldGoalID)
+	kb.rules[s.ID] = updatedScienceRules
+	return nil
+}
+
 func (kb *KnowledgeBase) DropRules(goalID string) {
 	delete(kb.rules, goalID)
 }
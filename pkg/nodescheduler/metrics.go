@@ -0,0 +1,154 @@
+package nodescheduler
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+)
+
+var pluginStates = []datatype.PluginState{
+	datatype.Inactive,
+	datatype.Queued,
+	datatype.Scheduled,
+	datatype.Initializing,
+	datatype.Running,
+	datatype.Completed,
+	datatype.Failed,
+}
+
+// Metrics holds Prometheus metrics of the node scheduler
+type Metrics struct {
+	Registry               *prometheus.Registry
+	queueLength            *prometheus.GaugeVec
+	pluginCount            *prometheus.GaugeVec
+	schedulingLatency      prometheus.Histogram
+	pluginRunDuration      *prometheus.HistogramVec
+	ruleEvaluationDuration prometheus.Histogram
+	ruleEvaluationErrors   prometheus.Counter
+	kubernetesEvents       *prometheus.CounterVec
+}
+
+// NewMetrics returns metrics of the node scheduler registered to a new registry
+func NewMetrics(ns *NodeScheduler) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		queueLength: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nodescheduler_queue_length",
+			Help: "Number of plugins in the queue",
+		}, []string{"queue"}),
+		pluginCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nodescheduler_plugins_count",
+			Help: "Number of plugins per state",
+		}, []string{"state"}),
+		schedulingLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "nodescheduler_scheduling_latency_seconds",
+			Help:    "Time from a plugin being queued to running",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		}),
+		pluginRunDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nodescheduler_plugin_run_duration_seconds",
+			Help:    "Time from a plugin running to completed or failed",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 16),
+		}, []string{"state"}),
+		ruleEvaluationDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "nodescheduler_rule_evaluation_duration_seconds",
+			Help:    "Time to evaluate science rules of a goal",
+			Buckets: prometheus.DefBuckets,
+		}),
+		ruleEvaluationErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nodescheduler_rule_evaluation_errors_total",
+			Help: "Number of failed science rule evaluations",
+		}),
+		kubernetesEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nodescheduler_kubernetes_events_total",
+			Help: "Number of events received from Kubernetes informers",
+		}, []string{"type", "action"}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		m.queueLength,
+		m.pluginCount,
+		m.schedulingLatency,
+		m.pluginRunDuration,
+		m.ruleEvaluationDuration,
+		m.ruleEvaluationErrors,
+		m.kubernetesEvents,
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "nodescheduler_rabbitmq_publish_failures_total",
+			Help: "Number of messages failed to be published to RabbitMQ",
+		}, func() float64 {
+			if ns.LogToBeehive == nil {
+				return 0
+			}
+			return float64(ns.LogToBeehive.PublishFailures())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "nodescheduler_outbox_backlog_messages",
+			Help: "Number of events in the outbox waiting to be published",
+		}, func() float64 {
+			if o := ns.outbox(); o != nil {
+				return float64(o.Len())
+			}
+			return 0
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "nodescheduler_outbox_backlog_bytes",
+			Help: "Size of events in the outbox waiting to be published",
+		}, func() float64 {
+			if o := ns.outbox(); o != nil {
+				return float64(o.Bytes())
+			}
+			return 0
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "nodescheduler_outbox_dropped_total",
+			Help: "Number of events dropped from the outbox",
+		}, func() float64 {
+			if o := ns.outbox(); o != nil {
+				return float64(o.Dropped())
+			}
+			return 0
+		}),
+	)
+	return m
+}
+
+// outbox returns the outbox of the events sent to beehive if used
+func (ns *NodeScheduler) outbox() *interfacing.Outbox {
+	if ns.LogToBeehive == nil {
+		return nil
+	}
+	return ns.LogToBeehive.Outbox()
+}
+
+// updateQueues updates the queue lengths and the number of plugins per state
+func (m *Metrics) updateQueues(ns *NodeScheduler) {
+	m.queueLength.WithLabelValues("ready").Set(float64(ns.readyQueue.Length()))
+	m.queueLength.WithLabelValues("scheduled").Set(float64(ns.scheduledPlugins.Length()))
+	counts := make(map[string]int)
+	for _, pr := range ns.GoalManager.LoadedPlugins {
+		counts[pr.Status.Current()] += 1
+	}
+	for _, s := range pluginStates {
+		m.pluginCount.WithLabelValues(string(s)).Set(float64(counts[string(s)]))
+	}
+}
+
+// observePluginRuntime observes the scheduling latency and the run duration
+// of the plugin if it started or finished since given time
+func (m *Metrics) observePluginRuntime(pr *datatype.PluginRuntime, since time.Time) {
+	if pr.StartedAt.After(since) && !pr.QueuedAt.IsZero() {
+		m.schedulingLatency.Observe(pr.StartedAt.Sub(pr.QueuedAt).Seconds())
+	}
+	if pr.FinishedAt.After(since) && !pr.StartedAt.IsZero() {
+		// a plugin deleted from external fails and becomes inactive at once
+		state := string(datatype.Failed)
+		if pr.Status.Is(string(datatype.Completed)) {
+			state = string(datatype.Completed)
+		}
+		m.pluginRunDuration.WithLabelValues(state).Observe(pr.FinishedAt.Sub(pr.StartedAt).Seconds())
+	}
+}
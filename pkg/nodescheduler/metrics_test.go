@@ -0,0 +1,60 @@
+package nodescheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func getHistogramSampleCount(t *testing.T, m *Metrics, name string) uint64 {
+	families, err := m.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count uint64
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			count += metric.GetHistogram().GetSampleCount()
+		}
+	}
+	return count
+}
+
+func TestObservePluginRuntime(t *testing.T) {
+	ns := NewNodeSchedulerBuilder(&NodeSchedulerConfig{Name: "W000"}).Build()
+	pr := datatype.NewPluginRuntime(datatype.Plugin{
+		Name:       "test-plugin",
+		PluginSpec: &datatype.PluginSpec{Image: "myimage:0.1.0"},
+	})
+	for _, transition := range []func() error{pr.Queued, pr.Scheduled, pr.Initializing} {
+		if err := transition(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	since := time.Now()
+	if err := pr.Running(); err != nil {
+		t.Fatal(err)
+	}
+	ns.Metrics.observePluginRuntime(pr, since)
+	if c := getHistogramSampleCount(t, ns.Metrics, "nodescheduler_scheduling_latency_seconds"); c != 1 {
+		t.Errorf("expected 1 scheduling latency observed, but got %d", c)
+	}
+	if c := getHistogramSampleCount(t, ns.Metrics, "nodescheduler_plugin_run_duration_seconds"); c != 0 {
+		t.Errorf("expected no run duration observed, but got %d", c)
+	}
+	since = time.Now()
+	if err := pr.Completed(); err != nil {
+		t.Fatal(err)
+	}
+	ns.Metrics.observePluginRuntime(pr, since)
+	if c := getHistogramSampleCount(t, ns.Metrics, "nodescheduler_scheduling_latency_seconds"); c != 1 {
+		t.Errorf("expected scheduling latency not observed again, but got %d", c)
+	}
+	if c := getHistogramSampleCount(t, ns.Metrics, "nodescheduler_plugin_run_duration_seconds"); c != 1 {
+		t.Errorf("expected 1 run duration observed, but got %d", c)
+	}
+}
@@ -0,0 +1,215 @@
+package nodescheduler
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// NetworkPolicyLabelPlugin marks NetworkPolicies generated for plugins
+	NetworkPolicyLabelPlugin = "sagecontinuum.org/plugin-network"
+)
+
+// lookupIP resolves hostnames listed in the network section of plugins
+var lookupIP = net.LookupIP
+
+// networkPolicyNameForPlugin returns the name of the NetworkPolicy for the plugin object
+func networkPolicyNameForPlugin(objectName string) string {
+	return objectName + "-network"
+}
+
+// CreateNetworkPolicyTemplate returns a NetworkPolicy for the Kubernetes object of the plugin.
+// The policy allows the plugin to reach WES services, DNS, and destinations listed in the network
+// section of the plugin only. Hostnames are resolved to IP addresses when the policy is created.
+// It returns nil if the plugin runs in develop mode that opts out of network filtering.
+func (rm *ResourceManager) CreateNetworkPolicyTemplate(pr *datatype.PluginRuntime, objectName string) (*networkingv1.NetworkPolicy, error) {
+	if pr.Plugin.PluginSpec.DevelopMode {
+		return nil, nil
+	}
+	udp, tcp := apiv1.ProtocolUDP, apiv1.ProtocolTCP
+	dnsPort := intstr.FromInt(53)
+	egress := []networkingv1.NetworkPolicyEgressRule{
+		// WES services
+		{
+			To: []networkingv1.NetworkPolicyPeer{
+				{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"kubernetes.io/metadata.name": rm.NodeServices.Namespace},
+					},
+				},
+			},
+		},
+		// DNS to resolve WES service names
+		{
+			To: []networkingv1.NetworkPolicyPeer{
+				{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"kubernetes.io/metadata.name": "kube-system"},
+					},
+				},
+			},
+			Ports: []networkingv1.NetworkPolicyPort{
+				{Protocol: &udp, Port: &dnsPort},
+				{Protocol: &tcp, Port: &dnsPort},
+			},
+		},
+	}
+	if network := pr.Plugin.PluginSpec.Network; network != nil && len(network.Egress) > 0 {
+		var peers []networkingv1.NetworkPolicyPeer
+		for _, dest := range network.Egress {
+			cidrs, err := resolveEgressDestination(dest)
+			if err != nil {
+				return nil, err
+			}
+			for _, cidr := range cidrs {
+				peers = append(peers, networkingv1.NetworkPolicyPeer{
+					IPBlock: &networkingv1.IPBlock{CIDR: cidr},
+				})
+			}
+		}
+		egress = append(egress, networkingv1.NetworkPolicyEgressRule{To: peers})
+	}
+	podSelector := map[string]string{
+		"app.kubernetes.io/name":       pr.Plugin.Name,
+		"app.kubernetes.io/managed-by": rm.runner,
+	}
+	if pr.Plugin.JobID != "" {
+		podSelector[PodLabelJobID] = pr.Plugin.JobID
+	}
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      networkPolicyNameForPlugin(objectName),
+			Namespace: rm.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": rm.runner,
+				"app.kubernetes.io/created-by": rm.runner,
+				NetworkPolicyLabelPlugin:       pr.Plugin.Name,
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: podSelector},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress:      egress,
+		},
+	}, nil
+}
+
+// resolveEgressDestination returns CIDRs of the destination given as a CIDR, IP address, or hostname
+func resolveEgressDestination(dest string) ([]string, error) {
+	if _, ipNet, err := net.ParseCIDR(dest); err == nil {
+		return []string{ipNet.String()}, nil
+	}
+	if ip := net.ParseIP(dest); ip != nil {
+		return []string{cidrForIP(ip)}, nil
+	}
+	ips, err := lookupIP(dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve egress destination %q: %s", dest, err.Error())
+	}
+	var cidrs []string
+	for _, ip := range ips {
+		cidrs = append(cidrs, cidrForIP(ip))
+	}
+	return cidrs, nil
+}
+
+func cidrForIP(ip net.IP) string {
+	if ip.To4() != nil {
+		return ip.String() + "/32"
+	}
+	return ip.String() + "/128"
+}
+
+// UpdateNetworkPolicy creates the NetworkPolicy or updates it if exists
+func (rm *ResourceManager) UpdateNetworkPolicy(policy *networkingv1.NetworkPolicy) error {
+	policies := rm.Clientset.NetworkingV1().NetworkPolicies(rm.Namespace)
+	_, err := policies.Create(context.TODO(), policy, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		_, err = policies.Update(context.TODO(), policy, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// SetNetworkPolicyOwner makes the NetworkPolicy owned by the Kubernetes object of the plugin
+// so that Kubernetes deletes the policy when the object is deleted.
+// The kind is one of Pod, Job, Deployment, and DaemonSet
+func (rm *ResourceManager) SetNetworkPolicyOwner(name string, kind string, objectName string) error {
+	var (
+		object     metav1.Object
+		apiVersion string
+		err        error
+	)
+	switch kind {
+	case "Pod":
+		apiVersion = "v1"
+		object, err = rm.Clientset.CoreV1().Pods(rm.Namespace).Get(context.TODO(), objectName, metav1.GetOptions{})
+	case "Job":
+		apiVersion = "batch/v1"
+		object, err = rm.Clientset.BatchV1().Jobs(rm.Namespace).Get(context.TODO(), objectName, metav1.GetOptions{})
+	case "Deployment":
+		apiVersion = "apps/v1"
+		object, err = rm.Clientset.AppsV1().Deployments(rm.Namespace).Get(context.TODO(), objectName, metav1.GetOptions{})
+	case "DaemonSet":
+		apiVersion = "apps/v1"
+		object, err = rm.Clientset.AppsV1().DaemonSets(rm.Namespace).Get(context.TODO(), objectName, metav1.GetOptions{})
+	default:
+		return fmt.Errorf("unknown kind %q for the owner of network policy", kind)
+	}
+	if err != nil {
+		return err
+	}
+	return rm.setNetworkPolicyOwner(name, metav1.OwnerReference{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Name:       object.GetName(),
+		UID:        object.GetUID(),
+	})
+}
+
+func (rm *ResourceManager) setNetworkPolicyOwner(name string, owner metav1.OwnerReference) error {
+	policies := rm.Clientset.NetworkingV1().NetworkPolicies(rm.Namespace)
+	policy, err := policies.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	policy.OwnerReferences = []metav1.OwnerReference{owner}
+	_, err = policies.Update(context.TODO(), policy, metav1.UpdateOptions{})
+	return err
+}
+
+// DeleteNetworkPolicy deletes the NetworkPolicy. It does not return an error if the policy does not exist
+func (rm *ResourceManager) DeleteNetworkPolicy(name string) error {
+	err := rm.Clientset.NetworkingV1().NetworkPolicies(rm.Namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// cleanUpNetworkPolicies deletes NetworkPolicies of plugins that are left behind
+func (rm *ResourceManager) cleanUpNetworkPolicies() error {
+	policies, err := rm.Clientset.NetworkingV1().NetworkPolicies(rm.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: NetworkPolicyLabelPlugin,
+	})
+	if err != nil {
+		return err
+	}
+	for _, policy := range policies.Items {
+		if policy.Labels["app.kubernetes.io/managed-by"] != rm.runner {
+			continue
+		}
+		if err := rm.DeleteNetworkPolicy(policy.Name); err != nil {
+			logger.Error.Printf("Failed to delete network policy %q: %s", policy.Name, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package nodescheduler
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestNetworkPolicyTemplate(t *testing.T) {
+	lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("192.0.2.10")}, nil
+	}
+	defer func() { lookupIP = net.LookupIP }()
+	newPluginRuntime := func(develop bool, network *datatype.PluginNetwork) *datatype.PluginRuntime {
+		return datatype.NewPluginRuntime(datatype.Plugin{
+			Name:  "test-plugin",
+			JobID: "1",
+			PluginSpec: &datatype.PluginSpec{
+				Image:       "myimage:0.1.0",
+				DevelopMode: develop,
+				Network:     network,
+			},
+		})
+	}
+	tests := map[string]struct {
+		Plugin   *datatype.PluginRuntime
+		NoPolicy bool
+		CIDRs    []string
+	}{
+		"default": {
+			Plugin: newPluginRuntime(false, nil),
+		},
+		"develop": {
+			Plugin:   newPluginRuntime(true, nil),
+			NoPolicy: true,
+		},
+		"egress": {
+			Plugin: newPluginRuntime(false, &datatype.PluginNetwork{
+				Egress: []string{"10.31.81.0/24", "198.51.100.1", "example.org"},
+			}),
+			CIDRs: []string{"10.31.81.0/24", "198.51.100.1/32", "192.0.2.10/32"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake_rm := NewFakeK3SResourceManager([]runtime.Object{})
+			policy, err := fake_rm.CreateNetworkPolicyTemplate(tc.Plugin, "test-plugin-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.NoPolicy {
+				if policy != nil {
+					t.Errorf("expected no policy, but got %v", policy)
+				}
+				return
+			}
+			if policy.Spec.PodSelector.MatchLabels[PodLabelJobID] != "1" {
+				t.Errorf("expected the policy to select pods of job 1, but got %v", policy.Spec.PodSelector.MatchLabels)
+			}
+			var cidrs []string
+			for _, rule := range policy.Spec.Egress {
+				for _, peer := range rule.To {
+					if peer.IPBlock != nil {
+						cidrs = append(cidrs, peer.IPBlock.CIDR)
+					}
+				}
+			}
+			if len(cidrs) != len(tc.CIDRs) {
+				t.Fatalf("expected egress to %v, but got %v", tc.CIDRs, cidrs)
+			}
+			for i := range cidrs {
+				if cidrs[i] != tc.CIDRs[i] {
+					t.Errorf("expected egress to %v, but got %v", tc.CIDRs, cidrs)
+				}
+			}
+		})
+	}
+}
+
+func TestNetworkPolicyOwner(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-plugin-1",
+			Namespace: "ses",
+			UID:       "1234",
+		},
+	}
+	fake_rm := NewFakeK3SResourceManager([]runtime.Object{pod})
+	pr := datatype.NewPluginRuntime(datatype.Plugin{
+		Name:       "test-plugin",
+		JobID:      "1",
+		PluginSpec: &datatype.PluginSpec{Image: "myimage:0.1.0"},
+	})
+	policy, err := fake_rm.CreateNetworkPolicyTemplate(pr, pod.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fake_rm.UpdateNetworkPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake_rm.SetNetworkPolicyOwner(policy.Name, "Pod", pod.Name); err != nil {
+		t.Fatal(err)
+	}
+	p, err := fake_rm.Clientset.NetworkingV1().NetworkPolicies(fake_rm.Namespace).Get(context.TODO(), policy.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.OwnerReferences) != 1 || p.OwnerReferences[0].UID != pod.UID {
+		t.Errorf("expected the policy to be owned by pod %q, but got %v", pod.Name, p.OwnerReferences)
+	}
+}
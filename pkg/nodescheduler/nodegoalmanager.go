@@ -2,6 +2,7 @@ package nodescheduler
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
@@ -17,6 +18,10 @@ type PluginIndex struct {
 type NodeGoalManager struct {
 	ScienceGoals  map[string]datatype.ScienceGoal
 	LoadedPlugins map[PluginIndex]*datatype.PluginRuntime
+	// readyGoals keeps the goals whose plugin images are present on the node.
+	// It is updated by goroutines pulling the images.
+	readyGoals map[string]bool
+	mu         sync.Mutex
 }
 
 // GetScienceGoalByID returns the goal of given goal name
@@ -59,6 +64,7 @@ func (ngm *NodeGoalManager) DropGoalByName(goalName string) error {
 }
 
 func (ngm *NodeGoalManager) DropGoal(goalID string) error {
+	ngm.SetGoalReady(goalID, false)
 	if _, exist := ngm.ScienceGoals[goalID]; exist {
 		delete(ngm.ScienceGoals, goalID)
 		return nil
@@ -67,6 +73,27 @@ func (ngm *NodeGoalManager) DropGoal(goalID string) error {
 	}
 }
 
+// SetGoalReady marks the goal ready, or not ready, to schedule its plugins
+func (ngm *NodeGoalManager) SetGoalReady(goalID string, ready bool) {
+	ngm.mu.Lock()
+	defer ngm.mu.Unlock()
+	if ngm.readyGoals == nil {
+		ngm.readyGoals = make(map[string]bool)
+	}
+	if ready {
+		ngm.readyGoals[goalID] = true
+	} else {
+		delete(ngm.readyGoals, goalID)
+	}
+}
+
+// IsGoalReady returns true if plugins of the goal are ready to be scheduled
+func (ngm *NodeGoalManager) IsGoalReady(goalID string) bool {
+	ngm.mu.Lock()
+	defer ngm.mu.Unlock()
+	return ngm.readyGoals[goalID]
+}
+
 func (ngm *NodeGoalManager) AddGoal(goal *datatype.ScienceGoal) {
 	ngm.ScienceGoals[goal.ID] = *goal
 }
@@ -107,6 +134,16 @@ func (ngm *NodeGoalManager) GetPluginRuntimeByNameAndJobID(name string, jobID st
 	})
 }
 
+// GetPluginRuntimesByGoalID returns PluginRuntimes of the plugins registered by given goal
+func (ngm *NodeGoalManager) GetPluginRuntimesByGoalID(goalID string) (r []*datatype.PluginRuntime) {
+	for index, pr := range ngm.LoadedPlugins {
+		if index.goalID == goalID {
+			r = append(r, pr)
+		}
+	}
+	return
+}
+
 func (ngm *NodeGoalManager) GetPluginRuntimeByPodUID(uid string) *datatype.PluginRuntime {
 	for _, pr := range ngm.LoadedPlugins {
 		if pr.PodUID == uid {
@@ -1,11 +1,15 @@
 package nodescheduler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/looplab/fsm"
@@ -18,6 +22,16 @@ import (
 
 const (
 	maxChannelBuffer = 100
+
+	shutdownFlushTimeout = 10 * time.Second
+
+	ruleCheckingInterval = 10 * time.Second
+	// livenessTimeout is how long the main loop can stay unresponsive before
+	// the scheduler is considered not alive
+	livenessTimeout = 6 * ruleCheckingInterval
+
+	imagePullTimeout       = 30 * time.Minute
+	imagePullRetryInterval = 1 * time.Minute
 )
 
 type NodeScheduler struct {
@@ -30,7 +44,10 @@ type NodeScheduler struct {
 	GoalManager                 *NodeGoalManager
 	APIServer                   *APIServer
 	SchedulingPolicy            policy.SchedulingPolicy
+	NodeManifest                *datatype.NodeManifest
 	LogToBeehive                *interfacing.RabbitMQHandler
+	Metrics                     *Metrics
+	ExecutionHistory            *ExecutionHistory
 	ToScoreboard                *interfacing.RedisClient
 	readyQueue                  datatype.Queue // act a job queue for resource management
 	scheduledPlugins            datatype.Queue
@@ -38,31 +55,95 @@ type NodeScheduler struct {
 	chanFromResourceManager     chan datatype.Event
 	chanFromCloudScheduler      chan datatype.Event
 	chanNeedScheduling          chan datatype.Event
+	// imagePullCancels keeps functions to stop pulling images of goals
+	imagePullCancels map[string]context.CancelFunc
+	imagePullLock    sync.Mutex
+	// draining stops scheduling plugins for node maintenance
+	draining atomic.Bool
+	// lastRuleCheck is the Unix time the main loop last evaluated science rules
+	lastRuleCheck atomic.Int64
 }
 
 // Configure sets up the followings in Kubernetes cluster
 //
 // - "ses" namespace
 //
-// - "wes-rabbitmq" and "wes-audio-server" services available in "ses" namespace
+// - WES services available in "ses" namespace (e.g., "wes-rabbitmq" and "wes-audio-server")
 //
-// - "waggle-data-config" and "wes-audio-server-plugin-conf" configmaps
+// - WES configmaps (e.g., "waggle-data-config" and "wes-audio-server-plugin-conf")
 //
 // - "wes-ses-goal" configmap that accepts user goals
+//
+// The WES services and configmaps are listed in the node services of the config.
+// In simulate mode, the above is set up in a fake Kubernetes cluster where plugin Pods
+// are simulated according to the simulation config.
 func (ns *NodeScheduler) Configure() (err error) {
+	if err := ns.ResourceManager.NodeServices.Validate(); err != nil {
+		return fmt.Errorf("invalid node services: %s", err.Error())
+	}
+	if ns.Config.NodeManifestPath != "" {
+		logger.With("path", ns.Config.NodeManifestPath).Info("loading node manifest")
+		blob, err := os.ReadFile(ns.Config.NodeManifestPath)
+		if err != nil {
+			return err
+		}
+		var nodeManifest datatype.NodeManifest
+		if err := json.Unmarshal(blob, &nodeManifest); err != nil {
+			return fmt.Errorf("failed to parse node manifest: %s", err.Error())
+		}
+		ns.NodeManifest = &nodeManifest
+	}
 	if ns.Config.Simulate {
-		return
+		var computes []string
+		if ns.NodeManifest != nil {
+			for _, c := range ns.NodeManifest.Computes {
+				computes = append(computes, c.Name)
+			}
+		}
+		logger.With("computes", strings.Join(computes, ",")).Info("simulating plugins on a fake Kubernetes cluster")
+		err = ns.ResourceManager.ConfigureSimulation(ns.NodeID, computes, ns.Config.Simulation)
+		if err != nil {
+			return fmt.Errorf("invalid simulation: %s", err.Error())
+		}
+	} else {
+		if ns.Config.RabbitmqManagementURI != "" {
+			logger.With("url", ns.Config.RabbitmqManagementURI).Info("plugins get their own credential from RabbitMQ")
+			username, password := ns.Config.RabbitmqManagementUsername, ns.Config.RabbitmqManagementPassword
+			if username == "" {
+				username, password = ns.Config.RabbitmqUsername, ns.Config.RabbitmqPassword
+			}
+			ns.ResourceManager.RMQManagement, err = NewRMQManagement(ns.Config.RabbitmqManagementURI, username, password, false)
+			if err != nil {
+				return
+			}
+		}
+		err = ns.ResourceManager.ConfigureKubernetes(ns.Config.InCluster, ns.Config.Kubeconfig)
+		if err != nil {
+			return
+		}
 	}
-	err = ns.ResourceManager.ConfigureKubernetes(ns.Config.InCluster, ns.Config.Kubeconfig)
-	if err != nil {
-		return
+	// goals are in place before the informers start so that they are picked up at start
+	if ns.Config.Simulate && ns.Config.Simulation.GoalsPath != "" {
+		logger.With("path", ns.Config.Simulation.GoalsPath).Info("loading goals")
+		blob, err := os.ReadFile(ns.Config.Simulation.GoalsPath)
+		if err != nil {
+			return err
+		}
+		var goals []datatype.ScienceGoal
+		if err := json.Unmarshal(blob, &goals); err != nil {
+			return fmt.Errorf("failed to parse goals: %s", err.Error())
+		}
+		err = ns.ResourceManager.CreateConfigMap(configMapNameForGoals, map[string]string{"goals": string(blob)}, ns.ResourceManager.Namespace, true)
+		if err != nil {
+			return err
+		}
 	}
 	err = ns.ResourceManager.Configure()
 	if err != nil {
 		return
 	}
 	if ns.Config.GoalStreamURL != "" {
-		logger.Info.Printf("subscribing goal downstream from %s", ns.Config.GoalStreamURL)
+		logger.With("url", ns.Config.GoalStreamURL).Info("subscribing goal downstream")
 		u, err := url.Parse(ns.Config.GoalStreamURL)
 		if err != nil {
 			return err
@@ -70,24 +151,49 @@ func (ns *NodeScheduler) Configure() (err error) {
 		s := interfacing.NewHTTPRequest(u.Scheme + "://" + u.Host)
 		s.Subscribe(u.Path, ns.chanFromCloudScheduler, true)
 	}
-	if ns.LogToBeehive != nil {
-		logger.Info.Println("starting THE RMQ handler loop for message publishing")
+	// scheduler events are not published in simulation
+	if ns.LogToBeehive != nil && !ns.Config.Simulate {
+		if ns.Config.OutboxPath != "" {
+			logger.With("path", ns.Config.OutboxPath).Info("scheduler events are kept in outbox until published")
+			outbox, err := interfacing.NewOutbox(ns.Config.OutboxPath, ns.Config.OutboxSize, interfacing.OutboxDropPolicy(ns.Config.OutboxDropPolicy))
+			if err != nil {
+				return fmt.Errorf("failed to open outbox: %s", err.Error())
+			}
+			ns.LogToBeehive.UseOutbox(outbox)
+		}
+		logger.With("url", ns.Config.RabbitmqURI).Info("starting the RabbitMQ handler loop for message publishing")
 		ns.LogToBeehive.StartLoop()
 	}
 	return
 }
 
-// Run handles communications between components for scheduling
-func (ns *NodeScheduler) Run() {
-	go ns.ResourceManager.Run()
+// Run handles communications between components for scheduling.
+// When the context is done, it shuts down the scheduler and returns
+func (ns *NodeScheduler) Run(ctx context.Context) {
+	go ns.ResourceManager.Run(ctx)
 	go ns.APIServer.Run()
-	ruleCheckingTicker := time.NewTicker(10 * time.Second)
+	ruleCheckingTicker := time.NewTicker(ruleCheckingInterval)
+	defer ruleCheckingTicker.Stop()
+	ns.lastRuleCheck.Store(time.Now().Unix())
+	var executionDigestTicker <-chan time.Time
+	if ns.Config.ExecutionDigestInterval > 0 {
+		t := time.NewTicker(time.Duration(ns.Config.ExecutionDigestInterval) * time.Second)
+		defer t.Stop()
+		executionDigestTicker = t.C
+	}
+	lastExecutionDigest := time.Now()
 	for {
 		select {
+		case <-ctx.Done():
+			ns.shutdown()
+			return
+		case now := <-executionDigestTicker:
+			ns.sendExecutionDigest(lastExecutionDigest)
+			lastExecutionDigest = now
 		case event := <-ns.chanFromCloudScheduler:
 			e := event.(datatype.SchedulerEvent)
 			goals := e.GetEntry("goals").(string)
-			logger.Debug.Printf("%s: %s", e.ToString(), goals)
+			logger.With("event", e.Type).Debug("goals received", "goals", goals)
 			err := ns.ResourceManager.CreateConfigMap(
 				configMapNameForGoals,
 				map[string]string{"goals": goals},
@@ -95,38 +201,51 @@ func (ns *NodeScheduler) Run() {
 				true,
 			)
 			if err != nil {
-				logger.Error.Printf("Failed to update goals for event %q", e.Type)
+				logger.With("event", e.Type).Error("failed to update goals", "error", err)
 			}
 		case <-ruleCheckingTicker.C:
-			logger.Debug.Print("Rule evaluation triggered")
+			ns.lastRuleCheck.Store(time.Now().Unix())
+			ns.Metrics.updateQueues(ns)
+			logger.With("goals", len(ns.GoalManager.ScienceGoals)).Debug("rule evaluation triggered")
 			triggerScheduling := false
 			// for goalID, _ := range ns.waitingQueue.GetGoalIDs() {
 			// NOTE: Getting only goals of the plugins from the ready queue is useful only for scheduling action.
 			//       To accommodate other types of action (i.e. publishing data to beehive) we need to
 			//       evaluate all science rules no matter what plugins in the waiting queue.
 			for goalID, sg := range ns.GoalManager.ScienceGoals {
+				if !ns.GoalManager.IsGoalReady(goalID) {
+					sg.Logger().Debug("goal is not ready. images of the plugins are being pulled")
+					continue
+				}
+				evaluationStart := time.Now()
 				validRules, err := ns.Knowledgebase.EvaluateGoal(goalID)
+				ns.Metrics.ruleEvaluationDuration.Observe(time.Since(evaluationStart).Seconds())
 				if err != nil {
-					logger.Error.Printf("Failed to evaluate goal %q: %s", goalID, err.Error())
+					ns.Metrics.ruleEvaluationErrors.Inc()
+					logger.With(logger.FieldGoalID, goalID).Error("failed to evaluate goal", "error", err)
 				} else {
+					// pluginsToSchedule keeps the plugins whose schedule rule is valid
+					// in order to stop service plugins whose rule is no longer valid
+					pluginsToSchedule := map[string]bool{}
 					for _, r := range validRules {
-						logger.Debug.Printf("Science rule %q is valid", r)
+						sg.Logger().Debug("science rule is valid", "rule", r.Condition, "action", r.ActionType)
 						switch r.ActionType {
 						case datatype.ScienceRuleActionSchedule:
 							// TODO: We will need to find a way to pass parameters to the plugin
 							//       For example, schedule(plugin-a, duration=5m) <<
 							pluginName := r.ActionObject
+							pluginsToSchedule[pluginName] = true
 							if pr := ns.GoalManager.GetPluginRuntime(PluginIndex{
 								name:   pluginName,
 								jobID:  sg.JobID,
 								goalID: sg.ID,
 							}); pr == nil {
-								logger.Error.Printf("failed to promote plugin: plugin name %q for goal %q not registered", pluginName, goalID)
+								sg.Logger().Error("failed to promote plugin: plugin not registered", logger.FieldPlugin, pluginName)
 								// TODO: we may want to verify what exist and why this happens
 							} else if !pr.Status.Is(string(datatype.Inactive)) {
-								logger.Debug.Printf("plugin %q is already active. no need to activate it", pr.Plugin.Name)
+								pr.Plugin.Logger().Debug("plugin is already active. no need to activate it", "status", pr.Status.Current())
 							} else if err := pr.Queued(); err != nil {
-								logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Queued, err.Error())
+								pr.Plugin.Logger().Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Queued, err.Error())
 							} else {
 								pr.UpdateWithScienceRule(r)
 								// TODO: We disable the plugin controller until we actually use it.
@@ -141,7 +260,7 @@ func (ns *NodeScheduler) Run() {
 								ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
 								ns.readyQueue.Push(pr)
 								triggerScheduling = true
-								logger.Info.Printf("Plugin %s is queued by %s", pr.Plugin.Name, r.Condition)
+								pr.Plugin.Logger().Info("plugin is queued", "condition", r.Condition)
 							}
 						case datatype.ScienceRuleActionPublish:
 							eventName := r.ActionObject
@@ -170,11 +289,20 @@ func (ns *NodeScheduler) Run() {
 							go func() {
 								err := ns.ToScoreboard.Set(stateName, value)
 								if err != nil {
-									logger.Error.Printf("Failed to set %q: %s", stateName, err.Error())
+									logger.With("state", stateName).Error("failed to set state to scoreboard", "error", err)
 								}
 							}()
 						}
 					}
+					for _, pr := range ns.GoalManager.GetPluginRuntimesByGoalID(goalID) {
+						if !pr.Plugin.PluginSpec.IsService() || pluginsToSchedule[pr.Plugin.Name] {
+							continue
+						}
+						if ns.scheduledPlugins.IsExist(pr) {
+							ns.stopServicePlugin(pr, "schedule rule is no longer valid")
+							triggerScheduling = true
+						}
+					}
 				}
 			}
 			if triggerScheduling {
@@ -185,104 +313,283 @@ func (ns *NodeScheduler) Run() {
 			}
 		case event := <-ns.chanNeedScheduling:
 			e := event.(datatype.SchedulerEvent)
-			logger.Info.Printf("Reason for (re)scheduling %q", e.Type)
-			logger.Debug.Printf("Plugins in ready queue: %+v", ns.readyQueue.GetPluginNames())
+			if ns.IsDraining() {
+				logger.With("event", e.Type).Info("node is draining. plugins stay in the ready queue")
+				break
+			}
+			log := logger.With("event", e.Type)
+			log.Info("(re)scheduling plugins")
+			log.Debug("plugins in ready queue", "plugins", strings.Join(ns.readyQueue.GetPluginNames(), ","))
 			// Select the best task
 			pluginsToRun, err := ns.SchedulingPolicy.SelectBestPlugins(
 				&ns.readyQueue,
 				&ns.scheduledPlugins,
-				datatype.Resource{
-					CPU:       "999000m",
-					Memory:    "999999Gi",
-					GPUMemory: "999999Gi",
-				},
+				ns.getNodeResource(),
 			)
 			if err != nil {
-				logger.Error.Printf("Failed to get the best task to run %q", err.Error())
+				log.Error("failed to get the best task to run", "error", err)
 			} else {
 				for _, _pr := range pluginsToRun {
+					if err := ns.placePlugin(_pr); err != nil {
+						_pr.Plugin.Logger().Info("plugin stays in the ready queue", "reason", err)
+						continue
+					}
 					pluginEvent := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusSelected).
 						AddReason("Fit to resource").
 						AddPluginRuntimeMeta(*_pr).
 						AddPluginMeta(_pr.Plugin).
 						Build()
-					logger.Debug.Printf("%s: %q (%q)", pluginEvent.ToString(), pluginEvent.GetPluginName(), pluginEvent.GetReason())
+					_pr.Plugin.Logger().Debug("plugin is selected", "event", pluginEvent.Type, "reason", pluginEvent.GetReason())
 					ns.LogToBeehive.SendWaggleMessageOnNodeAsync(pluginEvent.ToWaggleMessage(), "all")
 					pr := ns.readyQueue.Pop(_pr)
 					ns.scheduledPlugins.Push(pr)
 					go func() {
+						log := pr.Plugin.Logger()
+						ns.prepareDataConfig(pr)
+						if err := ns.preparePluginCredential(pr); err != nil {
+							log.Error("failed to create a credential", "error", err)
+							ns.abortPluginLaunch(pr, err)
+							return
+						}
+						if pr.Plugin.PluginSpec.IsService() {
+							ns.launchServicePlugin(pr)
+							return
+						}
 						// TODO: when failed we need to put the pr back to inactive...???
-						logger.Debug.Printf("Running plugin %q...", pr.Plugin.Name)
+						log.Debug("running plugin...")
 						pod, err := ns.ResourceManager.CreatePodTemplate(pr)
 						if err != nil {
-							logger.Error.Printf("Failed to create Kubernetes Pod for %q: %q", pr.Plugin.Name, err.Error())
-							msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
-								AddPluginRuntimeMeta(*pr).
-								AddReason(err.Error()).
-								AddPluginMeta(pr.Plugin).
-								Build()
-							ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+							log.Error("failed to create Kubernetes Pod", "error", err)
+							ns.revokePluginCredential(pr)
+							ns.abortPluginLaunch(pr, err)
 							return
 						}
 						// we override the plugin name to distinguish the same plugin name from different jobs
 						if pr.Plugin.JobID != "" {
 							pod.SetName(fmt.Sprintf("%s-%s", pod.GetName(), pr.Plugin.JobID))
 						}
+						policyName, err := ns.applyNetworkPolicy(pr, pod.Name)
+						if err != nil {
+							log.Error("failed to create network policy", "error", err)
+							ns.revokePluginCredential(pr)
+							ns.abortPluginLaunch(pr, err)
+							return
+						}
 						err = ns.ResourceManager.CreatePod(pod)
 						// defer rm.TerminatePod(pod.Name)
 						if err != nil {
-							logger.Error.Printf("Failed to run %q: %q", pod.Name, err.Error())
-							msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
-								AddPluginRuntimeMeta(*pr).
-								AddReason(err.Error()).
-								AddPluginMeta(pr.Plugin).
-								Build()
-							ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+							log.Error("failed to run plugin", "pod", pod.Name, "error", err)
+							ns.revokePluginCredential(pr)
+							if policyName != "" {
+								if err := ns.ResourceManager.DeleteNetworkPolicy(policyName); err != nil {
+									log.Error("failed to delete network policy", "policy", policyName, "error", err)
+								}
+							}
+							ns.abortPluginLaunch(pr, err)
 							if err = ns.ResourceManager.TerminatePod(pod.Name); err != nil {
-								logger.Error.Printf("Failed to delete %s: %s", pod.Name, err.Error())
+								log.Error("failed to delete pod", "pod", pod.Name, "error", err)
 							} else {
-								logger.Info.Printf("%s is deleted as it failed to run", pod.Name)
+								log.Info("pod is deleted as it failed to run", "pod", pod.Name)
 							}
 							return
 						}
-						logger.Info.Printf("Plugin %q is created", pod.Name)
+						if policyName != "" {
+							if err := ns.ResourceManager.SetNetworkPolicyOwner(policyName, "Pod", pod.Name); err != nil {
+								log.Error("failed to set the owner of network policy", "policy", policyName, "pod", pod.Name, "error", err)
+							}
+						}
+						log.Info("plugin is created", "pod", pod.Name)
 						pr.Plugin.PluginSpec.Job = pod.Name
 					}()
 				}
 			}
 		case event := <-ns.chanFromResourceManager:
-			e := event.(KubernetesEvent)
-			logger.Debug.Printf("Event received from Resource Manager: %s %q", e.Type, e.Action)
-			switch e.Type {
-			case KubernetesEventTypePod:
-				ns.handleKubernetesPodEvent(e)
-			case KubernetesEventTypeEvent:
-				ns.handleKubernetesEventEvent(e)
-			case KubernetesEventTypeConfigMap:
-				ns.handleKubernetesConfigMapEvent(e)
-			default:
-				// We shouldn't receive unknown type event. If so, we need to implement it here
-				panic(fmt.Sprintf("Unknown event received from Resource Manager: %s", e.Type))
-			}
+			ns.handleResourceManagerEvent(event)
 		}
 	}
 }
 
+func (ns *NodeScheduler) handleResourceManagerEvent(event datatype.Event) {
+	e := event.(KubernetesEvent)
+	logger.With("type", e.Type, "action", e.Action).Debug("event received from resource manager")
+	ns.Metrics.kubernetesEvents.WithLabelValues(string(e.Type), string(e.Action)).Inc()
+	switch e.Type {
+	case KubernetesEventTypePod:
+		ns.handleKubernetesPodEvent(e)
+	case KubernetesEventTypeEvent:
+		ns.handleKubernetesEventEvent(e)
+	case KubernetesEventTypeConfigMap:
+		ns.handleKubernetesConfigMapEvent(e)
+	default:
+		// We shouldn't receive unknown type event. If so, we need to implement it here
+		panic(fmt.Sprintf("Unknown event received from Resource Manager: %s", e.Type))
+	}
+}
+
+// Drain stops scheduling plugins. Running plugins are not affected and
+// plugins triggered by science rules wait in the ready queue until Resume is called
+func (ns *NodeScheduler) Drain() {
+	if !ns.draining.Swap(true) {
+		logger.With("running", len(ns.getRunningPluginNames())).Info("node is draining. no plugins will be scheduled")
+	}
+}
+
+// Resume starts scheduling plugins again after Drain
+func (ns *NodeScheduler) Resume() {
+	if ns.draining.Swap(false) {
+		logger.With("running", len(ns.getRunningPluginNames())).Info("node resumes scheduling")
+		// the caller must not wait for the main loop. A full channel already triggers scheduling
+		select {
+		case ns.chanNeedScheduling <- datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusQueued).
+			AddReason("drain ended").
+			Build():
+		default:
+		}
+	}
+}
+
+// IsDraining returns true if the node does not schedule plugins
+func (ns *NodeScheduler) IsDraining() bool {
+	return ns.draining.Load()
+}
+
+// shutdown drains the node, waits for running plugins to finish up to the
+// shutdown timeout, and flushes messages cached for RabbitMQ
+func (ns *NodeScheduler) shutdown() {
+	start := time.Now()
+	timeout := time.Duration(ns.Config.ShutdownTimeout) * time.Second
+	logger.With("timeout", timeout).Info("shutting down node scheduler")
+	ns.Drain()
+	ns.imagePullLock.Lock()
+	for goalID, cancel := range ns.imagePullCancels {
+		logger.With(logger.FieldGoalID, goalID).Debug("stopping image pulls")
+		cancel()
+	}
+	ns.imagePullLock.Unlock()
+	ns.waitForRunningPlugins(timeout)
+	ns.ResourceManager.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+	defer cancel()
+	if err := ns.APIServer.Shutdown(ctx); err != nil {
+		logger.With("port", ns.APIServer.port).Error("failed to shut down API server", "error", err)
+	}
+	if ns.LogToBeehive != nil {
+		if err := ns.LogToBeehive.Flush(ctx); err != nil {
+			logger.With("url", ns.Config.RabbitmqURI).Error("failed to flush messages to RabbitMQ", "error", err)
+		}
+		if err := ns.LogToBeehive.Close(); err != nil {
+			logger.With("url", ns.Config.RabbitmqURI).Error("failed to close RabbitMQ connection", "error", err)
+		}
+	}
+	logger.With("elapsed", time.Since(start).Round(time.Second)).Info("node scheduler is shut down")
+}
+
+// waitForRunningPlugins handles events from Kubernetes until plugins finish or timeout.
+// Service plugins are not waited as they do not finish by themselves
+func (ns *NodeScheduler) waitForRunningPlugins(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	deadline := time.After(timeout)
+	for {
+		running := ns.getRunningPluginNames()
+		if len(running) == 0 {
+			return
+		}
+		logger.With("plugins", strings.Join(running, ",")).Info("waiting for plugins to finish")
+		select {
+		case event := <-ns.chanFromResourceManager:
+			ns.handleResourceManagerEvent(event)
+		case <-deadline:
+			logger.With("timeout", timeout, "plugins", strings.Join(running, ",")).Info("shutdown timeout reached. plugins are left running")
+			return
+		}
+	}
+}
+
+// getRunningPluginNames returns names of the scheduled plugins that are not services
+func (ns *NodeScheduler) getRunningPluginNames() (names []string) {
+	for _, pr := range ns.scheduledPlugins.GetPluginRuntimes() {
+		if !pr.Plugin.PluginSpec.IsService() {
+			names = append(names, pr.Plugin.Name)
+		}
+	}
+	return
+}
+
+// IsAlive returns an error if the main loop has not evaluated science rules for a while
+func (ns *NodeScheduler) IsAlive() error {
+	lastRuleCheck := time.Unix(ns.lastRuleCheck.Load(), 0)
+	if elapsed := time.Since(lastRuleCheck); elapsed > livenessTimeout {
+		return fmt.Errorf("main loop has not run for %s", elapsed.Round(time.Second))
+	}
+	return nil
+}
+
+// IsReady returns errors of the connections to Kubernetes and RabbitMQ keyed by their name.
+// The map is empty if the scheduler is ready
+func (ns *NodeScheduler) IsReady() map[string]error {
+	errs := make(map[string]error)
+	if ns.Config.Simulate {
+		return errs
+	}
+	if err := ns.ResourceManager.Ping(); err != nil {
+		errs["kubernetes"] = err
+	}
+	if ns.LogToBeehive != nil {
+		if err := ns.LogToBeehive.Ping(); err != nil {
+			errs["rabbitmq"] = err
+		}
+	}
+	return errs
+}
+
+// getNodeResource returns the resource of the node used by scheduling policies.
+// GPU memory of each GPU comes from the node manifest and is left empty if unknown.
+func (ns *NodeScheduler) getNodeResource() datatype.Resource {
+	r := datatype.Resource{
+		CPU:    "999000m",
+		Memory: "999999Gi",
+	}
+	if ns.NodeManifest != nil {
+		if gpuMemory := ns.NodeManifest.GetGPUMemoryInMega(); gpuMemory > 0 {
+			r.GPUMemory = fmt.Sprintf("%dMi", gpuMemory)
+		}
+		// plugins cannot use GPU memory across GPUs of computes
+		r.GPUDevices = make(map[string]string)
+		for compute, gpuMemory := range ns.NodeManifest.GetGPUMemoryPerCompute() {
+			r.GPUDevices[compute] = fmt.Sprintf("%dMi", gpuMemory)
+		}
+	}
+	return r
+}
+
 func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 	pod := e.Pod
-	logger.Debug.Printf("pod status: %s", string(pod.Status.Phase))
+	// Pods pulling plugin images are managed by ResourceManager.PullImage
+	if _, found := pod.Labels[PodLabelImagePull]; found {
+		return
+	}
+	// credential of the plugin must not outlive its Pod
+	if secretName, found := pod.Annotations[PodAnnotationCredentialSecret]; found && e.Action == KubernetesEventTypeDeleted {
+		if err := ns.ResourceManager.RevokePluginCredential(secretName); err != nil {
+			logger.With("pod", pod.Name).Error("failed to revoke credential", "secret", secretName, "error", err)
+		}
+	}
+	podLog := logger.With("pod", pod.Name)
+	podLog.Debug("pod status", "phase", pod.Status.Phase)
 	for _, i := range pod.Status.InitContainerStatuses {
-		logger.Debug.Printf("%s: (%s) %s", pod.Name, i.Name, &i.State)
+		podLog.Debug("init container status", "container", i.Name, "state", &i.State)
 	}
 	for _, c := range pod.Status.ContainerStatuses {
-		logger.Debug.Printf("%s: (%s) %s", pod.Name, c.Name, &c.State)
+		podLog.Debug("container status", "container", c.Name, "state", &c.State)
 	}
 
 	pluginName, pluginNameExist := pod.Labels[PodLabelPluginTask]
 	goalID, goalIDExist := pod.Labels[PodLabelGoalID]
 	jobID, jobIDExist := pod.Labels[PodLabelJobID]
 	if !pluginNameExist || !goalIDExist || !jobIDExist {
-		logger.Error.Printf("Pod %q labels do not have information for Plugin Runtime from Pod: %v", pod.Name, pod.Labels)
+		logger.With("pod", pod.Name).Error("pod labels do not have information for plugin runtime", "labels", pod.Labels)
 		return
 	}
 	pluginIndex := PluginIndex{
@@ -292,25 +599,42 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 	}
 	pr := ns.GoalManager.GetPluginRuntime(pluginIndex)
 	if pr == nil {
-		logger.Error.Printf("Failed to find Plugin Runtime using index %v", pluginIndex)
+		// plugins kept over an update of their goal run in Pods labeled with the previous goal ID
+		pr = ns.GoalManager.GetPluginRuntimeByNameAndJobID(pluginName, jobID)
+	}
+	if pr == nil {
+		logger.With(logger.FieldJobID, jobID, logger.FieldGoalID, goalID, logger.FieldPlugin, pluginName).Error("failed to find plugin runtime", "pod", pod.Name)
 		return
 	}
-	logger.Debug.Printf("current Plugin %q state %s", pod.Name, pr.Status.Current())
+	log := pr.Plugin.Logger().With("pod", pod.Name)
+	log.Debugf("current plugin state %s", pr.Status.Current())
+	since := time.Now()
+	defer func() {
+		ns.Metrics.observePluginRuntime(pr, since)
+		if pr.FinishedAt.After(since) {
+			ns.ExecutionHistory.Add(ns.newExecutionRecord(pr, pod, e.Action))
+		}
+	}()
 
 	// we may receive Pod events from Kubernetes on already existing ones
 	// TODO: we need to not sending messages to cloud about those already exist
 	//       by skipping the following steps
 	if !ns.scheduledPlugins.IsExist(pr) {
 		// probably unmanaged one, we should ignore it
-		logger.Info.Printf("pod %q has no associated Plugin in the queue. Ignoring the event", pod.Name)
+		logger.With("pod", pod.Name).Info("pod has no associated plugin in the queue. ignoring the event")
+		return
+	}
+
+	if pr.Plugin.PluginSpec.IsService() {
+		ns.handleServicePluginPodEvent(e, pr)
 		return
 	}
 
 	switch e.Action {
 	case KubernetesEventTypeAdd:
-		logger.Info.Printf("Plugin %q is scheduled", pod.Name)
+		log.Info("plugin is scheduled")
 		if err := pr.Scheduled(); err != nil {
-			logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Scheduled, err.Error())
+			log.Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Scheduled, err.Error())
 		} else {
 			pr.SetPodUID(string(pod.UID))
 			msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusScheduled).
@@ -334,12 +658,12 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 			// we expect init container running and completion
 			if err := pr.Initializing(); err != nil {
 				if errors.Is(err, fsm.NoTransitionError{}) {
-					logger.Debug.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Initializing, err.Error())
+					log.Debugf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Initializing, err.Error())
 				} else {
-					logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Initializing, err.Error())
+					log.Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Initializing, err.Error())
 				}
 			} else {
-				logger.Info.Printf("plugin %q is being initialized", pod.Name)
+				log.Info("plugin is being initialized")
 				msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusInitializing).
 					AddPluginRuntimeMeta(*pr).
 					AddPodMeta(pod).
@@ -353,17 +677,17 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 			if pluginContainerStatus, err := ns.ResourceManager.GetContainerStatusFromPod(pod, pluginName); err != nil {
 				// Failed to retrieve the status
 				e := fmt.Sprintf("Failed to get container status: %s", err.Error())
-				logger.Error.Println(e)
+				log.Error("failed to get container status", "error", err)
 				if err := pr.Failed(); err != nil {
 					if errors.Is(err, fsm.NoTransitionError{}) {
-						logger.Debug.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
+						log.Debugf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Failed, err.Error())
 					} else {
-						logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
+						log.Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Failed, err.Error())
 					}
 				} else {
 					messageBuilder, err := ns.ResourceManager.AnalyzeFailureOfPod(pod)
 					if err != nil {
-						logger.Error.Println(err.Error())
+						log.Error("failed to analyze failure of pod", "error", err)
 					}
 					message := messageBuilder.AddPluginRuntimeMeta(*pr).
 						AddPodMeta(pod).
@@ -395,12 +719,12 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 				// 	defer ns.ResourceManager.TerminatePod(pod.Name)
 				// }
 			} else if pluginContainerStatus.State.Running != nil {
-				logger.Info.Printf("Plugin %q starts to run", pod.Name)
+				log.Info("plugin starts to run")
 				if err := pr.Running(); err != nil {
 					if errors.Is(err, fsm.NoTransitionError{}) {
-						logger.Warn.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Running, err.Error())
+						log.Warnf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Running, err.Error())
 					} else {
-						logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Running, err.Error())
+						log.Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Running, err.Error())
 					}
 				} else {
 					msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusRunning).
@@ -417,12 +741,12 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 			//       trigger message multiple times.
 			if err := pr.Completed(); err != nil {
 				if errors.Is(err, fsm.NoTransitionError{}) {
-					logger.Warn.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Completed, err.Error())
+					log.Warnf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Completed, err.Error())
 				} else {
-					logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Completed, err.Error())
+					log.Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Completed, err.Error())
 				}
 			} else {
-				logger.Info.Printf("Plugin %q succeeded", pod.Name)
+				log.Info("plugin succeeded")
 				// 	// publish plugin completion message locally so that
 				// 	// rule checker knows when the last execution was
 				// 	// TODO: The message takes time to get into DB so the rule checker may not notice
@@ -453,15 +777,15 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 			//       Thus, we ignore duplicated events.
 			if err := pr.Failed(); err != nil {
 				if errors.Is(err, fsm.NoTransitionError{}) {
-					logger.Warn.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
+					log.Warnf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Failed, err.Error())
 				} else {
-					logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
+					log.Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Failed, err.Error())
 				}
 			} else {
-				logger.Info.Printf("Plugin %q failed", pod.Name)
+				log.Info("plugin failed")
 				messageBuilder, err := ns.ResourceManager.AnalyzeFailureOfPod(pod)
 				if err != nil {
-					logger.Error.Println(err.Error())
+					log.Error("failed to analyze failure of pod", "error", err)
 				}
 				message := messageBuilder.AddPluginRuntimeMeta(*pr).
 					AddPluginMeta(pr.Plugin).
@@ -474,10 +798,10 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 		default:
 			// unknown Pod phase; we should notify us in case we
 			// care this event
-			logger.Error.Printf("plugin %q Pod is in unknown state: %s", pod.Name, pod.Status.Phase)
+			log.Error("plugin pod is in unknown state", "phase", pod.Status.Phase)
 		}
 	case KubernetesEventTypeDeleted:
-		logger.Info.Printf("Plugin %q removed", pod.Name)
+		log.Info("plugin removed")
 		var privateMessage datatype.SchedulerEvent
 		switch pr.Status.Current() {
 		case string(datatype.Completed):
@@ -497,9 +821,9 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 			// We mark this as a failure.
 			if err := pr.Failed(); err != nil {
 				if errors.Is(err, fsm.NoTransitionError{}) {
-					logger.Warn.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
+					log.Warnf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Failed, err.Error())
 				} else {
-					logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Failed, err.Error())
+					log.Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Failed, err.Error())
 				}
 			} else {
 				privateMessage = datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
@@ -519,9 +843,9 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 		ns.scheduledPlugins.Pop(pr)
 		if err := pr.Inactive(); err != nil {
 			if errors.Is(err, fsm.NoTransitionError{}) {
-				logger.Warn.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Inactive, err.Error())
+				log.Warnf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Inactive, err.Error())
 			} else {
-				logger.Error.Printf("plugin %q failed to transition from %s to %s: %s", pr.Plugin.Name, pr.Status.Current(), datatype.Inactive, err.Error())
+				log.Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Inactive, err.Error())
 			}
 		} else {
 			ns.chanNeedScheduling <- privateMessage
@@ -529,6 +853,279 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 	}
 }
 
+// handleServicePluginPodEvent processes Pod events of a plugin running in service mode.
+// The Deployment of the plugin restarts the Pod whenever it crashes. Instead of completing
+// or failing the plugin, we report its health transitions.
+func (ns *NodeScheduler) handleServicePluginPodEvent(e KubernetesEvent, pr *datatype.PluginRuntime) {
+	pod := e.Pod
+	log := pr.Plugin.Logger().With("pod", pod.Name)
+	switch e.Action {
+	case KubernetesEventTypeAdd:
+		pr.SetPodUID(string(pod.UID))
+		if err := pr.Scheduled(); err != nil {
+			// a new Pod replacing the crashed one
+			log.Debugf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Scheduled, err.Error())
+		} else {
+			log.Info("service plugin is scheduled")
+			msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusScheduled).
+				AddPluginRuntimeMeta(*pr).
+				AddPodMeta(pod).
+				AddPluginMeta(pr.Plugin).
+				Build()
+			ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+		}
+	case KubernetesEventTypeModified:
+		if pod.DeletionTimestamp != nil {
+			// the Pod is being replaced
+			return
+		}
+		pr.SetPodUID(string(pod.UID))
+		switch pod.Status.Phase {
+		case v1.PodPending:
+			if pr.Status.Is(string(datatype.Scheduled)) {
+				if err := pr.Initializing(); err != nil {
+					log.Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Initializing, err.Error())
+				} else {
+					log.Info("service plugin is being initialized")
+					msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusInitializing).
+						AddPluginRuntimeMeta(*pr).
+						AddPodMeta(pod).
+						AddPluginMeta(pr.Plugin).
+						Build()
+					ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+				}
+			} else {
+				ns.updateServicePluginHealth(pr, pod, false, "Pod is being restarted")
+			}
+		case v1.PodRunning:
+			pluginContainerStatus, err := ns.ResourceManager.GetContainerStatusFromPod(pod, pr.Plugin.Name)
+			if err != nil {
+				log.Error("failed to get container status", "error", err)
+				return
+			}
+			if pluginContainerStatus.State.Running != nil {
+				// the Pod may skip the Pending phase from our view
+				if pr.Status.Is(string(datatype.Scheduled)) {
+					if err := pr.Initializing(); err != nil {
+						log.Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Initializing, err.Error())
+					}
+				}
+				if err := pr.Running(); err != nil {
+					ns.updateServicePluginHealth(pr, pod, true, "plugin is running")
+				} else {
+					log.Info("service plugin starts to run")
+					pr.Healthy = true
+					msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusRunning).
+						AddPluginRuntimeMeta(*pr).
+						AddPodMeta(pod).
+						AddPluginMeta(pr.Plugin).
+						Build()
+					ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+				}
+			} else if w := pluginContainerStatus.State.Waiting; w != nil {
+				ns.updateServicePluginHealth(pr, pod, false, w.Reason)
+			} else if t := pluginContainerStatus.State.Terminated; t != nil {
+				ns.updateServicePluginHealth(pr, pod, false, fmt.Sprintf("plugin exited with return code %d", t.ExitCode))
+			}
+		default:
+			// Pods under a Deployment do not normally end.
+			// Eviction by the node is one of the reasons
+			ns.updateServicePluginHealth(pr, pod, false, fmt.Sprintf("Pod is in %s phase: %s", pod.Status.Phase, pod.Status.Reason))
+		}
+	case KubernetesEventTypeDeleted:
+		// The Deployment creates a new Pod for the plugin
+		pr.Plugin.Logger().Info("pod of service plugin removed. waiting for a new pod", "pod", pod.Name)
+		ns.updateServicePluginHealth(pr, pod, false, "Pod deleted from external")
+	}
+}
+
+// updateServicePluginHealth sends an event when the health of the service plugin changes
+func (ns *NodeScheduler) updateServicePluginHealth(pr *datatype.PluginRuntime, pod *v1.Pod, healthy bool, reason string) {
+	if pr.Healthy == healthy {
+		return
+	}
+	pr.Healthy = healthy
+	eventType := datatype.EventPluginStatusUnhealthy
+	if healthy {
+		eventType = datatype.EventPluginStatusHealthy
+	}
+	pr.Plugin.Logger().With("pod", pod.Name).Info("service plugin health changed", "event", eventType, "reason", reason)
+	messageBuilder := datatype.NewSchedulerEventBuilder(eventType).
+		AddPluginRuntimeMeta(*pr).
+		AddPodMeta(pod).
+		AddPluginMeta(pr.Plugin).
+		AddReason(reason)
+	if pluginContainerStatus, err := ns.ResourceManager.GetContainerStatusFromPod(pod, pr.Plugin.Name); err == nil {
+		messageBuilder = messageBuilder.AddEntry("restart_count", pluginContainerStatus.RestartCount)
+		if t := pluginContainerStatus.LastTerminationState.Terminated; t != nil {
+			messageBuilder = messageBuilder.AddEntry("return_code", t.ExitCode)
+		}
+	}
+	message := messageBuilder.Build()
+	ns.LogToBeehive.SendWaggleMessageOnNodeAsync(message.ToWaggleMessage(), "all")
+}
+
+// prepareDataConfig creates a data config for the plugin that only contains data shim entries
+// of the sensors the plugin requires. The entries are taken from the data config of the node.
+// The plugin uses the data config of the node if it requires no sensor or no entry matches.
+func (ns *NodeScheduler) prepareDataConfig(pr *datatype.PluginRuntime) {
+	pr.DataConfigMap = ""
+	if len(pr.Plugin.PluginSpec.Sensors) == 0 {
+		return
+	}
+	datashims, err := ns.ResourceManager.GetDataShims()
+	if err != nil {
+		pr.Plugin.Logger().Error("failed to get data shims of the node. plugin uses the data config of the node", "error", err)
+		return
+	}
+	sensorNames := map[string]bool{}
+	for _, sensor := range pr.Plugin.PluginSpec.Sensors {
+		sensorNames[sensor] = true
+		if ns.NodeManifest == nil {
+			continue
+		}
+		for _, s := range ns.NodeManifest.FindSensors(sensor) {
+			// the plugin only needs the sensors accessible from the compute it is placed on
+			if pr.Compute == "" || s.IsAttachedTo(pr.Compute) {
+				sensorNames[s.Name] = true
+			}
+		}
+	}
+	var matched []*datatype.DataShim
+	for _, d := range datashims {
+		if sensorNames[d.Name] || sensorNames[d.Match.ID] {
+			matched = append(matched, d)
+		}
+	}
+	if len(matched) == 0 {
+		pr.Plugin.Logger().Info("no data shim found for sensors of plugin. the plugin uses the data config of the node", "sensors", strings.Join(pr.Plugin.PluginSpec.Sensors, ","))
+		return
+	}
+	configName := dataConfigMapNameForPlugin(&pr.Plugin)
+	if err := ns.ResourceManager.CreateDataConfigMap(configName, matched); err != nil {
+		pr.Plugin.Logger().Error("failed to create data config. plugin uses the data config of the node", "configmap", configName, "error", err)
+		return
+	}
+	pr.Plugin.Logger().Debug("data config is created", "configmap", configName, "datashims", len(matched))
+	pr.DataConfigMap = configName
+}
+
+// preparePluginCredential registers a RabbitMQ credential for the plugin and keeps it in a Secret
+// only for this run of the plugin. The plugin Pod refers to the Secret. The plugin uses the shared
+// plugin credential if RabbitMQ management is not configured.
+func (ns *NodeScheduler) preparePluginCredential(pr *datatype.PluginRuntime) error {
+	pr.CredentialSecret = ""
+	if ns.ResourceManager.RMQManagement == nil {
+		return nil
+	}
+	credential := ns.ResourceManager.CreatePluginCredential(pr)
+	if err := ns.ResourceManager.RMQManagement.RegisterPluginCredential(credential); err != nil {
+		return err
+	}
+	secretName, err := ns.ResourceManager.CreatePluginCredentialSecret(pr, credential)
+	if err != nil {
+		if err := ns.ResourceManager.RMQManagement.RevokePluginCredential(credential.Username); err != nil {
+			pr.Plugin.Logger().Error("failed to revoke credential", "username", credential.Username, "error", err)
+		}
+		return err
+	}
+	pr.CredentialSecret = secretName
+	return nil
+}
+
+// revokePluginCredential revokes the credential of the plugin if it has one
+func (ns *NodeScheduler) revokePluginCredential(pr *datatype.PluginRuntime) {
+	if pr.CredentialSecret == "" {
+		return
+	}
+	if err := ns.ResourceManager.RevokePluginCredential(pr.CredentialSecret); err != nil {
+		pr.Plugin.Logger().Error("failed to revoke credential", "secret", pr.CredentialSecret, "error", err)
+	}
+	pr.CredentialSecret = ""
+}
+
+// applyNetworkPolicy creates the NetworkPolicy of the plugin before its Kubernetes object is created
+// so that the plugin does not run without the policy. The policy is owned by the object later
+// to be deleted together. It returns the name of the policy, or empty if the plugin has no policy.
+func (ns *NodeScheduler) applyNetworkPolicy(pr *datatype.PluginRuntime, objectName string) (string, error) {
+	policy, err := ns.ResourceManager.CreateNetworkPolicyTemplate(pr, objectName)
+	if err != nil || policy == nil {
+		return "", err
+	}
+	if err := ns.ResourceManager.UpdateNetworkPolicy(policy); err != nil {
+		return "", err
+	}
+	return policy.Name, nil
+}
+
+// abortPluginLaunch reports the plugin failed to launch and puts the plugin back to inactive
+// so that the science rule can bring it up again
+func (ns *NodeScheduler) abortPluginLaunch(pr *datatype.PluginRuntime, reason error) {
+	msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
+		AddPluginRuntimeMeta(*pr).
+		AddReason(reason.Error()).
+		AddPluginMeta(pr.Plugin).
+		Build()
+	ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+	ns.scheduledPlugins.Pop(pr)
+	if err := pr.Inactive(); err != nil {
+		pr.Plugin.Logger().Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Inactive, err.Error())
+	}
+}
+
+// launchServicePlugin creates a Kubernetes Deployment that keeps the plugin running
+func (ns *NodeScheduler) launchServicePlugin(pr *datatype.PluginRuntime) {
+	log := pr.Plugin.Logger()
+	log.Debug("running service plugin...")
+	policyName := ""
+	deployment, err := ns.ResourceManager.CreateServiceDeploymentTemplate(pr)
+	if err == nil {
+		policyName, err = ns.applyNetworkPolicy(pr, deployment.Name)
+	}
+	if err == nil {
+		err = ns.ResourceManager.UpdateDeployment(deployment, true)
+	}
+	if err != nil {
+		log.Error("failed to run service plugin", "error", err)
+		ns.revokePluginCredential(pr)
+		if policyName != "" {
+			if err := ns.ResourceManager.DeleteNetworkPolicy(policyName); err != nil {
+				log.Error("failed to delete network policy", "policy", policyName, "error", err)
+			}
+		}
+		ns.abortPluginLaunch(pr, err)
+		return
+	}
+	if policyName != "" {
+		if err := ns.ResourceManager.SetNetworkPolicyOwner(policyName, "Deployment", deployment.Name); err != nil {
+			log.Error("failed to set the owner of network policy", "policy", policyName, "deployment", deployment.Name, "error", err)
+		}
+	}
+	log.Info("service plugin is created", "deployment", deployment.Name)
+	pr.Plugin.PluginSpec.Job = deployment.Name
+}
+
+// stopServicePlugin removes the Deployment of the service plugin and puts the plugin back to inactive.
+// The plugin is removed from the scheduled plugins first so that events of its Pods being deleted are ignored.
+func (ns *NodeScheduler) stopServicePlugin(pr *datatype.PluginRuntime, reason string) {
+	ns.scheduledPlugins.Pop(pr)
+	if err := ns.ResourceManager.TerminateDeployment(kubernetesObjectNameForPlugin(&pr.Plugin)); err != nil {
+		pr.Plugin.Logger().Error("failed to delete the deployment of service plugin", "error", err)
+	}
+	ns.revokePluginCredential(pr)
+	msg := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusStopped).
+		AddPluginRuntimeMeta(*pr).
+		AddPluginMeta(pr.Plugin).
+		AddReason(reason).
+		Build()
+	ns.LogToBeehive.SendWaggleMessageOnNodeAsync(msg.ToWaggleMessage(), "all")
+	pr.Plugin.Logger().Info("service plugin is stopped", "reason", reason)
+	pr.Healthy = false
+	if err := pr.Inactive(); err != nil {
+		pr.Plugin.Logger().Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Inactive, err.Error())
+	}
+}
+
 // handleKubernetesEventEvent processes Event messages sent from Kubernetes.
 // When starting, Kubernetes Informer sends all events from any existing resources.
 //
@@ -538,8 +1135,7 @@ func (ns *NodeScheduler) handleKubernetesPodEvent(e KubernetesEvent) {
 // and resume managing them, instead of killing all of them due to a scheduler restart.
 func (ns *NodeScheduler) handleKubernetesEventEvent(e KubernetesEvent) {
 	event := e.Event
-	logger.Debug.Printf("event %s: %s, %s", event.Name, event.Reason, event.Message)
-	logger.Debug.Printf("%v", event)
+	logger.With("event", event.Name).Debug("Kubernetes event received", "reason", event.Reason, "message", event.Message, "object", event.InvolvedObject.Name)
 
 	// we assume Events are always Add type
 	// switch e.Action {
@@ -554,10 +1150,17 @@ func (ns *NodeScheduler) handleKubernetesEventEvent(e KubernetesEvent) {
 			// the Pod. Users should treat this message as a failure of their plugin.
 			switch event.Reason {
 			case "FailedPostStartHook", "Failed", "FailedMount", "FailedCreatePodSandBox":
+				// Kubernetes keeps retrying Pods of service plugins.
+				// We only report the event below
+				if pr.Plugin.PluginSpec.IsService() {
+					break
+				}
 				// NOTE: There can be multiple Reasons of a failure. We try to capture them
 				//       as much as possible.
-				logger.Info.Printf("Plugin %q failed due to %s", obj.Name, event.Reason)
-				pr.Failed()
+				pr.Plugin.Logger().Info("plugin failed", "pod", obj.Name, "reason", event.Reason)
+				if err := pr.Failed(); err != nil {
+					pr.Plugin.Logger().Errorf("plugin failed to transition from %s to %s: %s", pr.Status.Current(), datatype.Failed, err.Error())
+				}
 				message := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
 					AddPluginRuntimeMeta(*pr).
 					AddPluginMeta(pr.Plugin).
@@ -589,19 +1192,17 @@ func (ns *NodeScheduler) handleKubernetesConfigMapEvent(e KubernetesEvent) {
 	}
 	switch e.Action {
 	case KubernetesEventTypeAdd, KubernetesEventTypeModified:
-		logger.Debug.Printf("A bulk goal is received: %v", cm.Data)
+		logger.With("configmap", cm.Name).Debug("a bulk goal is received", "goals", cm.Data["goals"])
 		if data, found := cm.Data["goals"]; found {
 			var goals []datatype.ScienceGoal
 			err := json.Unmarshal([]byte(data), &goals)
 			if err != nil {
-				logger.Error.Printf("Failed to load bulk goals %s: %q", data, err.Error())
+				logger.With("configmap", cm.Name).Error("failed to load bulk goals", "goals", data, "error", err)
 			} else {
 				ns.handleBulkGoals(goals)
 			}
 		} else {
-			logger.Error.Printf("Kubernetes ConfigMap %q for goals does not have \"goals\" data: %s",
-				cm.Name,
-				cm.Data)
+			logger.With("configmap", cm.Name).Error("configmap for goals does not have goals data", "data", cm.Data)
 		}
 	default:
 	}
@@ -610,12 +1211,13 @@ func (ns *NodeScheduler) handleKubernetesConfigMapEvent(e KubernetesEvent) {
 func (ns *NodeScheduler) registerGoal(goal *datatype.ScienceGoal) {
 	ns.GoalManager.AddGoal(goal)
 	if mySubGoal := goal.GetMySubGoal(ns.NodeID); mySubGoal == nil {
-		logger.Error.Printf("Failed to find my sub goal from science goal %q. Failed to register the goal.", goal.ID)
+		goal.Logger().Error("failed to find my sub goal from science goal. failed to register the goal")
 	} else {
 		err := ns.Knowledgebase.AddRulesFromScienceGoal(goal)
 		if err != nil {
-			logger.Error.Printf("Failed to add science rules of goal %q: %s", goal.ID, err.Error())
+			goal.Logger().Error("failed to add science rules of goal", "error", err)
 		}
+		var plugins []*datatype.Plugin
 		for _, p := range mySubGoal.GetPlugins() {
 			// copy plugin object
 			_p := *p
@@ -625,59 +1227,238 @@ func (ns *NodeScheduler) registerGoal(goal *datatype.ScienceGoal) {
 
 			pr := datatype.NewPluginRuntime(_p)
 			ns.GoalManager.AddPluginRuntime(pr)
-			logger.Debug.Printf("plugin %s is added to the watiting queue", p.Name)
+			plugins = append(plugins, &pr.Plugin)
+			pr.Plugin.Logger().Debug("plugin is added to the waiting queue")
+		}
+		ns.prepareGoal(goal, plugins)
+	}
+}
+
+// prepareGoal makes the goal ready once images of given plugins are present on the node
+func (ns *NodeScheduler) prepareGoal(goal *datatype.ScienceGoal, plugins []*datatype.Plugin) {
+	if ns.Config.Simulate {
+		ns.GoalManager.SetGoalReady(goal.ID, true)
+	} else {
+		ctx, cancel := context.WithCancel(context.Background())
+		ns.imagePullLock.Lock()
+		ns.imagePullCancels[goal.ID] = cancel
+		ns.imagePullLock.Unlock()
+		go ns.pullImagesForGoal(ctx, *goal, plugins)
+	}
+}
+
+// cancelImagePulls stops pulling images of the goal
+func (ns *NodeScheduler) cancelImagePulls(goalID string) {
+	ns.imagePullLock.Lock()
+	defer ns.imagePullLock.Unlock()
+	if cancel, found := ns.imagePullCancels[goalID]; found {
+		cancel()
+		delete(ns.imagePullCancels, goalID)
+	}
+}
+
+// updateGoal applies changes of the goal to the existing goal of the same job.
+// Plugins that are added, removed, or changed are created or torn down while
+// unchanged plugins keep their state, e.g. running, and move to the new goal
+func (ns *NodeScheduler) updateGoal(existingGoal *datatype.ScienceGoal, goal *datatype.ScienceGoal) {
+	existingSubGoal := existingGoal.GetMySubGoal(ns.NodeID)
+	mySubGoal := goal.GetMySubGoal(ns.NodeID)
+	if existingSubGoal == nil || mySubGoal == nil {
+		ns.cleanUpGoal(existingGoal)
+		ns.registerGoal(goal)
+		return
+	}
+	// images of the kept plugins are already present if the existing goal was ready
+	wasReady := ns.GoalManager.IsGoalReady(existingGoal.ID)
+	ns.cancelImagePulls(existingGoal.ID)
+	if err := ns.Knowledgebase.UpdateRulesFromScienceGoal(existingGoal.ID, goal); err != nil {
+		goal.Logger().Error("failed to update science rules of goal", "error", err)
+	}
+	for _, p := range existingSubGoal.GetPlugins() {
+		index := PluginIndex{
+			name:   p.Name,
+			goalID: existingGoal.ID,
+			jobID:  existingGoal.JobID,
+		}
+		pr := ns.GoalManager.GetPluginRuntime(index)
+		if pr == nil {
+			existingGoal.Logger().Error("failed to update plugin: plugin not registered", logger.FieldPlugin, p.Name)
+			continue
+		}
+		if newPlugin := mySubGoal.GetPlugin(p.Name); newPlugin != nil && !p.IsUpdated(newPlugin) {
+			ns.GoalManager.DropPluginRuntime(index)
+			pr.Plugin.GoalID = goal.ID
+			ns.GoalManager.AddPluginRuntime(pr)
+			pr.Plugin.Logger().Info("plugin has not changed and is kept for the updated goal")
+			continue
+		}
+		ns.cleanUpPlugin(pr, "Cleaning up the plugin due to update of the goal")
+	}
+	ns.GoalManager.DropGoal(existingGoal.ID)
+	ns.GoalManager.AddGoal(goal)
+	var plugins []*datatype.Plugin
+	for _, p := range mySubGoal.GetPlugins() {
+		if pr := ns.GoalManager.GetPluginRuntime(PluginIndex{
+			name:   p.Name,
+			goalID: goal.ID,
+			jobID:  goal.JobID,
+		}); pr != nil {
+			if !wasReady {
+				plugins = append(plugins, &pr.Plugin)
+			}
+			continue
+		}
+		// copy plugin object
+		_p := *p
+		// make sure plugins has its job and goal IDs
+		_p.GoalID = goal.ID
+		_p.JobID = goal.JobID
+
+		pr := datatype.NewPluginRuntime(_p)
+		ns.GoalManager.AddPluginRuntime(pr)
+		plugins = append(plugins, &pr.Plugin)
+		pr.Plugin.Logger().Info("plugin is added to the updated goal")
+	}
+	ns.prepareGoal(goal, plugins)
+}
+
+// pullImagesForGoal pulls images of the plugins in the goal before the plugins are scheduled.
+// A multi-GB image pulled over a slow network would otherwise keep the plugin initializing
+// for minutes. The goal becomes ready once all images are present on the node. Failed pulls
+// are retried until the goal is removed.
+func (ns *NodeScheduler) pullImagesForGoal(ctx context.Context, goal datatype.ScienceGoal, plugins []*datatype.Plugin) {
+	// the image is pulled onto every compute the plugin may be placed on
+	type imagePull struct {
+		plugin   *datatype.Plugin
+		hostname string
+	}
+	var pulls []imagePull
+	for _, p := range plugins {
+		hostnames := ns.getComputeHostnamesForPlugin(p)
+		if len(hostnames) == 0 {
+			pulls = append(pulls, imagePull{plugin: p})
+		}
+		for _, hostname := range hostnames {
+			pulls = append(pulls, imagePull{plugin: p, hostname: hostname})
+		}
+	}
+	// the same image may be used by multiple plugins on the same Kubernetes node
+	pulled := map[string]bool{}
+	for i, pull := range pulls {
+		p := pull.plugin
+		key := p.PluginSpec.Image + pull.hostname + fmt.Sprint(nodeSelectorForConfig(p.PluginSpec))
+		if pulled[key] {
+			continue
+		}
+		progress := fmt.Sprintf("%d/%d", i+1, len(pulls))
+		for {
+			p.Logger().Info("pulling image", "image", p.PluginSpec.Image, "progress", progress)
+			e := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusImagePulling).
+				AddGoal(&goal).
+				AddPluginMeta(*p).
+				AddEntry("progress", progress).
+				AddEntry("hostname", pull.hostname).
+				Build()
+			ns.LogToBeehive.SendWaggleMessageOnNodeAsync(e.ToWaggleMessage(), "all")
+			pullCtx, cancel := context.WithTimeout(ctx, imagePullTimeout)
+			err := ns.ResourceManager.PullImage(pullCtx, p, pull.hostname)
+			cancel()
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				goal.Logger().Info("stopped pulling images as the goal is removed")
+				return
+			}
+			goal.Logger().Error("failed to pull image", logger.FieldPlugin, p.Name, "image", p.PluginSpec.Image, "error", err)
+			e = datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusImagePullFailed).
+				AddGoal(&goal).
+				AddPluginMeta(*p).
+				AddReason(err.Error()).
+				AddEntry("progress", progress).
+				Build()
+			ns.LogToBeehive.SendWaggleMessageOnNodeAsync(e.ToWaggleMessage(), "all")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(imagePullRetryInterval):
+			}
 		}
+		pulled[key] = true
+		e := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusImagePulled).
+			AddGoal(&goal).
+			AddPluginMeta(*p).
+			AddEntry("progress", progress).
+			Build()
+		ns.LogToBeehive.SendWaggleMessageOnNodeAsync(e.ToWaggleMessage(), "all")
+	}
+	if ctx.Err() != nil {
+		return
 	}
+	ns.GoalManager.SetGoalReady(goal.ID, true)
+	goal.Logger().Info("goal is ready as all plugin images are present")
+	e := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusReady).
+		AddGoal(&goal).
+		Build()
+	ns.LogToBeehive.SendWaggleMessageOnNodeAsync(e.ToWaggleMessage(), "all")
 }
 
 func (ns *NodeScheduler) cleanUpGoal(goal *datatype.ScienceGoal) {
-	ns.Knowledgebase.DropRules(goal.Name)
+	ns.cancelImagePulls(goal.ID)
+	ns.Knowledgebase.DropRules(goal.ID)
 	if mySubGoal := goal.GetMySubGoal(ns.NodeID); mySubGoal != nil {
-		for _, p := range goal.GetMySubGoal(ns.NodeID).GetPlugins() {
+		for _, p := range mySubGoal.GetPlugins() {
 			if pr := ns.GoalManager.GetPluginRuntime(PluginIndex{
 				name:   p.Name,
 				goalID: goal.ID,
 				jobID:  goal.JobID,
 			}); pr == nil {
-				logger.Error.Printf("failed to remove plugin: plugin name %q for goal %q not registered", p.Name, goal.ID)
+				goal.Logger().Error("failed to remove plugin: plugin not registered", logger.FieldPlugin, p.Name)
 				// TODO: we may want to verify what exist and why this happens
 			} else {
-				if a := ns.readyQueue.Pop(pr); a != nil {
-					logger.Debug.Printf("plugin %s is removed from the ready queue", p.Name)
-				}
-				if a := ns.scheduledPlugins.Pop(pr); a != nil {
-					// Pods have their job ID in the name
-					var podName string
-					if a.Plugin.JobID != "" {
-						podName = fmt.Sprintf("%s-%s", a.Plugin.Name, a.Plugin.JobID)
-					} else {
-						podName = a.Plugin.Name
-					}
-					if pod, err := ns.ResourceManager.GetPod(podName); err != nil {
-						logger.Error.Printf("Failed to get pod of the plugin %q", a.Plugin.Name)
-					} else {
-						e := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
-							AddPluginRuntimeMeta(*pr).
-							AddPluginMeta(a.Plugin).
-							AddPodMeta(pod).
-							AddReason("Cleaning up the plugin due to deletion of the goal").
-							Build()
-						ns.LogToBeehive.SendWaggleMessageOnNodeAsync(e.ToWaggleMessage(), "all")
-						ns.ResourceManager.TerminatePod(podName)
-						logger.Info.Printf("plugin %s is removed from running", p.Name)
-					}
-					ns.GoalManager.DropPluginRuntime(PluginIndex{
-						name:   p.Name,
-						goalID: goal.ID,
-						jobID:  goal.JobID,
-					})
-				}
+				ns.cleanUpPlugin(pr, "Cleaning up the plugin due to deletion of the goal")
 			}
 		}
 	}
 	ns.GoalManager.DropGoal(goal.ID)
 }
 
+// cleanUpPlugin removes the plugin from the queues and terminates it if running
+func (ns *NodeScheduler) cleanUpPlugin(pr *datatype.PluginRuntime, reason string) {
+	if a := ns.readyQueue.Pop(pr); a != nil {
+		pr.Plugin.Logger().Debug("plugin is removed from the ready queue", "reason", reason)
+	}
+	if pr.DataConfigMap != "" {
+		if err := ns.ResourceManager.DeleteConfigMap(pr.DataConfigMap, ""); err != nil {
+			pr.Plugin.Logger().Error("failed to delete data config", "configmap", pr.DataConfigMap, "error", err)
+		}
+	}
+	if pr.Plugin.PluginSpec.IsService() && ns.scheduledPlugins.IsExist(pr) {
+		ns.stopServicePlugin(pr, reason)
+	} else if a := ns.scheduledPlugins.Pop(pr); a != nil {
+		// Pods have their job ID in the name
+		podName := kubernetesObjectNameForPlugin(&a.Plugin)
+		if pod, err := ns.ResourceManager.GetPod(podName); err != nil {
+			a.Plugin.Logger().Error("failed to get pod of the plugin", "pod", podName, "error", err)
+		} else {
+			e := datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusFailed).
+				AddPluginRuntimeMeta(*pr).
+				AddPluginMeta(a.Plugin).
+				AddPodMeta(pod).
+				AddReason(reason).
+				Build()
+			ns.LogToBeehive.SendWaggleMessageOnNodeAsync(e.ToWaggleMessage(), "all")
+			ns.ResourceManager.TerminatePod(podName)
+			pr.Plugin.Logger().Info("plugin is removed from running", "pod", podName, "reason", reason)
+		}
+	}
+	ns.GoalManager.DropPluginRuntime(PluginIndex{
+		name:   pr.Plugin.Name,
+		goalID: pr.Plugin.GoalID,
+		jobID:  pr.Plugin.JobID,
+	})
+}
+
 // handleBulkGoals adds or updates each goal in given goal list
 func (ns *NodeScheduler) handleBulkGoals(goals []datatype.ScienceGoal) {
 	// NOTE: There are multiple triggers that call this function
@@ -694,19 +1475,18 @@ func (ns *NodeScheduler) handleBulkGoals(goals []datatype.ScienceGoal) {
 		if existingGoal, _ := ns.GoalManager.GetScienceGoalByJobID(goal.JobID); existingGoal != nil {
 			// We assume that if the goal ID are the same, the goal has not changed.
 			if existingGoal.ID == goal.ID {
-				logger.Info.Printf("The goal %s exists and no changes in the goal. Skipping adding the goal", goal.Name)
+				goal.Logger().Info("the goal exists and no changes in the goal. Skipping adding the goal", "goal", goal.Name)
 				continue
 			} else {
-				logger.Info.Printf("The goal %s %q exists and has changed its content. Cleaning up the existing goal %q", goal.Name, goal.ID, existingGoal.ID)
-				ns.cleanUpGoal(existingGoal)
-				ns.registerGoal(&goal)
+				goal.Logger().Info("the goal exists and has changed its content. Updating the existing goal", "goal", goal.Name, "existing_goal_id", existingGoal.ID)
+				ns.updateGoal(existingGoal, &goal)
 				e := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusUpdated).
 					AddGoal(&goal).
 					Build()
 				ns.LogToBeehive.SendWaggleMessageOnNodeAsync(e.ToWaggleMessage(), "all")
 			}
 		} else {
-			logger.Info.Printf("Adding the new goal %s %q", goal.Name, goal.ID)
+			goal.Logger().Info("adding the new goal", "goal", goal.Name)
 			ns.registerGoal(&goal)
 			e := datatype.NewSchedulerEventBuilder(datatype.EventGoalStatusReceived).
 				AddGoal(&goal).
@@ -0,0 +1,141 @@
+package nodescheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestDrainAndResume(t *testing.T) {
+	ns := NewNodeSchedulerBuilder(&NodeSchedulerConfig{Name: "W000"}).Build()
+	ns.Drain()
+	if !ns.IsDraining() {
+		t.Fatal("expected the node to be draining")
+	}
+	ns.Resume()
+	if ns.IsDraining() {
+		t.Fatal("expected the node to resume scheduling")
+	}
+	select {
+	case <-ns.chanNeedScheduling:
+	default:
+		t.Error("expected scheduling to be triggered when the node resumes")
+	}
+	// resuming a node that is not draining should not trigger scheduling
+	ns.Resume()
+	if len(ns.chanNeedScheduling) != 0 {
+		t.Error("expected no scheduling to be triggered")
+	}
+}
+
+func TestResumeDoesNotBlock(t *testing.T) {
+	ns := NewNodeSchedulerBuilder(&NodeSchedulerConfig{Name: "W000"}).Build()
+	for len(ns.chanNeedScheduling) < cap(ns.chanNeedScheduling) {
+		ns.chanNeedScheduling <- datatype.NewSchedulerEventBuilder(datatype.EventPluginStatusQueued).Build()
+	}
+	ns.Drain()
+	done := make(chan struct{})
+	go func() {
+		ns.Resume()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Resume to return while scheduling is pending")
+	}
+}
+
+func TestWaitForRunningPlugins(t *testing.T) {
+	ns := NewNodeSchedulerBuilder(&NodeSchedulerConfig{Name: "W000"}).Build()
+	ns.scheduledPlugins.Push(datatype.NewPluginRuntime(datatype.Plugin{
+		Name:       "test-service",
+		PluginSpec: &datatype.PluginSpec{Image: "myimage:0.1.0", Mode: datatype.PluginModeService},
+	}))
+	start := time.Now()
+	ns.waitForRunningPlugins(time.Minute)
+	if time.Since(start) > time.Second {
+		t.Error("expected not to wait for service plugins")
+	}
+	ns.scheduledPlugins.Push(datatype.NewPluginRuntime(datatype.Plugin{
+		Name:       "test-plugin",
+		PluginSpec: &datatype.PluginSpec{Image: "myimage:0.1.0"},
+	}))
+	start = time.Now()
+	ns.waitForRunningPlugins(100 * time.Millisecond)
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("expected to wait for the running plugin until timeout")
+	}
+}
+
+func TestUpdateGoalKeepsUnchangedPlugins(t *testing.T) {
+	ns := NewNodeSchedulerBuilder(&NodeSchedulerConfig{Name: "W000", Simulate: true}).
+		AddGoalManager("").
+		AddKnowledgebase().
+		AddLoggerToBeehive("").
+		Build()
+	ns.ResourceManager = NewFakeK3SResourceManager(nil)
+	newGoal := func(images map[string]string, rules ...string) datatype.ScienceGoal {
+		var plugins []*datatype.Plugin
+		for name, image := range images {
+			plugins = append(plugins, &datatype.Plugin{Name: name, PluginSpec: &datatype.PluginSpec{Image: image}})
+		}
+		var scienceRules []datatype.ScienceRule
+		for _, r := range rules {
+			scienceRules = append(scienceRules, datatype.ScienceRule{Rule: r})
+		}
+		return *datatype.NewScienceGoalBuilder("mygoal", "1").AddSubGoal("W000", plugins, scienceRules).Build()
+	}
+	oldGoal := newGoal(map[string]string{
+		"plugin-a": "plugin-a:0.1.0",
+		"plugin-b": "plugin-b:0.1.0",
+	}, "schedule(plugin-a): True", "schedule(plugin-b): True")
+	ns.handleBulkGoals([]datatype.ScienceGoal{oldGoal})
+	prA := ns.GoalManager.GetPluginRuntimeByNameAndJobID("plugin-a", "1")
+	prB := ns.GoalManager.GetPluginRuntimeByNameAndJobID("plugin-b", "1")
+	if prA == nil || prB == nil {
+		t.Fatal("expected plugins of the goal to be registered")
+	}
+	ns.scheduledPlugins.Push(prA)
+
+	updatedGoal := newGoal(map[string]string{
+		"plugin-a": "plugin-a:0.1.0",
+		"plugin-b": "plugin-b:0.2.0",
+		"plugin-c": "plugin-c:0.1.0",
+	}, "schedule(plugin-a): True", "schedule(plugin-c): True")
+	ns.handleBulkGoals([]datatype.ScienceGoal{updatedGoal})
+
+	if _, err := ns.GoalManager.GetScienceGoalByID(oldGoal.ID); err == nil {
+		t.Error("expected the old goal to be dropped")
+	}
+	if pr := ns.GoalManager.GetPluginRuntimeByNameAndJobID("plugin-a", "1"); pr != prA {
+		t.Error("expected the unchanged plugin to be kept")
+	} else if pr.Plugin.GoalID != updatedGoal.ID {
+		t.Errorf("expected the kept plugin to move to goal %q, got %q", updatedGoal.ID, pr.Plugin.GoalID)
+	}
+	if !ns.scheduledPlugins.IsExist(prA) {
+		t.Error("expected the unchanged plugin to keep running")
+	}
+	if pr := ns.GoalManager.GetPluginRuntimeByNameAndJobID("plugin-b", "1"); pr == nil || pr == prB {
+		t.Error("expected the changed plugin to be re-created")
+	} else if pr.Plugin.PluginSpec.Image != "plugin-b:0.2.0" {
+		t.Errorf("expected the changed plugin to have image plugin-b:0.2.0, got %s", pr.Plugin.PluginSpec.Image)
+	}
+	if pr := ns.GoalManager.GetPluginRuntimeByNameAndJobID("plugin-c", "1"); pr == nil {
+		t.Error("expected the new plugin to be added")
+	}
+	if len(ns.GoalManager.LoadedPlugins) != 3 {
+		t.Errorf("expected 3 plugins loaded, got %d", len(ns.GoalManager.LoadedPlugins))
+	}
+	if _, found := ns.Knowledgebase.rules[oldGoal.ID]; found {
+		t.Error("expected rules of the old goal to be dropped")
+	}
+	rules := ns.Knowledgebase.rules[updatedGoal.ID]
+	if len(rules) != 2 || rules[1].ActionObject != "plugin-c" {
+		t.Errorf("expected rules of the updated goal, got %v", rules)
+	}
+	if !ns.GoalManager.IsGoalReady(updatedGoal.ID) {
+		t.Error("expected the updated goal to be ready")
+	}
+}
@@ -0,0 +1,214 @@
+package nodescheduler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// NodeServices structs WES services and resources of the node that are provided to plugins.
+// Endpoints not specified use the WES defaults. Forwarded services, forwarded configmaps,
+// environment variables, and volumes are added to the defaults.
+type NodeServices struct {
+	// Namespace is where WES services run
+	Namespace      string          `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	RabbitMQ       ServiceEndpoint `json:"rabbitmq,omitempty" yaml:"rabbitMQ,omitempty"`
+	AudioServer    ServiceEndpoint `json:"audio_server,omitempty" yaml:"audioServer,omitempty"`
+	GPSServer      ServiceEndpoint `json:"gps_server,omitempty" yaml:"gpsServer,omitempty"`
+	ROSMaster      ServiceEndpoint `json:"ros_master,omitempty" yaml:"rosMaster,omitempty"`
+	Scoreboard     ServiceEndpoint `json:"scoreboard,omitempty" yaml:"scoreboard,omitempty"`
+	AppMetaCache   ServiceEndpoint `json:"app_meta_cache,omitempty" yaml:"appMetaCache,omitempty"`
+	JetsonExporter ServiceEndpoint `json:"jetson_exporter,omitempty" yaml:"jetsonExporter,omitempty"`
+	// ForwardedServices are WES services made accessible from the namespace of plugins
+	ForwardedServices []string `json:"forwarded_services,omitempty" yaml:"forwardedServices,omitempty"`
+	// ForwardedConfigMaps are WES configmaps copied to the namespace of plugins
+	ForwardedConfigMaps []string `json:"forwarded_configmaps,omitempty" yaml:"forwardedConfigMaps,omitempty"`
+	// Env is injected to every plugin
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	// Volumes are mounted to every plugin
+	Volumes []NodeServiceVolume `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+}
+
+// ServiceEndpoint structs the address of a WES service
+type ServiceEndpoint struct {
+	Host string `json:"host,omitempty" yaml:"host,omitempty"`
+	Port int    `json:"port,omitempty" yaml:"port,omitempty"`
+}
+
+// Address returns the endpoint in HOST:PORT format
+func (e ServiceEndpoint) Address() string {
+	return e.Host + ":" + strconv.Itoa(e.Port)
+}
+
+// NodeServiceVolume structs a volume mounted to every plugin from either
+// a host path or a configmap
+type NodeServiceVolume struct {
+	Name      string `json:"name" yaml:"name"`
+	HostPath  string `json:"host_path,omitempty" yaml:"hostPath,omitempty"`
+	ConfigMap string `json:"configmap,omitempty" yaml:"configMap,omitempty"`
+	MountPath string `json:"mount_path" yaml:"mountPath"`
+	SubPath   string `json:"sub_path,omitempty" yaml:"subPath,omitempty"`
+	ReadOnly  bool   `json:"read_only,omitempty" yaml:"readOnly,omitempty"`
+}
+
+// DefaultNodeServices returns WES services of a standard Waggle node
+func DefaultNodeServices() NodeServices {
+	return defaultNodeServicesIn("default")
+}
+
+// defaultNodeServicesIn returns WES services of a standard Waggle node running in the namespace
+func defaultNodeServicesIn(namespace string) NodeServices {
+	host := func(service string) string {
+		return fmt.Sprintf("%s.%s.svc.cluster.local", service, namespace)
+	}
+	return NodeServices{
+		Namespace:           namespace,
+		RabbitMQ:            ServiceEndpoint{Host: host("wes-rabbitmq"), Port: 5672},
+		AudioServer:         ServiceEndpoint{Host: host("wes-audio-server"), Port: 4713},
+		GPSServer:           ServiceEndpoint{Host: host("wes-gps-server")},
+		ROSMaster:           ServiceEndpoint{Host: host("wes-roscore"), Port: 11311},
+		Scoreboard:          ServiceEndpoint{Host: host("wes-scoreboard")},
+		AppMetaCache:        ServiceEndpoint{Host: host("wes-app-meta-cache")},
+		JetsonExporter:      ServiceEndpoint{Host: host("wes-jetson-exporter")},
+		ForwardedServices:   []string{"wes-rabbitmq", "wes-audio-server", "wes-scoreboard", "wes-app-meta-cache"},
+		ForwardedConfigMaps: []string{"waggle-data-config", "wes-audio-server-plugin-conf"},
+		Volumes: []NodeServiceVolume{
+			{
+				Name:      "wes-audio-server-plugin-conf",
+				ConfigMap: "wes-audio-server-plugin-conf",
+				MountPath: "/etc/asound.conf",
+				SubPath:   "asound.conf",
+			},
+		},
+	}
+}
+
+// WithDefaults returns the node services filled with the defaults. Default endpoints
+// point to WES services in the namespace of the node services
+func (s NodeServices) WithDefaults() NodeServices {
+	d := DefaultNodeServices()
+	if s.Namespace != "" {
+		d = defaultNodeServicesIn(s.Namespace)
+	}
+	for _, e := range []struct {
+		from ServiceEndpoint
+		to   *ServiceEndpoint
+	}{
+		{s.RabbitMQ, &d.RabbitMQ},
+		{s.AudioServer, &d.AudioServer},
+		{s.GPSServer, &d.GPSServer},
+		{s.ROSMaster, &d.ROSMaster},
+		{s.Scoreboard, &d.Scoreboard},
+		{s.AppMetaCache, &d.AppMetaCache},
+		{s.JetsonExporter, &d.JetsonExporter},
+	} {
+		if e.from.Host != "" {
+			e.to.Host = e.from.Host
+		}
+		if e.from.Port != 0 {
+			e.to.Port = e.from.Port
+		}
+	}
+	d.ForwardedServices = appendUnique(d.ForwardedServices, s.ForwardedServices...)
+	d.ForwardedConfigMaps = appendUnique(d.ForwardedConfigMaps, s.ForwardedConfigMaps...)
+	d.Env = s.Env
+	d.Volumes = append(d.Volumes, s.Volumes...)
+	return d
+}
+
+// Validate returns an error if a volume is not valid
+func (s NodeServices) Validate() error {
+	for _, v := range s.Volumes {
+		if v.Name == "" || v.MountPath == "" {
+			return fmt.Errorf("volume %q must have name and mount path", v.Name)
+		}
+		if (v.HostPath == "") == (v.ConfigMap == "") {
+			return fmt.Errorf("volume %q must have either host path or configmap", v.Name)
+		}
+	}
+	return nil
+}
+
+// envs returns environment variables of WES services for plugins
+func (s NodeServices) envs() []apiv1.EnvVar {
+	envs := []apiv1.EnvVar{
+		{
+			Name:  "PULSE_SERVER",
+			Value: "tcp:" + s.AudioServer.Address(),
+		},
+		{
+			Name:  "WAGGLE_PLUGIN_HOST",
+			Value: s.RabbitMQ.Host,
+		},
+		{
+			Name:  "WAGGLE_PLUGIN_PORT",
+			Value: strconv.Itoa(s.RabbitMQ.Port),
+		},
+		{
+			Name:  "WAGGLE_GPS_SERVER",
+			Value: s.GPSServer.Host,
+		},
+		// Use default WES roscore hostname for ROS clients.
+		{
+			Name:  "ROS_MASTER_URI",
+			Value: "http://" + s.ROSMaster.Address(),
+		},
+		// Use WES scoreboard
+		{
+			Name:  "WAGGLE_SCOREBOARD",
+			Value: s.Scoreboard.Host,
+		},
+	}
+	// sort names to keep the pod spec the same across runs
+	names := make([]string, 0, len(s.Env))
+	for k := range s.Env {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		envs = append(envs, apiv1.EnvVar{Name: k, Value: s.Env[k]})
+	}
+	return envs
+}
+
+// volumes returns volumes and their mounts for plugins
+func (s NodeServices) volumes() (volumes []apiv1.Volume, volumeMounts []apiv1.VolumeMount) {
+	for _, v := range s.Volumes {
+		volume := apiv1.Volume{Name: v.Name}
+		if v.ConfigMap != "" {
+			volume.VolumeSource.ConfigMap = &apiv1.ConfigMapVolumeSource{
+				LocalObjectReference: apiv1.LocalObjectReference{Name: v.ConfigMap},
+			}
+		} else {
+			volume.VolumeSource.HostPath = &apiv1.HostPathVolumeSource{
+				Path: v.HostPath,
+			}
+		}
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, apiv1.VolumeMount{
+			Name:      v.Name,
+			MountPath: v.MountPath,
+			SubPath:   v.SubPath,
+			ReadOnly:  v.ReadOnly,
+		})
+	}
+	return
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		found := false
+		for _, l := range list {
+			if l == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
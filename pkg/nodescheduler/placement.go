@@ -0,0 +1,182 @@
+package nodescheduler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+// computeLoad structs the resource already taken by plugins placed on a compute
+type computeLoad struct {
+	plugins      int
+	cpuInMilli   int
+	memInMega    int
+	gpuMemInMega int
+}
+
+// placePlugin chooses a compute of the node for the plugin and records it in the PluginRuntime.
+// The plugin is not placed by the scheduler if the node manifest is not known,
+// the user specifies the node of the plugin, or no compute supports the plugin.
+// In those cases Kubernetes places the plugin with the selectors of the plugin.
+// It returns an error if computes supporting the plugin do not have enough resource to run the plugin.
+func (ns *NodeScheduler) placePlugin(pr *datatype.PluginRuntime) error {
+	pr.Compute, pr.ComputeHostname = "", ""
+	if ns.NodeManifest == nil || pr.Plugin.PluginSpec.Node != "" {
+		return nil
+	}
+	if _, found := pr.Plugin.PluginSpec.Selector["k3s.io/hostname"]; found {
+		return nil
+	}
+	candidates := filterComputesForPlugin(ns.NodeManifest, &pr.Plugin)
+	if len(candidates) == 0 {
+		logger.Info.Printf("No compute found to support plugin %q. Letting Kubernetes place the plugin", pr.Plugin.Name)
+		return nil
+	}
+	var placedPlugins []*datatype.PluginRuntime
+	ns.scheduledPlugins.ResetIter()
+	for ns.scheduledPlugins.More() {
+		placedPlugins = append(placedPlugins, ns.scheduledPlugins.Next())
+	}
+	compute, err := selectLeastLoadedCompute(candidates, pr, placedPlugins)
+	if err != nil {
+		return err
+	}
+	hostname, err := ns.ResourceManager.GetKubernetesNodeNameForCompute(compute)
+	if err != nil {
+		logger.Error.Printf("Failed to find Kubernetes node of compute %q: %s. Letting Kubernetes place the plugin", compute.Name, err.Error())
+		return nil
+	}
+	pr.Compute, pr.ComputeHostname = compute.Name, hostname
+	logger.Info.Printf("Plugin %q is placed on compute %q (%s)", pr.Plugin.Name, compute.Name, hostname)
+	return nil
+}
+
+// getComputeHostnamesForPlugin returns Kubernetes node names of the computes that the plugin
+// may be placed on. It returns nothing if the scheduler does not place the plugin.
+func (ns *NodeScheduler) getComputeHostnamesForPlugin(plugin *datatype.Plugin) (hostnames []string) {
+	if ns.NodeManifest == nil || plugin.PluginSpec.Node != "" {
+		return
+	}
+	if _, found := plugin.PluginSpec.Selector["k3s.io/hostname"]; found {
+		return
+	}
+	for _, c := range filterComputesForPlugin(ns.NodeManifest, plugin) {
+		if hostname, err := ns.ResourceManager.GetKubernetesNodeNameForCompute(&c); err != nil {
+			logger.Error.Printf("Failed to find Kubernetes node of compute %q: %s", c.Name, err.Error())
+		} else {
+			hostnames = append(hostnames, hostname)
+		}
+	}
+	return
+}
+
+// filterComputesForPlugin returns computes of the node that support architecture and GPU requirement
+// of the plugin and have access to the sensors the plugin requires
+func filterComputesForPlugin(nodeManifest *datatype.NodeManifest, plugin *datatype.Plugin) (candidates []datatype.ComputeManifest) {
+	for _, c := range nodeManifest.Computes {
+		if len(plugin.Architectures) > 0 {
+			supported := false
+			for _, arch := range plugin.Architectures {
+				// NOTE: plugin manifest has linux/ prefix for architecture
+				//       that node manifest does not have
+				if c.SupportsArchitecture(strings.Replace(arch, "linux/", "", -1)) {
+					supported = true
+					break
+				}
+			}
+			if !supported {
+				continue
+			}
+		}
+		if plugin.PluginSpec.IsGPURequired() && !c.Hardware.HasCapability("gpu") {
+			continue
+		}
+		if !hasAccessToSensors(nodeManifest, c.Name, plugin.PluginSpec.Sensors) {
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	return
+}
+
+// hasAccessToSensors returns true if the compute can access at least one sensor matching
+// each of given sensors. Sensors unknown to the node manifest are not checked.
+func hasAccessToSensors(nodeManifest *datatype.NodeManifest, compute string, sensors []string) bool {
+	for _, sensor := range sensors {
+		matched := nodeManifest.FindSensors(sensor)
+		if len(matched) == 0 {
+			continue
+		}
+		attached := false
+		for _, s := range matched {
+			if s.IsAttachedTo(compute) {
+				attached = true
+				break
+			}
+		}
+		if !attached {
+			return false
+		}
+	}
+	return true
+}
+
+// selectLeastLoadedCompute returns the compute that has the fewest plugins placed among the computes
+// that have enough resource for the plugin. Resource of a compute not specified in its manifest
+// is not checked.
+func selectLeastLoadedCompute(candidates []datatype.ComputeManifest, pr *datatype.PluginRuntime, placedPlugins []*datatype.PluginRuntime) (*datatype.ComputeManifest, error) {
+	loads := map[string]*computeLoad{}
+	for _, c := range candidates {
+		loads[c.Name] = &computeLoad{}
+	}
+	for _, placed := range placedPlugins {
+		if load, found := loads[placed.Compute]; found {
+			r := placed.Plugin.PluginSpec.GetResourceRequest()
+			load.plugins += 1
+			load.cpuInMilli += positive(r.GetCPUInMilli())
+			load.memInMega += positive(r.GetMemoryInMega())
+			load.gpuMemInMega += positive(r.GetGPUMemoryInMega())
+		}
+	}
+	request := pr.Plugin.PluginSpec.GetResourceRequest()
+	var selected *datatype.ComputeManifest
+	for i, c := range candidates {
+		load := loads[c.Name]
+		capacity := datatype.Resource{
+			CPU:       c.Hardware.CPU,
+			Memory:    c.Hardware.CPURAM,
+			GPUMemory: c.Hardware.GPURAM,
+		}
+		if !fits(capacity.GetCPUInMilli(), load.cpuInMilli, request.GetCPUInMilli()) ||
+			!fits(capacity.GetMemoryInMega(), load.memInMega, request.GetMemoryInMega()) ||
+			!fits(capacity.GetGPUMemoryInMega(), load.gpuMemInMega, request.GetGPUMemoryInMega()) {
+			logger.Debug.Printf("compute %q does not have enough resource for plugin %q", c.Name, pr.Plugin.Name)
+			continue
+		}
+		if selected == nil || load.plugins < loads[selected.Name].plugins {
+			selected = &candidates[i]
+		}
+	}
+	if selected == nil {
+		return nil, fmt.Errorf("no compute has enough resource to run plugin %q", pr.Plugin.Name)
+	}
+	return selected, nil
+}
+
+// fits returns true if the requested amount fits to the capacity with given usage.
+// Unknown capacity or request always fits.
+func fits(capacity int, used int, request int) bool {
+	if capacity <= 0 || request <= 0 {
+		return true
+	}
+	return used+request <= capacity
+}
+
+func positive(v int) int {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
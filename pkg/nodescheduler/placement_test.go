@@ -0,0 +1,126 @@
+package nodescheduler
+
+import (
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestComputePlacement(t *testing.T) {
+	computes := []datatype.ComputeManifest{
+		{
+			Name: "nxcore",
+			Hardware: datatype.ComputeHardwareManifest{
+				Capabilities: []string{"arm64", "gpu"},
+				CPU:          "6",
+				CPURAM:       "8Gi",
+				GPURAM:       "8Gi",
+			},
+		},
+		{
+			Name: "nxagent",
+			Hardware: datatype.ComputeHardwareManifest{
+				Capabilities: []string{"arm64", "gpu"},
+				CPU:          "6",
+				CPURAM:       "8Gi",
+				GPURAM:       "8Gi",
+			},
+		},
+		{
+			Name: "rpi",
+			Hardware: datatype.ComputeHardwareManifest{
+				Capabilities: []string{"arm64"},
+				CPU:          "4",
+				CPURAM:       "4Gi",
+			},
+		},
+		{
+			Name: "dell",
+			Hardware: datatype.ComputeHardwareManifest{
+				Capabilities: []string{"amd64"},
+			},
+		},
+	}
+	nodeManifest := &datatype.NodeManifest{
+		Computes: computes,
+		Sensors: []datatype.SensorManifest{
+			{Name: "bottom_camera", Scope: "global", Labels: []string{"camera"}},
+			{Name: "microphone", Scope: "rpi", Labels: []string{"audio"}},
+		},
+	}
+	newPluginRuntime := func(name string, compute string, selector map[string]string, resource map[string]string) *datatype.PluginRuntime {
+		pr := datatype.NewPluginRuntime(datatype.Plugin{
+			Name:          name,
+			Architectures: []string{"linux/arm64"},
+			PluginSpec: &datatype.PluginSpec{
+				Image:    name + ":0.1.0",
+				Selector: selector,
+				Resource: resource,
+			},
+		})
+		pr.Compute = compute
+		return pr
+	}
+	placed := []*datatype.PluginRuntime{
+		newPluginRuntime("plugin-a", "nxcore", nil, nil),
+		newPluginRuntime("plugin-b", "rpi", nil, map[string]string{"request.memory": "3Gi"}),
+	}
+	tests := map[string]struct {
+		Plugin  *datatype.PluginRuntime
+		Sensors []string
+		Wants   string
+	}{
+		"least loaded": {
+			Plugin: newPluginRuntime("plugin-c", "", nil, nil),
+			Wants:  "nxagent",
+		},
+		"gpu": {
+			Plugin: newPluginRuntime("plugin-d", "", map[string]string{"resource.gpu": "true"}, nil),
+			Wants:  "nxagent",
+		},
+		"not enough memory": {
+			Plugin: newPluginRuntime("plugin-e", "", nil, map[string]string{"request.memory": "6Gi"}),
+			Wants:  "nxagent",
+		},
+		"sensor attached to compute": {
+			Plugin:  newPluginRuntime("plugin-g", "", nil, nil),
+			Sensors: []string{"audio"},
+			Wants:   "rpi",
+		},
+		"global sensor": {
+			Plugin:  newPluginRuntime("plugin-h", "", nil, nil),
+			Sensors: []string{"bottom_camera"},
+			Wants:   "nxagent",
+		},
+		"sensor not accessible": {
+			Plugin:  newPluginRuntime("plugin-i", "", map[string]string{"resource.gpu": "true"}, nil),
+			Sensors: []string{"microphone"},
+			Wants:   "",
+		},
+		"no compute fits": {
+			Plugin: newPluginRuntime("plugin-f", "", nil, map[string]string{"request.cpu": "8"}),
+			Wants:  "",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.Plugin.Plugin.PluginSpec.Sensors = tc.Sensors
+			candidates := filterComputesForPlugin(nodeManifest, &tc.Plugin.Plugin)
+			for _, c := range candidates {
+				if c.Name == "dell" {
+					t.Errorf("compute %q does not support the plugin architecture", c.Name)
+				}
+			}
+			c, err := selectLeastLoadedCompute(candidates, tc.Plugin, placed)
+			if tc.Wants == "" {
+				if err == nil {
+					t.Errorf("expected no compute, but got %q", c.Name)
+				}
+			} else if err != nil {
+				t.Error(err)
+			} else if c.Name != tc.Wants {
+				t.Errorf("expected compute %q, but got %q", tc.Wants, c.Name)
+			}
+		})
+	}
+}
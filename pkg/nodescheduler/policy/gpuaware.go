@@ -1,6 +1,8 @@
 package policy
 
 import (
+	"sort"
+
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
@@ -14,9 +16,16 @@ func NewGPUAwareSchedulingPolicy() *GPUAwareSchedulingPolicy {
 
 // SelectBestPlugins returns the best plugin to run at the time
 // For non-GPU-demand plugins, it returns all the plugins.
-// For GPU-demand plugins it returns the oldest one if no GPU-demand plugins in the scheduled plugin list
+// For GPU-demand plugins that declare their GPU memory, it returns the plugins as long as
+// each plugin fits to the GPU memory left on one of the GPUs of the node, as a plugin cannot
+// use GPU memory across GPUs.
+// For GPU-demand plugins that do not declare GPU memory, or when GPU memory of the node is unknown,
+// it returns the oldest one if no GPU-demand plugins in the scheduled plugin list. Such plugin
+// runs exclusively on the GPU.
 func (rs *GPUAwareSchedulingPolicy) SelectBestPlugins(readyQueue *datatype.Queue, scheduledPlugins *datatype.Queue, availableResource datatype.Resource) (pluginsToRun []*datatype.PluginRuntime, err error) {
+	devices := newGPUDevices(availableResource.GetGPUDevicesInMega())
 	GPUPluginExists := false
+	exclusiveGPUPluginExists := false
 	// Flag if GPU-demand plugin already exists in scheduled plugin list
 	scheduledPlugins.ResetIter()
 	for scheduledPlugins.More() {
@@ -24,17 +33,34 @@ func (rs *GPUAwareSchedulingPolicy) SelectBestPlugins(readyQueue *datatype.Queue
 		if pr.Plugin.PluginSpec.IsGPURequired() {
 			GPUPluginExists = true
 			logger.Debug.Printf("GPU-demand plugin %q exists in scheduled plugin list.", pr.Plugin.Name)
-			break
+			if demand := getGPUMemoryDemand(pr); demand > 0 && len(devices) > 0 {
+				devices.take(pr.Compute, demand)
+			} else {
+				exclusiveGPUPluginExists = true
+			}
 		}
 	}
 	readyQueue.ResetIter()
 	for readyQueue.More() {
 		pr := readyQueue.Next()
 		if pr.Plugin.PluginSpec.IsGPURequired() {
-			if GPUPluginExists == false {
+			demand := getGPUMemoryDemand(pr)
+			if exclusiveGPUPluginExists {
+				logger.Debug.Printf("GPU-demand plugin %q needs to wait because other GPU-demand plugin is running exclusively.", pr.Plugin.Name)
+			} else if demand > 0 && len(devices) > 0 {
+				if device := devices.find(demand); device != nil {
+					pluginsToRun = append(pluginsToRun, pr)
+					device.used += demand
+					logger.Debug.Printf("GPU-demand plugin %q is added to scheduled plugin list. GPU memory %d/%d Mi of GPU %q", pr.Plugin.Name, device.used, device.capacity, device.name)
+					GPUPluginExists = true
+				} else {
+					logger.Debug.Printf("GPU-demand plugin %q needs to wait because its GPU memory %d Mi does not fit to the available %d Mi of any GPU.", pr.Plugin.Name, demand, devices.maxAvailable())
+				}
+			} else if GPUPluginExists == false {
 				pluginsToRun = append(pluginsToRun, pr)
-				logger.Debug.Printf("GPU-demand plugin %q is added to scheduled plugin list.", pr.Plugin.Name)
+				logger.Debug.Printf("GPU-demand plugin %q is added to scheduled plugin list to run exclusively.", pr.Plugin.Name)
 				GPUPluginExists = true
+				exclusiveGPUPluginExists = true
 			} else {
 				logger.Debug.Printf("GPU-demand plugin %q needs to wait because other GPU-demand plugin is scheduled or being run.", pr.Plugin.Name)
 			}
@@ -44,3 +70,61 @@ func (rs *GPUAwareSchedulingPolicy) SelectBestPlugins(readyQueue *datatype.Queue
 	}
 	return
 }
+
+// gpuDevice tracks GPU memory in Mi taken by plugins on a GPU
+type gpuDevice struct {
+	name     string
+	capacity int
+	used     int
+}
+
+type gpuDevices []*gpuDevice
+
+func newGPUDevices(capacities map[string]int) (devices gpuDevices) {
+	for name, capacity := range capacities {
+		devices = append(devices, &gpuDevice{name: name, capacity: capacity})
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].name < devices[j].name })
+	return
+}
+
+// take counts the demand of a scheduled plugin on the GPU of its compute. The plugin is counted
+// on the GPU with the most memory left if its compute is not known
+func (devices gpuDevices) take(compute string, demand int) {
+	var device *gpuDevice
+	for _, d := range devices {
+		if d.name == compute {
+			device = d
+			break
+		}
+		if device == nil || d.capacity-d.used > device.capacity-device.used {
+			device = d
+		}
+	}
+	device.used += demand
+}
+
+// find returns the GPU with the least memory left that fits the demand, or nil if none fits
+func (devices gpuDevices) find(demand int) (device *gpuDevice) {
+	for _, d := range devices {
+		if available := d.capacity - d.used; available >= demand && (device == nil || available < device.capacity-device.used) {
+			device = d
+		}
+	}
+	return
+}
+
+func (devices gpuDevices) maxAvailable() (available int) {
+	for _, d := range devices {
+		if a := d.capacity - d.used; a > available {
+			available = a
+		}
+	}
+	return
+}
+
+// getGPUMemoryDemand returns the GPU memory in Mi declared by the plugin
+func getGPUMemoryDemand(pr *datatype.PluginRuntime) int {
+	r := datatype.Resource{GPUMemory: pr.Plugin.PluginSpec.GetGPUMemoryRequest()}
+	return r.GetGPUMemoryInMega()
+}
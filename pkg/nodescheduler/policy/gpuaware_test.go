@@ -68,3 +68,114 @@ func TestGPUAwarePolicy(t *testing.T) {
 		}
 	}
 }
+
+func TestGPUAwarePolicyWithGPUMemory(t *testing.T) {
+	var (
+		readyQueue       datatype.Queue
+		scheduledPlugins datatype.Queue
+	)
+	newGPUPlugin := func(name string, gpuMemory string) *datatype.PluginRuntime {
+		pr := &datatype.PluginRuntime{
+			Plugin: datatype.Plugin{
+				Name: name,
+				PluginSpec: &datatype.PluginSpec{
+					Image: name + ":latest",
+					Selector: map[string]string{
+						"resource.gpu": "true",
+					},
+					Resource: map[string]string{},
+				},
+			},
+		}
+		if gpuMemory != "" {
+			pr.Plugin.PluginSpec.Resource[datatype.ResourceRequestGPUMemory] = gpuMemory
+		}
+		return pr
+	}
+	scheduledPlugins.Push(newGPUPlugin("gpu-plugin-a", "2Gi"))
+	readyQueue.Push(newGPUPlugin("gpu-plugin-b", "3Gi"))
+	readyQueue.Push(newGPUPlugin("gpu-plugin-c", "4Gi"))
+	readyQueue.Push(newGPUPlugin("gpu-plugin-d", "2Gi"))
+	readyQueue.Push(newGPUPlugin("gpu-plugin-e", ""))
+	schedulingPolicy := GetSchedulingPolicyByName("gpuaware")
+	pluginsToSchedule, err := schedulingPolicy.SelectBestPlugins(
+		&readyQueue,
+		&scheduledPlugins,
+		datatype.Resource{
+			CPU:       "999000m",
+			Memory:    "999999Gi",
+			GPUMemory: "8Gi",
+		})
+	if err != nil {
+		t.Error(err)
+	}
+	// a (2Gi) + b (3Gi) + d (2Gi) fit to 8Gi. c (4Gi) does not fit and
+	// e does not declare GPU memory so it needs to wait for the GPU to be free
+	expected := []string{"gpu-plugin-b", "gpu-plugin-d"}
+	if len(pluginsToSchedule) != len(expected) {
+		t.Fatalf("%d plugins are expected to be scheduled, but %d plugins were scheduled", len(expected), len(pluginsToSchedule))
+	}
+	for i, pr := range pluginsToSchedule {
+		if pr.Plugin.Name != expected[i] {
+			t.Errorf("expected %q to be scheduled, but got %q", expected[i], pr.Plugin.Name)
+		}
+	}
+}
+
+func TestGPUAwarePolicyWithGPUDevices(t *testing.T) {
+	var (
+		readyQueue       datatype.Queue
+		scheduledPlugins datatype.Queue
+	)
+	newGPUPlugin := func(name string, gpuMemory string) *datatype.PluginRuntime {
+		return &datatype.PluginRuntime{
+			Plugin: datatype.Plugin{
+				Name: name,
+				PluginSpec: &datatype.PluginSpec{
+					Image: name + ":latest",
+					Selector: map[string]string{
+						"resource.gpu": "true",
+					},
+					Resource: map[string]string{
+						datatype.ResourceRequestGPUMemory: gpuMemory,
+					},
+				},
+			},
+		}
+	}
+	running := newGPUPlugin("gpu-plugin-a", "6Gi")
+	running.Compute = "nxcore"
+	scheduledPlugins.Push(running)
+	readyQueue.Push(newGPUPlugin("gpu-plugin-b", "10Gi"))
+	readyQueue.Push(newGPUPlugin("gpu-plugin-c", "4Gi"))
+	readyQueue.Push(newGPUPlugin("gpu-plugin-d", "2Gi"))
+	readyQueue.Push(newGPUPlugin("gpu-plugin-e", "4Gi"))
+	readyQueue.Push(newGPUPlugin("gpu-plugin-f", "3Gi"))
+	schedulingPolicy := GetSchedulingPolicyByName("gpuaware")
+	pluginsToSchedule, err := schedulingPolicy.SelectBestPlugins(
+		&readyQueue,
+		&scheduledPlugins,
+		datatype.Resource{
+			CPU:       "999000m",
+			Memory:    "999999Gi",
+			GPUMemory: "16Gi",
+			GPUDevices: map[string]string{
+				"nxcore":  "8Gi",
+				"nxagent": "8Gi",
+			},
+		})
+	if err != nil {
+		t.Error(err)
+	}
+	// b (10Gi) does not fit to any GPU although 10Gi is left on the node. c (4Gi) and e (4Gi)
+	// fill nxagent and d (2Gi) fills nxcore, so f (3Gi) does not fit
+	expected := []string{"gpu-plugin-c", "gpu-plugin-d", "gpu-plugin-e"}
+	if len(pluginsToSchedule) != len(expected) {
+		t.Fatalf("%d plugins are expected to be scheduled, but %d plugins were scheduled", len(expected), len(pluginsToSchedule))
+	}
+	for i, pr := range pluginsToSchedule {
+		if pr.Plugin.Name != expected[i] {
+			t.Errorf("expected %q to be scheduled, but got %q", expected[i], pr.Plugin.Name)
+		}
+	}
+}
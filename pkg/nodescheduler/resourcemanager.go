@@ -1,6 +1,7 @@
 package nodescheduler
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -8,6 +9,8 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -49,9 +52,20 @@ const (
 	PodLabelPluginTask = "sagecontinuum.org/plugin-task"
 	PodLabelGoalID     = "sagecontinuum.org/plugin-goal-id"
 	PodLabelJobID      = "sagecontinuum.org/plugin-job-id"
+	PodLabelImagePull  = "sagecontinuum.org/image-pull"
+
+	// PodAnnotationCredentialSecret refers to the Secret holding the RabbitMQ credential of the plugin Pod
+	PodAnnotationCredentialSecret = "sagecontinuum.org/credential-secret"
+	// SecretLabelPluginCredential marks Secrets holding RabbitMQ credentials of plugins
+	SecretLabelPluginCredential = "sagecontinuum.org/plugin-credential"
 
 	InitContainerName             = "init-app-meta-cache"
 	PluginControllerContainerName = "plugin-controller"
+	ImagePullContainerName        = "image-pull"
+
+	imagePullCheckInterval = 5 * time.Second
+
+	pluginCredentialUserTag = "waggle-plugin"
 )
 
 var (
@@ -108,10 +122,13 @@ type ResourceManager struct {
 	Namespace           string
 	Clientset           kubernetes.Interface
 	kubeInformerFactory kubeinformers.SharedInformerFactory
+	informerStop        chan struct{}
 	MetricsClient       *metrics.Clientset
 	RMQManagement       *RMQManagement
+	NodeServices        NodeServices
 	Notifier            *interfacing.Notifier
 	Simulate            bool
+	simulator           *PodSimulator
 	runner              string
 }
 
@@ -129,6 +146,7 @@ func NewK3SResourceManager(incluster bool, kubeconfig string, runner string) (rm
 		Namespace:     namespace,
 		Clientset:     k3sClient,
 		MetricsClient: metricsClient,
+		NodeServices:  DefaultNodeServices(),
 		runner:        runner,
 	}, nil
 }
@@ -140,6 +158,7 @@ func NewFakeK3SResourceManager(objects []runtime.Object) (rm *ResourceManager) {
 		Namespace:     namespace,
 		Clientset:     fake.NewSimpleClientset(objects...),
 		MetricsClient: nil,
+		NodeServices:  DefaultNodeServices(),
 		runner:        "fake",
 	}
 }
@@ -302,6 +321,9 @@ func resourceListForConfig(pluginSpec *datatype.PluginSpec) (v1.ResourceRequirem
 			resources.Requests[v1.ResourceCPU] = quantity
 		case "request.memory":
 			resources.Requests[v1.ResourceMemory] = quantity
+		case datatype.ResourceRequestGPUMemory:
+			// GPU memory is accounted by the scheduler, not by Kubernetes
+			continue
 		default:
 			resources.Limits[v1.ResourceName(resourceName)] = quantity
 			// return resources, fmt.Errorf("Unknown resource name %q", resourceName)
@@ -364,20 +386,123 @@ func (rm *ResourceManager) ConfigureKubernetes(inCluster bool, kubeconfig string
 	return nil
 }
 
-// CreatePluginCredential creates a credential inside RabbitMQ server for the plugin
-func (rm *ResourceManager) CreatePluginCredential(plugin *datatype.Plugin) (datatype.PluginCredential, error) {
-	tag, err := plugin.PluginSpec.GetImageTag()
-	if err != nil {
-		return datatype.PluginCredential{}, err
+// ConfigureSimulation replaces the Kubernetes cluster with a fake one that has a node per compute.
+// Pods created in the fake cluster are advanced by a PodSimulator once the resource manager is configured
+func (rm *ResourceManager) ConfigureSimulation(nodeID string, computes []string, config SimulatorConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
 	}
+	var objects []runtime.Object
+	nodes := simulatedNodes(nodeID, computes)
+	for _, n := range nodes {
+		objects = append(objects, n)
+	}
+	rm.Clientset = fake.NewSimpleClientset(objects...)
+	rm.MetricsClient = nil
+	rm.simulator = NewPodSimulator(rm.Clientset, rm.Namespace, nodes[0].Name, config)
+	return nil
+}
 
-	// TODO: We will need to add instance of plugin as a aprt of Username
-	// username should follow "plugin.NAME:VERSION" format to publish messages via WES
-	credential := datatype.PluginCredential{
-		Username: fmt.Sprint("plugin.", strings.ToLower(plugin.Name), ":", tag),
+// CreatePluginCredential creates a credential for the run of the plugin. The username is made of
+// the Kubernetes object name of the plugin, its Pod instance, and a random suffix so that no other
+// run or job shares the credential, e.g. plugin.myplugin-12-abcd-x1y2z3w4
+func (rm *ResourceManager) CreatePluginCredential(pr *datatype.PluginRuntime) datatype.PluginCredential {
+	name := kubernetesObjectNameForPlugin(&pr.Plugin)
+	if instance := strings.TrimPrefix(pr.PodInstance, pr.Plugin.Name+"-"); instance != "" {
+		name = name + "-" + instance
+	}
+	return datatype.PluginCredential{
+		Username: strings.ToLower(fmt.Sprint("plugin.", name, "-", generatePassword()[:8])),
 		Password: generatePassword(),
 	}
-	return credential, nil
+}
+
+// CreatePluginCredentialSecret creates a Secret holding the credential for the run of the plugin and returns its name
+func (rm *ResourceManager) CreatePluginCredentialSecret(pr *datatype.PluginRuntime, credential datatype.PluginCredential) (string, error) {
+	secret := &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      credentialSecretNameForPluginRuntime(pr),
+			Namespace: rm.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": rm.runner,
+				"app.kubernetes.io/created-by": rm.runner,
+				SecretLabelPluginCredential:    pr.Plugin.Name,
+			},
+		},
+		Type: apiv1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			"username": []byte(credential.Username),
+			"password": []byte(credential.Password),
+		},
+	}
+	_, err := rm.Clientset.CoreV1().Secrets(rm.Namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	return secret.Name, err
+}
+
+// RevokePluginCredential removes the credential held by the Secret from RabbitMQ and deletes the Secret.
+// It does nothing if the Secret does not exist
+func (rm *ResourceManager) RevokePluginCredential(secretName string) error {
+	secret, err := rm.GetSecret(secretName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if rm.RMQManagement != nil {
+		username := string(secret.Data["username"])
+		if err := rm.RMQManagement.RevokePluginCredential(username); err != nil {
+			return fmt.Errorf("failed to remove user %q from RabbitMQ: %s", username, err.Error())
+		}
+	}
+	err = rm.Clientset.CoreV1().Secrets(rm.Namespace).Delete(context.TODO(), secretName, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// listPluginCredentialSecrets returns Secrets holding RabbitMQ credentials of plugins
+func (rm *ResourceManager) listPluginCredentialSecrets() ([]apiv1.Secret, error) {
+	secrets, err := rm.Clientset.CoreV1().Secrets(rm.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: SecretLabelPluginCredential,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return secrets.Items, nil
+}
+
+// pluginCredentialEnvs returns environment variables of the RabbitMQ credential for the plugin.
+// The shared plugin credential is used if the plugin does not have its own
+func pluginCredentialEnvs(pr *datatype.PluginRuntime) []apiv1.EnvVar {
+	if pr.CredentialSecret == "" {
+		return []apiv1.EnvVar{
+			{
+				Name:  "WAGGLE_PLUGIN_USERNAME",
+				Value: "plugin",
+			},
+			{
+				Name:  "WAGGLE_PLUGIN_PASSWORD",
+				Value: "plugin",
+			},
+		}
+	}
+	envFromSecret := func(name string, key string) apiv1.EnvVar {
+		return apiv1.EnvVar{
+			Name: name,
+			ValueFrom: &apiv1.EnvVarSource{
+				SecretKeyRef: &apiv1.SecretKeySelector{
+					LocalObjectReference: apiv1.LocalObjectReference{Name: pr.CredentialSecret},
+					Key:                  key,
+				},
+			},
+		}
+	}
+	return []apiv1.EnvVar{
+		envFromSecret("WAGGLE_PLUGIN_USERNAME", "username"),
+		envFromSecret("WAGGLE_PLUGIN_PASSWORD", "password"),
+	}
 }
 
 // CreateNamespace creates a Kubernetes namespace
@@ -586,31 +711,8 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 		return v1.PodTemplateSpec{}, err
 	}
 
+	envs = append(envs, rm.NodeServices.envs()...)
 	envs = append(envs, []apiv1.EnvVar{
-		{
-			Name:  "PULSE_SERVER",
-			Value: "tcp:wes-audio-server.default.svc.cluster.local:4713",
-		},
-		{
-			Name:  "WAGGLE_PLUGIN_HOST",
-			Value: "wes-rabbitmq.default.svc.cluster.local",
-		},
-		{
-			Name:  "WAGGLE_PLUGIN_PORT",
-			Value: "5672",
-		},
-		{
-			Name:  "WAGGLE_PLUGIN_USERNAME",
-			Value: "plugin",
-		},
-		{
-			Name:  "WAGGLE_PLUGIN_PASSWORD",
-			Value: "plugin",
-		},
-		{
-			Name:  "WAGGLE_GPS_SERVER",
-			Value: "wes-gps-server.default.svc.cluster.local",
-		},
 		// NOTE WAGGLE_APP_ID is used to bind plugin <-> Pod identities.
 		{
 			Name: "WAGGLE_APP_ID",
@@ -629,16 +731,6 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 				},
 			},
 		},
-		// Use default WES roscore hostname for ROS clients.
-		{
-			Name:  "ROS_MASTER_URI",
-			Value: "http://wes-roscore.default.svc.cluster.local:11311",
-		},
-		// Use WES scoreboard
-		{
-			Name:  "WAGGLE_SCOREBOARD",
-			Value: "wes-scoreboard.default.svc.cluster.local",
-		},
 		{
 			Name: "HOST",
 			ValueFrom: &apiv1.EnvVarSource{
@@ -668,12 +760,17 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 		// 	},
 		// },
 	}...)
+	envs = append(envs, pluginCredentialEnvs(pr)...)
 
 	tag, err := pr.Plugin.PluginSpec.GetImageTag()
 	if err != nil {
 		return v1.PodTemplateSpec{}, err
 	}
 
+	dataConfigMapName := "waggle-data-config"
+	if pr.DataConfigMap != "" {
+		dataConfigMapName = pr.DataConfigMap
+	}
 	volumes := []apiv1.Volume{
 		{
 			Name: "uploads",
@@ -689,17 +786,7 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 			VolumeSource: apiv1.VolumeSource{
 				ConfigMap: &apiv1.ConfigMapVolumeSource{
 					LocalObjectReference: apiv1.LocalObjectReference{
-						Name: "waggle-data-config",
-					},
-				},
-			},
-		},
-		{
-			Name: "wes-audio-server-plugin-conf",
-			VolumeSource: apiv1.VolumeSource{
-				ConfigMap: &apiv1.ConfigMapVolumeSource{
-					LocalObjectReference: apiv1.LocalObjectReference{
-						Name: "wes-audio-server-plugin-conf",
+						Name: dataConfigMapName,
 					},
 				},
 			},
@@ -725,17 +812,16 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 			MountPath: "/run/waggle/data-config.json",
 			SubPath:   "data-config.json",
 		},
-		{
-			Name:      "wes-audio-server-plugin-conf",
-			MountPath: "/etc/asound.conf",
-			SubPath:   "asound.conf",
-		},
 		// {
 		// 	Name:      "my-secret",
 		// 	MountPath: "/my/secret",
 		// },
 	}
 
+	nodeServiceVolumes, nodeServiceVolumeMounts := rm.NodeServices.volumes()
+	volumes = append(volumes, nodeServiceVolumes...)
+	volumeMounts = append(volumeMounts, nodeServiceVolumeMounts...)
+
 	if pr.EnablePluginController {
 		volumes = append(volumes, apiv1.Volume{
 			Name: "local-share",
@@ -803,6 +889,10 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 	//  if the user does not specify the node because the Kubernetes default scheduler
 	//  may not place the Pod on the same node.
 	nodeSelector := nodeSelectorForConfig(pr.Plugin.PluginSpec)
+	// the plugin is placed on the compute chosen by the scheduler
+	if pr.ComputeHostname != "" {
+		nodeSelector["k3s.io/hostname"] = pr.ComputeHostname
+	}
 	if volumeCount > 0 && len(nodeSelector) == 0 {
 		return v1.PodTemplateSpec{}, fmt.Errorf("volume mounting requires nodeSelector. Please specify the node by --selector or --node")
 	}
@@ -835,7 +925,7 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 				"--nodename",
 				"$(HOST)",
 				"--host",
-				"wes-app-meta-cache.default.svc.cluster.local",
+				rm.NodeServices.AppMetaCache.Host,
 				"app-meta.$(WAGGLE_APP_ID)",
 				string(appMetaData),
 			},
@@ -917,26 +1007,18 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 			// may use below for debugging
 			// ImagePullPolicy: "Always",
 			Args: pluginControllerArgs,
-			Env: []apiv1.EnvVar{
+			Env: append([]apiv1.EnvVar{
 				{
 					Name:  "GPU_METRIC_HOST",
-					Value: "wes-jetson-exporter.default.svc.cluster.local",
+					Value: rm.NodeServices.JetsonExporter.Host,
 				},
 				{
 					Name:  "WAGGLE_PLUGIN_HOST",
-					Value: "wes-rabbitmq.default.svc.cluster.local",
+					Value: rm.NodeServices.RabbitMQ.Host,
 				},
 				{
 					Name:  "WAGGLE_PLUGIN_PORT",
-					Value: "5672",
-				},
-				{
-					Name:  "WAGGLE_PLUGIN_USERNAME",
-					Value: "plugin",
-				},
-				{
-					Name:  "WAGGLE_PLUGIN_PASSWORD",
-					Value: "plugin",
+					Value: strconv.Itoa(rm.NodeServices.RabbitMQ.Port),
 				},
 				{
 					Name: "WAGGLE_APP_ID",
@@ -946,7 +1028,7 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(pr *datatype.PluginRun
 						},
 					},
 				},
-			},
+			}, pluginCredentialEnvs(pr)...),
 			Ports: []apiv1.ContainerPort{
 				{
 					Name:          "http",
@@ -1023,11 +1105,17 @@ func (rm *ResourceManager) CreatePodTemplate(pr *datatype.PluginRuntime) (*apiv1
 	// https://github.com/kubernetes/kubernetes/issues/24913#issuecomment-694817890
 	template.Labels["sagecontinuum.org/plugin-instance"] = pr.PodInstance
 	template.Spec.RestartPolicy = apiv1.RestartPolicyNever
+	// the credential of the plugin is revoked when the Pod is deleted
+	annotations := map[string]string{}
+	if pr.CredentialSecret != "" {
+		annotations[PodAnnotationCredentialSecret] = pr.CredentialSecret
+	}
 	return &apiv1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: rm.Namespace,
-			Labels:    template.Labels,
+			Name:        name,
+			Namespace:   rm.Namespace,
+			Labels:      template.Labels,
+			Annotations: annotations,
 		},
 		Spec: template.Spec,
 	}, nil
@@ -1084,6 +1172,28 @@ func (rm *ResourceManager) CreateDeploymentTemplate(pr *datatype.PluginRuntime)
 	}, nil
 }
 
+// CreateServiceDeploymentTemplate creates and returns a Kubernetes deployment object
+// for the plugin in service mode. Unlike Pods of oneshot plugins, Kubernetes restarts
+// the plugin whenever it exits until the deployment is deleted.
+func (rm *ResourceManager) CreateServiceDeploymentTemplate(pr *datatype.PluginRuntime) (*appsv1.Deployment, error) {
+	deployment, err := rm.CreateDeploymentTemplate(pr)
+	if err != nil {
+		return nil, err
+	}
+	// we override the name to distinguish the same plugin name from different jobs
+	deployment.SetName(kubernetesObjectNameForPlugin(&pr.Plugin))
+	// NOTE: the labels are shared by the selector and the Pod template
+	deployment.Spec.Template.Labels["sagecontinuum.org/plugin-instance"] = pr.PodInstance
+	deployment.Spec.Template.Spec.RestartPolicy = apiv1.RestartPolicyAlways
+	deployment.Spec.Replicas = int32Ptr(1)
+	// the old Pod must be gone before a new one runs as plugins may hold
+	// exclusive access to devices such as cameras and microphones
+	deployment.Spec.Strategy = appsv1.DeploymentStrategy{
+		Type: appsv1.RecreateDeploymentStrategyType,
+	}
+	return deployment, nil
+}
+
 func (rm *ResourceManager) CreateDaemonSetTemplate(pr *datatype.PluginRuntime) (*appsv1.DaemonSet, error) {
 	name, err := pluginNameForSpecDeployment(&pr.Plugin)
 	if err != nil {
@@ -1108,29 +1218,39 @@ func (rm *ResourceManager) CreateDaemonSetTemplate(pr *datatype.PluginRuntime) (
 	}, nil
 }
 
-// CreateDataConfigMap creates a K3S configmap object
+// CreateDataConfigMap creates a K3S configmap object holding given data shims.
+// An existing configmap with the same name is overwritten
 func (rm *ResourceManager) CreateDataConfigMap(configName string, datashims []*datatype.DataShim) error {
-	// Check if the configmap already exists
-	configMaps, err := rm.Clientset.CoreV1().ConfigMaps(rm.Namespace).List(context.TODO(), metav1.ListOptions{})
+	data, err := json.Marshal(datashims)
 	if err != nil {
 		return err
 	}
-	for _, c := range configMaps.Items {
-		if c.Name == configName {
-			// TODO: May want to renew the existing one
-			logger.Info.Printf("ConfigMap %s already exists", configName)
-			return nil
-		}
-	}
-	data, err := json.Marshal(datashims)
+	return rm.CreateConfigMap(configName, map[string]string{"data-config.json": string(data)}, rm.Namespace, true)
+}
+
+// GetDataShims returns data shims in the data config of the node
+func (rm *ResourceManager) GetDataShims() (datashims []*datatype.DataShim, err error) {
+	configMap, err := rm.Clientset.CoreV1().ConfigMaps(rm.Namespace).Get(context.TODO(), "waggle-data-config", metav1.GetOptions{})
 	if err != nil {
-		return err
+		return
+	}
+	blob, found := configMap.Data["data-config.json"]
+	if !found {
+		return nil, fmt.Errorf("data-config.json not found in configmap %s", configMap.Name)
+	}
+	err = json.Unmarshal([]byte(blob), &datashims)
+	return
+}
+
+// DeleteConfigMap deletes the configmap. It does not return an error if the configmap does not exist
+func (rm *ResourceManager) DeleteConfigMap(name string, namespace string) error {
+	if namespace == "" {
+		namespace = rm.Namespace
+	}
+	err := rm.Clientset.CoreV1().ConfigMaps(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
 	}
-	var config apiv1.ConfigMap
-	config.Name = configName
-	config.Data = make(map[string]string)
-	config.Data["data-config.json"] = string(data)
-	_, err = rm.Clientset.CoreV1().ConfigMaps(rm.Namespace).Create(context.TODO(), &config, metav1.CreateOptions{})
 	return err
 }
 
@@ -1238,6 +1358,99 @@ func (rm *ResourceManager) UpdateDaemonSet(daemonSet *appsv1.DaemonSet, forceToU
 	return err
 }
 
+// PullImage pulls the image of the plugin onto the Kubernetes node where the plugin would run.
+// If hostname is given, the image is pulled onto the Kubernetes node of the hostname.
+// It creates a short-lived Pod using the image and waits until the image is present on the node
+// or pulling the image fails. The Pod is removed when returned.
+func (rm *ResourceManager) PullImage(ctx context.Context, plugin *datatype.Plugin, hostname string) error {
+	name := kubernetesObjectNameForPlugin(plugin) + "-pull"
+	nodeSelector := nodeSelectorForConfig(plugin.PluginSpec)
+	if hostname != "" {
+		name = name + "-" + hostname
+		nodeSelector["k3s.io/hostname"] = hostname
+	}
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: rm.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": rm.runner,
+				"app.kubernetes.io/created-by": rm.runner,
+				PodLabelImagePull:              plugin.Name,
+			},
+		},
+		Spec: apiv1.PodSpec{
+			RestartPolicy: apiv1.RestartPolicyNever,
+			NodeSelector:  nodeSelector,
+			Containers: []apiv1.Container{
+				{
+					Name:            ImagePullContainerName,
+					Image:           plugin.PluginSpec.Image,
+					ImagePullPolicy: apiv1.PullIfNotPresent,
+					// NOTE: the command does not need to exist in the image, e.g. distroless
+					//       or scratch images. The pull is judged by the kubelet pulling the
+					//       image, not by the container running the command
+					Command: []string{"true"},
+				},
+			},
+		},
+	}
+	// the Pod may remain from the last attempt
+	if err := rm.UpdatePod(pod, true); err != nil {
+		return err
+	}
+	defer rm.TerminatePod(pod.Name)
+	ticker := time.NewTicker(imagePullCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("pulling %s did not finish: %s", plugin.PluginSpec.Image, ctx.Err().Error())
+		case <-ticker.C:
+			p, err := rm.GetPod(pod.Name)
+			if err != nil {
+				return err
+			}
+			if pulled, err := isImagePulled(p); err != nil {
+				return err
+			} else if pulled {
+				return nil
+			}
+		}
+	}
+}
+
+// isImagePulled checks the container status of the image pull Pod. The image is pulled once
+// the kubelet moves the container past pulling, whether or not the container can run, e.g.
+// CreateContainerError or StartError when the image does not have the command.
+// It returns an error if Kubernetes failed to pull the image.
+func isImagePulled(p *apiv1.Pod) (bool, error) {
+	for _, c := range p.Status.ContainerStatuses {
+		if c.Name != ImagePullContainerName {
+			continue
+		}
+		if c.ImageID != "" {
+			return true, nil
+		}
+		switch {
+		case c.State.Waiting != nil:
+			switch w := c.State.Waiting; w.Reason {
+			case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull":
+				return false, fmt.Errorf("failed to pull %s: %s %s", c.Image, w.Reason, w.Message)
+			case "", "ContainerCreating", "PodInitializing":
+				// the kubelet may still be pulling the image
+				return false, nil
+			default:
+				// the container is waiting on something other than the image
+				return true, nil
+			}
+		case c.State.Running != nil, c.State.Terminated != nil:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (rm *ResourceManager) RunPlugin(job *batchv1.Job) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
@@ -1408,6 +1621,27 @@ func (rm *ResourceManager) GetContainerLastLog(podName string, containerName str
 	return string(buffer[:totalLength]), nil
 }
 
+// GetKubernetesNodeNameForCompute returns name of the Kubernetes node running on given compute.
+// Kubernetes nodes of Waggle nodes have the serial number of the compute in their name,
+// e.g. 000048b02d15bc7c.ws-nxcore.
+func (rm *ResourceManager) GetKubernetesNodeNameForCompute(compute *datatype.ComputeManifest) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	nodes, err := rm.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, n := range nodes.Items {
+		if n.Name == compute.Name {
+			return n.Name, nil
+		}
+		if compute.SerialNumber != "" && strings.Contains(strings.ToLower(n.Name), strings.ToLower(compute.SerialNumber)) {
+			return n.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no Kubernetes node found for compute %q (%s)", compute.Name, compute.SerialNumber)
+}
+
 func (rm *ResourceManager) GetServiceClusterIP(serviceName string, namespace string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Second)
 	defer cancel()
@@ -1420,6 +1654,17 @@ func (rm *ResourceManager) GetServiceClusterIP(serviceName string, namespace str
 
 // CleanUp removes all currently running plugins
 func (rm *ResourceManager) CleanUp() error {
+	// Deployments of service plugins would bring their Pods back if not removed first
+	deployments, err := rm.ListDeployments()
+	if err != nil {
+		return err
+	}
+	for _, d := range deployments.Items {
+		if d.Labels["app.kubernetes.io/managed-by"] != rm.runner {
+			continue
+		}
+		rm.TerminateDeployment(d.Name)
+	}
 	pods, err := rm.ListPods()
 	if err != nil {
 		return err
@@ -1433,7 +1678,17 @@ func (rm *ResourceManager) CleanUp() error {
 		rm.TerminatePod(pod.Name)
 		logger.Info.Printf("pod %q terminated successfully", pod.Name)
 	}
-	return nil
+	// credentials of the plugins terminated above are no longer used
+	secrets, err := rm.listPluginCredentialSecrets()
+	if err != nil {
+		return err
+	}
+	for _, secret := range secrets {
+		if err := rm.RevokePluginCredential(secret.Name); err != nil {
+			logger.Error.Printf("Failed to revoke plugin credential %q: %s", secret.Name, err.Error())
+		}
+	}
+	return rm.cleanUpNetworkPolicies()
 }
 
 // LaunchAndWatchPlugin manages the lifecycle of a Plugin run. It sends out
@@ -1744,13 +1999,29 @@ func (rm *ResourceManager) ConfigureKubernetesInformer() error {
 			rm.Notifier.Notify(e.Build())
 		},
 	})
-	stop := make(chan struct{})
-	// We don't want to stop the informer.
-	// defer close(stop)
-	rm.kubeInformerFactory.Start(stop)
+	// The informers run until Stop is called
+	rm.informerStop = make(chan struct{})
+	rm.kubeInformerFactory.Start(rm.informerStop)
 	return nil
 }
 
+// Ping returns an error if the Kubernetes API server is not reachable
+func (rm *ResourceManager) Ping() error {
+	if rm.Clientset == nil {
+		return fmt.Errorf("Kubernetes clientset is null")
+	}
+	_, err := rm.Clientset.Discovery().ServerVersion()
+	return err
+}
+
+// Stop stops the Kubernetes Informers. No events are notified after this call
+func (rm *ResourceManager) Stop() {
+	if rm.informerStop != nil {
+		close(rm.informerStop)
+		rm.informerStop = nil
+	}
+}
+
 func (rm *ResourceManager) Configure() (err error) {
 	err = rm.CreateNamespace("ses")
 	if err != nil {
@@ -1760,18 +2031,19 @@ func (rm *ResourceManager) Configure() (err error) {
 	logger.Info.Println("Attempting to clean up all plugins before starting scheduling...")
 	rm.CleanUp()
 
-	servicesToBringUp := []string{"wes-rabbitmq", "wes-audio-server", "wes-scoreboard", "wes-app-meta-cache"}
-	for _, service := range servicesToBringUp {
-		err = rm.ForwardService(service, "default", "ses")
-		if err != nil {
-			return
+	// WES services and configmaps do not exist in the simulated cluster
+	if !rm.Simulate {
+		for _, service := range rm.NodeServices.ForwardedServices {
+			err = rm.ForwardService(service, rm.NodeServices.Namespace, "ses")
+			if err != nil {
+				return
+			}
 		}
-	}
-	configMapsToBring := []string{"waggle-data-config", "wes-audio-server-plugin-conf"}
-	for _, configMapName := range configMapsToBring {
-		err = rm.CopyConfigMap(configMapName, "default", rm.Namespace)
-		if err != nil {
-			logger.Error.Printf("Failed to create ConfigMap %q: %q", configMapName, err.Error())
+		for _, configMapName := range rm.NodeServices.ForwardedConfigMaps {
+			err = rm.CopyConfigMap(configMapName, rm.NodeServices.Namespace, rm.Namespace)
+			if err != nil {
+				logger.Error.Printf("Failed to create ConfigMap %q: %q", configMapName, err.Error())
+			}
 		}
 	}
 	err = rm.CreateConfigMap(configMapNameForGoals, map[string]string{}, "default", false)
@@ -1779,10 +2051,18 @@ func (rm *ResourceManager) Configure() (err error) {
 		return
 	}
 	err = rm.ConfigureKubernetesInformer()
+	if err != nil {
+		return
+	}
+	if rm.simulator != nil {
+		logger.Info.Printf("Simulating Pods: %+v", rm.simulator.Config)
+		rm.simulator.Run(rm.informerStop)
+	}
 	return
 }
 
-func (rm *ResourceManager) Run() {
+// Run runs the gabage collector until the context is done
+func (rm *ResourceManager) Run(ctx context.Context) {
 	if rm.MetricsClient == nil {
 		logger.Info.Println("No metrics client is set. Metrics information cannot be obtained")
 	}
@@ -1800,10 +2080,16 @@ func (rm *ResourceManager) Run() {
 	// logger.Info.Println("Starting the main loop of resource manager...")
 
 	gabageCollectorTicker := time.NewTicker(1 * time.Minute)
-	for range gabageCollectorTicker.C {
-		err := rm.RunGabageCollector()
-		if err != nil {
-			logger.Error.Printf("Failed to run gabage collector: %s", err.Error())
+	defer gabageCollectorTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-gabageCollectorTicker.C:
+			err := rm.RunGabageCollector()
+			if err != nil {
+				logger.Error.Printf("Failed to run gabage collector: %s", err.Error())
+			}
 		}
 	}
 
@@ -2086,6 +2372,30 @@ func pluginNameForSpecDeployment(plugin *datatype.Plugin) (string, error) {
 	return generateJobNameForSpec(plugin.PluginSpec)
 }
 
+// credentialSecretNameForPluginRuntime returns the name of the Secret holding the RabbitMQ credential
+// for the run of the plugin. The pod instance makes the name unique for every run
+func credentialSecretNameForPluginRuntime(pr *datatype.PluginRuntime) string {
+	instance := strings.TrimPrefix(pr.PodInstance, pr.Plugin.Name+"-")
+	if instance == "" {
+		instance = generatePassword()[:8]
+	}
+	return fmt.Sprintf("%s-%s-credential", kubernetesObjectNameForPlugin(&pr.Plugin), strings.ToLower(instance))
+}
+
+// dataConfigMapNameForPlugin returns the name of the configmap holding data shims for the plugin
+func dataConfigMapNameForPlugin(plugin *datatype.Plugin) string {
+	return kubernetesObjectNameForPlugin(plugin) + "-data-config"
+}
+
+// kubernetesObjectNameForPlugin returns the name of the Kubernetes object created for the plugin.
+// The job ID is appended to distinguish the same plugin name from different jobs.
+func kubernetesObjectNameForPlugin(plugin *datatype.Plugin) string {
+	if plugin.JobID != "" {
+		return fmt.Sprintf("%s-%s", plugin.Name, plugin.JobID)
+	}
+	return plugin.Name
+}
+
 // generateJobNameForSpec generates a consistent name for a Spec.
 //
 // Very important note from: https://pkg.go.dev/encoding/json#Marshal
@@ -2142,23 +2452,86 @@ func NewRMQManagement(rmqManagementURI string, rmqManagementUsername string, rmq
 	}, nil
 }
 
-// RegisterPluginCredential registers given plugin credential to designated RMQ server
+// pluginTopicWritePermission returns the routing keys the plugin user can publish with
+// to the "to-validator" exchange. The routing key is the scope followed by the username,
+// e.g. node.plugin.myplugin-12-abcd-x1y2z3w4, so that a plugin cannot publish as other
+// plugins or the scheduler
+func pluginTopicWritePermission(username string) string {
+	return `^(node|beehive|all)\.` + regexp.QuoteMeta(username) + `$`
+}
+
+// RegisterPluginCredential registers given plugin credential to designated RMQ server.
+// The plugin can only publish messages to the "to-validator" exchange with its own routing keys,
+// and subscribe messages from the "data.topic" exchange through its own queues
 func (rmq *RMQManagement) RegisterPluginCredential(credential datatype.PluginCredential) error {
 	// The functions below come from Sean's RunPlugin
 	if _, err := rmq.Client.PutUser(credential.Username, rabbithole.UserSettings{
 		Password: credential.Password,
+		Tags:     pluginCredentialUserTag,
 	}); err != nil {
 		return err
 	}
 
 	if _, err := rmq.Client.UpdatePermissionsIn("/", credential.Username, rabbithole.Permissions{
-		Configure: "^amq.gen",
-		Read:      ".*",
-		Write:     ".*",
+		Configure: `^amq\.gen`,
+		Read:      `^(data\.topic|amq\.gen.*)$`,
+		Write:     `^(to-validator|amq\.gen.*)$`,
 	}); err != nil {
 		return err
 	}
-	logger.Debug.Printf("Plugin credential %s:%s is registered in RabbitMQ at %s", credential.Username, credential.Password, rmq.RabbitmqManagementURI)
+	if err := rmq.updateTopicPermissionsIn("/", credential.Username, "to-validator", pluginTopicWritePermission(credential.Username), ".*"); err != nil {
+		return err
+	}
+	logger.Debug.Printf("Plugin credential %s is registered in RabbitMQ at %s", credential.Username, rmq.RabbitmqManagementURI)
+	return nil
+}
+
+// RevokePluginCredential removes the user of the plugin credential from RMQ server.
+// It does nothing if the user does not exist
+func (rmq *RMQManagement) RevokePluginCredential(username string) error {
+	resp, err := rmq.Client.DeleteUser(username)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	} else if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to delete user %s: %s", username, resp.Status)
+	}
+	logger.Debug.Printf("Plugin credential %s is removed from RabbitMQ at %s", username, rmq.RabbitmqManagementURI)
+	return nil
+}
+
+// updateTopicPermissionsIn restricts routing keys the user can use on the topic exchange.
+// The RabbitMQ management client does not support topic permissions, so we call the API directly
+func (rmq *RMQManagement) updateTopicPermissionsIn(vhost string, username string, exchange string, write string, read string) error {
+	body, err := json.Marshal(map[string]string{
+		"exchange": exchange,
+		"write":    write,
+		"read":     read,
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/api/topic-permissions/%s/%s",
+		strings.TrimRight(rmq.RabbitmqManagementURI, "/"),
+		url.PathEscape(vhost),
+		url.PathEscape(username))
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(rmq.RabbitmqManagementUsername, rmq.RabbitmqManagementPassword)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to update topic permissions of %s: %s", username, resp.Status)
+	}
 	return nil
 }
 
@@ -2237,3 +2610,24 @@ func IsOwnedByRoot(p string) (bool, error) {
 	}
 	return false, nil
 }
+
+// GetPodResourceUsage returns CPU and memory usage of the container in the Pod
+// reported by Kubernetes metrics server. It gives up shortly as the scheduler waits for it
+// when recording plugin executions
+func (rm *ResourceManager) GetPodResourceUsage(podName string, containerName string) (cpu string, memory string, err error) {
+	if rm.MetricsClient == nil {
+		return "", "", fmt.Errorf("no metrics client is set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	podMetrics, err := rm.MetricsClient.MetricsV1beta1().PodMetricses(rm.Namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", err
+	}
+	for _, c := range podMetrics.Containers {
+		if c.Name == containerName {
+			return c.Usage.Cpu().String(), c.Usage.Memory().String(), nil
+		}
+	}
+	return "", "", fmt.Errorf("no metrics found for container %q in pod %q", containerName, podName)
+}
@@ -2,6 +2,10 @@ package nodescheduler
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -128,3 +132,298 @@ func TestFakeClient(t *testing.T) {
 		t.Error("Informer did not get the added pod")
 	}
 }
+
+func TestServiceDeploymentTemplate(t *testing.T) {
+	fake_rm := NewFakeK3SResourceManager([]runtime.Object{})
+	pr := datatype.NewPluginRuntime(
+		datatype.Plugin{
+			Name:  "test-service",
+			JobID: "1",
+			PluginSpec: &datatype.PluginSpec{
+				Image: "myimage:latest",
+				Mode:  datatype.PluginModeService,
+			},
+		},
+	)
+	pr.GeneratePodInstance()
+	deployment, err := fake_rm.CreateServiceDeploymentTemplate(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Name != "test-service-1" {
+		t.Errorf("expected deployment name %q, but got %q", "test-service-1", deployment.Name)
+	}
+	if deployment.Spec.Template.Spec.RestartPolicy != v1.RestartPolicyAlways {
+		t.Errorf("expected restart policy %q, but got %q", v1.RestartPolicyAlways, deployment.Spec.Template.Spec.RestartPolicy)
+	}
+	if v := deployment.Spec.Template.Labels[PodLabelJobID]; v != "1" {
+		t.Errorf("expected job ID label %q, but got %q", "1", v)
+	}
+	if err := fake_rm.UpdateDeployment(deployment, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake_rm.CleanUp(); err != nil {
+		t.Fatal(err)
+	}
+	deployments, err := fake_rm.ListDeployments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments.Items) != 0 {
+		t.Errorf("expected the deployment removed by CleanUp, but %d remain", len(deployments.Items))
+	}
+}
+
+func TestIsImagePulled(t *testing.T) {
+	tests := map[string]struct {
+		Status    v1.ContainerStatus
+		Pulled    bool
+		ExpectErr bool
+	}{
+		"pulling": {
+			Status: v1.ContainerStatus{
+				Name:  ImagePullContainerName,
+				State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+			},
+			Pulled: false,
+		},
+		"pulled": {
+			Status: v1.ContainerStatus{
+				Name:    ImagePullContainerName,
+				ImageID: "docker.io/library/myimage@sha256:1234",
+				State:   v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 127}},
+			},
+			Pulled: true,
+		},
+		"failed": {
+			Status: v1.ContainerStatus{
+				Name:  ImagePullContainerName,
+				State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+			},
+			Pulled:    false,
+			ExpectErr: true,
+		},
+		// distroless and scratch images do not have the command of the pull container
+		"no command": {
+			Status: v1.ContainerStatus{
+				Name:  ImagePullContainerName,
+				State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CreateContainerError", Message: `exec: "true": executable file not found in $PATH`}},
+			},
+			Pulled: true,
+		},
+		"start error": {
+			Status: v1.ContainerStatus{
+				Name:  ImagePullContainerName,
+				State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "StartError", ExitCode: 128}},
+			},
+			Pulled: true,
+		},
+	}
+	for name, test := range tests {
+		pod := &v1.Pod{
+			Status: v1.PodStatus{
+				ContainerStatuses: []v1.ContainerStatus{test.Status},
+			},
+		}
+		pulled, err := isImagePulled(pod)
+		if (err != nil) != test.ExpectErr {
+			t.Errorf("%s: expected error %t, but got %v", name, test.ExpectErr, err)
+		}
+		if pulled != test.Pulled {
+			t.Errorf("%s: expected pulled %t, but got %t", name, test.Pulled, pulled)
+		}
+	}
+}
+
+func TestPluginCredentialSecret(t *testing.T) {
+	fake_rm := NewFakeK3SResourceManager([]runtime.Object{})
+	pr := datatype.NewPluginRuntime(
+		datatype.Plugin{
+			Name:  "test-plugin",
+			JobID: "1",
+			PluginSpec: &datatype.PluginSpec{
+				Image: "myimage:0.1.0",
+			},
+		},
+	)
+	pr.GeneratePodInstance()
+	credential := fake_rm.CreatePluginCredential(pr)
+	var err error
+	pr.CredentialSecret, err = fake_rm.CreatePluginCredentialSecret(pr, credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod, err := fake_rm.CreatePodTemplate(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Annotations[PodAnnotationCredentialSecret] != pr.CredentialSecret {
+		t.Errorf("expected the pod to refer to secret %q, but got %v", pr.CredentialSecret, pod.Annotations)
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, e := range c.Env {
+			if e.Name != "WAGGLE_PLUGIN_USERNAME" && e.Name != "WAGGLE_PLUGIN_PASSWORD" {
+				continue
+			}
+			if e.Value != "" || e.ValueFrom == nil || e.ValueFrom.SecretKeyRef == nil || e.ValueFrom.SecretKeyRef.Name != pr.CredentialSecret {
+				t.Errorf("container %q: expected %s from secret %q, but got %+v", c.Name, e.Name, pr.CredentialSecret, e)
+			}
+		}
+	}
+	if err := fake_rm.RevokePluginCredential(pr.CredentialSecret); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake_rm.GetSecret(pr.CredentialSecret); err == nil {
+		t.Errorf("secret %q should have been deleted", pr.CredentialSecret)
+	}
+	// revoking again should not fail
+	if err := fake_rm.RevokePluginCredential(pr.CredentialSecret); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPluginCredentialPerRun(t *testing.T) {
+	var deletedUsers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/users/") {
+			deletedUsers = append(deletedUsers, strings.TrimPrefix(r.URL.Path, "/api/users/"))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	rmq, err := NewRMQManagement(server.URL, "admin", "admin", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake_rm := NewFakeK3SResourceManager([]runtime.Object{})
+	fake_rm.RMQManagement = rmq
+	var runs []*datatype.PluginRuntime
+	var credentials []datatype.PluginCredential
+	for _, jobID := range []string{"1", "1", "2"} {
+		pr := datatype.NewPluginRuntime(
+			datatype.Plugin{
+				Name:  "test-plugin",
+				JobID: jobID,
+				PluginSpec: &datatype.PluginSpec{
+					Image: "myimage:0.1.0",
+				},
+			},
+		)
+		pr.GeneratePodInstance()
+		credential := fake_rm.CreatePluginCredential(pr)
+		if !strings.HasPrefix(credential.Username, "plugin.test-plugin-"+jobID+"-") {
+			t.Errorf("expected username of job %s to start with plugin.test-plugin-%s-, but got %q", jobID, jobID, credential.Username)
+		}
+		for _, c := range credentials {
+			if c.Username == credential.Username || c.Password == credential.Password {
+				t.Errorf("expected a new credential for each run, but got %q twice", credential.Username)
+			}
+		}
+		if pr.CredentialSecret, err = fake_rm.CreatePluginCredentialSecret(pr, credential); err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, pr)
+		credentials = append(credentials, credential)
+	}
+	// revoking a run does not affect other runs
+	if err := fake_rm.RevokePluginCredential(runs[0].CredentialSecret); err != nil {
+		t.Fatal(err)
+	}
+	if len(deletedUsers) != 1 || deletedUsers[0] != credentials[0].Username {
+		t.Errorf("expected user %q to be deleted, but got %v", credentials[0].Username, deletedUsers)
+	}
+	for _, pr := range runs[1:] {
+		if _, err := fake_rm.GetSecret(pr.CredentialSecret); err != nil {
+			t.Errorf("secret %q of the other run should exist: %s", pr.CredentialSecret, err.Error())
+		}
+	}
+}
+
+func TestPluginTopicWritePermission(t *testing.T) {
+	username := "plugin.test-plugin-1-abcd-x1y2z3w4"
+	write := regexp.MustCompile(pluginTopicWritePermission(username))
+	for routingKey, allowed := range map[string]bool{
+		"node." + username:    true,
+		"beehive." + username: true,
+		"all." + username:     true,
+		"node":                false,
+		"all":                 false,
+		"node.plugin.other-plugin-2-efgh-a1b2c3d4": false,
+		"node." + username + "x":                   false,
+		"node.plugin.test-plugin-1-abcd-x1y2z3w":   false,
+		"sys.scheduler." + username:                false,
+		"nodeXplugin.test-plugin-1-abcd-x1y2z3w4":  false,
+	} {
+		if write.MatchString(routingKey) != allowed {
+			t.Errorf("routing key %q: expected allowed=%t", routingKey, allowed)
+		}
+	}
+}
+
+func TestNodeServicesInPodTemplate(t *testing.T) {
+	fake_rm := NewFakeK3SResourceManager([]runtime.Object{})
+	fake_rm.NodeServices = NodeServices{
+		RabbitMQ: ServiceEndpoint{Host: "rabbitmq.example"},
+		Env:      map[string]string{"MY_SERVICE": "my-service:8000"},
+		Volumes: []NodeServiceVolume{
+			{Name: "calibration", HostPath: "/opt/calibration", MountPath: "/calibration", ReadOnly: true},
+		},
+	}.WithDefaults()
+	pr := datatype.NewPluginRuntime(datatype.Plugin{
+		Name:       "test-plugin",
+		PluginSpec: &datatype.PluginSpec{Image: "myimage:0.1.0"},
+	})
+	pluginSpec, err := fake_rm.createPodTemplateSpecForPlugin(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envs := map[string]string{}
+	for _, e := range pluginSpec.Spec.Containers[0].Env {
+		envs[e.Name] = e.Value
+	}
+	for name, value := range map[string]string{
+		"WAGGLE_PLUGIN_HOST": "rabbitmq.example",
+		"WAGGLE_PLUGIN_PORT": "5672",
+		"MY_SERVICE":         "my-service:8000",
+	} {
+		if envs[name] != value {
+			t.Errorf("expected %s=%q, but got %q", name, value, envs[name])
+		}
+	}
+	mounts := map[string]string{}
+	for _, m := range pluginSpec.Spec.Containers[0].VolumeMounts {
+		mounts[m.Name] = m.MountPath
+	}
+	for name, path := range map[string]string{
+		"wes-audio-server-plugin-conf": "/etc/asound.conf",
+		"calibration":                  "/calibration",
+	} {
+		if mounts[name] != path {
+			t.Errorf("expected volume %q mounted at %q, but got %q", name, path, mounts[name])
+		}
+	}
+}
+
+func TestNodeServicesInNamespace(t *testing.T) {
+	s := NodeServices{
+		Namespace:  "wes",
+		Scoreboard: ServiceEndpoint{Host: "scoreboard.example"},
+		Env:        map[string]string{"B": "2", "A": "1", "C": "3"},
+	}.WithDefaults()
+	if s.RabbitMQ.Host != "wes-rabbitmq.wes.svc.cluster.local" {
+		t.Errorf("expected RabbitMQ in namespace wes, but got %q", s.RabbitMQ.Host)
+	}
+	if s.Scoreboard.Host != "scoreboard.example" {
+		t.Errorf("expected scoreboard.example, but got %q", s.Scoreboard.Host)
+	}
+	var names []string
+	for _, e := range s.envs() {
+		switch e.Name {
+		case "A", "B", "C":
+			names = append(names, e.Name)
+		}
+	}
+	if strings.Join(names, ",") != "A,B,C" {
+		t.Errorf("expected envs in order A,B,C, but got %v", names)
+	}
+}
@@ -0,0 +1,311 @@
+package nodescheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// SimulatorConfig configures how Pods progress on the simulated cluster
+type SimulatorConfig struct {
+	// ScheduleDelay is the time for a Pod to be assigned to a node after creation
+	ScheduleDelay time.Duration `json:"schedule_delay" yaml:"scheduleDelay"`
+	// InitDelay is the time for containers of a Pod to start after assignment
+	InitDelay time.Duration `json:"init_delay" yaml:"initDelay"`
+	// RunDuration is the time a plugin runs before it exits
+	RunDuration time.Duration `json:"run_duration" yaml:"runDuration"`
+	// FailureRate is the probability of a plugin exiting with an error, between 0 and 1
+	FailureRate float64 `json:"failure_rate" yaml:"failureRate"`
+	// GoalsPath is a JSON file of science goals given to the scheduler at start
+	GoalsPath string `json:"goals_path" yaml:"goalsPath"`
+}
+
+// DefaultSimulatorConfig returns timings resembling a plugin run on a node
+func DefaultSimulatorConfig() SimulatorConfig {
+	return SimulatorConfig{
+		ScheduleDelay: 1 * time.Second,
+		InitDelay:     3 * time.Second,
+		RunDuration:   30 * time.Second,
+	}
+}
+
+// Validate returns an error if the config cannot be simulated
+func (c SimulatorConfig) Validate() error {
+	if c.ScheduleDelay < 0 || c.InitDelay < 0 || c.RunDuration < 0 {
+		return fmt.Errorf("simulation timings must not be negative")
+	}
+	if c.FailureRate < 0 || c.FailureRate > 1 {
+		return fmt.Errorf("failure rate %.2f must be between 0 and 1", c.FailureRate)
+	}
+	return nil
+}
+
+// PodSimulator plays the role of the Kubernetes controllers and kubelet on the fake clientset.
+// It creates Pods for Deployments and advances Pods from Pending to Running and then
+// to Succeeded or Failed so that the Informers of the resource manager receive Pod events
+type PodSimulator struct {
+	Config    SimulatorConfig
+	clientset kubernetes.Interface
+	namespace string
+	nodeName  string
+	mu        sync.Mutex
+	random    *rand.Rand
+}
+
+// NewPodSimulator returns a simulator for Pods in the namespace. Pods not selecting a node
+// are assigned to given node
+func NewPodSimulator(clientset kubernetes.Interface, namespace string, nodeName string, config SimulatorConfig) *PodSimulator {
+	return &PodSimulator{
+		Config:    config,
+		clientset: clientset,
+		namespace: namespace,
+		nodeName:  nodeName,
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Run simulates Pods until stop is closed
+func (s *PodSimulator) Run(stop <-chan struct{}) {
+	factory := kubeinformers.NewSharedInformerFactoryWithOptions(
+		s.clientset,
+		0,
+		kubeinformers.WithNamespace(s.namespace))
+	factory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			go s.simulatePod(stop, obj.(*v1.Pod))
+		},
+	})
+	factory.Apps().V1().Deployments().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			s.createPodForDeployment(obj.(*appsv1.Deployment))
+		},
+		UpdateFunc: func(old, new interface{}) {
+			s.createPodForDeployment(new.(*appsv1.Deployment))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if d, ok := obj.(*appsv1.Deployment); ok {
+				s.deletePodsOfDeployment(d)
+			}
+		},
+	})
+	factory.Start(stop)
+	factory.WaitForCacheSync(stop)
+}
+
+// failed decides if the next plugin run fails
+func (s *PodSimulator) failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.random.Float64() < s.Config.FailureRate
+}
+
+// waitOrStop returns false if stop is closed before d elapses
+func waitOrStop(stop <-chan struct{}, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-stop:
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// updatePod applies f to the latest Pod. It returns false if the Pod no longer exists
+func (s *PodSimulator) updatePod(name string, f func(*v1.Pod)) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	pod, err := s.clientset.CoreV1().Pods(s.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			logger.Error.Printf("simulator failed to get pod %q: %s", name, err.Error())
+		}
+		return false
+	}
+	f(pod)
+	// the fake clientset does not distinguish the status subresource
+	if _, err := s.clientset.CoreV1().Pods(s.namespace).Update(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		if !errors.IsNotFound(err) {
+			logger.Error.Printf("simulator failed to update pod %q: %s", name, err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+// simulatePod advances the Pod through its phases until it ends or gets deleted
+func (s *PodSimulator) simulatePod(stop <-chan struct{}, pod *v1.Pod) {
+	if pod.Status.Phase != "" {
+		return
+	}
+	name := pod.Name
+	if !waitOrStop(stop, s.Config.ScheduleDelay) {
+		return
+	}
+	if !s.updatePod(name, func(p *v1.Pod) {
+		if p.Spec.NodeName == "" {
+			p.Spec.NodeName = s.nodeName
+			if hostname, found := p.Spec.NodeSelector["k3s.io/hostname"]; found {
+				p.Spec.NodeName = hostname
+			}
+		}
+		p.Status.Phase = v1.PodPending
+		p.Status.Conditions = []v1.PodCondition{
+			{Type: v1.PodScheduled, Status: v1.ConditionTrue, LastTransitionTime: metav1.Now()},
+		}
+		p.Status.InitContainerStatuses = containerStatuses(p.Spec.InitContainers, v1.ContainerState{
+			Waiting: &v1.ContainerStateWaiting{Reason: "PodInitializing"},
+		})
+		p.Status.ContainerStatuses = containerStatuses(p.Spec.Containers, v1.ContainerState{
+			Waiting: &v1.ContainerStateWaiting{Reason: "PodInitializing"},
+		})
+	}) {
+		return
+	}
+	if !waitOrStop(stop, s.Config.InitDelay) {
+		return
+	}
+	startedAt := metav1.Now()
+	if !s.updatePod(name, func(p *v1.Pod) {
+		p.Status.Phase = v1.PodRunning
+		p.Status.StartTime = &startedAt
+		p.Status.PodIP = "10.42.0.1"
+		p.Status.InitContainerStatuses = containerStatuses(p.Spec.InitContainers, v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{Reason: "Completed", StartedAt: startedAt, FinishedAt: startedAt},
+		})
+		p.Status.ContainerStatuses = containerStatuses(p.Spec.Containers, v1.ContainerState{
+			Running: &v1.ContainerStateRunning{StartedAt: startedAt},
+		})
+	}) {
+		return
+	}
+	// Pods of Deployments, e.g. service plugins, run until deleted
+	if len(pod.OwnerReferences) > 0 {
+		return
+	}
+	if !waitOrStop(stop, s.Config.RunDuration) {
+		return
+	}
+	failed := s.failed()
+	s.updatePod(name, func(p *v1.Pod) {
+		finishedAt := metav1.Now()
+		p.Status.Phase = v1.PodSucceeded
+		if failed {
+			p.Status.Phase = v1.PodFailed
+		}
+		mainContainer := p.Labels[PodLabelPluginTask]
+		if mainContainer == "" && len(p.Spec.Containers) > 0 {
+			mainContainer = p.Spec.Containers[0].Name
+		}
+		for i, c := range p.Status.ContainerStatuses {
+			terminated := &v1.ContainerStateTerminated{Reason: "Completed", StartedAt: startedAt, FinishedAt: finishedAt}
+			if failed && c.Name == mainContainer {
+				terminated.ExitCode, terminated.Reason = 1, "Error"
+			}
+			p.Status.ContainerStatuses[i].Ready = false
+			p.Status.ContainerStatuses[i].State = v1.ContainerState{Terminated: terminated}
+		}
+	})
+}
+
+func containerStatuses(containers []v1.Container, state v1.ContainerState) (statuses []v1.ContainerStatus) {
+	for _, c := range containers {
+		statuses = append(statuses, v1.ContainerStatus{
+			Name:  c.Name,
+			Image: c.Image,
+			State: state,
+			Ready: state.Running != nil,
+		})
+	}
+	return
+}
+
+// createPodForDeployment creates a Pod from the template of the Deployment if it has none
+func (s *PodSimulator) createPodForDeployment(d *appsv1.Deployment) {
+	if d.DeletionTimestamp != nil {
+		return
+	}
+	pods, err := s.clientset.CoreV1().Pods(s.namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		logger.Error.Printf("simulator failed to list pods: %s", err.Error())
+		return
+	}
+	for _, p := range pods.Items {
+		if isOwnedBy(&p, d) {
+			return
+		}
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-%s", d.Name, generatePassword()[:5]),
+			Namespace:   s.namespace,
+			Labels:      d.Spec.Template.Labels,
+			Annotations: d.Spec.Template.Annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: d.Name, UID: d.UID},
+			},
+		},
+		Spec: d.Spec.Template.Spec,
+	}
+	if _, err := s.clientset.CoreV1().Pods(s.namespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		logger.Error.Printf("simulator failed to create pod for deployment %q: %s", d.Name, err.Error())
+	}
+}
+
+// deletePodsOfDeployment deletes Pods created for the Deployment as the garbage collector would
+func (s *PodSimulator) deletePodsOfDeployment(d *appsv1.Deployment) {
+	pods, err := s.clientset.CoreV1().Pods(s.namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		logger.Error.Printf("simulator failed to list pods: %s", err.Error())
+		return
+	}
+	for _, p := range pods.Items {
+		if isOwnedBy(&p, d) {
+			s.clientset.CoreV1().Pods(s.namespace).Delete(context.TODO(), p.Name, metav1.DeleteOptions{})
+		}
+	}
+}
+
+func isOwnedBy(p *v1.Pod, d *appsv1.Deployment) bool {
+	for _, o := range p.OwnerReferences {
+		if o.Kind == "Deployment" && o.Name == d.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// simulatedNodes returns Kubernetes nodes of the computes in the manifest or a single
+// node named after the node if no compute is given
+func simulatedNodes(nodeID string, computes []string) (nodes []*v1.Node) {
+	if len(computes) == 0 {
+		computes = []string{strings.ToLower(nodeID)}
+	}
+	for _, c := range computes {
+		nodes = append(nodes, &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   c,
+				Labels: map[string]string{"k3s.io/hostname": c},
+			},
+			Status: v1.NodeStatus{
+				Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+			},
+		})
+	}
+	return
+}
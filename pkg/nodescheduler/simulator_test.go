@@ -0,0 +1,86 @@
+package nodescheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestPodSimulator(t *testing.T) {
+	tests := map[string]struct {
+		FailureRate float64
+		Want        v1.PodPhase
+	}{
+		"succeeded": {FailureRate: 0, Want: v1.PodSucceeded},
+		"failed":    {FailureRate: 1, Want: v1.PodFailed},
+	}
+	for name, test := range tests {
+		rm := &ResourceManager{
+			Namespace:    namespace,
+			NodeServices: DefaultNodeServices(),
+			Notifier:     interfacing.NewNotifier(),
+			Simulate:     true,
+			runner:       "fake",
+		}
+		events := make(chan datatype.Event, maxChannelBuffer)
+		rm.Notifier.Subscribe(events)
+		err := rm.ConfigureSimulation("W000", nil, SimulatorConfig{
+			ScheduleDelay: 10 * time.Millisecond,
+			InitDelay:     10 * time.Millisecond,
+			RunDuration:   10 * time.Millisecond,
+			FailureRate:   test.FailureRate,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rm.Configure(); err != nil {
+			t.Fatal(err)
+		}
+		pr := datatype.NewPluginRuntime(datatype.Plugin{
+			Name:       "test-plugin",
+			JobID:      "1",
+			PluginSpec: &datatype.PluginSpec{Image: "myimage:0.1.0"},
+		})
+		pod, err := rm.CreatePodTemplate(pr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rm.CreatePod(pod); err != nil {
+			t.Fatal(err)
+		}
+		var phases []v1.PodPhase
+		timeout := time.After(wait.ForeverTestTimeout)
+		for len(phases) == 0 || phases[len(phases)-1] != test.Want {
+			select {
+			case e := <-events:
+				if k, ok := e.(KubernetesEvent); ok && k.Type == KubernetesEventTypePod && k.Action == KubernetesEventTypeModified {
+					phases = append(phases, k.Pod.Status.Phase)
+					pod = k.Pod
+				}
+			case <-timeout:
+				t.Fatalf("%s: expected the pod to be %s, got %v", name, test.Want, phases)
+			}
+		}
+		if want := []v1.PodPhase{v1.PodPending, v1.PodRunning, test.Want}; len(phases) != len(want) {
+			t.Errorf("%s: expected phases %v, got %v", name, want, phases)
+		}
+		if pod.Spec.NodeName != "w000" {
+			t.Errorf("%s: expected the pod to be assigned to w000, got %q", name, pod.Spec.NodeName)
+		}
+		if test.Want == v1.PodFailed {
+			message, err := rm.AnalyzeFailureOfPod(pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := message.Build()
+			if code := e.GetEntry("return_code"); code != int32(1) {
+				t.Errorf("%s: expected return code 1, got %v", name, code)
+			}
+		}
+		rm.Stop()
+	}
+}
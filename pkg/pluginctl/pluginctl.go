@@ -32,6 +32,12 @@ type MetricsServer struct {
 	Client influxdb2.Client
 }
 
+// Config holds settings of pluginctl loaded from a config file
+type Config struct {
+	// NodeServices overrides WES services provided to plugins
+	NodeServices nodescheduler.NodeServices `yaml:"nodeServices"`
+}
+
 type PluginCtl struct {
 	kubeConfig      string
 	MetricsServer   *MetricsServer
@@ -56,14 +62,30 @@ type Deployment struct {
 	Volume                 []string
 	EnablePluginController bool
 	ForceToUpdate          bool
+	AllowEgress            []string
 }
 
-func NewPluginCtl(kubeconfig string) (*PluginCtl, error) {
+// NewPluginCtl returns a PluginCtl. The config file is optional
+func NewPluginCtl(kubeconfig string, configPath string) (*PluginCtl, error) {
+	var config Config
+	if configPath != "" {
+		blob, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config %q: %s", configPath, err.Error())
+		}
+		if err := yaml.Unmarshal(blob, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse config %q: %s", configPath, err.Error())
+		}
+	}
+	if err := config.NodeServices.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid node services: %s", err.Error())
+	}
 	resourceManager, err := nodescheduler.NewK3SResourceManager(false, kubeconfig, "pluginctl")
 	if err != nil {
 		return nil, err
 	}
 	resourceManager.Namespace = "default"
+	resourceManager.NodeServices = config.NodeServices.WithDefaults()
 	return &PluginCtl{
 		kubeConfig:      kubeconfig,
 		ResourceManager: resourceManager,
@@ -210,52 +232,85 @@ func (p *PluginCtl) Deploy(dep *Deployment) (string, error) {
 		},
 		EnablePluginController: dep.EnablePluginController,
 	}
+	if len(dep.AllowEgress) > 0 {
+		pluginRuntime.Plugin.PluginSpec.Network = &datatype.PluginNetwork{Egress: dep.AllowEgress}
+		if err := pluginRuntime.Plugin.PluginSpec.Network.Validate(); err != nil {
+			return "", err
+		}
+	}
 	switch dep.Type {
 	case "pod":
 		pod, err := p.ResourceManager.CreatePodTemplate(&pluginRuntime)
 		if err != nil {
 			return "", err
 		}
-		if p.DryRun {
-			return pod.Name, writeResourceYAML(os.Stdout, "core/v1", "Pod", pod)
-		} else {
-			return pod.Name, p.ResourceManager.UpdatePod(pod, dep.ForceToUpdate)
-		}
+		return pod.Name, p.applyWithNetworkPolicy(&pluginRuntime, "core/v1", "Pod", pod.Name, pod, func() error {
+			return p.ResourceManager.UpdatePod(pod, dep.ForceToUpdate)
+		})
 	case "job":
 		job, err := p.ResourceManager.CreateJobTemplate(&pluginRuntime)
 		if err != nil {
 			return "", err
 		}
-		if p.DryRun {
-			return job.Name, writeResourceYAML(os.Stdout, "batch/v1", "Job", job)
-		} else {
-			return job.Name, p.ResourceManager.UpdateJob(job, dep.ForceToUpdate)
-		}
+		return job.Name, p.applyWithNetworkPolicy(&pluginRuntime, "batch/v1", "Job", job.Name, job, func() error {
+			return p.ResourceManager.UpdateJob(job, dep.ForceToUpdate)
+		})
 	case "deployment":
 		deployment, err := p.ResourceManager.CreateDeploymentTemplate(&pluginRuntime)
 		if err != nil {
 			return "", err
 		}
-		if p.DryRun {
-			return deployment.Name, writeResourceYAML(os.Stdout, "apps/v1", "Deployment", deployment)
-		} else {
-			return deployment.Name, p.ResourceManager.UpdateDeployment(deployment, dep.ForceToUpdate)
-		}
+		return deployment.Name, p.applyWithNetworkPolicy(&pluginRuntime, "apps/v1", "Deployment", deployment.Name, deployment, func() error {
+			return p.ResourceManager.UpdateDeployment(deployment, dep.ForceToUpdate)
+		})
 	case "daemonset":
 		daemonSet, err := p.ResourceManager.CreateDaemonSetTemplate(&pluginRuntime)
 		if err != nil {
 			return "", err
 		}
-		if p.DryRun {
-			return daemonSet.Name, writeResourceYAML(os.Stdout, "apps/v1", "DaemonSet", daemonSet)
-		} else {
-			return daemonSet.Name, p.ResourceManager.UpdateDaemonSet(daemonSet, dep.ForceToUpdate)
-		}
+		return daemonSet.Name, p.applyWithNetworkPolicy(&pluginRuntime, "apps/v1", "DaemonSet", daemonSet.Name, daemonSet, func() error {
+			return p.ResourceManager.UpdateDaemonSet(daemonSet, dep.ForceToUpdate)
+		})
 	default:
 		return "", fmt.Errorf("unknown type %q for plugin", dep.Type)
 	}
 }
 
+// applyWithNetworkPolicy applies the Kubernetes object of the plugin with its NetworkPolicy.
+// The policy is applied first and then owned by the object to be deleted together.
+// In dry-run, the object and the policy are written to stdout instead.
+func (p *PluginCtl) applyWithNetworkPolicy(pr *datatype.PluginRuntime, apiVersion string, kind string, name string, object interface{}, apply func() error) error {
+	policy, err := p.ResourceManager.CreateNetworkPolicyTemplate(pr, name)
+	if err != nil {
+		return err
+	}
+	if p.DryRun {
+		if err := writeResourceYAML(os.Stdout, apiVersion, kind, object); err != nil {
+			return err
+		}
+		if policy == nil {
+			return nil
+		}
+		fmt.Fprintln(os.Stdout, "---")
+		return writeResourceYAML(os.Stdout, "networking.k8s.io/v1", "NetworkPolicy", policy)
+	}
+	if policy != nil {
+		if err := p.ResourceManager.UpdateNetworkPolicy(policy); err != nil {
+			return err
+		}
+	}
+	if err := apply(); err != nil {
+		if policy != nil {
+			p.ResourceManager.DeleteNetworkPolicy(policy.Name)
+		}
+		return err
+	}
+	if policy != nil {
+		return p.ResourceManager.SetNetworkPolicyOwner(policy.Name, kind, name)
+	}
+	return nil
+}
+
 func writeResourceYAML(w io.Writer, apiVersion string, kind string, resource interface{}) error {
 	cleaned, err := cleanResource(resource)
 	if err != nil {